@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/bootstrapper"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/config"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/config/v1alpha1"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/nodecerts"
+	"github.com/spf13/cobra"
+)
+
+var (
+	certsCmd = &cobra.Command{
+		Use:   "certs",
+		Short: "Inspects the kubelet certificates on the Windows node",
+	}
+
+	certsCheckCmd = &cobra.Command{
+		Use:   "check",
+		Short: "Checks the expiry of the kubelet certificates on the Windows node",
+		Long: "Checks the kubelet client and serving certificates and the kubelet CA on the Windows node, reporting " +
+			"their subject, SANs, issuer and expiry. Exits with a non-zero status if any of them is missing, invalid, " +
+			"expired or expires within --warn-before. A missing serving certificate usually means the CSR the " +
+			"kubelet made for it has not been approved.",
+		Run: runCertsCheckCmd,
+	}
+
+	certsCheckOpts struct {
+		// warnBefore is how long before their expiry certificates are reported as expiring
+		warnBefore time.Duration
+		// configFile is the WMCB configuration file, which the other flags take precedence over
+		configFile string
+		// The directory the kubelet is installed in
+		installDir string
+		// certDir is the directory the kubelet keeps its certificates in
+		certDir string
+		// output is the format the results are printed in, either text or json
+		output string
+	}
+)
+
+func init() {
+	rootCmd.AddCommand(certsCmd)
+	certsCmd.AddCommand(certsCheckCmd)
+	certsCheckCmd.PersistentFlags().DurationVar(&certsCheckOpts.warnBefore, "warn-before", nodecerts.DefaultWarnBefore,
+		"How long before their expiry certificates are reported as expiring")
+	certsCheckCmd.PersistentFlags().StringVar(&certsCheckOpts.configFile, "config", "",
+		"WMCB configuration file. Flags set on the command line take precedence over it")
+	certsCheckCmd.PersistentFlags().StringVar(&certsCheckOpts.installDir, "install-dir", v1alpha1.DefaultInstallDir,
+		"Installation directory")
+	certsCheckCmd.PersistentFlags().StringVar(&certsCheckOpts.certDir, "cert-dir", v1alpha1.DefaultCertDirectory,
+		"Directory the kubelet keeps its certificates in")
+	certsCheckCmd.PersistentFlags().StringVar(&certsCheckOpts.output, "output", "text",
+		"Format the results are printed in, either text or json")
+}
+
+// certsCheckOverrides applies the certs check flags set on the command line to the WMCB configuration
+var certsCheckOverrides = configOverrides{
+	"install-dir": func(c *config.Configuration) {
+		c.InstallDir = certsCheckOpts.installDir
+	},
+	"cert-dir": func(c *config.Configuration) {
+		c.CertDirectory = certsCheckOpts.certDir
+	},
+}
+
+// runCertsCheckCmd checks the kubelet certificates and prints the results
+func runCertsCheckCmd(cmd *cobra.Command, args []string) {
+	flag.Parse()
+	ctx, cancel := commandContext()
+	defer cancel()
+	if certsCheckOpts.output != "text" && certsCheckOpts.output != "json" {
+		log.Error(fmt.Errorf("unsupported output %q, must be text or json", certsCheckOpts.output), "invalid flags")
+		os.Exit(1)
+	}
+	cfg, err := loadConfig(cmd, certsCheckOpts.configFile, certsCheckOverrides)
+	if err != nil {
+		log.Error(err, "could not load configuration")
+		os.Exit(1)
+	}
+
+	wmcb, err := bootstrapper.New(bootstrapper.WithConfiguration(cfg))
+	if err != nil {
+		log.Error(err, "could not create bootstrapper")
+		os.Exit(1)
+	}
+
+	results, err := wmcb.CheckCertificates(ctx, certsCheckOpts.warnBefore)
+	if disconnectErr := wmcb.Disconnect(); disconnectErr != nil {
+		log.Error(disconnectErr, "can't clean up bootstrapper")
+	}
+	if err != nil {
+		log.Error(err, "could not check certificates")
+		os.Exit(1)
+	}
+	if certsCheckOpts.output == "json" {
+		err = printJSON(results)
+	} else {
+		var b strings.Builder
+		writeCertResults(&b, results)
+		_, err = os.Stdout.WriteString(b.String())
+	}
+	if err != nil {
+		log.Error(err, "could not print certificate results")
+		os.Exit(1)
+	}
+	if results.Failed() {
+		os.Exit(1)
+	}
+}
+
+// writeCertResults writes the status of every certificate file followed by the certificates found in it
+func writeCertResults(w io.Writer, results nodecerts.Results) {
+	for _, result := range results {
+		fmt.Fprintf(w, "[%s] %s: %s\n", strings.ToUpper(string(result.Status)), result.Name, result.Message)
+		fmt.Fprintf(w, "       path: %s\n", result.Path)
+		for _, cert := range result.Certificates {
+			fmt.Fprintf(w, "       subject: %s\n", cert.Subject)
+			if len(cert.SANs) > 0 {
+				fmt.Fprintf(w, "         SANs: %s\n", strings.Join(cert.SANs, ", "))
+			}
+			fmt.Fprintf(w, "         issuer: %s\n", cert.Issuer)
+			fmt.Fprintf(w, "         notAfter: %s\n", cert.NotAfter.Format(time.RFC3339))
+		}
+	}
+}
+
+// printJSON writes the given value to stdout as indented JSON
+func printJSON(v interface{}) error {
+	contents, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(append(contents, '\n'))
+	return err
+}
@@ -2,9 +2,14 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"os"
+	"time"
 
 	"github.com/openshift/windows-machine-config-bootstrapper/pkg/bootstrapper"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/cniconf"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/config"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/config/v1alpha1"
 	"github.com/spf13/cobra"
 )
 
@@ -14,16 +19,20 @@ var (
 		Use:   "configure-cni",
 		Short: "Configures CNI on the Windows node",
 		Long: "Configures CNI on the Windows node. " +
-			"This command needs to be executed every time initialize-kubelet is executed.",
+			"This command needs to be executed every time initialize-kubelet is executed. " +
+			"The CNI config is either given with --cni-config, or rendered as the win-overlay config of the OVN " +
+			"hybrid overlay from --host-subnet and --service-cidr.",
 		Run: runConfigureCNICmd,
 		PreRunE: func(cmd *cobra.Command, _ []string) error {
 			err := cmd.MarkPersistentFlagRequired("cni-dir")
 			if err != nil {
 				return err
 			}
-			err = cmd.MarkPersistentFlagRequired("cni-config")
-			if err != nil {
-				return err
+			if (configureCNIOpts.config == "") == (len(configureCNIOpts.hostSubnets) == 0) {
+				return fmt.Errorf("exactly one of --cni-config and --host-subnet is required")
+			}
+			if len(configureCNIOpts.hostSubnets) != 0 && len(configureCNIOpts.serviceCIDRs) == 0 {
+				return fmt.Errorf("--service-cidr is required with --host-subnet")
 			}
 			return nil
 		},
@@ -35,33 +44,119 @@ var (
 		dir string
 		// config is the location of the CNI configuration
 		config string
+		// hostSubnets are the subnets of the node the win-overlay config is rendered with, one per IP family
+		hostSubnets []string
+		// serviceCIDRs are the service networks of the cluster the win-overlay config is rendered with, one per IP
+		// family
+		serviceCIDRs []string
+		// networkName is the name of the HNS network of the rendered config
+		networkName string
+		// vni is the virtual network identifier of the rendered config
+		vni uint32
+		// dnsCapability enables the dns capability of the rendered config
+		dnsCapability bool
+		// manifest is the location of the manifest the CNI binaries are verified against
+		manifest string
 		// installDir is the main installation directory
 		installDir string
+		// configFile is the WMCB configuration file, which the other flags take precedence over
+		configFile string
+		// reconcile applies only the differences between the desired and the actual state of the node
+		reconcile bool
+		// healthTimeout is how long to wait for the kubelet to report healthy after it has been restarted
+		healthTimeout time.Duration
+		// progressFile is where the phases of the CNI configuration are written to while it runs
+		progressFile string
+		// output is the format the result is printed in, either text or json
+		output string
 	}
 )
 
 func init() {
 	rootCmd.AddCommand(configureCNICmd)
-	configureCNICmd.PersistentFlags().StringVar(&configureCNIOpts.installDir, "install-dir", "c:\\k",
-		"Installation directory. Defaults to C:\\k")
+	configureCNICmd.PersistentFlags().StringVar(&configureCNIOpts.configFile, "config", "",
+		"WMCB configuration file. Flags set on the command line take precedence over it")
+	configureCNICmd.PersistentFlags().StringVar(&configureCNIOpts.installDir, "install-dir",
+		v1alpha1.DefaultInstallDir, "Installation directory")
 	configureCNICmd.PersistentFlags().StringVar(&configureCNIOpts.dir, "cni-dir", "",
 		"The location of the CNI binaries")
 	configureCNICmd.PersistentFlags().StringVar(&configureCNIOpts.config, "cni-config", "",
-		"The location of the CNI configuration file")
+		"The location of the CNI configuration file. Cannot be combined with --host-subnet")
+	configureCNICmd.PersistentFlags().StringSliceVar(&configureCNIOpts.hostSubnets, "host-subnet", nil,
+		"Subnet of the node, as given by its hybrid overlay subnet annotation, to render the win-overlay CNI "+
+			"configuration with instead of reading --cni-config. Dual-stack nodes take one subnet per IP family, "+
+			"repeated or comma separated")
+	configureCNICmd.PersistentFlags().StringSliceVar(&configureCNIOpts.serviceCIDRs, "service-cidr", nil,
+		"Service network of the cluster to render the CNI configuration with, one per IP family of --host-subnet. "+
+			"Can be repeated or comma separated")
+	configureCNICmd.PersistentFlags().StringVar(&configureCNIOpts.networkName, "network-name",
+		cniconf.DefaultOverlayNetworkName, "Name of the HNS network of the rendered CNI configuration")
+	configureCNICmd.PersistentFlags().Uint32Var(&configureCNIOpts.vni, "vni", 0,
+		"Virtual network identifier of the rendered CNI configuration. The one of the HNS network is used if 0")
+	configureCNICmd.PersistentFlags().BoolVar(&configureCNIOpts.dnsCapability, "dns-capability", true,
+		"Enable the dns capability of the rendered CNI configuration")
+	configureCNICmd.PersistentFlags().StringVar(&configureCNIOpts.manifest, "cni-manifest", "",
+		"The location of a sha256sum style manifest, kept outside of --cni-dir, listing the digests of the CNI "+
+			"binaries. The binaries are verified against it before they are installed")
+	configureCNICmd.PersistentFlags().BoolVar(&configureCNIOpts.reconcile, "reconcile", false,
+		"Only copy the CNI files and update the kubelet arguments if they differ from the desired state. The kubelet "+
+			"is restarted only if something changed.")
+	configureCNICmd.PersistentFlags().DurationVar(&configureCNIOpts.healthTimeout, "kubelet-health-timeout",
+		v1alpha1.DefaultKubeletHealthTimeout, "How long to wait for the kubelet to report healthy after it has "+
+			"been restarted. Set to 0 to skip the health verification.")
+	configureCNICmd.PersistentFlags().StringVar(&configureCNIOpts.progressFile, "progress-file", "",
+		"JSON file the phases of the CNI configuration and their timing are written to while it runs, for the "+
+			"caller to poll")
+	configureCNICmd.PersistentFlags().StringVar(&configureCNIOpts.output, "output", "text",
+		"Format the result is printed in, either text or json. The json result holds the phases of the CNI "+
+			"configuration and their timing")
+}
+
+// configureCNIOverrides applies the configure-cni flags set on the command line to the WMCB configuration
+var configureCNIOverrides = configOverrides{
+	"install-dir": func(c *config.Configuration) {
+		c.InstallDir = configureCNIOpts.installDir
+	},
+	"kubelet-health-timeout": func(c *config.Configuration) {
+		c.KubeletHealthTimeout = configureCNIOpts.healthTimeout
+	},
 }
 
 // runConfigureCNICmd configures the CNI on the Windows node
 func runConfigureCNICmd(cmd *cobra.Command, args []string) {
 	flag.Parse()
+	ctx, cancel := commandContext()
+	defer cancel()
+	if configureCNIOpts.output != "text" && configureCNIOpts.output != "json" {
+		log.Error(fmt.Errorf("unsupported output %q, must be text or json", configureCNIOpts.output), "invalid flags")
+		os.Exit(1)
+	}
+	cfg, err := loadConfig(cmd, configureCNIOpts.configFile, configureCNIOverrides)
+	if err != nil {
+		log.Error(err, "could not load configuration")
+		os.Exit(1)
+	}
 
-	wmcb, err := bootstrapper.NewWinNodeBootstrapper(configureCNIOpts.installDir, "", "", configureCNIOpts.dir,
-		configureCNIOpts.config)
+	cniOpt := bootstrapper.WithCNI(configureCNIOpts.dir, configureCNIOpts.config)
+	if len(configureCNIOpts.hostSubnets) != 0 {
+		cniOpt = bootstrapper.WithCNIOverlay(configureCNIOpts.dir, cniconf.Overlay{
+			Name:         configureCNIOpts.networkName,
+			HostSubnets:  configureCNIOpts.hostSubnets,
+			ServiceCIDRs: configureCNIOpts.serviceCIDRs,
+			VNI:          configureCNIOpts.vni,
+			DNS:          configureCNIOpts.dnsCapability,
+		})
+	}
+	wmcb, err := bootstrapper.New(bootstrapper.WithConfiguration(cfg), cniOpt,
+		bootstrapper.WithCNIManifest(configureCNIOpts.manifest), bootstrapper.WithReconcile(configureCNIOpts.reconcile),
+		bootstrapper.WithProgressFile(configureCNIOpts.progressFile), bootstrapper.WithLogger(progressLog))
 	if err != nil {
 		log.Error(err, "could not create bootstrapper")
 		os.Exit(1)
 	}
 
-	err = wmcb.Configure()
+	err = wmcb.ConfigureCNI(ctx)
+	printProgress(wmcb.Progress(), configureCNIOpts.output)
 	if err != nil {
 		log.Error(err, "could not configure CNI")
 		os.Exit(1)
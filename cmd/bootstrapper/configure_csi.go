@@ -0,0 +1,110 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"time"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/bootstrapper"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/config"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/config/v1alpha1"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/csiproxy"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// configureCSICmd describes the configure-csi command
+	configureCSICmd = &cobra.Command{
+		Use:   "configure-csi",
+		Short: "Configures CSI on the Windows node",
+		Long: "Configures CSI on the Windows node. " +
+			"csi-proxy is installed and run as a Windows service, and the directories the CSI node plugins register " +
+			"with the kubelet through are created. csi-proxy and the kubelet are only restarted if something changed.",
+		Run: runConfigureCSICmd,
+		PreRunE: func(cmd *cobra.Command, _ []string) error {
+			return cmd.MarkPersistentFlagRequired("csi-proxy-path")
+		},
+	}
+
+	// configureCSIOpts holds the configure-csi CLI options
+	configureCSIOpts struct {
+		// proxyPath is the location of the csi-proxy binary
+		proxyPath string
+		// kubeletRootDir is the directory the kubelet keeps its state in
+		kubeletRootDir string
+		// apiVersions are the csi-proxy API versions the CSI node plugins use, by API group
+		apiVersions map[string]string
+		// installDir is the main installation directory
+		installDir string
+		// configFile is the WMCB configuration file, which the other flags take precedence over
+		configFile string
+		// healthTimeout is how long to wait for the kubelet to report healthy after it has been restarted
+		healthTimeout time.Duration
+	}
+)
+
+func init() {
+	rootCmd.AddCommand(configureCSICmd)
+	configureCSICmd.PersistentFlags().StringVar(&configureCSIOpts.configFile, "config", "",
+		"WMCB configuration file. Flags set on the command line take precedence over it")
+	configureCSICmd.PersistentFlags().StringVar(&configureCSIOpts.installDir, "install-dir",
+		v1alpha1.DefaultInstallDir, "Installation directory")
+	configureCSICmd.PersistentFlags().StringVar(&configureCSIOpts.proxyPath, "csi-proxy-path", "",
+		"The location of the csi-proxy binary")
+	configureCSICmd.PersistentFlags().StringVar(&configureCSIOpts.kubeletRootDir, "kubelet-root-dir",
+		csiproxy.DefaultKubeletRootDir, "Directory the kubelet keeps its state in, where the CSI plugin directories "+
+			"are created. The kubelet is restarted with it if it is not the default")
+	configureCSICmd.PersistentFlags().StringToStringVar(&configureCSIOpts.apiVersions, "csi-api-versions", nil,
+		"csi-proxy API versions the CSI node plugins use, such as disk=v1beta2,filesystem=v1beta1. csi-proxy is "+
+			"expected to serve each of them. The versions of the Azure Disk, vSphere and SMB CSI drivers are used if "+
+			"not given")
+	configureCSICmd.PersistentFlags().DurationVar(&configureCSIOpts.healthTimeout, "kubelet-health-timeout",
+		v1alpha1.DefaultKubeletHealthTimeout, "How long to wait for the kubelet to report healthy after it has "+
+			"been restarted. Set to 0 to skip the health verification.")
+}
+
+// configureCSIOverrides applies the configure-csi flags set on the command line to the WMCB configuration
+var configureCSIOverrides = configOverrides{
+	"install-dir": func(c *config.Configuration) {
+		c.InstallDir = configureCSIOpts.installDir
+	},
+	"kubelet-health-timeout": func(c *config.Configuration) {
+		c.KubeletHealthTimeout = configureCSIOpts.healthTimeout
+	},
+}
+
+// runConfigureCSICmd configures CSI on the Windows node
+func runConfigureCSICmd(cmd *cobra.Command, args []string) {
+	flag.Parse()
+	ctx, cancel := commandContext()
+	defer cancel()
+	cfg, err := loadConfig(cmd, configureCSIOpts.configFile, configureCSIOverrides)
+	if err != nil {
+		log.Error(err, "could not load configuration")
+		os.Exit(1)
+	}
+
+	var apiVersions csiproxy.APIVersions
+	if len(configureCSIOpts.apiVersions) != 0 {
+		apiVersions = csiproxy.APIVersions(configureCSIOpts.apiVersions)
+	}
+	wmcb, err := bootstrapper.New(bootstrapper.WithConfiguration(cfg),
+		bootstrapper.WithCSI(configureCSIOpts.proxyPath, configureCSIOpts.kubeletRootDir, apiVersions))
+	if err != nil {
+		log.Error(err, "could not create bootstrapper")
+		os.Exit(1)
+	}
+
+	err = wmcb.ConfigureCSI(ctx)
+	if err != nil {
+		log.Error(err, "could not configure CSI")
+		os.Exit(1)
+	}
+	// Send success message to StdOut for WSU to ascertain that CSI configuration was successful
+	os.Stdout.WriteString("CSI configuration completed successfully")
+
+	err = wmcb.Disconnect()
+	if err != nil {
+		log.Error(err, "can't clean up bootstrapper")
+	}
+}
@@ -2,9 +2,17 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"os"
+	"time"
 
 	"github.com/openshift/windows-machine-config-bootstrapper/pkg/bootstrapper"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/config"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/config/v1alpha1"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/nodeidentity"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/nodelabels"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/progress"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/runtimeconf"
 	"github.com/spf13/cobra"
 )
 
@@ -33,8 +41,76 @@ var (
 		ignitionFile string
 		// The location where the kubelet.exe has been downloaded to
 		kubeletPath string
+		// configFile is the WMCB configuration file, which the other flags take precedence over
+		configFile string
 		// The directory to install the kubelet and related files
 		installDir string
+		// reconcile applies only the differences between the desired and the actual state of the node
+		reconcile bool
+		// healthTimeout is how long to wait for the kubelet to report healthy after it has been started
+		healthTimeout time.Duration
+		// containerRuntime is the container runtime used by the kubelet
+		containerRuntime string
+		// containerdConfig is where the containerd config.toml is written when the container runtime is containerd
+		containerdConfig string
+		// dockerConfig is where the docker daemon.json is written when the container runtime is docker
+		dockerConfig string
+		// containerLogMaxSize is the size a container log is rotated at
+		containerLogMaxSize string
+		// containerLogMaxFiles is the number of log files kept per container
+		containerLogMaxFiles int32
+		// runtimeDataRoot is where the container runtime keeps its images and containers
+		runtimeDataRoot string
+		// imageConfig is a file holding the image.config.openshift.io object of the cluster
+		imageConfig string
+		// registryMirrors are mirrors given as source=endpoint
+		registryMirrors []string
+		// parsedRegistryMirrors are the parsed registryMirrors
+		parsedRegistryMirrors []runtimeconf.Mirror
+		// pauseImage overrides the pause image picked based on the host Windows build
+		pauseImage string
+		// pauseImageManifest is a file mapping Windows builds to pause images
+		pauseImageManifest string
+		// pauseImageArchive is a tarball of the pause image loaded into the container runtime
+		pauseImageArchive string
+		// reservedSizing is how the systemReserved kubelet config field is sized, either fixed or auto
+		reservedSizing string
+		// systemReserved overrides the reserved amount of the given resources
+		systemReserved map[string]string
+		// systemReservedMin is the smallest automatically sized reservation
+		systemReservedMin map[string]string
+		// systemReservedMax is the largest automatically sized reservation
+		systemReservedMax map[string]string
+		// kubeReservedPercent is the share of the reservation set aside for Kubernetes components
+		kubeReservedPercent int64
+		// evictionHard sets the hard eviction thresholds based on the node memory
+		evictionHard bool
+		// nodeIP is the IP address the node registers with, an address per IP family on dual-stack nodes
+		nodeIP string
+		// nodeIPCIDR picks the node IP from the addresses within the CIDR, a CIDR per IP family on dual-stack nodes
+		nodeIPCIDR string
+		// nodeIPInterface picks the node IP from the addresses of the network interface
+		nodeIPInterface string
+		// clusterDNS are the IP addresses of the cluster DNS service
+		clusterDNS []string
+		// hostnameOverride is the name the node registers with
+		hostnameOverride string
+		// hostnameSource is where the node name is read from
+		hostnameSource string
+		// nodeLabels are registered with the node in addition to the configured labels
+		nodeLabels map[string]string
+		// nodeTaints are registered with the node in addition to the configured taints
+		nodeTaints []string
+		// parsedNodeTaints are the parsed nodeTaints
+		parsedNodeTaints []config.Taint
+		// apiServerOverride replaces the API server address of the bootstrap kubeconfig
+		apiServerOverride string
+		// probeAPIServer makes the bootstrap fail if the API server does not report ready
+		probeAPIServer bool
+		// progressFile is where the phases of the bootstrap are written to while it runs
+		progressFile string
+		// output is the format the result is printed in, either text or json
+		output string
 	}
 )
 
@@ -44,23 +120,231 @@ func init() {
 		"Ignition file location to bootstrap the Windows node")
 	initializeKubeletCmd.PersistentFlags().StringVar(&initializeKubeletOpts.kubeletPath, "kubelet-path", "",
 		"Kubelet file location to bootstrap the Windows node")
-	initializeKubeletCmd.PersistentFlags().StringVar(&initializeKubeletOpts.installDir, "install-dir", "c:\\k",
-		"Kubelet file location to bootstrap the Windows node. Defaults to C:\\k")
+	initializeKubeletCmd.PersistentFlags().StringVar(&initializeKubeletOpts.configFile, "config", "",
+		"WMCB configuration file. Flags set on the command line take precedence over it")
+	initializeKubeletCmd.PersistentFlags().StringVar(&initializeKubeletOpts.installDir, "install-dir",
+		v1alpha1.DefaultInstallDir, "Kubelet file location to bootstrap the Windows node")
+	initializeKubeletCmd.PersistentFlags().BoolVar(&initializeKubeletOpts.reconcile, "reconcile", false,
+		"Only apply the differences between the desired and the actual state of the node, instead of recreating the "+
+			"kubelet service. The kubelet is restarted only if its binary, configuration or arguments changed.")
+	initializeKubeletCmd.PersistentFlags().DurationVar(&initializeKubeletOpts.healthTimeout, "kubelet-health-timeout",
+		v1alpha1.DefaultKubeletHealthTimeout, "How long to wait for the kubelet to report healthy after it has "+
+			"been started. Set to 0 to skip the health verification.")
+	initializeKubeletCmd.PersistentFlags().StringVar(&initializeKubeletOpts.containerRuntime, "container-runtime",
+		v1alpha1.DefaultContainerRuntime, "Container runtime used by the kubelet, either "+
+			config.ContainerRuntimeDocker+" or "+config.ContainerRuntimeContainerd)
+	initializeKubeletCmd.PersistentFlags().StringVar(&initializeKubeletOpts.containerdConfig, "containerd-config",
+		v1alpha1.DefaultContainerdConfigPath, "Location of the containerd config.toml written when the container "+
+			"runtime is "+config.ContainerRuntimeContainerd)
+	initializeKubeletCmd.PersistentFlags().StringVar(&initializeKubeletOpts.dockerConfig, "docker-config",
+		v1alpha1.DefaultDockerConfigPath, "Location of the docker daemon.json written when the container runtime is "+
+			config.ContainerRuntimeDocker)
+	initializeKubeletCmd.PersistentFlags().StringVar(&initializeKubeletOpts.containerLogMaxSize,
+		"container-log-max-size", v1alpha1.DefaultContainerLogMaxSize, "Size a container log is rotated at, for "+
+			"both the kubelet and the docker log options")
+	initializeKubeletCmd.PersistentFlags().Int32Var(&initializeKubeletOpts.containerLogMaxFiles,
+		"container-log-max-files", v1alpha1.DefaultContainerLogMaxFiles, "Number of log files kept per container")
+	initializeKubeletCmd.PersistentFlags().StringVar(&initializeKubeletOpts.runtimeDataRoot, "runtime-data-root", "",
+		"Directory the container runtime keeps its images and containers in. Defaults to the one of the runtime")
+	initializeKubeletCmd.PersistentFlags().StringVar(&initializeKubeletOpts.imageConfig, "image-config", "",
+		"YAML or JSON file holding the image.config.openshift.io object of the cluster, which the insecure, "+
+			"allowed and blocked registries are read from")
+	initializeKubeletCmd.PersistentFlags().StringArrayVar(&initializeKubeletOpts.registryMirrors, "registry-mirror",
+		nil, "Mirror to pull the images of a registry from, in the source=endpoint format, for example "+
+			"docker.io=https://mirror.local. Can be repeated, mirrors of a source being tried in order")
+	initializeKubeletCmd.PersistentFlags().StringVar(&initializeKubeletOpts.pauseImage, "pause-image", "",
+		"Pause image to use instead of the one matching the host Windows build")
+	initializeKubeletCmd.PersistentFlags().StringVar(&initializeKubeletOpts.pauseImageManifest,
+		"pause-image-manifest", "", "YAML file mapping Windows builds to pause images. Defaults to the built-in "+
+			"manifest")
+	initializeKubeletCmd.PersistentFlags().StringVar(&initializeKubeletOpts.pauseImageArchive, "pause-image-archive",
+		"", "Tarball of the pause image to load into the container runtime before the kubelet is started")
+	initializeKubeletCmd.PersistentFlags().StringVar(&initializeKubeletOpts.reservedSizing, "system-reserved-sizing",
+		v1alpha1.DefaultSizing, "How the resources reserved for the system are sized, either "+config.SizingFixed+
+			" to reserve 500m CPU and 1Gi memory, or "+config.SizingAuto+" to compute them from the node CPU and memory")
+	initializeKubeletCmd.PersistentFlags().StringToStringVar(&initializeKubeletOpts.systemReserved, "system-reserved",
+		nil, "Reserved amount of the given resources, overriding the sizing. For example cpu=1,memory=2Gi")
+	initializeKubeletCmd.PersistentFlags().StringToStringVar(&initializeKubeletOpts.systemReservedMin,
+		"system-reserved-min", nil, "Smallest reservation of the given resources. For example memory=1Gi")
+	initializeKubeletCmd.PersistentFlags().StringToStringVar(&initializeKubeletOpts.systemReservedMax,
+		"system-reserved-max", nil, "Largest reservation of the given resources. For example memory=8Gi")
+	initializeKubeletCmd.PersistentFlags().Int64Var(&initializeKubeletOpts.kubeReservedPercent,
+		"kube-reserved-percent", 0, "Percentage of the CPU and memory reservation to set as kubeReserved instead of "+
+			"systemReserved")
+	initializeKubeletCmd.PersistentFlags().BoolVar(&initializeKubeletOpts.evictionHard, "auto-eviction-hard", false,
+		"Set the hard eviction thresholds based on the node memory")
+	initializeKubeletCmd.PersistentFlags().StringVar(&initializeKubeletOpts.nodeIP, "node-ip", "",
+		"IP address the node registers with, or comma separated addresses of each IP family on dual-stack nodes. "+
+			"Takes precedence over --node-ip-cidr and --node-ip-interface")
+	initializeKubeletCmd.PersistentFlags().StringVar(&initializeKubeletOpts.nodeIPCIDR, "node-ip-cidr", "",
+		"Register the node with its first address within the given CIDR. Dual-stack nodes take comma separated "+
+			"CIDRs of each IP family and register with an address within each")
+	initializeKubeletCmd.PersistentFlags().StringVar(&initializeKubeletOpts.nodeIPInterface, "node-ip-interface", "",
+		"Register the node with the first address of the network interface with the given name")
+	initializeKubeletCmd.PersistentFlags().StringSliceVar(&initializeKubeletOpts.clusterDNS, "cluster-dns",
+		[]string{v1alpha1.DefaultClusterDNS}, "IP addresses of the cluster DNS service, at most one per IP family. "+
+			"Dual-stack clusters take an address of each IP family")
+	initializeKubeletCmd.PersistentFlags().StringVar(&initializeKubeletOpts.hostnameOverride, "hostname-override", "",
+		"Name the node registers with. Takes precedence over --hostname-source")
+	initializeKubeletCmd.PersistentFlags().StringVar(&initializeKubeletOpts.hostnameSource, "hostname-source", "",
+		"Read the name the node registers with from the instance metadata of the cloud, either "+
+			nodeidentity.HostnameSourceAWS+" or "+nodeidentity.HostnameSourceAzure+". Defaults to the OS hostname")
+	initializeKubeletCmd.PersistentFlags().StringToStringVar(&initializeKubeletOpts.nodeLabels, "node-label", nil,
+		"Labels to register the node with in addition to the configured ones, taking precedence over them. "+
+			"For example pool=gpu")
+	initializeKubeletCmd.PersistentFlags().StringArrayVar(&initializeKubeletOpts.nodeTaints, "node-taint", nil,
+		"Taint to register the node with in addition to the configured ones, in the key=value:effect format. "+
+			"Can be repeated")
+	initializeKubeletCmd.PersistentFlags().StringVar(&initializeKubeletOpts.apiServerOverride,
+		"api-server-override", "", "API server address to write to the bootstrap kubeconfig instead of the one in the "+
+			"ignition file, for example https://10.0.0.10:6443")
+	initializeKubeletCmd.PersistentFlags().BoolVar(&initializeKubeletOpts.probeAPIServer, "probe-api-server", false,
+		"Fail if the API server does not report ready on /readyz when reached with the bootstrap kubeconfig")
+	initializeKubeletCmd.PersistentFlags().StringVar(&initializeKubeletOpts.progressFile, "progress-file", "",
+		"JSON file the phases of the bootstrap and their timing are written to while it runs, for the caller to poll")
+	initializeKubeletCmd.PersistentFlags().StringVar(&initializeKubeletOpts.output, "output", "text",
+		"Format the result is printed in, either text or json. The json result holds the phases of the bootstrap "+
+			"and their timing")
+}
+
+// initializeKubeletOverrides applies the initialize-kubelet flags set on the command line to the WMCB configuration
+var initializeKubeletOverrides = configOverrides{
+	"install-dir": func(c *config.Configuration) {
+		c.InstallDir = initializeKubeletOpts.installDir
+	},
+	"kubelet-health-timeout": func(c *config.Configuration) {
+		c.KubeletHealthTimeout = initializeKubeletOpts.healthTimeout
+	},
+	"container-runtime": func(c *config.Configuration) {
+		c.ContainerRuntime = initializeKubeletOpts.containerRuntime
+	},
+	"containerd-config": func(c *config.Configuration) {
+		c.ContainerdConfigPath = initializeKubeletOpts.containerdConfig
+	},
+	"docker-config": func(c *config.Configuration) {
+		c.DockerConfigPath = initializeKubeletOpts.dockerConfig
+	},
+	"container-log-max-size": func(c *config.Configuration) {
+		c.Runtime.LogMaxSize = initializeKubeletOpts.containerLogMaxSize
+	},
+	"container-log-max-files": func(c *config.Configuration) {
+		c.Runtime.LogMaxFiles = initializeKubeletOpts.containerLogMaxFiles
+	},
+	"runtime-data-root": func(c *config.Configuration) {
+		c.Runtime.DataRoot = initializeKubeletOpts.runtimeDataRoot
+	},
+	"image-config": func(c *config.Configuration) {
+		c.Runtime.ImageConfigPath = initializeKubeletOpts.imageConfig
+	},
+	"registry-mirror": func(c *config.Configuration) {
+		c.Runtime.Mirrors = initializeKubeletOpts.parsedRegistryMirrors
+	},
+	"pause-image": func(c *config.Configuration) {
+		c.PauseImage = initializeKubeletOpts.pauseImage
+	},
+	"pause-image-manifest": func(c *config.Configuration) {
+		c.PauseImageManifest = initializeKubeletOpts.pauseImageManifest
+	},
+	"pause-image-archive": func(c *config.Configuration) {
+		c.PauseImageArchive = initializeKubeletOpts.pauseImageArchive
+	},
+	"system-reserved-sizing": func(c *config.Configuration) {
+		c.Sizing.Auto = initializeKubeletOpts.reservedSizing == config.SizingAuto
+	},
+	"system-reserved": func(c *config.Configuration) {
+		c.Sizing.Override = initializeKubeletOpts.systemReserved
+	},
+	"system-reserved-min": func(c *config.Configuration) {
+		c.Sizing.Min = initializeKubeletOpts.systemReservedMin
+	},
+	"system-reserved-max": func(c *config.Configuration) {
+		c.Sizing.Max = initializeKubeletOpts.systemReservedMax
+	},
+	"kube-reserved-percent": func(c *config.Configuration) {
+		c.Sizing.KubeReservedPercent = initializeKubeletOpts.kubeReservedPercent
+	},
+	"auto-eviction-hard": func(c *config.Configuration) {
+		c.Sizing.EvictionHard = initializeKubeletOpts.evictionHard
+	},
+	"node-ip": func(c *config.Configuration) {
+		c.NodeIdentity.NodeIP = initializeKubeletOpts.nodeIP
+	},
+	"node-ip-cidr": func(c *config.Configuration) {
+		c.NodeIdentity.NodeIPCIDR = initializeKubeletOpts.nodeIPCIDR
+	},
+	"node-ip-interface": func(c *config.Configuration) {
+		c.NodeIdentity.NodeIPInterface = initializeKubeletOpts.nodeIPInterface
+	},
+	"cluster-dns": func(c *config.Configuration) {
+		c.ClusterDNS = initializeKubeletOpts.clusterDNS
+	},
+	"hostname-override": func(c *config.Configuration) {
+		c.NodeIdentity.Hostname = initializeKubeletOpts.hostnameOverride
+	},
+	"hostname-source": func(c *config.Configuration) {
+		c.NodeIdentity.HostnameSource = initializeKubeletOpts.hostnameSource
+	},
+	"node-taint": func(c *config.Configuration) {
+		c.Taints = nodelabels.MergeTaints(c.Taints, initializeKubeletOpts.parsedNodeTaints)
+	},
+	"node-label": func(c *config.Configuration) {
+		c.Labels = nodelabels.MergeLabels(c.Labels, initializeKubeletOpts.nodeLabels)
+	},
+	"api-server-override": func(c *config.Configuration) {
+		c.APIServerOverride = initializeKubeletOpts.apiServerOverride
+	},
+	"probe-api-server": func(c *config.Configuration) {
+		c.ProbeAPIServer = initializeKubeletOpts.probeAPIServer
+	},
 }
 
 // runInitializeKubeletCmd starts the Windows Machine Config Bootstrapper
 func runInitializeKubeletCmd(cmd *cobra.Command, args []string) {
 	flag.Parse()
-	// TODO: add validation for flags
+	ctx, cancel := commandContext()
+	defer cancel()
+	if initializeKubeletOpts.output != "text" && initializeKubeletOpts.output != "json" {
+		log.Error(fmt.Errorf("unsupported output %q, must be text or json", initializeKubeletOpts.output),
+			"invalid flags")
+		os.Exit(1)
+	}
+	if err := config.ValidateSizing(initializeKubeletOpts.reservedSizing); err != nil {
+		log.Error(err, "invalid flags")
+		os.Exit(1)
+	}
+	for _, value := range initializeKubeletOpts.nodeTaints {
+		taint, err := config.ParseTaint(value)
+		if err != nil {
+			log.Error(err, "invalid flags")
+			os.Exit(1)
+		}
+		initializeKubeletOpts.parsedNodeTaints = append(initializeKubeletOpts.parsedNodeTaints, taint)
+	}
+	mirrors, err := runtimeconf.ParseMirrors(initializeKubeletOpts.registryMirrors)
+	if err != nil {
+		log.Error(err, "invalid flags")
+		os.Exit(1)
+	}
+	initializeKubeletOpts.parsedRegistryMirrors = mirrors
+	cfg, err := loadConfig(cmd, initializeKubeletOpts.configFile, initializeKubeletOverrides)
+	if err != nil {
+		log.Error(err, "could not load configuration")
+		os.Exit(1)
+	}
 
-	wmcb, err := bootstrapper.NewWinNodeBootstrapper(initializeKubeletOpts.installDir,
-		initializeKubeletOpts.ignitionFile, initializeKubeletOpts.kubeletPath, "", "")
+	wmcb, err := bootstrapper.New(bootstrapper.WithConfiguration(cfg),
+		bootstrapper.WithIgnitionFile(initializeKubeletOpts.ignitionFile),
+		bootstrapper.WithKubeletPath(initializeKubeletOpts.kubeletPath),
+		bootstrapper.WithReconcile(initializeKubeletOpts.reconcile),
+		bootstrapper.WithProgressFile(initializeKubeletOpts.progressFile),
+		bootstrapper.WithLogger(progressLog))
 	if err != nil {
 		log.Error(err, "could not create bootstrapper")
 		os.Exit(1)
 	}
 
-	err = wmcb.InitializeKubelet()
+	err = wmcb.InitializeKubelet(ctx)
+	printProgress(wmcb.Progress(), initializeKubeletOpts.output)
 	if err != nil {
 		log.Error(err, "could not run bootstrapper")
 		os.Exit(1)
@@ -74,3 +358,14 @@ func runInitializeKubeletCmd(cmd *cobra.Command, args []string) {
 		log.Error(err, "can't clean up bootstrapper")
 	}
 }
+
+// printProgress prints the phases of the bootstrap to StdOut when the result is requested in the json format, whether
+// the bootstrap succeeded or not
+func printProgress(report progress.Report, output string) {
+	if output != "json" {
+		return
+	}
+	if err := printJSON(report); err != nil {
+		log.Error(err, "could not print result")
+	}
+}
@@ -1,8 +1,14 @@
 package main
 
 import (
+	"context"
 	"flag"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/config"
 	"github.com/spf13/cobra"
 	logger "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
@@ -20,10 +26,20 @@ var (
 			"the node can join existing OpenShift cluster",
 	}
 	log = logger.Log.WithName("wmcb")
+	// progressLog receives the progress of the bootstrapper. It logs to StdOut, as WMCO interprets logs in StdErr as an
+	// indication that bootstrapping failed.
+	progressLog = zap.New(func(o *zap.Options) { o.DestWritter = os.Stdout }).WithName("wmcb")
+
+	rootOpts struct {
+		// timeout bounds how long a command may run. There is no limit if it is zero.
+		timeout time.Duration
+	}
 )
 
 func init() {
 	rootCmd.PersistentFlags().AddGoFlagSet(flag.CommandLine)
+	rootCmd.PersistentFlags().DurationVar(&rootOpts.timeout, "timeout", 0,
+		"How long the command may run before it is cancelled, for example 10m. There is no limit if it is 0")
 	// Controller-runtime's zap package redirects logs to StdErr by default. Functionality to set up the destination of
 	// logs would require bumping up the version of controller-runtime to at least 0.4.0, which is dependent on
 	// https://issues.redhat.com/browse/WINC-347
@@ -32,6 +48,57 @@ func init() {
 	logger.SetLogger(zap.New())
 }
 
+// configOverrides maps the name of a flag to the function applying its value to the WMCB configuration
+type configOverrides map[string]func(c *config.Configuration)
+
+// loadConfig reads the WMCB configuration file at the given path, or takes the default configuration if the path is
+// empty, and applies the flags that were set on the command line on top of it, so that the flags take precedence over
+// the file
+func loadConfig(cmd *cobra.Command, path string, overrides configOverrides) (config.Configuration, error) {
+	c, err := config.Load(path)
+	if err != nil {
+		return config.Configuration{}, err
+	}
+	for name, override := range overrides {
+		if cmd.Flags().Changed(name) {
+			override(&c)
+		}
+	}
+	if err = c.Validate(); err != nil {
+		return config.Configuration{}, err
+	}
+	return c, nil
+}
+
+// commandContext returns the context a command runs with. It is cancelled once the --timeout has passed or when wmcb
+// receives SIGINT or SIGTERM. The bootstrapper stops at the next point where the node is in a consistent state, which
+// can take up to the service wait time. A second signal exits right away.
+func commandContext() (context.Context, context.CancelFunc) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if rootOpts.timeout > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), rootOpts.timeout)
+	} else {
+		ctx, cancel = context.WithCancel(context.Background())
+	}
+
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case sig := <-signals:
+			log.Info("cancelling, send the signal again to exit right away", "signal", sig.String())
+			cancel()
+		case <-ctx.Done():
+			signal.Stop(signals)
+			return
+		}
+		<-signals
+		os.Exit(1)
+	}()
+	return ctx, cancel
+}
+
 func main() {
 	if err := rootCmd.Execute(); err != nil {
 		log.Error(err, "wmcb execution failed")
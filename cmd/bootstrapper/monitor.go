@@ -0,0 +1,98 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/bootstrapper"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/monitor"
+	"github.com/spf13/cobra"
+)
+
+var (
+	monitorCmd = &cobra.Command{
+		Use:   "monitor",
+		Short: "Monitors the node components of the Windows node",
+		Long: "Periodically checks the kubelet health, the hybrid-overlay and kube-proxy processes, the HNS network " +
+			"and the free disk space, and remediates the components that keep failing by restarting their service, " +
+			"re-running configure-cni or marking them in a status file. Can be installed as a Windows service.",
+		Run: runMonitorCmd,
+	}
+
+	monitorOpts struct {
+		// configPath is the monitor config file
+		configPath string
+		// installService registers the monitor as a Windows service instead of running it
+		installService bool
+		// uninstallService removes the monitor Windows service instead of running the monitor
+		uninstallService bool
+	}
+)
+
+func init() {
+	rootCmd.AddCommand(monitorCmd)
+	monitorCmd.PersistentFlags().StringVar(&monitorOpts.configPath, "config", "",
+		"Monitor config file with the checks, their intervals and remediations. Defaults to the built-in checks")
+	monitorCmd.PersistentFlags().BoolVar(&monitorOpts.installService, "install-service", false,
+		"Install and start the monitor as the "+bootstrapper.MonitorServiceName+" Windows service")
+	monitorCmd.PersistentFlags().BoolVar(&monitorOpts.uninstallService, "uninstall-service", false,
+		"Stop and remove the "+bootstrapper.MonitorServiceName+" Windows service")
+}
+
+// runMonitorCmd runs the node component monitor, or installs or removes its Windows service
+func runMonitorCmd(cmd *cobra.Command, args []string) {
+	flag.Parse()
+	// The monitor runs until it is interrupted or its service is stopped, so it is only cancelled by a signal
+	if cmd.Flags().Changed("timeout") {
+		log.Error(fmt.Errorf("--timeout is not supported by the monitor, which runs until it is stopped"),
+			"invalid flags")
+		os.Exit(1)
+	}
+
+	if monitorOpts.uninstallService {
+		if err := bootstrapper.UninstallMonitorService(); err != nil {
+			log.Error(err, "could not uninstall monitor service")
+			os.Exit(1)
+		}
+		os.Stdout.WriteString("Monitor service uninstalled successfully")
+		return
+	}
+
+	// Load the config before installing the service so that an invalid config is reported right away
+	config, err := monitor.LoadConfig(monitorOpts.configPath)
+	if err != nil {
+		log.Error(err, "could not load monitor config")
+		os.Exit(1)
+	}
+
+	if monitorOpts.installService {
+		if err = bootstrapper.InstallMonitorService(monitorOpts.configPath); err != nil {
+			log.Error(err, "could not install monitor service")
+			os.Exit(1)
+		}
+		os.Stdout.WriteString("Monitor service installed successfully")
+		return
+	}
+
+	ctx, cancel := commandContext()
+	defer cancel()
+	err = bootstrapper.RunMonitor(ctx, config, func(status monitor.Status, err error) {
+		if err != nil {
+			log.Error(err, "could not update monitor status")
+		}
+		for _, check := range status.Checks {
+			if !check.Healthy {
+				log.Info("check failed", "check", check.Name, "failures", check.ConsecutiveFailures,
+					"message", check.Message)
+			}
+			if check.RemediationError != "" {
+				log.Info("remediation failed", "check", check.Name, "error", check.RemediationError)
+			}
+		}
+	})
+	if err != nil {
+		log.Error(err, "monitor failed")
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/bootstrapper"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/config"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/config/v1alpha1"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/preflight"
+	"github.com/spf13/cobra"
+)
+
+var (
+	preflightCmd = &cobra.Command{
+		Use:   "preflight",
+		Short: "Checks that the Windows node meets the requirements of the bootstrapper",
+		Long: "Checks that the Windows node meets the requirements of the bootstrapper without changing it. " +
+			"Every check passes, warns or fails, and the ones that do not pass come with how to address them. " +
+			"Exits with a non-zero status if any check fails.",
+		Run: runPreflightCmd,
+	}
+
+	preflightOpts struct {
+		// The location of the ignition file, which is not checked if empty
+		ignitionFile string
+		// The location of the kubelet.exe to check, which is not checked if empty
+		kubeletPath string
+		// kubeletVersion is the version the kubelet is expected to have
+		kubeletVersion string
+		// configFile is the WMCB configuration file, which the other flags take precedence over
+		configFile string
+		// The directory the kubelet is installed in
+		installDir string
+		// containerRuntime is the container runtime used by the kubelet
+		containerRuntime string
+		// pauseImageManifest is a file mapping the supported Windows builds to pause images
+		pauseImageManifest string
+		// output is the format the results are printed in, either text or json
+		output string
+	}
+)
+
+func init() {
+	rootCmd.AddCommand(preflightCmd)
+	preflightCmd.PersistentFlags().StringVar(&preflightOpts.ignitionFile, "ignition-file", "",
+		"Ignition file to check. It is not checked if not given")
+	preflightCmd.PersistentFlags().StringVar(&preflightOpts.kubeletPath, "kubelet-path", "",
+		"Kubelet binary to check. It is not checked if not given")
+	preflightCmd.PersistentFlags().StringVar(&preflightOpts.kubeletVersion, "kubelet-version", "",
+		"Version the kubelet binary is expected to have, for example v1.19.0")
+	preflightCmd.PersistentFlags().StringVar(&preflightOpts.configFile, "config", "",
+		"WMCB configuration file. Flags set on the command line take precedence over it")
+	preflightCmd.PersistentFlags().StringVar(&preflightOpts.installDir, "install-dir", v1alpha1.DefaultInstallDir,
+		"Installation directory")
+	preflightCmd.PersistentFlags().StringVar(&preflightOpts.containerRuntime, "container-runtime",
+		v1alpha1.DefaultContainerRuntime, "Container runtime used by the kubelet, either "+
+			config.ContainerRuntimeDocker+" or "+config.ContainerRuntimeContainerd)
+	preflightCmd.PersistentFlags().StringVar(&preflightOpts.pauseImageManifest, "pause-image-manifest", "",
+		"YAML file mapping the supported Windows builds to pause images. Defaults to the built-in manifest")
+	preflightCmd.PersistentFlags().StringVar(&preflightOpts.output, "output", "text",
+		"Format the results are printed in, either text or json")
+}
+
+// preflightOverrides applies the preflight flags set on the command line to the WMCB configuration
+var preflightOverrides = configOverrides{
+	"install-dir": func(c *config.Configuration) {
+		c.InstallDir = preflightOpts.installDir
+	},
+	"container-runtime": func(c *config.Configuration) {
+		c.ContainerRuntime = preflightOpts.containerRuntime
+	},
+	"pause-image-manifest": func(c *config.Configuration) {
+		c.PauseImageManifest = preflightOpts.pauseImageManifest
+	},
+}
+
+// runPreflightCmd runs the preflight checks and prints their results
+func runPreflightCmd(cmd *cobra.Command, args []string) {
+	flag.Parse()
+	ctx, cancel := commandContext()
+	defer cancel()
+	if preflightOpts.output != "text" && preflightOpts.output != "json" {
+		log.Error(fmt.Errorf("unsupported output %q, must be text or json", preflightOpts.output), "invalid flags")
+		os.Exit(1)
+	}
+	cfg, err := loadConfig(cmd, preflightOpts.configFile, preflightOverrides)
+	if err != nil {
+		log.Error(err, "could not load configuration")
+		os.Exit(1)
+	}
+
+	wmcb, err := bootstrapper.New(bootstrapper.WithConfiguration(cfg),
+		bootstrapper.WithIgnitionFile(preflightOpts.ignitionFile),
+		bootstrapper.WithKubeletPath(preflightOpts.kubeletPath))
+	if err != nil {
+		log.Error(err, "could not create bootstrapper")
+		os.Exit(1)
+	}
+
+	results, err := wmcb.Preflight(ctx, preflightOpts.kubeletVersion)
+	if disconnectErr := wmcb.Disconnect(); disconnectErr != nil {
+		log.Error(disconnectErr, "can't clean up bootstrapper")
+	}
+	if err != nil {
+		log.Error(err, "could not run preflight checks")
+		os.Exit(1)
+	}
+	if err = printPreflightResults(results, preflightOpts.output); err != nil {
+		log.Error(err, "could not print preflight results")
+		os.Exit(1)
+	}
+	if results.Failed() {
+		os.Exit(1)
+	}
+}
+
+// printPreflightResults writes the given results to stdout in the given format
+func printPreflightResults(results preflight.Results, output string) error {
+	if output == "json" {
+		return printJSON(results)
+	}
+	var b strings.Builder
+	for _, result := range results {
+		fmt.Fprintf(&b, "[%s] %s: %s\n", strings.ToUpper(string(result.Status)), result.Name, result.Message)
+		if result.Remediation != "" {
+			fmt.Fprintf(&b, "       %s\n", result.Remediation)
+		}
+	}
+	_, err := os.Stdout.WriteString(b.String())
+	return err
+}
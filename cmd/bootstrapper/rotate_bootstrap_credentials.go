@@ -0,0 +1,148 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/bootstrapper"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/config"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/config/v1alpha1"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/ignition"
+	"github.com/spf13/cobra"
+)
+
+var (
+	rotateBootstrapCredentialsCmd = &cobra.Command{
+		Use:   "rotate-bootstrap-credentials",
+		Short: "Replaces the bootstrap kubeconfig and kubelet CA on the Windows node",
+		Long: "Replaces the bootstrap kubeconfig and kubelet CA on the Windows node with the ones of the given " +
+			"ignition file or Machine Config Server URL, without rerunning the bootstrap. Only the kubelet service, " +
+			"and the services depending on it, are restarted. With --purge-client-certs, the kubelet client " +
+			"certificates are removed as well so that the kubelet goes through its TLS bootstrap again.",
+		Run: runRotateBootstrapCredentialsCmd,
+		PreRunE: func(cmd *cobra.Command, _ []string) error {
+			if (rotateBootstrapCredentialsOpts.ignitionFile == "") == (rotateBootstrapCredentialsOpts.ignitionURL == "") {
+				return fmt.Errorf("exactly one of --ignition-file and --ignition-url is required")
+			}
+			return nil
+		},
+	}
+
+	rotateBootstrapCredentialsOpts struct {
+		// The location of the ignition file
+		ignitionFile string
+		// ignitionURL is where the ignition is fetched from, such as the worker config of the Machine Config Server
+		ignitionURL string
+		// ignitionCAFile is the CA bundle the server at ignitionURL is verified with
+		ignitionCAFile string
+		// ignitionTimeout is how long to wait for the ignition to be fetched
+		ignitionTimeout time.Duration
+		// purgeClientCerts removes the kubelet client certificates so that the kubelet bootstraps again
+		purgeClientCerts bool
+		// configFile is the WMCB configuration file, which the other flags take precedence over
+		configFile string
+		// The directory the kubelet is installed in
+		installDir string
+		// healthTimeout is how long to wait for the kubelet to report healthy after it has been restarted
+		healthTimeout time.Duration
+		// apiServerOverride replaces the API server address of the bootstrap kubeconfig
+		apiServerOverride string
+		// probeAPIServer makes the rotation fail if the API server does not report ready
+		probeAPIServer bool
+	}
+)
+
+func init() {
+	rootCmd.AddCommand(rotateBootstrapCredentialsCmd)
+	rotateBootstrapCredentialsCmd.PersistentFlags().StringVar(&rotateBootstrapCredentialsOpts.ignitionFile,
+		"ignition-file", "", "Ignition file holding the new bootstrap credentials")
+	rotateBootstrapCredentialsCmd.PersistentFlags().StringVar(&rotateBootstrapCredentialsOpts.ignitionURL,
+		"ignition-url", "", "URL the ignition holding the new bootstrap credentials is fetched from, for example "+
+			"https://api-int.<cluster domain>:22623/config/worker")
+	rotateBootstrapCredentialsCmd.PersistentFlags().StringVar(&rotateBootstrapCredentialsOpts.ignitionCAFile,
+		"ignition-ca-file", "", "CA bundle the server of --ignition-url is verified with. Defaults to the system roots")
+	rotateBootstrapCredentialsCmd.PersistentFlags().DurationVar(&rotateBootstrapCredentialsOpts.ignitionTimeout,
+		"ignition-timeout", 30*time.Second, "How long to wait for the ignition to be fetched from --ignition-url")
+	rotateBootstrapCredentialsCmd.PersistentFlags().BoolVar(&rotateBootstrapCredentialsOpts.purgeClientCerts,
+		"purge-client-certs", false, "Remove the kubelet client certificates so that the kubelet goes through its "+
+			"TLS bootstrap again with the new credentials")
+	rotateBootstrapCredentialsCmd.PersistentFlags().StringVar(&rotateBootstrapCredentialsOpts.configFile, "config", "",
+		"WMCB configuration file. Flags set on the command line take precedence over it")
+	rotateBootstrapCredentialsCmd.PersistentFlags().StringVar(&rotateBootstrapCredentialsOpts.installDir,
+		"install-dir", v1alpha1.DefaultInstallDir, "Installation directory")
+	rotateBootstrapCredentialsCmd.PersistentFlags().DurationVar(&rotateBootstrapCredentialsOpts.healthTimeout,
+		"kubelet-health-timeout", v1alpha1.DefaultKubeletHealthTimeout, "How long to wait for the kubelet to report "+
+			"healthy after it has been restarted. Set to 0 to skip the health verification.")
+	rotateBootstrapCredentialsCmd.PersistentFlags().StringVar(&rotateBootstrapCredentialsOpts.apiServerOverride,
+		"api-server-override", "", "API server address to write to the bootstrap kubeconfig instead of the one in the "+
+			"ignition, for example https://10.0.0.10:6443")
+	rotateBootstrapCredentialsCmd.PersistentFlags().BoolVar(&rotateBootstrapCredentialsOpts.probeAPIServer,
+		"probe-api-server", false, "Fail if the API server does not report ready on /readyz when reached with the "+
+			"new bootstrap kubeconfig")
+}
+
+// rotateBootstrapCredentialsOverrides applies the rotate-bootstrap-credentials flags set on the command line to the
+// WMCB configuration
+var rotateBootstrapCredentialsOverrides = configOverrides{
+	"install-dir": func(c *config.Configuration) {
+		c.InstallDir = rotateBootstrapCredentialsOpts.installDir
+	},
+	"kubelet-health-timeout": func(c *config.Configuration) {
+		c.KubeletHealthTimeout = rotateBootstrapCredentialsOpts.healthTimeout
+	},
+	"api-server-override": func(c *config.Configuration) {
+		c.APIServerOverride = rotateBootstrapCredentialsOpts.apiServerOverride
+	},
+	"probe-api-server": func(c *config.Configuration) {
+		c.ProbeAPIServer = rotateBootstrapCredentialsOpts.probeAPIServer
+	},
+}
+
+// runRotateBootstrapCredentialsCmd replaces the bootstrap credentials of the kubelet on the Windows node
+func runRotateBootstrapCredentialsCmd(cmd *cobra.Command, args []string) {
+	flag.Parse()
+	ctx, cancel := commandContext()
+	defer cancel()
+	cfg, err := loadConfig(cmd, rotateBootstrapCredentialsOpts.configFile, rotateBootstrapCredentialsOverrides)
+	if err != nil {
+		log.Error(err, "could not load configuration")
+		os.Exit(1)
+	}
+
+	ignitionOpt := bootstrapper.WithIgnitionFile(rotateBootstrapCredentialsOpts.ignitionFile)
+	if rotateBootstrapCredentialsOpts.ignitionURL != "" {
+		client, err := ignition.HTTPClient(rotateBootstrapCredentialsOpts.ignitionCAFile,
+			rotateBootstrapCredentialsOpts.ignitionTimeout)
+		if err != nil {
+			log.Error(err, "could not create ignition client")
+			os.Exit(1)
+		}
+		contents, err := ignition.Fetch(ctx, client, rotateBootstrapCredentialsOpts.ignitionURL)
+		if err != nil {
+			log.Error(err, "could not fetch ignition")
+			os.Exit(1)
+		}
+		ignitionOpt = bootstrapper.WithIgnition(contents)
+	}
+
+	wmcb, err := bootstrapper.New(bootstrapper.WithConfiguration(cfg), ignitionOpt)
+	if err != nil {
+		log.Error(err, "could not create bootstrapper")
+		os.Exit(1)
+	}
+
+	err = wmcb.RotateBootstrapCredentials(ctx, rotateBootstrapCredentialsOpts.purgeClientCerts)
+	if err != nil {
+		log.Error(err, "could not rotate bootstrap credentials")
+		os.Exit(1)
+	}
+	// Send success message to StdOut for WSU to ascertain that the rotation was successful
+	os.Stdout.WriteString("Bootstrap credentials rotated successfully")
+
+	err = wmcb.Disconnect()
+	if err != nil {
+		log.Error(err, "can't clean up bootstrapper")
+	}
+}
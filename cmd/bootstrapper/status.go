@@ -0,0 +1,116 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/bootstrapper"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/config"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/config/v1alpha1"
+	"github.com/spf13/cobra"
+)
+
+var (
+	statusCmd = &cobra.Command{
+		Use:   "status",
+		Short: "Reports the state of the kubelet on the Windows node",
+		Long: "Reports the state and health of the kubelet service, its CNI configuration, and the subject, SANs, " +
+			"issuer and expiry of its client and serving certificates and CA.",
+		Run: runStatusCmd,
+	}
+
+	statusOpts struct {
+		// configFile is the WMCB configuration file, which the other flags take precedence over
+		configFile string
+		// The directory the kubelet is installed in
+		installDir string
+		// certDir is the directory the kubelet keeps its certificates in
+		certDir string
+		// output is the format the status is printed in, either text or json
+		output string
+	}
+)
+
+func init() {
+	rootCmd.AddCommand(statusCmd)
+	statusCmd.PersistentFlags().StringVar(&statusOpts.configFile, "config", "",
+		"WMCB configuration file. Flags set on the command line take precedence over it")
+	statusCmd.PersistentFlags().StringVar(&statusOpts.installDir, "install-dir", v1alpha1.DefaultInstallDir,
+		"Installation directory")
+	statusCmd.PersistentFlags().StringVar(&statusOpts.certDir, "cert-dir", v1alpha1.DefaultCertDirectory,
+		"Directory the kubelet keeps its certificates in")
+	statusCmd.PersistentFlags().StringVar(&statusOpts.output, "output", "text",
+		"Format the status is printed in, either text or json")
+}
+
+// statusOverrides applies the status flags set on the command line to the WMCB configuration
+var statusOverrides = configOverrides{
+	"install-dir": func(c *config.Configuration) {
+		c.InstallDir = statusOpts.installDir
+	},
+	"cert-dir": func(c *config.Configuration) {
+		c.CertDirectory = statusOpts.certDir
+	},
+}
+
+// runStatusCmd prints the state of the kubelet
+func runStatusCmd(cmd *cobra.Command, args []string) {
+	flag.Parse()
+	ctx, cancel := commandContext()
+	defer cancel()
+	if statusOpts.output != "text" && statusOpts.output != "json" {
+		log.Error(fmt.Errorf("unsupported output %q, must be text or json", statusOpts.output), "invalid flags")
+		os.Exit(1)
+	}
+	cfg, err := loadConfig(cmd, statusOpts.configFile, statusOverrides)
+	if err != nil {
+		log.Error(err, "could not load configuration")
+		os.Exit(1)
+	}
+
+	wmcb, err := bootstrapper.New(bootstrapper.WithConfiguration(cfg))
+	if err != nil {
+		log.Error(err, "could not create bootstrapper")
+		os.Exit(1)
+	}
+
+	status, err := wmcb.Status(ctx)
+	if disconnectErr := wmcb.Disconnect(); disconnectErr != nil {
+		log.Error(disconnectErr, "can't clean up bootstrapper")
+	}
+	if err != nil {
+		log.Error(err, "could not get status")
+		os.Exit(1)
+	}
+	if err = printStatus(status, statusOpts.output); err != nil {
+		log.Error(err, "could not print status")
+		os.Exit(1)
+	}
+}
+
+// printStatus writes the given status to stdout in the given format
+func printStatus(status bootstrapper.Status, output string) error {
+	if output == "json" {
+		return printJSON(status)
+	}
+	var b strings.Builder
+	switch {
+	case !status.KubeletInstalled:
+		b.WriteString("kubelet: not installed\n")
+	case status.KubeletHealthy:
+		fmt.Fprintf(&b, "kubelet: %s, healthy\n", status.KubeletState)
+	default:
+		fmt.Fprintf(&b, "kubelet: %s, not healthy\n", status.KubeletState)
+	}
+	if status.CNIConfigured {
+		fmt.Fprintf(&b, "CNI: configured, binaries in %s, config in %s\n", status.CNIBinDir, status.CNIConfDir)
+	} else if status.KubeletInstalled {
+		b.WriteString("CNI: not configured\n")
+	}
+	b.WriteString("certificates:\n")
+	writeCertResults(&b, status.Certificates)
+	_, err := os.Stdout.WriteString(b.String())
+	return err
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"time"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/bootstrapper"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/config"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/config/v1alpha1"
+	"github.com/spf13/cobra"
+)
+
+var (
+	upgradeKubeletCmd = &cobra.Command{
+		Use:   "upgrade-kubelet",
+		Short: "Upgrades the kubelet binary on the Windows node",
+		Long: "Upgrades the kubelet binary on the Windows node without rerunning the bootstrap. " +
+			"The new kubelet must match the given sha256 digest and be supported with the API server version. " +
+			"The previous kubelet is restored if the new one does not become healthy.",
+		Run: runUpgradeKubeletCmd,
+		PreRunE: func(cmd *cobra.Command, _ []string) error {
+			err := cmd.MarkPersistentFlagRequired("kubelet-path")
+			if err != nil {
+				return err
+			}
+			err = cmd.MarkPersistentFlagRequired("kubelet-sha256")
+			if err != nil {
+				return err
+			}
+			return nil
+		},
+	}
+
+	upgradeKubeletOpts struct {
+		// The location where the new kubelet.exe has been downloaded to
+		kubeletPath string
+		// The expected sha256 digest of the new kubelet.exe
+		kubeletSHA256 string
+		// The directory the kubelet is installed in
+		installDir string
+		// configFile is the WMCB configuration file, which the other flags take precedence over
+		configFile string
+		// healthTimeout is how long to wait for the new kubelet to report healthy before rolling back
+		healthTimeout time.Duration
+	}
+)
+
+func init() {
+	rootCmd.AddCommand(upgradeKubeletCmd)
+	upgradeKubeletCmd.PersistentFlags().StringVar(&upgradeKubeletOpts.kubeletPath, "kubelet-path", "",
+		"Location of the new kubelet binary")
+	upgradeKubeletCmd.PersistentFlags().StringVar(&upgradeKubeletOpts.kubeletSHA256, "kubelet-sha256", "",
+		"Expected hex encoded sha256 digest of the new kubelet binary")
+	upgradeKubeletCmd.PersistentFlags().StringVar(&upgradeKubeletOpts.configFile, "config", "",
+		"WMCB configuration file. Flags set on the command line take precedence over it")
+	upgradeKubeletCmd.PersistentFlags().StringVar(&upgradeKubeletOpts.installDir, "install-dir",
+		v1alpha1.DefaultInstallDir, "Installation directory")
+	upgradeKubeletCmd.PersistentFlags().DurationVar(&upgradeKubeletOpts.healthTimeout, "kubelet-health-timeout",
+		v1alpha1.DefaultKubeletHealthTimeout, "How long to wait for the new kubelet to report healthy before "+
+			"rolling back to the previous kubelet. Set to 0 to skip the health verification.")
+}
+
+// upgradeKubeletOverrides applies the upgrade-kubelet flags set on the command line to the WMCB configuration
+var upgradeKubeletOverrides = configOverrides{
+	"install-dir": func(c *config.Configuration) {
+		c.InstallDir = upgradeKubeletOpts.installDir
+	},
+	"kubelet-health-timeout": func(c *config.Configuration) {
+		c.KubeletHealthTimeout = upgradeKubeletOpts.healthTimeout
+	},
+}
+
+// runUpgradeKubeletCmd replaces the kubelet binary on the Windows node
+func runUpgradeKubeletCmd(cmd *cobra.Command, args []string) {
+	flag.Parse()
+	ctx, cancel := commandContext()
+	defer cancel()
+	cfg, err := loadConfig(cmd, upgradeKubeletOpts.configFile, upgradeKubeletOverrides)
+	if err != nil {
+		log.Error(err, "could not load configuration")
+		os.Exit(1)
+	}
+
+	wmcb, err := bootstrapper.New(bootstrapper.WithConfiguration(cfg))
+	if err != nil {
+		log.Error(err, "could not create bootstrapper")
+		os.Exit(1)
+	}
+
+	err = wmcb.UpgradeKubelet(ctx, upgradeKubeletOpts.kubeletPath, upgradeKubeletOpts.kubeletSHA256)
+	if err != nil {
+		log.Error(err, "could not upgrade kubelet")
+		os.Exit(1)
+	}
+	// Send success message to StdOut for WSU to ascertain that the upgrade was successful
+	os.Stdout.WriteString("Kubelet upgrade completed successfully")
+
+	err = wmcb.Disconnect()
+	if err != nil {
+		log.Error(err, "can't clean up bootstrapper")
+	}
+}
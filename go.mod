@@ -11,10 +11,12 @@ replace (
 )
 
 require (
+	github.com/containernetworking/cni v0.8.1
 	github.com/coreos/ign-converter v0.0.0-20200825151652-ea20012f9844
 	github.com/coreos/ignition v0.35.0
 	github.com/coreos/ignition/v2 v2.6.0
 	github.com/go-bindata/go-bindata/v3 v3.1.3
+	github.com/go-logr/logr v0.1.0
 	github.com/go-logr/zapr v0.1.0
 	github.com/gogo/protobuf v1.2.1 // indirect
 	github.com/pkg/errors v0.9.1
@@ -25,7 +27,9 @@ require (
 	go.uber.org/atomic v1.4.0 // indirect
 	go.uber.org/zap v1.10.0
 	golang.org/x/sys v0.0.0-20200610111108-226ff32320da
+	gopkg.in/yaml.v2 v2.2.2
 	k8s.io/api v0.0.0-20190923155552-eac758366a00 // indirect
-	k8s.io/apimachinery v0.0.0-20190923155427-ec87dd743e08 // indirect
+	k8s.io/apimachinery v0.0.0-20190923155427-ec87dd743e08
+	k8s.io/client-go v11.0.1-0.20190409021438-1a26190bd76a+incompatible
 	sigs.k8s.io/controller-runtime v0.2.1
 )
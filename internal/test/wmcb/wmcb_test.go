@@ -4,15 +4,11 @@ import (
 	"context"
 	"flag"
 	"fmt"
-	"io/ioutil"
 	"log"
 	"net/url"
-	"os"
 	"path"
-	"path/filepath"
 	"strings"
 	"testing"
-	"text/template"
 	"time"
 
 	"github.com/stretchr/testify/assert"
@@ -31,12 +27,8 @@ const (
 	winTemp = "C:\\Windows\\Temp\\"
 	// winCNIDir is the directory where the CNI files are placed
 	winCNIDir = winTemp + "\\cni\\"
-	// winCNIConfigPath is the CNI configuration file path on the Windows VM
-	winCNIConfigPath = "C:\\Windows\\Temp\\cni\\config\\"
 	// logDir is the remote kubernetes log director
 	kLog = "C:\\k\\log\\"
-	// cniConfigTemplate is the location of the cni.conf template file
-	cniConfigTemplate = "templates/cni.template"
 	// wgetIgnoreCertCmd is the remote location of the wget-ignore-cert.ps1 script
 	wgetIgnoreCertCmd = remoteDir + "wget-ignore-cert.ps1"
 	// e2eExecutable is the remote location of the WMCB e2e test binary
@@ -172,10 +164,15 @@ func (vm *wmcbVM) runTestConfigureCNI(t *testing.T) {
 
 	// It is guaranteed that the hybrid overlay annotations are present as we have already checked for it
 	hybridOverlayAnnotation := node.GetAnnotations()[test.HybridOverlaySubnet]
-	err = vm.initializeTestConfigureCNIFiles(hybridOverlayAnnotation)
+	err = vm.initializeTestConfigureCNIFiles()
 	require.NoError(t, err, "error initializing files required for TestConfigureCNI")
 
-	err = vm.runTest(e2eExecutable + " --test.run TestConfigureCNI --test.v")
+	serviceNetworkCIDRs, err := getServiceNetworkCIDRs()
+	require.NoError(t, err, "unable to get service network CIDRs")
+
+	// The CNI config is rendered by WMCB from the hybrid overlay subnet and the service networks
+	err = vm.runTest(e2eExecutable + " --test.run TestConfigureCNI --test.v --host-subnet=" + hybridOverlayAnnotation +
+		" --service-cidr=" + strings.Join(serviceNetworkCIDRs, ","))
 	require.NoError(t, err, "TestConfigureCNI failed")
 }
 
@@ -249,7 +246,7 @@ func (vm *wmcbVM) remoteDownloadExtract(pkg PkgInfo, remoteDownloadFile, remoteE
 }
 
 // initializeTestConfigureCNIFiles initializes the files required for configure-cni
-func (vm *wmcbVM) initializeTestConfigureCNIFiles(ovnHostSubnet string) error {
+func (vm *wmcbVM) initializeTestConfigureCNIFiles() error {
 	// Create the CNI directory C:\Windows\Temp\cni on the Windows VM
 	output, err := vm.Run(mkdirCmd(winCNIDir), false)
 	if err != nil {
@@ -268,18 +265,6 @@ func (vm *wmcbVM) initializeTestConfigureCNIFiles(ovnHostSubnet string) error {
 	if err != nil {
 		return fmt.Errorf("unable to download CNI package: %v", err)
 	}
-
-	// Create the CNI config file locally
-	cniConfigPath, err := createCNIConf(ovnHostSubnet)
-	if err != nil {
-		return fmt.Errorf("error creating local cni.conf: %v", err)
-	}
-
-	// Copy the created config to C:\Window\Temp\cni\config\cni.conf on the Windows VM
-	err = vm.CopyFile(cniConfigPath, winCNIConfigPath)
-	if err != nil {
-		return fmt.Errorf("error copying %s --> VM %s: %v", cniConfigPath, winCNIConfigPath, err)
-	}
 	return nil
 }
 
@@ -371,81 +356,19 @@ func mkdirCmd(dirName string) string {
 	return "if not exist " + dirName + " mkdir " + dirName
 }
 
-// createCNIConf create the local cni.conf and returns its path
-func createCNIConf(ovnHostSubnet string) (string, error) {
-	serviceNetworkCIDR, err := getServiceNetworkCIDR()
-	if err != nil {
-		return "", fmt.Errorf("unable to get service network CIDR: %v", err)
-	}
-
-	cniConfigPath, err := generateCNIConf(ovnHostSubnet, serviceNetworkCIDR)
-	if err != nil {
-		return "", fmt.Errorf("unable to generate CNI configuration: %v", err)
-	}
-
-	return cniConfigPath, nil
-}
-
-// getServiceNetworkCIDR returns the service network CIDR from the cluster network object
-func getServiceNetworkCIDR() (string, error) {
-	// Get the cluster network object so that we can find the service network CIDR
+// getServiceNetworkCIDRs returns the service network CIDRs from the cluster network object
+func getServiceNetworkCIDRs() ([]string, error) {
+	// Get the cluster network object so that we can find the service network CIDRs
 	networkCR, err := framework.OSConfigClient.ConfigV1().Networks().Get(context.TODO(), "cluster", metav1.GetOptions{})
 	if err != nil {
-		return "", fmt.Errorf("error getting cluster network object: %v", err)
-	}
-
-	if len(networkCR.Spec.ServiceNetwork) != 1 {
-		return "", fmt.Errorf("expected one service network but got %d", len(networkCR.Spec.ServiceNetwork))
-	}
-
-	return networkCR.Spec.ServiceNetwork[0], nil
-}
-
-// generateCNIConf generates the cni.conf file, based on the input OVN host subnet and service network CIDR, and
-// returns the its path
-func generateCNIConf(ovnHostSubnet, serviceNetworkCIDR string) (string, error) {
-	// cniConf is used in replacing the template values in templates/cni.template
-	type cniConf struct {
-		OvnHostSubnet      string
-		ServiceNetworkCIDR string
-	}
-	confData := cniConf{ovnHostSubnet, serviceNetworkCIDR}
-
-	// Read the contents of the template file
-	content, err := ioutil.ReadFile(cniConfigTemplate)
-	if err != nil {
-		return "", fmt.Errorf("error reading CNI config template: %v", err)
-	}
-
-	cniConfTmpl := template.New("CNI")
-
-	// Parse the template
-	cniConfTmpl, err = cniConfTmpl.Parse(string(content))
-	if err != nil {
-		return "", fmt.Errorf("error parsing CNI config template: %v", err)
-	}
-
-	// Create a temp file to hold the config
-	tmpCniDir, err := ioutil.TempDir("", "cni")
-	if err != nil {
-		return "", fmt.Errorf("error creating local temp CNI directory: %v", err)
-	}
-
-	cniConfigPath, err := os.Create(filepath.Join(tmpCniDir, "cni.conf"))
-	if err != nil {
-		return "", fmt.Errorf("error creating local cni.conf: %v", err)
-	}
-
-	// Take the data values, replace it in the template and write the result out to a file
-	if err = cniConfTmpl.Execute(cniConfigPath, confData); err != nil {
-		return "", fmt.Errorf("error applying data to CNI config template: %v", err)
+		return nil, fmt.Errorf("error getting cluster network object: %v", err)
 	}
 
-	if err = cniConfigPath.Close(); err != nil {
-		return "", fmt.Errorf("error closing %s: %v", cniConfigPath.Name(), err)
+	if len(networkCR.Spec.ServiceNetwork) == 0 {
+		return nil, fmt.Errorf("no service network found")
 	}
 
-	return cniConfigPath.Name(), nil
+	return networkCR.Spec.ServiceNetwork, nil
 }
 
 // waitForHybridOverlayAnnotation waits for the hybrid overlay subnet annotation to be present on the node until the
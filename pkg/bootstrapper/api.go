@@ -0,0 +1,384 @@
+package bootstrapper
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/go-logr/logr"
+	"golang.org/x/sys/windows/svc"
+	crlog "sigs.k8s.io/controller-runtime/pkg/log"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/cniconf"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/config"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/csiproxy"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/nodecerts"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/preflight"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/progress"
+)
+
+// Bootstrapper bootstraps a Windows node so that it can join the cluster as a worker. It is what the wmcb commands are
+// built on, and can be embedded by other tools instead of running wmcb.exe. A Bootstrapper holds a connection to the
+// Windows service manager, which must be released with Disconnect. Cancelling the context given to an operation stops
+// it at the next point where the node is in a consistent state.
+type Bootstrapper interface {
+	// InitializeKubelet installs the kubelet files from the ignition and creates and starts the kubelet service. With
+	// WithReconcile, only the differences between the desired and the actual state of the node are applied.
+	InitializeKubelet(ctx context.Context) error
+	// ConfigureCNI installs the CNI binaries and config given with WithCNI or WithCNIOverlay and restarts the kubelet
+	// with the CNI arguments. With WithReconcile, the kubelet is only restarted if something has changed.
+	ConfigureCNI(ctx context.Context) error
+	// ConfigureCSI installs csi-proxy, given with WithCSI, as a Windows service and prepares the kubelet for the CSI node
+	// plugins. csi-proxy and the kubelet are only restarted if something has changed.
+	ConfigureCSI(ctx context.Context) error
+	// UpgradeKubelet replaces the installed kubelet with the given binary, which must match the given sha256 digest
+	UpgradeKubelet(ctx context.Context, kubeletPath, digest string) error
+	// Status reports the state of the kubelet service, of its CNI configuration and of its certificates
+	Status(ctx context.Context) (Status, error)
+	// CheckCertificates reports the kubelet certificates that are missing, invalid, expired or expiring within
+	// warnBefore
+	CheckCertificates(ctx context.Context, warnBefore time.Duration) (nodecerts.Results, error)
+	// RotateBootstrapCredentials replaces the bootstrap kubeconfig and kubelet CA with the ones of the ignition and
+	// restarts the kubelet, optionally purging its client certificates so that it goes through its TLS bootstrap again
+	RotateBootstrapCredentials(ctx context.Context, purgeClientCerts bool) error
+	// Preflight checks that the node meets the requirements of the bootstrapper, expecting the kubelet to have the
+	// given version if it is not empty. The checks that fail or warn come with how to address them.
+	Preflight(ctx context.Context, kubeletVersion string) (preflight.Results, error)
+	// Progress reports the phases of the last InitializeKubelet or ConfigureCNI, and of the running one while it runs
+	Progress() progress.Report
+	// Uninstall stops and removes the kubelet service and the files installed by the bootstrapper. The logs and the
+	// kubelet certificates are kept.
+	Uninstall(ctx context.Context) error
+	// Disconnect releases the connection to the Windows service manager
+	Disconnect() error
+}
+
+// Status is the state of the kubelet installed by the bootstrapper
+type Status struct {
+	// KubeletInstalled is true if the kubelet service is present
+	KubeletInstalled bool `json:"kubeletInstalled"`
+	// KubeletState is the state of the kubelet service, such as Running or Stopped
+	KubeletState string `json:"kubeletState,omitempty"`
+	// KubeletHealthy is true if the kubelet healthz endpoint reports healthy
+	KubeletHealthy bool `json:"kubeletHealthy"`
+	// CNIConfigured is true if the kubelet service is run with the CNI network plugin
+	CNIConfigured bool `json:"cniConfigured"`
+	// CNIBinDir is the directory the kubelet looks for the CNI binaries in
+	CNIBinDir string `json:"cniBinDir,omitempty"`
+	// CNIConfDir is the directory the kubelet looks for the CNI config in
+	CNIConfDir string `json:"cniConfDir,omitempty"`
+	// Certificates are the kubelet client and serving certificates and the kubelet CA, checked against
+	// nodecerts.DefaultWarnBefore
+	Certificates nodecerts.Results `json:"certificates"`
+}
+
+// serviceStates maps the Windows service states to their names
+var serviceStates = map[svc.State]string{
+	svc.Stopped:         "Stopped",
+	svc.StartPending:    "StartPending",
+	svc.StopPending:     "StopPending",
+	svc.Running:         "Running",
+	svc.ContinuePending: "ContinuePending",
+	svc.PausePending:    "PausePending",
+	svc.Paused:          "Paused",
+}
+
+// options holds the settings a Bootstrapper is built from
+type options struct {
+	// cfg is the WMCB configuration
+	cfg config.Configuration
+	// installDir overrides the install directory of the configuration
+	installDir string
+	// ignitionFile is the path to the worker ignition file
+	ignitionFile string
+	// ignition holds the contents of the worker ignition file, taking precedence over ignitionFile
+	ignition []byte
+	// kubeletPath is the path to the kubelet binary installed by InitializeKubelet
+	kubeletPath string
+	// cniDir is the directory holding the CNI binaries
+	cniDir string
+	// cniConfig is the path to the CNI config file
+	cniConfig string
+	// cniNetwork holds the parameters the CNI config is rendered from, instead of being read from cniConfig
+	cniNetwork *cniconf.Overlay
+	// cniManifest is the path to the manifest the CNI binaries are verified against, if any
+	cniManifest string
+	// csiProxyPath is the path to the csi-proxy binary installed by ConfigureCSI
+	csiProxyPath string
+	// kubeletRootDir is the directory the kubelet keeps its state in, where the CSI plugin directories are created
+	kubeletRootDir string
+	// csiAPIVersions are the csi-proxy API versions the CSI node plugins of the node use
+	csiAPIVersions csiproxy.APIVersions
+	// reconcile applies only the differences between the desired and the actual state of the node
+	reconcile bool
+	// progressFile is where the progress of InitializeKubelet and ConfigureCNI is written, if anywhere
+	progressFile string
+	// log receives the progress of the bootstrapper
+	log logr.Logger
+	// svcMgr is the connection to the Windows service manager. A connection is established if it is nil.
+	svcMgr ServiceManager
+}
+
+// Option configures a Bootstrapper
+type Option func(*options)
+
+// WithConfiguration sets the WMCB configuration. The default configuration is used otherwise.
+func WithConfiguration(cfg config.Configuration) Option {
+	return func(o *options) {
+		o.cfg = cfg
+	}
+}
+
+// WithInstallDir sets the directory the kubelet and its files are installed to, taking precedence over the install
+// directory of the configuration
+func WithInstallDir(dir string) Option {
+	return func(o *options) {
+		o.installDir = dir
+	}
+}
+
+// WithIgnitionFile sets the worker ignition file the kubelet files are read from
+func WithIgnitionFile(path string) Option {
+	return func(o *options) {
+		o.ignitionFile = path
+	}
+}
+
+// WithIgnition sets the contents of the worker ignition file the kubelet files are read from, such as an ignition
+// fetched from the Machine Config Server. It takes precedence over WithIgnitionFile.
+func WithIgnition(contents []byte) Option {
+	return func(o *options) {
+		o.ignition = contents
+	}
+}
+
+// WithKubeletPath sets the kubelet binary installed by InitializeKubelet
+func WithKubeletPath(path string) Option {
+	return func(o *options) {
+		o.kubeletPath = path
+	}
+}
+
+// WithCNI sets the directory holding the CNI binaries and the CNI config file installed by ConfigureCNI
+func WithCNI(dir, config string) Option {
+	return func(o *options) {
+		o.cniDir = dir
+		o.cniConfig = config
+	}
+}
+
+// WithCNIOverlay sets the directory holding the CNI binaries, and the parameters of the OVN hybrid overlay network the
+// win-overlay config installed by ConfigureCNI is rendered from. It cannot be combined with a config file given with
+// WithCNI.
+func WithCNIOverlay(dir string, network cniconf.Overlay) Option {
+	return func(o *options) {
+		o.cniDir = dir
+		o.cniNetwork = &network
+	}
+}
+
+// WithCNIManifest sets the manifest listing the sha256 digests of the CNI binaries given with WithCNI or
+// WithCNIOverlay. The binaries are verified against it before anything is installed.
+func WithCNIManifest(path string) Option {
+	return func(o *options) {
+		o.cniManifest = path
+	}
+}
+
+// WithCSI sets the csi-proxy binary installed by ConfigureCSI, the kubelet root dir the CSI plugin directories are
+// created in, and the csi-proxy API versions the CSI node plugins of the node use. The default kubelet root dir and API
+// versions are used if they are empty.
+func WithCSI(proxyPath, kubeletRootDir string, apiVersions csiproxy.APIVersions) Option {
+	return func(o *options) {
+		o.csiProxyPath = proxyPath
+		o.kubeletRootDir = kubeletRootDir
+		o.csiAPIVersions = apiVersions
+	}
+}
+
+// WithReconcile makes InitializeKubelet and ConfigureCNI apply only the differences between the desired and the actual
+// state of the node, instead of recreating the kubelet service
+func WithReconcile(reconcile bool) Option {
+	return func(o *options) {
+		o.reconcile = reconcile
+	}
+}
+
+// WithProgressFile sets the file the phases of InitializeKubelet and ConfigureCNI are written to as they run, as the
+// JSON encoded progress.Report, so that they can be followed while the bootstrap runs. The file is replaced rather than
+// rewritten, and its directory has to exist.
+func WithProgressFile(path string) Option {
+	return func(o *options) {
+		o.progressFile = path
+	}
+}
+
+// WithLogger sets the logger receiving the progress of the bootstrapper. Nothing is logged otherwise.
+func WithLogger(log logr.Logger) Option {
+	return func(o *options) {
+		o.log = log
+	}
+}
+
+// WithServiceManager sets the connection to the Windows service manager. The connection stays owned by the caller and
+// is not closed by Disconnect.
+func WithServiceManager(svcMgr ServiceManager) Option {
+	return func(o *options) {
+		o.svcMgr = svcMgr
+	}
+}
+
+// newOptions returns the default options with the given options applied
+func newOptions(opts ...Option) options {
+	o := options{cfg: config.Default(), log: crlog.NullLogger{}}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.installDir != "" {
+		o.cfg.InstallDir = o.installDir
+	}
+	return o
+}
+
+// New returns a Bootstrapper built with the given options. An InvalidInputError is returned if the options are not
+// valid.
+func New(opts ...Option) (Bootstrapper, error) {
+	wmcb, err := newWinNodeBootstrapper(newOptions(opts...))
+	if err != nil {
+		return nil, err
+	}
+	return wmcb, nil
+}
+
+// InitializeKubelet performs the initial kubelet configuration, or reconciles it when the bootstrapper was built with
+// WithReconcile
+func (wmcb *winNodeBootstrapper) InitializeKubelet(ctx context.Context) error {
+	if wmcb.reconcile {
+		wmcb.log.Info("reconciling kubelet", "installDir", wmcb.installDir)
+		wmcb.progress = progress.NewRecorder("reconcile-kubelet", wmcb.log, wmcb.progressFile)
+		return wmcb.progress.Finish(wmcb.reconcileKubelet(ctx))
+	}
+	wmcb.log.Info("initializing kubelet", "installDir", wmcb.installDir)
+	wmcb.progress = progress.NewRecorder("initialize-kubelet", wmcb.log, wmcb.progressFile)
+	return wmcb.progress.Finish(wmcb.initializeKubelet(ctx))
+}
+
+// ConfigureCNI performs the CNI configuration, or reconciles it when the bootstrapper was built with WithReconcile
+func (wmcb *winNodeBootstrapper) ConfigureCNI(ctx context.Context) error {
+	if wmcb.cni == nil {
+		return &InvalidInputError{Err: fmt.Errorf("cannot configure without required plugin inputs")}
+	}
+	if wmcb.reconcile {
+		wmcb.log.Info("reconciling CNI", "dir", wmcb.cni.dir, "config", wmcb.cni.configFile().path)
+		wmcb.progress = progress.NewRecorder("reconcile-cni", wmcb.log, wmcb.progressFile)
+		return wmcb.progress.Finish(wmcb.reconcileCNI(ctx))
+	}
+	wmcb.log.Info("configuring CNI", "dir", wmcb.cni.dir, "config", wmcb.cni.configFile().path)
+	wmcb.progress = progress.NewRecorder("configure-cni", wmcb.log, wmcb.progressFile)
+	return wmcb.progress.Finish(wmcb.configure(ctx))
+}
+
+// Progress reports the phases of the last InitializeKubelet or ConfigureCNI. The report is empty if neither has run.
+func (wmcb *winNodeBootstrapper) Progress() progress.Report {
+	return wmcb.progress.Report()
+}
+
+// ConfigureCSI installs csi-proxy and prepares the kubelet for the CSI node plugins
+func (wmcb *winNodeBootstrapper) ConfigureCSI(ctx context.Context) error {
+	if wmcb.csi == nil {
+		return &InvalidInputError{Err: fmt.Errorf("cannot configure CSI without the csi-proxy binary")}
+	}
+	wmcb.log.Info("configuring CSI", "proxyPath", wmcb.csi.proxyPath, "kubeletRootDir", wmcb.csi.kubeletRootDir)
+	return wmcb.configureCSI(ctx)
+}
+
+// UpgradeKubelet replaces the installed kubelet with the given binary
+func (wmcb *winNodeBootstrapper) UpgradeKubelet(ctx context.Context, kubeletPath, digest string) error {
+	wmcb.log.Info("upgrading kubelet", "kubeletPath", kubeletPath)
+	return wmcb.upgradeKubelet(ctx, kubeletPath, digest)
+}
+
+// Status reports the state of the kubelet service, of its CNI configuration and of its certificates. The kubelet is
+// reported as not installed if its service is not present.
+func (wmcb *winNodeBootstrapper) Status(ctx context.Context) (Status, error) {
+	certs, err := wmcb.CheckCertificates(ctx, nodecerts.DefaultWarnBefore)
+	if err != nil {
+		return Status{}, err
+	}
+	if wmcb.kubeletSVC == nil {
+		return Status{Certificates: certs}, nil
+	}
+
+	status := Status{KubeletInstalled: true, Certificates: certs}
+	svcStatus, err := wmcb.kubeletSVC.obj.Query()
+	if err != nil {
+		return Status{}, kubeletServiceError("query", err)
+	}
+	status.KubeletState = serviceStates[svcStatus.State]
+	if svcStatus.State == svc.Running {
+		status.KubeletHealthy = wmcb.kubeletHealthy(ctx)
+	}
+
+	serviceConfig, err := wmcb.kubeletSVC.config()
+	if err != nil {
+		return Status{}, kubeletServiceError("query", err)
+	}
+	args, err := deconstructKubeletCmd(&serviceConfig.BinaryPathName)
+	if err != nil {
+		return Status{}, fmt.Errorf("unable to deconstruct kubelet command %s: %v", serviceConfig.BinaryPathName, err)
+	}
+	status.CNIConfigured = args[networkPluginOption] == networkPluginValue
+	status.CNIBinDir = args[cniBinDirOption]
+	status.CNIConfDir = args[cniConfDirOption]
+	return status, nil
+}
+
+// CheckCertificates reads the kubelet client and serving certificates from the certificate directory and the kubelet
+// CA from the install directory, and reports the ones that are missing, invalid, expired or expiring within warnBefore
+func (wmcb *winNodeBootstrapper) CheckCertificates(ctx context.Context, warnBefore time.Duration) (nodecerts.Results,
+	error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return nodecerts.Check(nodecerts.Inspect(wmcb.certDir, wmcb.installDir), time.Now(), warnBefore), nil
+}
+
+// Uninstall stops and removes the kubelet and csi-proxy services, and removes the kubelet binary, its configuration,
+// kubeconfigs and CA, the CNI binaries and config, and the csi-proxy binary from the install directory. Uninstalling a
+// node without a kubelet service removes the remaining files.
+func (wmcb *winNodeBootstrapper) Uninstall(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	wmcb.log.Info("uninstalling kubelet", "installDir", wmcb.installDir)
+	if wmcb.kubeletSVC != nil {
+		if err := wmcb.kubeletSVC.stopAndRemove(ctx); err != nil {
+			return kubeletServiceError("remove", err)
+		}
+		if err := wmcb.kubeletSVC.disconnect(); err != nil {
+			return kubeletServiceError("close", err)
+		}
+		wmcb.kubeletSVC = nil
+	}
+	if err := wmcb.removeCSIProxy(ctx); err != nil {
+		return err
+	}
+
+	paths := []string{
+		filepath.Join(wmcb.installDir, "kubelet.exe"),
+		wmcb.kubeletConfPath,
+		wmcb.kubeconfigPath,
+		filepath.Join(wmcb.installDir, "bootstrap-kubeconfig"),
+		filepath.Join(wmcb.installDir, "kubelet-ca.crt"),
+		cniBinDir(wmcb.installDir),
+		filepath.Join(wmcb.installDir, csiProxyExe),
+	}
+	for _, path := range paths {
+		if err := os.RemoveAll(path); err != nil {
+			return fmt.Errorf("unable to remove %s: %v", path, err)
+		}
+	}
+	return nil
+}
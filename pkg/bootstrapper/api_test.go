@@ -0,0 +1,116 @@
+package bootstrapper
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/config"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/csiproxy"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/nodecerts"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/osinfo"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/preflight"
+)
+
+// TestStatus tests that Status reports the state of the kubelet service, its CNI arguments and its certificates
+func TestStatus(t *testing.T) {
+	installDir, err := ioutil.TempDir("", "wmcb")
+	require.NoError(t, err, "error creating temp directory")
+	// Ignore the return error as there is not much we can do if the temporary directory is not deleted
+	defer os.RemoveAll(installDir)
+	cfg := config.Default()
+	cfg.InstallDir = installDir
+	cfg.CertDirectory = installDir
+
+	ctx := context.Background()
+	wmcb, err := New(WithServiceManager(newFakeServiceManager()), WithConfiguration(cfg))
+	require.NoError(t, err, "error instantiating bootstrapper")
+	status, err := wmcb.Status(ctx)
+	require.NoError(t, err)
+	require.Len(t, status.Certificates, 3)
+	for _, cert := range status.Certificates {
+		assert.Equal(t, nodecerts.StatusMissing, cert.Status, cert.Name)
+	}
+	status.Certificates = nil
+	assert.Equal(t, Status{}, status, "kubelet reported without a kubelet service")
+
+	kubelet := &fakeService{serviceName: KubeletServiceName, state: svc.Stopped, config: mgr.Config{
+		BinaryPathName: "C:\\k\\kubelet.exe --windows-service --network-plugin=cni --cni-bin-dir=C:\\k\\cni " +
+			"--cni-conf-dir=C:\\k\\cni\\config",
+	}}
+	wmcb, err = New(WithServiceManager(newFakeServiceManager(kubelet)), WithConfiguration(cfg))
+	require.NoError(t, err, "error instantiating bootstrapper")
+	status, err = wmcb.Status(ctx)
+	require.NoError(t, err)
+	status.Certificates = nil
+	assert.Equal(t, Status{KubeletInstalled: true, KubeletState: "Stopped", CNIConfigured: true,
+		CNIBinDir: "C:\\k\\cni", CNIConfDir: "C:\\k\\cni\\config"}, status)
+}
+
+// TestUninstall tests that Uninstall removes the kubelet service and the installed files, but keeps the logs
+func TestUninstall(t *testing.T) {
+	installDir, err := ioutil.TempDir("", "wmcb")
+	require.NoError(t, err, "error creating temp directory")
+	// Ignore the return error as there is not much we can do if the temporary directory is not deleted
+	defer os.RemoveAll(installDir)
+
+	installed := []string{"kubelet.exe", "kubelet.conf", "kubeconfig", "bootstrap-kubeconfig", "kubelet-ca.crt",
+		filepath.Join("cni", "win-overlay.exe"), csiProxyExe}
+	require.NoError(t, os.MkdirAll(filepath.Join(installDir, "cni"), 0755))
+	require.NoError(t, os.MkdirAll(filepath.Join(installDir, "log"), 0755))
+	for _, name := range append(installed, filepath.Join("log", "kubelet.log")) {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(installDir, name), []byte(name), 0644))
+	}
+
+	kubelet := &fakeService{serviceName: KubeletServiceName, state: svc.Running}
+	proxy := &fakeService{serviceName: csiproxy.ServiceName, state: svc.Running}
+	wmcb, err := New(WithServiceManager(newFakeServiceManager(kubelet, proxy)), WithInstallDir(installDir))
+	require.NoError(t, err, "error instantiating bootstrapper")
+	require.NoError(t, wmcb.Uninstall(context.Background()))
+
+	assert.True(t, kubelet.deleted, "kubelet service was not deleted")
+	assert.Equal(t, svc.Stopped, kubelet.state, "kubelet service was not stopped")
+	assert.True(t, proxy.deleted, "csi-proxy service was not deleted")
+	assert.Equal(t, svc.Stopped, proxy.state, "csi-proxy service was not stopped")
+	for _, name := range installed {
+		assert.NoFileExists(t, filepath.Join(installDir, name))
+	}
+	assert.FileExists(t, filepath.Join(installDir, "log", "kubelet.log"))
+
+	err = wmcb.UpgradeKubelet(context.Background(), filepath.Join(installDir, "kubelet.exe"), "")
+	var serviceErr *ServiceError
+	require.True(t, errors.As(err, &serviceErr), "error is not a ServiceError")
+	assert.True(t, serviceErr.NotInstalled(), "kubelet service reported as present after uninstalling")
+}
+
+// TestPreflight tests that Preflight checks the container runtime service known to the service manager
+func TestPreflight(t *testing.T) {
+	installDir, err := ioutil.TempDir("", "wmcb")
+	require.NoError(t, err, "error creating temp directory")
+	// Ignore the return error as there is not much we can do if the temporary directory is not deleted
+	defer os.RemoveAll(installDir)
+
+	docker := &fakeService{serviceName: "docker", state: svc.Stopped}
+	wmcb, err := newWinNodeBootstrapper(newOptions(WithServiceManager(newFakeServiceManager(docker)),
+		WithInstallDir(installDir)))
+	require.NoError(t, err, "error instantiating bootstrapper")
+	wmcb.osInfo = osinfo.Static{Build: 17763}
+
+	results, err := wmcb.Preflight(context.Background(), "")
+	require.NoError(t, err)
+	assert.True(t, results.Failed(), "stopped container runtime not reported")
+	for _, result := range results {
+		if result.Name == "container-runtime" {
+			assert.Equal(t, preflight.StatusFail, result.Status)
+			assert.Contains(t, result.Message, "docker service is not running")
+		}
+	}
+}
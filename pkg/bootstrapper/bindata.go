@@ -1,6 +1,7 @@
 // Code generated by go-bindata. (@generated) DO NOT EDIT.
 
  //Package bootstrapper generated by go-bindata.// sources:
+// pkg/bootstrapper/templates/containerd_config.toml
 // pkg/bootstrapper/templates/kubelet_config.json
 package bootstrapper
 
@@ -54,7 +55,53 @@ func (fi bindataFileInfo) Sys() interface{} {
 	return nil
 }
 
-var _templatesKubelet_configJson = []byte(`{"kind":"KubeletConfiguration","apiVersion":"kubelet.config.k8s.io/v1beta1","rotateCertificates":true,"serverTLSBootstrap":true,"authentication":{"x509":{"clientCAFile":"{{.ClientCAFile}} "},"anonymous":{"enabled":false}},"clusterDomain":"cluster.local","clusterDNS":["172.30.0.10"],"cgroupsPerQOS":false,"runtimeRequestTimeout":"10m0s","maxPods":250,"kubeAPIQPS":50,"kubeAPIBurst":100,"serializeImagePulls":false,"featureGates":{"LegacyNodeRoleBehavior":false,"NodeDisruptionExclusion":true,"RotateKubeletServerCertificate":true,"SCTPSupport":true,"ServiceNodeExclusion":true,"SupportPodPidsLimit":true},"containerLogMaxSize":"50Mi","systemReserved":{"cpu":"500m","ephemeral-storage":"1Gi","memory":"1Gi"},"enforceNodeAllocatable":[]}`)
+var _templatesContainerd_configToml = []byte(`version = 2
+root = '{{.DataRoot}}'
+state = 'C:\ProgramData\containerd\state'
+
+[grpc]
+  address = '\\.\pipe\containerd-containerd'
+
+[plugins]
+  [plugins."io.containerd.grpc.v1.cri"]
+    sandbox_image = '{{.PauseImage}}'
+    [plugins."io.containerd.grpc.v1.cri".containerd]
+      snapshotter = "windows"
+      default_runtime_name = "runhcs-wcow-process"
+      [plugins."io.containerd.grpc.v1.cri".containerd.runtimes.runhcs-wcow-process]
+        runtime_type = "io.containerd.runhcs.v1"
+    [plugins."io.containerd.grpc.v1.cri".cni]
+      bin_dir = '{{.CNIBinDir}}'
+      conf_dir = '{{.CNIConfDir}}'
+{{- if or .Registries.Mirrors .Registries.InsecureHosts}}
+    [plugins."io.containerd.grpc.v1.cri".registry]
+{{- range .Registries.Mirrors}}
+      [plugins."io.containerd.grpc.v1.cri".registry.mirrors."{{.Source}}"]
+        endpoint = [{{range $i, $endpoint := .Endpoints}}{{if $i}}, {{end}}'{{$endpoint}}'{{end}}]
+{{- end}}
+{{- range .Registries.InsecureHosts}}
+      [plugins."io.containerd.grpc.v1.cri".registry.configs."{{.}}".tls]
+        insecure_skip_verify = true
+{{- end}}
+{{- end}}
+`)
+
+func templatesContainerd_configTomlBytes() ([]byte, error) {
+	return _templatesContainerd_configToml, nil
+}
+
+func templatesContainerd_configToml() (*asset, error) {
+	bytes, err := templatesContainerd_configTomlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "templates/containerd_config.toml", size: 0, mode: os.FileMode(0), modTime: time.Unix(0, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var _templatesKubelet_configJson = []byte(`{"kind":"KubeletConfiguration","apiVersion":"kubelet.config.k8s.io/v1beta1","rotateCertificates":true,"serverTLSBootstrap":true,"authentication":{"x509":{"clientCAFile":"{{.ClientCAFile}} "},"anonymous":{"enabled":false}},"clusterDomain":"cluster.local","clusterDNS":{{.ClusterDNS}},"cgroupsPerQOS":false,"runtimeRequestTimeout":"10m0s","maxPods":250,"kubeAPIQPS":50,"kubeAPIBurst":100,"serializeImagePulls":false,"featureGates":{"LegacyNodeRoleBehavior":false,"NodeDisruptionExclusion":true,"RotateKubeletServerCertificate":true,"SCTPSupport":true,"ServiceNodeExclusion":true,"SupportPodPidsLimit":true{{if .DualStack}},"IPv6DualStack":true{{end}}},"containerLogMaxSize":"{{.ContainerLogMaxSize}}","containerLogMaxFiles":{{.ContainerLogMaxFiles}},"systemReserved":{{.SystemReserved}}{{if .KubeReserved}},"kubeReserved":{{.KubeReserved}}{{end}}{{if .EvictionHard}},"evictionHard":{{.EvictionHard}}{{end}},"enforceNodeAllocatable":[]}`)
 
 func templatesKubelet_configJsonBytes() ([]byte, error) {
 	return _templatesKubelet_configJson, nil
@@ -123,7 +170,8 @@ func AssetNames() []string {
 
 // _bindata is a table, holding each asset generator, mapped to its name.
 var _bindata = map[string]func() (*asset, error){
-	"templates/kubelet_config.json": templatesKubelet_configJson,
+	"templates/containerd_config.toml": templatesContainerd_configToml,
+	"templates/kubelet_config.json":    templatesKubelet_configJson,
 }
 
 // AssetDir returns the file names below a certain
@@ -168,7 +216,8 @@ type bintree struct {
 
 var _bintree = &bintree{nil, map[string]*bintree{
 	"templates": &bintree{nil, map[string]*bintree{
-		"kubelet_config.json": &bintree{templatesKubelet_configJson, map[string]*bintree{}},
+		"containerd_config.toml": &bintree{templatesContainerd_configToml, map[string]*bintree{}},
+		"kubelet_config.json":    &bintree{templatesKubelet_configJson, map[string]*bintree{}},
 	}},
 }}
 
@@ -1,25 +1,35 @@
 package bootstrapper
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
 	"text/template"
 	"time"
 
-	ignitionCfgv24tov31 "github.com/coreos/ign-converter/translate/v24tov31"
-	ignitionCfgv2_4 "github.com/coreos/ignition/config/v2_4"
-	ignitionCfgv2_4Types "github.com/coreos/ignition/config/v2_4/types"
-	ignitionCfgError "github.com/coreos/ignition/v2/config/shared/errors"
-	ignitionCfgv3 "github.com/coreos/ignition/v2/config/v3_1"
-	ignitionCfgv3Types "github.com/coreos/ignition/v2/config/v3_1/types"
-	"github.com/pkg/errors"
+	"github.com/go-logr/logr"
 	"github.com/vincent-petithory/dataurl"
 	"golang.org/x/sys/windows/svc/mgr"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/cniconf"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/config"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/fileutil"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/ignition"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/nodeidentity"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/nodesizing"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/osinfo"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/platform"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/progress"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/runtimeconf"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/timesync"
 )
 
 /*
@@ -41,31 +51,6 @@ const (
 	// kubeletSystemdName is the name of the systemd service that the kubelet runs under,
 	// this is used to parse the kubelet args
 	kubeletSystemdName = "kubelet.service"
-	// kubeletPauseContainerImage is the location of the image we will use for the kubelet pause container
-	kubeletPauseContainerImage = "mcr.microsoft.com/oss/kubernetes/pause:1.3.0"
-	// serviceWaitTime is amount of wait time required for the Windows service API to complete stop requests
-	serviceWaitTime = time.Second * 20
-	// certDirectory is where the kubelet will look for certificates
-	certDirectory = "c:\\var\\lib\\kubelet\\pki\\"
-	// cloudConfigOption is kubelet CLI option for cloud configuration
-	cloudConfigOption = "cloud-config"
-	// windowsTaints defines the taints that need to be applied on the Windows nodes.
-	/*
-			TODO: As of now, this is limited to os=Windows, so every Windows pod in
-			OpenShift cluster should have a toleration for this.
-			Example toleration in the pod spec:
-			tolerations:
-			  - key: "os"
-		      	operator: "Equal"
-		      	value: "Windows"
-		      	effect: "NoSchedule"
-	*/
-	windowsTaints = "os=Windows:NoSchedule"
-	// nodeLabel contains the os specific label that will be applied to the Windows node object. This can be used to
-	// identify the nodes managed by WSU and future operators. (We could have gotten this from boostrap kubeconfig too
-	// however the label value is resolved on the host side, making it convenient when we run WMCB within a container)
-	nodeLabel = "node.openshift.io/os_id=Windows"
-
 	// kubeletExeKey is the map key used for the kubelet.exe in the deconstructed kubelet map
 	kubeletExeKey = "kubeletexe"
 	// kubeletStandAloneArgsKey is the map key used for standalone kubelet args like --windows-service in the
@@ -95,13 +80,6 @@ const (
 
 // These regex are global, so that we only need to compile them once
 var (
-	// cloudProviderRegex searches for the cloud provider option given to the kubelet
-	cloudProviderRegex = regexp.MustCompile(`--cloud-provider=(\w*)`)
-
-	// cloudConfigRegex searches for the cloud config option given to the kubelet. We are assuming that the file has a
-	// conf extension.
-	cloudConfigRegex = regexp.MustCompile(`--` + cloudConfigOption + `=(\/.*conf)`)
-
 	// verbosityRegex searches for the verbosity option given to the kubelet
 	verbosityRegex = regexp.MustCompile(`--v=(\w*)`)
 )
@@ -115,22 +93,96 @@ type winNodeBootstrapper struct {
 	// ignitionFilePath is the path to the ignition file which is used to set up worker nodes
 	// https://github.com/coreos/ignition/blob/spec2x/doc/getting-started.md
 	ignitionFilePath string
+	// ignitionContents holds the contents of the ignition file. It takes precedence over ignitionFilePath.
+	ignitionContents []byte
 	//initialKubeletPath is the path to the kubelet that we'll be using to bootstrap this node
 	initialKubeletPath string
 	// TODO: When more services are added consider decomposing the services to a separate Service struct with common functions
 	// kubeletSVC is a pointer to the kubeletService struct
 	kubeletSVC *kubeletService
 	// svcMgr is used to interact with the Windows service API
-	svcMgr *mgr.Mgr
+	svcMgr ServiceManager
 	// installDir is the directory the the kubelet service will be installed
 	installDir string
 	// logDir is the directory that captures log outputs of Kubelet
 	// TODO: make this directory available in Artifacts
 	logDir string
+	// certDir is where the kubelet keeps its certificates
+	certDir string
+	// taints are registered with the node
+	taints []config.Taint
+	// labels are registered with the node
+	labels map[string]string
+	// ignitionTaints are the taints of the kubelet unit of the ignition
+	ignitionTaints []config.Taint
+	// ignitionLabels are the labels of the kubelet unit of the ignition
+	ignitionLabels map[string]string
+	// windowsLabels are the labels describing the Windows version of the host
+	windowsLabels map[string]string
+	// serviceWaitTime is how long to wait for the Windows service API to complete a stop request
+	serviceWaitTime time.Duration
+	// recoveryPolicy is what the Windows service manager does when the kubelet service fails
+	recoveryPolicy config.RecoveryPolicy
 	// kubeletArgs is a map of the variable arguments that will be passed to the kubelet
 	kubeletArgs map[string]string
 	// cni holds all the CNI specific information
 	cni *cniOptions
+	// csi holds all the CSI specific information
+	csi *csiOptions
+	// kubeletHealthCheck holds the settings used to verify the kubelet is healthy after it has been started
+	kubeletHealthCheck kubeletHealthCheck
+	// containerRuntime is the container runtime used by the kubelet, either docker or containerd
+	containerRuntime string
+	// containerdConfigPath is where the containerd config.toml is written when the container runtime is containerd
+	containerdConfigPath string
+	// dockerConfigPath is where the docker daemon.json is written when the container runtime is docker. The docker
+	// daemon.json is left alone if it is empty.
+	dockerConfigPath string
+	// runtime configures the container log rotation, the data root and the registries of the container runtime
+	runtime runtimeconf.Options
+	// pauseImage is the image used for the pod sandbox. It is picked based on the host Windows build unless it was
+	// overridden.
+	pauseImage string
+	// pauseImageManifest is the manifest mapping Windows builds to pause images. The default manifest is used if it is
+	// empty.
+	pauseImageManifest string
+	// pauseImageArchive is a tarball of the pause image that is loaded into the container runtime before the kubelet is
+	// started, so that the pause image does not need to be pulled
+	pauseImageArchive string
+	// osInfo provides the Windows version of the host
+	osInfo osinfo.Provider
+	// sizing configures how much of the node resources are reserved for the system and Kubernetes components
+	sizing nodesizing.Options
+	// sizingHost provides the capacity of the node the reservation is computed from
+	sizingHost nodesizing.Host
+	// nodeIdentity selects the IP address and hostname the node registers with
+	nodeIdentity nodeidentity.Options
+	// identityResolver determines the node identity from the network interfaces and the instance metadata
+	identityResolver nodeidentity.Resolver
+	// identity is the resolved node IP and hostname passed to the kubelet
+	identity nodeidentity.Identity
+	// progressFile is where the progress of InitializeKubelet and ConfigureCNI is written, if anywhere
+	progressFile string
+	// progress records the phases of the running InitializeKubelet or ConfigureCNI. Phases are run without being
+	// recorded if it is nil.
+	progress *progress.Recorder
+	// timeHost reads and writes the configuration of the Windows time service
+	timeHost timesync.Host
+	// timePlan is the time service configuration taken from the chrony config of the ignition, if any
+	timePlan *timesync.Plan
+	// clusterDNS are the IP addresses of the cluster DNS service, an address per IP family on dual-stack clusters
+	clusterDNS []string
+	// apiServerOverride replaces the API server address of the bootstrap kubeconfig if it is not empty
+	apiServerOverride string
+	// probeAPIServer makes the bootstrap fail if the API server does not report ready with the bootstrap kubeconfig
+	probeAPIServer bool
+	// reconcile applies only the differences between the desired and the actual state of the node
+	reconcile bool
+	// log receives the progress of the bootstrapper
+	log logr.Logger
+	// ownsSvcMgr is true if the connection to the Windows service manager was established by the bootstrapper, and
+	// should be closed by it
+	ownsSvcMgr bool
 }
 
 // cniOptions is responsible for reconfiguring the kubelet service with CNI configuration
@@ -141,51 +193,115 @@ type cniOptions struct {
 	dir string
 	// config is the input CNI configuration file
 	config string
+	// rendered is the CNI configuration rendered from the network parameters, which is installed instead of config
+	rendered []byte
 	// binDir is the directory where the CNI binaries will be placed
 	binDir string
 	// confDir is the directory where the CNI config will be placed
 	confDir string
 }
 
-// NewWinNodeBootstrapper takes the dir to install the kubelet to, and paths to the ignition and kubelet files along
-// with the CNI options as inputs, and generates the winNodeBootstrapper object. The CNI options are populated only in
-// the configure-cni command.
-func NewWinNodeBootstrapper(k8sInstallDir, ignitionFile, kubeletPath string, cniDir string,
-	cniConfig string) (*winNodeBootstrapper, error) {
-	// Check if cniDir or cniConfig is empty when the other is not
-	if (cniDir == "" && cniConfig != "") || (cniDir != "" && cniConfig == "") {
-		return nil, fmt.Errorf("both cniDir and cniConfig need to be populated")
+// newWinNodeBootstrapper generates the winNodeBootstrapper object from the given options. The CNI and CSI options are
+// only populated when configuring CNI and CSI.
+func newWinNodeBootstrapper(o options) (*winNodeBootstrapper, error) {
+	cfg := o.cfg
+	// Check if cniDir or cniConfig is empty when the other is not. The config is rendered instead when a CNI network is
+	// given.
+	if o.cniNetwork != nil {
+		if o.cniDir == "" || o.cniConfig != "" {
+			return nil, &InvalidInputError{Err: fmt.Errorf("a CNI network needs cniDir and cannot be combined " +
+				"with cniConfig")}
+		}
+	} else if (o.cniDir == "" && o.cniConfig != "") || (o.cniDir != "" && o.cniConfig == "") {
+		return nil, &InvalidInputError{Err: fmt.Errorf("both cniDir and cniConfig need to be populated")}
+	}
+	if o.cniManifest != "" && o.cniDir == "" {
+		return nil, &InvalidInputError{Err: fmt.Errorf("a CNI manifest needs cniDir")}
+	}
+	if o.csiProxyPath == "" && (o.kubeletRootDir != "" || o.csiAPIVersions != nil) {
+		return nil, &InvalidInputError{Err: fmt.Errorf("the kubelet root dir and CSI API versions need csiProxyPath")}
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, &InvalidInputError{Err: err}
 	}
 
-	svcMgr, err := mgr.Connect()
-	if err != nil {
-		return nil, fmt.Errorf("could not connect to Windows SCM: %s", err)
+	var err error
+	svcMgr := o.svcMgr
+	if svcMgr == nil {
+		if svcMgr, err = connectSCM(); err != nil {
+			return nil, fmt.Errorf("could not connect to Windows SCM: %s", err)
+		}
 	}
 	bootstrapper := winNodeBootstrapper{
-		kubeconfigPath:     filepath.Join(k8sInstallDir, "kubeconfig"),
-		kubeletConfPath:    filepath.Join(k8sInstallDir, "kubelet.conf"),
-		ignitionFilePath:   ignitionFile,
-		installDir:         k8sInstallDir,
-		logDir:             "C:\\var\\log\\kubelet",
-		initialKubeletPath: kubeletPath,
+		kubeconfigPath:     filepath.Join(cfg.InstallDir, "kubeconfig"),
+		kubeletConfPath:    filepath.Join(cfg.InstallDir, "kubelet.conf"),
+		ignitionFilePath:   o.ignitionFile,
+		ignitionContents:   o.ignition,
+		installDir:         cfg.InstallDir,
+		logDir:             cfg.LogDir,
+		certDir:            cfg.CertDirectory,
+		taints:             cfg.Taints,
+		labels:             cfg.Labels,
+		serviceWaitTime:    cfg.ServiceWaitTime,
+		recoveryPolicy:     cfg.RecoveryPolicy,
+		initialKubeletPath: o.kubeletPath,
 		svcMgr:             svcMgr,
 		kubeletArgs:        make(map[string]string),
+		kubeletHealthCheck: kubeletHealthCheck{
+			url:      kubeletHealthzURL,
+			timeout:  cfg.KubeletHealthTimeout,
+			interval: kubeletHealthInterval,
+		},
+		containerRuntime:     cfg.ContainerRuntime,
+		containerdConfigPath: cfg.ContainerdConfigPath,
+		dockerConfigPath:     cfg.DockerConfigPath,
+		runtime:              cfg.Runtime,
+		pauseImage:           cfg.PauseImage,
+		pauseImageManifest:   cfg.PauseImageManifest,
+		pauseImageArchive:    cfg.PauseImageArchive,
+		osInfo:               osinfo.Host{},
+		sizing:               cfg.Sizing,
+		sizingHost:           nodesizing.NodeHost{},
+		nodeIdentity:         cfg.NodeIdentity,
+		identityResolver:     nodeidentity.NewResolver(),
+		timeHost:             timesync.NodeHost{},
+		clusterDNS:           cfg.ClusterDNS,
+		apiServerOverride:    cfg.APIServerOverride,
+		probeAPIServer:       cfg.ProbeAPIServer,
+		progressFile:         o.progressFile,
+		reconcile:            o.reconcile,
+		log:                  o.log,
+		ownsSvcMgr:           o.svcMgr == nil,
 	}
 	// populate the CNI struct if CNI options are present
-	if cniDir != "" && cniConfig != "" {
-		bootstrapper.cni, err = newCNIOptions(k8sInstallDir, cniDir, cniConfig)
+	if o.cniDir != "" {
+		bootstrapper.cni, err = newCNIOptions(cfg.InstallDir, o.cniDir, o.cniConfig, o.cniNetwork)
+		if err != nil {
+			return nil, &InvalidInputError{Err: fmt.Errorf("could not initialize cniOptions: %v", err)}
+		}
+		if o.cniManifest != "" {
+			if err = bootstrapper.cni.verifyManifest(o.cniManifest); err != nil {
+				return nil, &InvalidInputError{Err: err}
+			}
+		}
+	}
+
+	// populate the CSI struct if CSI options are present
+	if o.csiProxyPath != "" {
+		bootstrapper.csi, err = newCSIOptions(cfg.InstallDir, cfg.LogDir, o.csiProxyPath, o.kubeletRootDir,
+			o.csiAPIVersions)
 		if err != nil {
-			return nil, fmt.Errorf("could not initialize cniOptions: %v", err)
+			return nil, &InvalidInputError{Err: fmt.Errorf("could not initialize csiOptions: %v", err)}
 		}
 	}
 
-	var dependents []*mgr.Service
+	var dependents []WindowsService
 	// If there is already a kubelet service running, find it
 	if ksvc, err := svcMgr.OpenService(KubeletServiceName); err == nil {
 		if dependentSvc, err := svcMgr.OpenService(kubeletDependentSvc); err == nil {
 			dependents = append(dependents, dependentSvc)
 		}
-		bootstrapper.kubeletSVC, err = newKubeletService(ksvc, dependents)
+		bootstrapper.kubeletSVC, err = newKubeletService(ksvc, dependents, cfg.ServiceWaitTime)
 		if err != nil {
 			return nil, fmt.Errorf("could not initialize struct kubeletService: %v", err)
 		}
@@ -194,19 +310,34 @@ func NewWinNodeBootstrapper(k8sInstallDir, ignitionFile, kubeletPath string, cni
 }
 
 // newCNIOptions takes the paths to the kubelet installation and the CNI files as input and returns the cniOptions
-// object
-func newCNIOptions(k8sInstallDir, dir, config string) (*cniOptions, error) {
-	if err := checkCNIInputs(k8sInstallDir, dir, config); err != nil {
-		return nil, err
-	}
-
-	return &cniOptions{
+// object. The CNI config is rendered from the given network instead of being read from config if it is not nil.
+func newCNIOptions(k8sInstallDir, dir, config string, network *cniconf.Overlay) (*cniOptions, error) {
+	cni := &cniOptions{
 		k8sInstallDir: k8sInstallDir,
 		dir:           dir,
 		config:        config,
-		binDir:        filepath.Join(k8sInstallDir, cniDirName),
-		confDir:       filepath.Join(k8sInstallDir, cniConfigDirName),
-	}, nil
+		binDir:        cniBinDir(k8sInstallDir),
+		confDir:       cniConfDir(k8sInstallDir),
+	}
+	if network == nil {
+		if err := checkCNIInputs(k8sInstallDir, dir, config); err != nil {
+			return nil, err
+		}
+		return cni, nil
+	}
+
+	rendered, err := network.Render()
+	if err != nil {
+		return nil, fmt.Errorf("error rendering CNI config: %v", err)
+	}
+	if err = checkCNIDirs(k8sInstallDir, dir); err != nil {
+		return nil, err
+	}
+	if err = validateCNIConfig(rendered, dir); err != nil {
+		return nil, err
+	}
+	cni.rendered = rendered
+	return cni, nil
 }
 
 // translationFunc is a function that takes a byte array and changes it for use on windows
@@ -222,12 +353,26 @@ type fileTranslation struct {
 type kubeletConf struct {
 	// ClientCAFile specifies location to client certificate
 	ClientCAFile string
+	// SystemReserved is the JSON object of resources reserved for the system
+	SystemReserved string
+	// KubeReserved is the JSON object of resources reserved for Kubernetes components, omitted if empty
+	KubeReserved string
+	// EvictionHard is the JSON object of hard eviction thresholds, omitted if empty
+	EvictionHard string
+	// ClusterDNS is the JSON array of cluster DNS addresses
+	ClusterDNS string
+	// DualStack enables the IPv6DualStack feature gate, set if the cluster DNS has an address per IP family
+	DualStack bool
+	// ContainerLogMaxSize is the size a container log is rotated at
+	ContainerLogMaxSize string
+	// ContainerLogMaxFiles is the number of log files kept per container
+	ContainerLogMaxFiles int32
 }
 
-// createKubeletConf creates config file for kubelet, with Windows specific configuration
+// renderKubeletConf renders the kubelet config file contents, with Windows specific configuration
 // Add values in kubelet_config.json files, for additional static fields.
 // Add fields in kubeletConf struct for variable fields
-func (wmcb *winNodeBootstrapper) createKubeletConf() ([]byte, error) {
+func (wmcb *winNodeBootstrapper) renderKubeletConf() ([]byte, error) {
 	// get config file content using bindata.go
 	content, err := Asset("templates/kubelet_config.json")
 
@@ -241,24 +386,62 @@ func (wmcb *winNodeBootstrapper) createKubeletConf() ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
+	reservation, err := nodesizing.Compute(wmcb.sizingHost, wmcb.sizing)
+	if err != nil {
+		return nil, fmt.Errorf("error sizing node reservation: %v", err)
+	}
 	// Fill up the config file, using kubeletConf struct
 	variableFields := kubeletConf{
 		ClientCAFile: strings.Join(append(strings.Split(wmcb.installDir, `\`), `kubelet-ca.crt`), `\\`),
+		DualStack:    len(wmcb.clusterDNS) > 1,
+		// The log rotation matches the one of the docker daemon.json, as the kubelet only rotates the container logs
+		// of containerd
+		ContainerLogMaxSize:  wmcb.runtime.LogMaxSize,
+		ContainerLogMaxFiles: wmcb.runtime.LogMaxFiles,
 	}
-	// Create kubelet.conf file
-	kubeletConfPath := filepath.Join(wmcb.installDir, "kubelet.conf")
-	kubeletConfFile, err := os.Create(kubeletConfPath)
+	clusterDNS, err := json.Marshal(wmcb.clusterDNS)
 	if err != nil {
-		return nil, fmt.Errorf("error creating %s: %v", kubeletConfPath, err)
+		return nil, fmt.Errorf("error encoding cluster DNS %v: %v", wmcb.clusterDNS, err)
+	}
+	variableFields.ClusterDNS = string(clusterDNS)
+	if variableFields.SystemReserved, err = jsonObject(reservation.SystemReserved); err != nil {
+		return nil, err
+	}
+	if variableFields.KubeReserved, err = jsonObject(reservation.KubeReserved); err != nil {
+		return nil, err
+	}
+	if variableFields.EvictionHard, err = jsonObject(reservation.EvictionHard); err != nil {
+		return nil, err
+	}
+	var kubeletConfData bytes.Buffer
+	if err = kubeletConfTmpl.Execute(&kubeletConfData, variableFields); err != nil {
+		return nil, fmt.Errorf("error rendering kubelet config template: %v", err)
+	}
+	return kubeletConfData.Bytes(), nil
+}
+
+// jsonObject returns the given map as a JSON object with sorted keys, or an empty string if the map is empty
+func jsonObject(values map[string]string) (string, error) {
+	if len(values) == 0 {
+		return "", nil
 	}
-	err = kubeletConfTmpl.Execute(kubeletConfFile, variableFields)
+	data, err := json.Marshal(values)
 	if err != nil {
-		return nil, fmt.Errorf("error writing data to %v file: %v", kubeletConfPath, err)
+		return "", fmt.Errorf("error encoding %v: %v", values, err)
 	}
+	return string(data), nil
+}
 
-	kubeletConfData, err := ioutil.ReadFile(kubeletConfFile.Name())
+// createKubeletConf creates config file for kubelet, with Windows specific configuration
+func (wmcb *winNodeBootstrapper) createKubeletConf() ([]byte, error) {
+	kubeletConfData, err := wmcb.renderKubeletConf()
 	if err != nil {
-		return nil, fmt.Errorf("error reading data from %v file: %v", kubeletConfPath, err)
+		return nil, err
+	}
+	// Create kubelet.conf file
+	kubeletConfPath := filepath.Join(wmcb.installDir, "kubelet.conf")
+	if err = ioutil.WriteFile(kubeletConfPath, kubeletConfData, 0644); err != nil {
+		return nil, fmt.Errorf("error writing data to %v file: %v", kubeletConfPath, err)
 	}
 	return kubeletConfData, nil
 }
@@ -280,42 +463,30 @@ func (wmcb *winNodeBootstrapper) translateFile(ignitionSource string, fileTransl
 	return newContents, err
 }
 
-// convertIgnition2to3 takes an ignition spec v2.4 config and returns a v3.1 config
-func convertIgnition2to3(ign2config ignitionCfgv2_4Types.Config) (ignitionCfgv3Types.Config, error) {
-	// only support writing to root file system
-	fsMap := map[string]string{
-		"root": "/",
-	}
-	dedupedIgn2config, err := ignitionCfgv24tov31.RemoveDuplicateFilesAndUnits(ign2config)
-	if err != nil {
-		return ignitionCfgv3Types.Config{}, errors.Errorf("unable to deduplicate Ignition spec v2 config: %v", err)
-	}
-	ign3_1config, err := ignitionCfgv24tov31.Translate(dedupedIgn2config, fsMap)
-	if err != nil {
-		return ignitionCfgv3Types.Config{}, errors.Errorf("unable to convert Ignition spec v2 config to v3: %v", err)
-	}
-
-	return ign3_1config, nil
-}
-
 // parseIgnitionFileContents parses the ignition file contents and writes the contents of the described files to the k8s
 // installation directory
 func (wmcb *winNodeBootstrapper) parseIgnitionFileContents(ignitionFileContents []byte,
 	filesToTranslate map[string]fileTranslation) error {
-	// Parse raw file contents for Ignition spec v3.1 config
-	configuration, report, err := ignitionCfgv3.Parse(ignitionFileContents)
-	if err != nil && err.Error() == ignitionCfgError.ErrUnknownVersion.Error() {
-		// the Ignition config spec v2.4 parser supports parsing all spec versions up to 2.4
-		configV2, reportV2, errV2 := ignitionCfgv2_4.Parse(ignitionFileContents)
-		if errV2 != nil || reportV2.IsFatal() {
-			return errors.Errorf("failed to parse Ign spec v2 config: %v\nReport: %v", errV2, reportV2)
-		}
-		configuration, err = convertIgnition2to3(configV2)
-		if err != nil {
-			return err
+	translatedFiles, err := wmcb.translateIgnitionFiles(ignitionFileContents, filesToTranslate)
+	if err != nil {
+		return err
+	}
+	for _, f := range translatedFiles {
+		if err = ioutil.WriteFile(f.path, f.contents, 0644); err != nil {
+			return fmt.Errorf("could not write to %s: %s", f.path, err)
 		}
-	} else if err != nil || report.IsFatal() {
-		return errors.Errorf("failed to parse Ign spec v3.1 config: %v\nReport: %v", err, report)
+	}
+	return nil
+}
+
+// translateIgnitionFiles parses the ignition file contents, populates the kubelet args found in the kubelet systemd
+// unit and the time service configuration found in the chrony config, and returns the described files along with their
+// translated contents, in the order the ignition file lists them
+func (wmcb *winNodeBootstrapper) translateIgnitionFiles(ignitionFileContents []byte,
+	filesToTranslate map[string]fileTranslation) ([]nodeFile, error) {
+	configuration, err := ignition.Parse(ignitionFileContents)
+	if err != nil {
+		return nil, err
 	}
 
 	// Find the kubelet systemd service specified in the ignition file and grab the variable arguments
@@ -326,77 +497,126 @@ func (wmcb *winNodeBootstrapper) parseIgnitionFileContents(ignitionFileContents
 		}
 
 		if unit.Contents == nil {
-			return fmt.Errorf("could not process %s: Unit is empty", unit.Name)
+			return nil, fmt.Errorf("could not process %s: Unit is empty", unit.Name)
 		}
 
-		results := cloudProviderRegex.FindStringSubmatch(*unit.Contents)
-		if len(results) == 2 {
-			wmcb.kubeletArgs["cloud-provider"] = results[1]
+		// Let the handler of the cloud provider the kubelet is run with pick the files and kubelet flags it needs
+		platformInput := platform.Input{
+			UnitFlags:  platform.ParseUnitFlags(*unit.Contents),
+			InstallDir: wmcb.installDir,
+			ReadFile: func(path string) ([]byte, bool, error) {
+				return ignition.ReadFile(configuration, path)
+			},
 		}
-
-		// Check for the presence of "--cloud-config" option and if it is present append the value to
-		// filesToTranslate. This option is only present for Azure and hence we cannot assume it as a file that
-		// requires translation across clouds.
-		results = cloudConfigRegex.FindStringSubmatch(*unit.Contents)
-		if len(results) == 2 {
-			cloudConfFilename := filepath.Base(results[1])
-
-			// Check if we were able to get a valid filename. Read filepath.Base() godoc for explanation.
-			if cloudConfFilename == "." || os.IsPathSeparator(cloudConfFilename[0]) {
-				return fmt.Errorf("could not get cloud config filename from %s", results[0])
-			}
-
-			filesToTranslate[results[1]] = fileTranslation{
-				dest: filepath.Join(wmcb.installDir, cloudConfFilename),
+		wmcb.setUnitLabels(platformInput.UnitFlags)
+		handler := platform.Lookup(platformInput.UnitFlags[platform.CloudProviderOption])
+		platformFiles, err := handler.Files(platformInput)
+		if err != nil {
+			return nil, err
+		}
+		for _, platformFile := range platformFiles {
+			filesToTranslate[platformFile.Source] = fileTranslation{
+				dest:            platformFile.Dest,
+				translationFunc: platformTranslation(platformFile.Transform),
 			}
-
-			// Set the --cloud-config option value
-			wmcb.kubeletArgs[cloudConfigOption] = filepath.Join(wmcb.installDir, cloudConfFilename)
+		}
+		platformArgs, err := handler.KubeletArgs(platformInput)
+		if err != nil {
+			return nil, err
+		}
+		for name, value := range platformArgs {
+			wmcb.kubeletArgs[name] = value
 		}
 
-		results = verbosityRegex.FindStringSubmatch(*unit.Contents)
+		results := verbosityRegex.FindStringSubmatch(*unit.Contents)
 		if len(results) == 2 {
 			wmcb.kubeletArgs["v"] = results[1]
 		}
 	}
 
+	if err = wmcb.setTimePlan(configuration); err != nil {
+		return nil, err
+	}
+
 	// In case the verbosity argument is missing, use a default value
 	if wmcb.kubeletArgs["v"] == "" {
 		wmcb.kubeletArgs["v"] = "3"
 	}
 
-	// For each new file in the ignition file check if is a file we are interested in, if so, decode, transform,
-	// and write it to the destination path
+	// For each new file in the ignition file check if is a file we are interested in, if so, decode and transform it
+	var translatedFiles []nodeFile
 	for _, ignFile := range configuration.Storage.Files {
 		if filePair, ok := filesToTranslate[ignFile.Node.Path]; ok {
 			if ignFile.Contents.Source == nil {
-				return fmt.Errorf("could not process %s: File is empty", ignFile.Node.Path)
+				return nil, fmt.Errorf("could not process %s: File is empty", ignFile.Node.Path)
 			}
 
 			newContents, err := wmcb.translateFile(*ignFile.Contents.Source, filePair.translationFunc)
 			if err != nil {
-				return fmt.Errorf("could not process %s: %s", ignFile.Node.Path, err)
-			}
-			if err = ioutil.WriteFile(filePair.dest, newContents, 0644); err != nil {
-				return fmt.Errorf("could not write to %s: %s", filePair.dest, err)
+				return nil, fmt.Errorf("could not process %s: %s", ignFile.Node.Path, err)
 			}
+			translatedFiles = append(translatedFiles, nodeFile{path: filePair.dest, contents: newContents})
 		}
 	}
 
-	return nil
+	return translatedFiles, nil
+}
+
+// platformTranslation returns the translationFunc applying the given platform transform, or nil if there is none
+func platformTranslation(transform platform.TransformFunc) translationFunc {
+	if transform == nil {
+		return nil
+	}
+	return func(_ *winNodeBootstrapper, contents []byte) ([]byte, error) {
+		return transform(contents)
+	}
+}
+
+// readIgnition returns the contents of the ignition file given to the bootstrapper. found is false if no ignition file
+// was given.
+func (wmcb *winNodeBootstrapper) readIgnition() (contents []byte, found bool, err error) {
+	if wmcb.ignitionContents != nil {
+		return wmcb.ignitionContents, true, nil
+	}
+	if wmcb.ignitionFilePath == "" {
+		return nil, false, nil
+	}
+	contents, err = ioutil.ReadFile(wmcb.ignitionFilePath)
+	if err != nil {
+		return nil, true, fmt.Errorf("could not read ignition file: %s", err)
+	}
+	return contents, true, nil
+}
+
+// parseIgnition parses the ignition file given to the bootstrapper and returns the files required by the kubelet along
+// with their translated contents. Nothing is returned if no ignition file was given.
+func (wmcb *winNodeBootstrapper) parseIgnition() ([]nodeFile, error) {
+	contents, found, err := wmcb.readIgnition()
+	if err != nil || !found {
+		return nil, err
+	}
+	files, err := wmcb.translateIgnitionFiles(contents, wmcb.kubeletFilesToTranslate())
+	if err != nil {
+		return nil, fmt.Errorf("could not parse ignition file: %s", err)
+	}
+	return files, nil
 }
 
-// initializeKubeletFiles initializes the files required by the kubelet
-func (wmcb *winNodeBootstrapper) initializeKubeletFiles() error {
-	filesToTranslate := map[string]fileTranslation{
-		"/etc/kubernetes/kubeconfig": {
-			dest: filepath.Join(wmcb.installDir, "bootstrap-kubeconfig"),
+// kubeletFilesToTranslate returns the ignition files required by the kubelet along with where they should be written
+func (wmcb *winNodeBootstrapper) kubeletFilesToTranslate() map[string]fileTranslation {
+	return map[string]fileTranslation{
+		ignition.BootstrapKubeconfigPath: {
+			dest:            filepath.Join(wmcb.installDir, "bootstrap-kubeconfig"),
+			translationFunc: translateBootstrapKubeconfig,
 		},
-		"/etc/kubernetes/kubelet-ca.crt": {
+		ignition.KubeletCAPath: {
 			dest: filepath.Join(wmcb.installDir, "kubelet-ca.crt"),
 		},
 	}
+}
 
+// ensureKubeletDirs creates the directories required by the kubelet
+func (wmcb *winNodeBootstrapper) ensureKubeletDirs() error {
 	// Create the manifest directory needed by kubelet for the static pods, we shouldn't override if the pod manifest
 	// directory already exists
 	podManifestDirectory := filepath.Join(wmcb.installDir, "etc", "kubernetes", "manifests")
@@ -412,42 +632,42 @@ func (wmcb *winNodeBootstrapper) initializeKubeletFiles() error {
 		return fmt.Errorf("could not make install directory: %s", err)
 	}
 
-	_, err = wmcb.createKubeletConf()
-	if err != nil {
-		return fmt.Errorf("error creating kubelet configuration %v", err)
-	}
-
-	if wmcb.initialKubeletPath != "" {
-		err = copyFile(wmcb.initialKubeletPath, filepath.Join(wmcb.installDir, "kubelet.exe"))
-		if err != nil {
-			return fmt.Errorf("could not copy kubelet: %s", err)
-		}
-	}
-
 	// Create log directory
 	err = os.MkdirAll(wmcb.logDir, os.ModeDir)
 	if err != nil {
 		return fmt.Errorf("could not make %s directory: %v", wmcb.logDir, err)
 	}
+	return nil
+}
 
-	// Populate destination directory with the files we need
-	if wmcb.ignitionFilePath != "" {
-		ignitionFileContents, err := ioutil.ReadFile(wmcb.ignitionFilePath)
-		if err != nil {
-			return fmt.Errorf("could not read ignition file: %s", err)
+// initializeKubeletFiles initializes the files required by the kubelet. Nothing is written to the node until the
+// ignition file has been parsed and the configuration rendered.
+func (wmcb *winNodeBootstrapper) initializeKubeletFiles(ctx context.Context) error {
+	files, err := wmcb.prepareKubeletFiles(ctx)
+	if err != nil {
+		return err
+	}
+	return wmcb.progress.Run(progress.WriteFiles, func() error {
+		if err := wmcb.ensureKubeletDirs(); err != nil {
+			return err
 		}
-
-		err = wmcb.parseIgnitionFileContents(ignitionFileContents, filesToTranslate)
+		outdated, err := outdatedFiles(files)
 		if err != nil {
-			return fmt.Errorf("could not parse ignition file: %s", err)
+			return err
 		}
-	}
-	return nil
+		if err = wmcb.writeNodeFiles(ctx, outdated); err != nil {
+			return err
+		}
+		if err = wmcb.loadPauseImageArchive(ctx); err != nil {
+			return err
+		}
+		// The clock has to be in sync before the kubelet goes through its TLS bootstrap
+		return wmcb.configureTimeService(ctx)
+	})
 }
 
-// createKubeletService creates a new kubelet service to our specifications
-func (wmcb *winNodeBootstrapper) createKubeletService() error {
-	var err error
+// kubeletServiceArgs returns the arguments the kubelet service is run with
+func (wmcb *winNodeBootstrapper) kubeletServiceArgs() []string {
 	// If initialize-kubelet is run after configure-cni, the kubelet args will be overwritten and the CNI
 	// configuration will be lost. The assumption is that every time initialize-kubelet is run, configure-cni needs to
 	// be run again. This is how the WSU playbook is written and we don't expect users to execute WMCB directly.
@@ -456,34 +676,48 @@ func (wmcb *winNodeBootstrapper) createKubeletService() error {
 		"--config=" + wmcb.kubeletConfPath,
 		"--bootstrap-kubeconfig=" + filepath.Join(wmcb.installDir, "bootstrap-kubeconfig"),
 		"--kubeconfig=" + wmcb.kubeconfigPath,
-		"--pod-infra-container-image=" + kubeletPauseContainerImage,
-		"--cert-dir=" + certDirectory,
+		"--pod-infra-container-image=" + wmcb.pauseImage,
+		"--cert-dir=" + wmcb.certDir,
 		"--windows-service",
 		"--logtostderr=false",
 		"--log-file=" + filepath.Join(wmcb.logDir, "kubelet.log"),
-		// Registers the Kubelet with Windows specific taints so that linux pods won't get scheduled onto
-		// Windows nodes.
-		// TODO: Write a `against the cluster` e2e test which checks for the Windows node object created
-		// and check for taint.
-		"--register-with-taints=" + windowsTaints,
-		// Label that WMCB uses
-		"--node-labels=" + nodeLabel,
-	}
-	if cloudProvider, ok := wmcb.kubeletArgs["cloud-provider"]; ok {
-		kubeletArgs = append(kubeletArgs, "--cloud-provider="+cloudProvider)
 	}
-	if v, ok := wmcb.kubeletArgs["v"]; ok {
-		kubeletArgs = append(kubeletArgs, "--v="+v)
+	kubeletArgs = append(kubeletArgs, wmcb.nodeLabelKubeletArgs()...)
+	// The args parsed from the ignition are added in a fixed order, so that the kubelet command does not change
+	// between runs
+	for _, name := range sortedArgNames(wmcb.kubeletArgs) {
+		kubeletArgs = append(kubeletArgs, "--"+name+"="+wmcb.kubeletArgs[name])
 	}
-	if cloudConfigValue, ok := wmcb.kubeletArgs[cloudConfigOption]; ok {
-		kubeletArgs = append(kubeletArgs, "--"+cloudConfigOption+"="+cloudConfigValue)
+	kubeletArgs = append(kubeletArgs, wmcb.identityKubeletArgs()...)
+	kubeletArgs = append(kubeletArgs, wmcb.runtimeKubeletArgs()...)
+	return kubeletArgs
+}
+
+// sortedArgNames returns the names of the given kubelet args, with the cloud provider, verbosity and cloud config
+// first, in that order, followed by the remaining names in alphabetical order
+func sortedArgNames(args map[string]string) []string {
+	leading := []string{platform.CloudProviderOption, "v", platform.CloudConfigOption}
+	isLeading := make(map[string]bool)
+	var names, remaining []string
+	for _, name := range leading {
+		isLeading[name] = true
+		if _, ok := args[name]; ok {
+			names = append(names, name)
+		}
 	}
-	if nodeWorkerLabel, ok := wmcb.kubeletArgs["node-labels"]; ok {
-		kubeletArgs = append(kubeletArgs, "--"+"node-labels"+"="+nodeWorkerLabel)
+	for name := range args {
+		if !isLeading[name] {
+			remaining = append(remaining, name)
+		}
 	}
+	sort.Strings(remaining)
+	return append(names, remaining...)
+}
 
+// kubeletServiceConfig returns the Windows service config for the kubelet service
+func (wmcb *winNodeBootstrapper) kubeletServiceConfig() mgr.Config {
 	// Mostly default values here
-	c := mgr.Config{
+	return mgr.Config{
 		ServiceType: 0,
 		// StartAutomatic will start the service again if the node restarts
 		StartType:    mgr.StartAutomatic,
@@ -492,28 +726,33 @@ func (wmcb *winNodeBootstrapper) createKubeletService() error {
 		BinaryPathName: filepath.Join(wmcb.installDir, "kubelet.exe"),
 		LoadOrderGroup: "",
 		TagId:          0,
-		// set dependency on docker
-		Dependencies:     []string{"docker"},
+		// set dependency on the container runtime
+		Dependencies:     []string{wmcb.runtimeService()},
 		ServiceStartName: "",
 		DisplayName:      "",
 		Password:         "",
 		Description:      "OpenShift Kubelet",
 	}
-	ksvc, err := wmcb.svcMgr.CreateService(KubeletServiceName, filepath.Join(wmcb.installDir, "kubelet.exe"), c, kubeletArgs...)
+}
+
+// createKubeletService creates a new kubelet service to our specifications
+func (wmcb *winNodeBootstrapper) createKubeletService() error {
+	ksvc, err := wmcb.svcMgr.CreateService(KubeletServiceName, filepath.Join(wmcb.installDir, "kubelet.exe"),
+		wmcb.kubeletServiceConfig(), wmcb.kubeletServiceArgs()...)
 	if err != nil {
 		return err
 	}
 
-	var dependents []*mgr.Service
+	var dependents []WindowsService
 	if dependentSvc, err := wmcb.svcMgr.OpenService(kubeletDependentSvc); err == nil {
 		dependents = append(dependents, dependentSvc)
 	}
-	wmcb.kubeletSVC, err = newKubeletService(ksvc, dependents)
+	wmcb.kubeletSVC, err = newKubeletService(ksvc, dependents, wmcb.serviceWaitTime)
 	if err != nil {
 		return fmt.Errorf("could not initialize struct kubeletService: %v", err)
 	}
 
-	if err := wmcb.kubeletSVC.setRecoveryActions(); err != nil {
+	if err := wmcb.kubeletSVC.setRecoveryActions(wmcb.recoveryPolicy); err != nil {
 		return fmt.Errorf("failed to set recovery actions for Windows service %s", KubeletServiceName)
 	}
 
@@ -522,64 +761,92 @@ func (wmcb *winNodeBootstrapper) createKubeletService() error {
 
 // refreshServiceManager will disconnect and reconnect from the Windows service API. In order to complete certain
 // operations, there must be zero handlers to the API present on the system.
-func (wmcb *winNodeBootstrapper) refreshServiceManager() error {
+// A connection to the service manager owned by the caller is kept, and only the handles to the services are closed.
+func (wmcb *winNodeBootstrapper) refreshServiceManager(ctx context.Context) error {
+	if !wmcb.ownsSvcMgr {
+		if err := wmcb.kubeletSVC.disconnect(); err != nil {
+			return err
+		}
+		// We need to give Windows time to clean up the services we've marked for deletion
+		return sleep(ctx, wmcb.serviceWaitTime)
+	}
+	if err := wmcb.Disconnect(); err != nil {
+		return err
+	}
+	// We need to give Windows time to clean up the services we've marked for deletion. The connection is established
+	// again even if the context is cancelled, so that the bootstrapper can still be disconnected.
+	sleepErr := sleep(ctx, wmcb.serviceWaitTime)
 	var err error
-	if err = wmcb.Disconnect(); err != nil {
+	if wmcb.svcMgr, err = connectSCM(); err != nil {
 		return err
 	}
-	// We need to give Windows time to clean up the services we've marked for deletion
-	time.Sleep(serviceWaitTime)
-	wmcb.svcMgr, err = mgr.Connect()
-	return err
+	return sleepErr
 }
 
-// InitializeKubelet performs the initial kubelet configuration. It sets up the install directory, creates the kubelet
-// service, and then starts the kubelet service
-func (wmcb *winNodeBootstrapper) InitializeKubelet() error {
+// initializeKubelet performs the initial kubelet configuration. It sets up the install directory, creates the kubelet
+// service, and then starts the kubelet service. If the context is cancelled before the kubelet service is created, the
+// node is left without a kubelet service, and initializeKubelet can be run again. Once the kubelet service has been
+// created, it is started even if the context is cancelled.
+func (wmcb *winNodeBootstrapper) initializeKubelet(ctx context.Context) error {
 	var err error
 	if wmcb.kubeletSVC != nil {
-		// if the kubelet service exists, we silently remove it and continue, to preserve idempotency
-		err = wmcb.kubeletSVC.stopAndRemove()
-		if err != nil {
-			return err
-		}
-		// We need to refresh the service to allow the service to be removed by Windows
-		err = wmcb.refreshServiceManager()
+		err = wmcb.progress.Run(progress.StopService, func() error {
+			// if the kubelet service exists, we silently remove it and continue, to preserve idempotency
+			if err := wmcb.kubeletSVC.stopAndRemove(ctx); err != nil {
+				return err
+			}
+			// We need to refresh the service to allow the service to be removed by Windows
+			return wmcb.refreshServiceManager(ctx)
+		})
 		if err != nil {
 			return err
 		}
 	}
-	err = wmcb.initializeKubeletFiles()
+	err = wmcb.initializeKubeletFiles(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to initialize kubelet: %v", err)
 	}
-	err = wmcb.createKubeletService()
+	if err = ctx.Err(); err != nil {
+		return fmt.Errorf("failed to initialize kubelet: %w", err)
+	}
+	err = wmcb.progress.Run(progress.CreateService, wmcb.createKubeletService)
+	if err != nil {
+		return kubeletServiceError("create", err)
+	}
+	err = wmcb.progress.Run(progress.StartService, func() error { return wmcb.kubeletSVC.start() })
 	if err != nil {
-		return fmt.Errorf("failed to create kubelet windows service: %v", err)
+		return kubeletServiceError("start", err)
 	}
-	err = wmcb.kubeletSVC.start()
+	err = wmcb.progress.Run(progress.VerifyHealth, func() error { return wmcb.verifyKubelet(ctx) })
 	if err != nil {
-		return fmt.Errorf("failed to start kubelet windows service: %v", err)
+		return fmt.Errorf("kubelet windows service is not healthy: %w", err)
 	}
 	return nil
 }
 
-// Configure configures the kubelet service for plugins like CNI
-func (wmcb *winNodeBootstrapper) Configure() error {
-	// TODO: add && wmcb.csi == null check here when we add CSI support
+// configure configures the kubelet service for CNI. Once the kubelet service has been stopped, the configuration is
+// completed even if the context is cancelled, so that the kubelet is not left stopped. CSI is configured by
+// configureCSI instead, as the CSI node plugins register with a running kubelet and the kubelet only needs to be
+// restarted if its root dir changes.
+func (wmcb *winNodeBootstrapper) configure(ctx context.Context) error {
 	if wmcb.cni == nil {
-		return fmt.Errorf("cannot configure without required plugin inputs")
+		return &InvalidInputError{Err: fmt.Errorf("cannot configure without required plugin inputs")}
 	}
 
 	// We cannot proceed if the kubelet service is not present on the system as we need to update it with the plugin
 	// configuration
 	if wmcb.kubeletSVC == nil {
-		return fmt.Errorf("kubelet service is not present")
+		return kubeletNotInstalled()
 	}
 
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	critical := withoutCancel(ctx)
 	// Stop the kubelet service as there could be open file handles from kubelet.exe on the plugin files
-	if err := wmcb.kubeletSVC.stop(); err != nil {
-		return fmt.Errorf("unable to stop kubelet service: %v", err)
+	err := wmcb.progress.Run(progress.StopService, func() error { return wmcb.kubeletSVC.stop(critical) })
+	if err != nil {
+		return kubeletServiceError("stop", err)
 	}
 
 	config, err := wmcb.kubeletSVC.config()
@@ -587,47 +854,95 @@ func (wmcb *winNodeBootstrapper) Configure() error {
 		return fmt.Errorf("error getting kubelet service config: %v", err)
 	}
 
-	// TODO: add wmcb.cni != null check here when we add CSI support as this function will be called in both cases
-	if err = wmcb.cni.configure(&config.BinaryPathName); err != nil {
+	err = wmcb.progress.Run(progress.WriteFiles, func() error {
+		return wmcb.cni.configure(critical, &config.BinaryPathName)
+	})
+	if err != nil {
 		return fmt.Errorf("error configuring kubelet service for CNI: %v", err)
 	}
 
-	if err = wmcb.kubeletSVC.refresh(config); err != nil {
+	err = wmcb.progress.Run(progress.UpdateService, func() error { return wmcb.kubeletSVC.refresh(critical, config) })
+	if err != nil {
 		return fmt.Errorf("unable to refresh kubelet service: %v", err)
 	}
 
+	err = wmcb.progress.Run(progress.VerifyHealth, func() error { return wmcb.verifyKubelet(ctx) })
+	if err != nil {
+		return fmt.Errorf("kubelet windows service is not healthy: %w", err)
+	}
 	return nil
 }
 
-// Disconnect removes all connections to the Windows service manager api, and allows services to be deleted
+// Disconnect removes all connections to the Windows service manager api, and allows services to be deleted. A
+// connection to the service manager owned by the caller is left open.
 func (wmcb *winNodeBootstrapper) Disconnect() error {
 	if err := wmcb.kubeletSVC.disconnect(); err != nil {
 		return err
 	}
+	if !wmcb.ownsSvcMgr {
+		return nil
+	}
 	err := wmcb.svcMgr.Disconnect()
 	wmcb.svcMgr = nil
 	return err
 }
 
-func copyFile(src, dest string) error {
+// copyFile atomically replaces dest with a copy of src. The context is checked before the copy begins, but a copy that
+// has begun is completed, so that cancelling does not leave a partially written file behind.
+func copyFile(ctx context.Context, src, dest string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	from, err := os.Open(src)
 	if err != nil {
 		return err
 	}
 	defer from.Close()
 
-	to, err := os.OpenFile(dest, os.O_RDWR|os.O_CREATE, 0666)
-	if err != nil {
+	return fileutil.Replace(dest, func(to io.Writer) error {
+		_, err := io.Copy(to, from)
 		return err
-	}
-	defer to.Close()
-
-	_, err = io.Copy(to, from)
-	return err
+	})
 }
 
 // checkCNIInputs checks if there are any issues with the CNI inputs to WMCB and returns an error if there is
 func checkCNIInputs(k8sInstallDir string, cniDir string, cniConfig string) error {
+	if err := checkCNIDirs(k8sInstallDir, cniDir); err != nil {
+		return err
+	}
+
+	// Check if there are any issues accessing the CNI configuration file. We don't want to proceed on any error as it
+	// could cause issues further down the line when copying the files.
+	cniConfigInfo, err := os.Stat(cniConfig)
+	if err != nil {
+		return fmt.Errorf("error accessing CNI config %s: %v", cniConfig, err)
+	}
+	if cniConfigInfo.IsDir() {
+		return fmt.Errorf("CNI config cannot be a directory")
+	}
+
+	contents, err := ioutil.ReadFile(cniConfig)
+	if err != nil {
+		return fmt.Errorf("error reading CNI config %s: %v", cniConfig, err)
+	}
+	if err = validateCNIConfig(contents, cniDir); err != nil {
+		return fmt.Errorf("error validating CNI config %s: %v", cniConfig, err)
+	}
+	return nil
+}
+
+// validateCNIConfig parses and validates the given CNI configuration against the CNI binaries, so that a broken config
+// is rejected before the kubelet is restarted with it
+func validateCNIConfig(contents []byte, cniDir string) error {
+	config, err := cniconf.Parse(contents)
+	if err != nil {
+		return err
+	}
+	return config.Validate(cniDir)
+}
+
+// checkCNIDirs checks that the installation directory and the directory holding the CNI binaries can be accessed
+func checkCNIDirs(k8sInstallDir string, cniDir string) error {
 	// Check if there are any issues accessing the installation directory. We don't want to proceed on any error as it
 	// could cause issues further down the line when copying the files.
 	if _, err := os.Stat(k8sInstallDir); err != nil {
@@ -652,53 +967,115 @@ func checkCNIInputs(k8sInstallDir string, cniDir string, cniConfig string) error
 	if len(files) == 0 {
 		return fmt.Errorf("no files present in CNI dir %s", cniDir)
 	}
+	return nil
+}
 
-	// Check if there are any issues accessing the CNI configuration file. We don't want to proceed on any error as it
-	// could cause issues further down the line when copying the files.
-	cniConfigInfo, err := os.Stat(cniConfig)
+// copyFiles() copies the CNI binaries, including those in subdirectories, and config to the installation directory,
+// and removes the installed CNI binaries that are no longer part of the input CNI dir. Copying stops between files if
+// the context is cancelled.
+func (cni *cniOptions) copyFiles(ctx context.Context) error {
+	files, err := cni.desiredFiles()
 	if err != nil {
-		return fmt.Errorf("error accessing CNI config %s: %v", cniConfig, err)
-	}
-	if cniConfigInfo.IsDir() {
-		return fmt.Errorf("CNI config cannot be a directory")
+		return err
 	}
-
-	return nil
+	return writeFiles(ctx, files)
 }
 
-// copyFiles() copies the CNI binaries and config to the installation directory
-func (cni *cniOptions) copyFiles() error {
-	// Read C:\source\cni\
-	files, err := ioutil.ReadDir(cni.dir)
+// sourceFiles returns the paths of the CNI binaries relative to the input CNI dir. Subdirectories are walked
+// recursively, except for a top level config directory, which would otherwise be installed as the CNI config
+// directory. The input CNI config is skipped if it is in the input CNI dir, as it is installed separately.
+func (cni *cniOptions) sourceFiles() ([]string, error) {
+	var files []string
+	err := filepath.Walk(cni.dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(cni.dir, path)
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if rel == filepath.Base(cni.confDir) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if cni.config != "" && filepath.Clean(path) == filepath.Clean(cni.config) {
+			return nil
+		}
+		files = append(files, rel)
+		return nil
+	})
 	if err != nil {
-		return fmt.Errorf("error reading CNI dir %s: %v", cni.dir, err)
+		return nil, fmt.Errorf("error reading CNI dir %s: %v", cni.dir, err)
 	}
+	return files, nil
+}
 
-	// Copy the CNI binaries from the input CNI dir to the CNI installation directory
-	for _, file := range files {
-		// Ignore directories for now. If we find that there are CNI packages with nested directories, we can update
-		// this to loop to be recursive.
-		if file.IsDir() {
-			continue
-		}
+// staleFiles returns the files installed in the CNI binary directory that are not among the given desired files, to be
+// removed. The CNI config directory is left alone.
+func (cni *cniOptions) staleFiles(desired []nodeFile) ([]nodeFile, error) {
+	// Windows paths are case insensitive
+	wanted := make(map[string]bool, len(desired))
+	for _, f := range desired {
+		wanted[strings.ToLower(filepath.Clean(f.path))] = true
+	}
 
-		// C:\source\cni\filename
-		src := filepath.Join(cni.dir, file.Name())
-		// C:\k\cni\filename
-		dest := filepath.Join(cni.binDir, file.Name())
-		if err = copyFile(src, dest); err != nil {
-			return fmt.Errorf("error copying %s --> %s: %v", src, dest, err)
+	var stale []nodeFile
+	err := filepath.Walk(cni.binDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
 		}
+		if info.IsDir() {
+			if filepath.Clean(path) == filepath.Clean(cni.confDir) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !wanted[strings.ToLower(filepath.Clean(path))] {
+			stale = append(stale, nodeFile{path: path, remove: true})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error reading CNI binary directory %s: %v", cni.binDir, err)
 	}
+	return stale, nil
+}
 
-	// Copy the CNI config to the CNI configuration directory. Example: C:\k\cni\config\cni.conf
-	cniConfigDest := filepath.Join(cni.confDir, filepath.Base(cni.config))
-	if err = copyFile(cni.config, cniConfigDest); err != nil {
-		return fmt.Errorf("error copying CNI config %s --> %s: %v", cni.config, cniConfigDest, err)
+// verifyManifest verifies the CNI binaries in the input CNI dir against the sha256 digests listed in the given
+// manifest, so that corrupted or unexpected binaries are rejected before anything is installed
+func (cni *cniOptions) verifyManifest(manifestPath string) error {
+	data, err := ioutil.ReadFile(manifestPath)
+	if err != nil {
+		return fmt.Errorf("error reading CNI manifest %s: %v", manifestPath, err)
+	}
+	manifest, err := cniconf.ParseManifest(data)
+	if err != nil {
+		return fmt.Errorf("invalid CNI manifest %s: %v", manifestPath, err)
+	}
+	files, err := cni.sourceFiles()
+	if err != nil {
+		return err
+	}
+	if err = manifest.Verify(cni.dir, files); err != nil {
+		return fmt.Errorf("CNI dir %s does not match manifest %s: %v", cni.dir, manifestPath, err)
 	}
 	return nil
 }
 
+// configFile returns the CNI config, either rendered or copied from the input config file, along with where it is
+// installed
+func (cni *cniOptions) configFile() nodeFile {
+	if cni.rendered != nil {
+		return nodeFile{path: filepath.Join(cni.confDir, cniconf.ConfigFileName), contents: cni.rendered}
+	}
+	return nodeFile{path: filepath.Join(cni.confDir, filepath.Base(cni.config)), src: cni.config}
+}
+
 // ensureDirIsPresent ensures that CNI parent and child directories are present on the system
 func (cni *cniOptions) ensureDirIsPresent() error {
 	// By checking for the config directory, we can ensure both parent and child directories are present
@@ -815,12 +1192,12 @@ func (cni *cniOptions) updateKubeletArgs(kubeletCmd *string) error {
 
 // Configure performs the CNI configuration. It sets up the CNI directories and updates the kubelet command with the CNI
 // arguments. Updating and restarting the kubelet service is outside of its purview.
-func (cni *cniOptions) configure(kubeletCmd *string) error {
+func (cni *cniOptions) configure(ctx context.Context, kubeletCmd *string) error {
 	if err := cni.ensureDirIsPresent(); err != nil {
 		return fmt.Errorf("unable to create CNI directory %s: %v", filepath.Join(cni.dir, cniConfigDirName), err)
 	}
 
-	if err := cni.copyFiles(); err != nil {
+	if err := cni.copyFiles(ctx); err != nil {
 		return fmt.Errorf("unable to copy CNI files: %v", err)
 	}
 
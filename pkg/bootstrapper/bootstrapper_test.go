@@ -1,8 +1,14 @@
 package bootstrapper
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
@@ -10,6 +16,11 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/cniconf"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/nodesizing"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/osinfo"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/runtimeconf"
 )
 
 //cniTest holds the location of the directories and files required for running some of the CNI tests
@@ -34,7 +45,7 @@ func initCNITestFramework() error {
 		return fmt.Errorf("error creating temp directories and files: %v", err)
 	}
 
-	cniTest.cni, err = newCNIOptions(cniTest.k8sInstallDir, cniTest.dir, cniTest.config)
+	cniTest.cni, err = newCNIOptions(cniTest.k8sInstallDir, cniTest.dir, cniTest.config, nil)
 	if err != nil {
 		return fmt.Errorf("error initializing CNI options: %v", err)
 	}
@@ -57,12 +68,11 @@ func createFilesAndDirsRequiredForTests() error {
 	}
 	cniTest.dir = cniDir
 
-	// Create temp CNI file
-	cniExe, err := ioutil.TempFile(cniDir, "cni.exe")
-	if err != nil {
+	// Create the CNI plugin referenced by the CNI config
+	cniTest.exe = filepath.Join(cniDir, "win-overlay.exe")
+	if err = ioutil.WriteFile(cniTest.exe, []byte("win-overlay"), 0644); err != nil {
 		return fmt.Errorf("error creating CNI exe: %v", err)
 	}
-	cniTest.exe = cniExe.Name()
 
 	// Create temp CNI config dir
 	cniConfigPath, err := ioutil.TempDir(cniDir, "cni")
@@ -75,6 +85,10 @@ func createFilesAndDirsRequiredForTests() error {
 	if err != nil {
 		return fmt.Errorf("error creating CNI config: %v", err)
 	}
+	defer cniConfig.Close()
+	if _, err = cniConfig.WriteString(`{"cniVersion":"0.2.0","name":"net","type":"win-overlay"}`); err != nil {
+		return fmt.Errorf("error writing CNI config: %v", err)
+	}
 	cniTest.config = cniConfig.Name()
 	return nil
 }
@@ -165,18 +179,36 @@ func TestCreateKubeletConf(t *testing.T) {
 	require.NoError(t, err, "error creating install directory")
 
 	tests := []struct {
-		name string
-		args args
-		want []byte
+		name       string
+		args       args
+		sizing     nodesizing.Options
+		clusterDNS []string
+		want       []byte
 	}{
 		{
 			name: "Base case",
-			want: []byte(`{"kind":"KubeletConfiguration","apiVersion":"kubelet.config.k8s.io/v1beta1","rotateCertificates":true,"serverTLSBootstrap":true,"authentication":{"x509":{"clientCAFile":"C:\\k\\kubelet-ca.crt "},"anonymous":{"enabled":false}},"clusterDomain":"cluster.local","clusterDNS":["172.30.0.10"],"cgroupsPerQOS":false,"runtimeRequestTimeout":"10m0s","maxPods":250,"kubeAPIQPS":50,"kubeAPIBurst":100,"serializeImagePulls":false,"featureGates":{"LegacyNodeRoleBehavior":false,"NodeDisruptionExclusion":true,"RotateKubeletServerCertificate":true,"SCTPSupport":true,"ServiceNodeExclusion":true,"SupportPodPidsLimit":true},"containerLogMaxSize":"50Mi","systemReserved":{"cpu":"500m","ephemeral-storage":"1Gi","memory":"1Gi"},"enforceNodeAllocatable":[]}`),
+			want: []byte(`{"kind":"KubeletConfiguration","apiVersion":"kubelet.config.k8s.io/v1beta1","rotateCertificates":true,"serverTLSBootstrap":true,"authentication":{"x509":{"clientCAFile":"C:\\k\\kubelet-ca.crt "},"anonymous":{"enabled":false}},"clusterDomain":"cluster.local","clusterDNS":["172.30.0.10"],"cgroupsPerQOS":false,"runtimeRequestTimeout":"10m0s","maxPods":250,"kubeAPIQPS":50,"kubeAPIBurst":100,"serializeImagePulls":false,"featureGates":{"LegacyNodeRoleBehavior":false,"NodeDisruptionExclusion":true,"RotateKubeletServerCertificate":true,"SCTPSupport":true,"ServiceNodeExclusion":true,"SupportPodPidsLimit":true},"containerLogMaxSize":"50Mi","containerLogMaxFiles":5,"systemReserved":{"cpu":"500m","ephemeral-storage":"1Gi","memory":"1Gi"},"enforceNodeAllocatable":[]}`),
+		},
+		{
+			name:   "Auto sizing",
+			sizing: nodesizing.Options{Auto: true, KubeReservedPercent: 50, EvictionHard: true},
+			want:   []byte(`{"kind":"KubeletConfiguration","apiVersion":"kubelet.config.k8s.io/v1beta1","rotateCertificates":true,"serverTLSBootstrap":true,"authentication":{"x509":{"clientCAFile":"C:\\k\\kubelet-ca.crt "},"anonymous":{"enabled":false}},"clusterDomain":"cluster.local","clusterDNS":["172.30.0.10"],"cgroupsPerQOS":false,"runtimeRequestTimeout":"10m0s","maxPods":250,"kubeAPIQPS":50,"kubeAPIBurst":100,"serializeImagePulls":false,"featureGates":{"LegacyNodeRoleBehavior":false,"NodeDisruptionExclusion":true,"RotateKubeletServerCertificate":true,"SCTPSupport":true,"ServiceNodeExclusion":true,"SupportPodPidsLimit":true},"containerLogMaxSize":"50Mi","containerLogMaxFiles":5,"systemReserved":{"cpu":"35m","ephemeral-storage":"1Gi","memory":"922Mi"},"kubeReserved":{"cpu":"35m","memory":"921Mi"},"evictionHard":{"memory.available":"100Mi","nodefs.available":"10%"},"enforceNodeAllocatable":[]}`),
+		},
+		{
+			name:       "Dual-stack",
+			clusterDNS: []string{"172.30.0.10", "fd02::a"},
+			want:       []byte(`{"kind":"KubeletConfiguration","apiVersion":"kubelet.config.k8s.io/v1beta1","rotateCertificates":true,"serverTLSBootstrap":true,"authentication":{"x509":{"clientCAFile":"C:\\k\\kubelet-ca.crt "},"anonymous":{"enabled":false}},"clusterDomain":"cluster.local","clusterDNS":["172.30.0.10","fd02::a"],"cgroupsPerQOS":false,"runtimeRequestTimeout":"10m0s","maxPods":250,"kubeAPIQPS":50,"kubeAPIBurst":100,"serializeImagePulls":false,"featureGates":{"LegacyNodeRoleBehavior":false,"NodeDisruptionExclusion":true,"RotateKubeletServerCertificate":true,"SCTPSupport":true,"ServiceNodeExclusion":true,"SupportPodPidsLimit":true,"IPv6DualStack":true},"containerLogMaxSize":"50Mi","containerLogMaxFiles":5,"systemReserved":{"cpu":"500m","ephemeral-storage":"1Gi","memory":"1Gi"},"enforceNodeAllocatable":[]}`),
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			bs := winNodeBootstrapper{installDir: instDir}
+			clusterDNS := tt.clusterDNS
+			if clusterDNS == nil {
+				clusterDNS = []string{"172.30.0.10"}
+			}
+			bs := winNodeBootstrapper{installDir: instDir, sizing: tt.sizing,
+				sizingHost: nodesizing.Static{MemoryBytes: 8 << 30, CPUs: 2}, clusterDNS: clusterDNS,
+				runtime: runtimeconf.Options{LogMaxSize: "50Mi", LogMaxFiles: 5}}
 			got, err := bs.createKubeletConf()
 			assert.NoError(t, err)
 			assert.Equalf(t, tt.want, got, "got = %v, want %v", string(got), string(tt.want))
@@ -339,26 +371,80 @@ func TestCloudConfInvalidNames(t *testing.T) {
 	assert.Error(t, err, "error not thrown on encountering invalid --cloud-config option")
 }
 
-// TestNewWinNodeBootstrapperWithInvalidCNIInputs tests if NewWinNodeBootstrapper returns the expected error on passing
-// invalid CNI inputs
-func TestNewWinNodeBootstrapperWithInvalidCNIInputs(t *testing.T) {
-	_, err := NewWinNodeBootstrapper("", "", "", "C:\\something", "")
+// TestVSphereCloudConfExtraction tests that the vSphere cloud config and the CA bundle it references are extracted
+// from the ignition file, with the CA bundle path rewritten to its location on the node
+func TestVSphereCloudConfExtraction(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wmcb")
+	require.NoError(t, err, "error creating temp directory")
+	// Ignore the return error as there is not much we can do if the temporary directory is not deleted
+	defer os.RemoveAll(dir)
+
+	cloudConf := "[Global]\nsecret-name = vsphere-creds\nsecret-namespace = kube-system\n" +
+		"ca-file = /etc/kubernetes/vsphere-ca.pem\n"
+	unit := "[Service]\nExecStart=/usr/bin/hyperkube \\\n    kubelet \\\n" +
+		"      --cloud-provider=vsphere \\\n      --cloud-config=/etc/kubernetes/cloud.conf \\\n      --v=4\n"
+	ignition, err := json.Marshal(map[string]interface{}{
+		"ignition": map[string]string{"version": "3.1.0"},
+		"storage": map[string]interface{}{"files": []map[string]interface{}{
+			{"path": "/etc/kubernetes/cloud.conf", "contents": map[string]string{"source": "data:," +
+				url.PathEscape(cloudConf)}},
+			{"path": "/etc/kubernetes/vsphere-ca.pem", "contents": map[string]string{"source": "data:,ca"}},
+		}},
+		"systemd": map[string]interface{}{"units": []map[string]interface{}{
+			{"name": kubeletSystemdName, "enabled": true, "contents": unit},
+		}},
+	})
+	require.NoError(t, err, "error creating ignition file contents")
+
+	wnb := winNodeBootstrapper{installDir: dir, kubeletArgs: make(map[string]string)}
+	require.NoError(t, wnb.parseIgnitionFileContents(ignition, map[string]fileTranslation{}),
+		"error parsing ignition file contents")
+
+	caFile := filepath.Join(dir, "vsphere-vsphere-ca.pem")
+	caContents, err := ioutil.ReadFile(caFile)
+	require.NoError(t, err, "CA bundle was not extracted")
+	assert.Equal(t, "ca", string(caContents))
+	confContents, err := ioutil.ReadFile(filepath.Join(dir, "cloud.conf"))
+	require.NoError(t, err, "cloud.conf was not extracted")
+	assert.Contains(t, string(confContents), `ca-file = "`+strings.ReplaceAll(caFile, `\`, `\\`)+`"`)
+
+	args := wnb.kubeletServiceArgs()
+	assert.Contains(t, args, "--cloud-provider=vsphere")
+	assert.Contains(t, args, "--cloud-config="+filepath.Join(dir, "cloud.conf"))
+	assert.Contains(t, args, "--v=4")
+}
+
+// TestNewWithInvalidCNIInputs tests if New returns the expected error on passing invalid CNI inputs
+func TestNewWithInvalidCNIInputs(t *testing.T) {
+	_, err := New(WithServiceManager(newFakeServiceManager()), WithCNI("C:\\something", ""))
 	require.Error(t, err, "no error thrown when cniDir is not empty and cniConfig is empty")
 	assert.Contains(t, err.Error(), "both cniDir and cniConfig need to be populated", "incorrect error thrown")
+	var inputErr *InvalidInputError
+	assert.True(t, errors.As(err, &inputErr), "error is not an InvalidInputError")
 
-	_, err = NewWinNodeBootstrapper("", "", "", "", "C:\\something")
+	_, err = New(WithServiceManager(newFakeServiceManager()), WithCNI("", "C:\\something"))
 	require.Error(t, err, "no error thrown when cniDir is empty and cniConfig not empty")
 	assert.Contains(t, err.Error(), "both cniDir and cniConfig need to be populated", "incorrect error thrown")
+
+	_, err = New(WithServiceManager(newFakeServiceManager()), WithCNI("C:\\something", "C:\\something"),
+		WithCNIOverlay("C:\\something", cniconf.Overlay{}))
+	require.Error(t, err, "no error thrown when both cniConfig and a CNI network are given")
+	assert.Contains(t, err.Error(), "cannot be combined with cniConfig", "incorrect error thrown")
+
+	_, err = New(WithServiceManager(newFakeServiceManager()), WithCNIManifest("C:\\something"))
+	require.Error(t, err, "no error thrown when a CNI manifest is given without cniDir")
+	assert.Contains(t, err.Error(), "a CNI manifest needs cniDir", "incorrect error thrown")
 }
 
-// TestWinNodeBootstrapperConfigureWithInvalidInputs tests if Configure returns the expected error when CNI inputs
-// are not present
-func TestWinNodeBootstrapperConfigureWithInvalidInputs(t *testing.T) {
-	wnb, err := NewWinNodeBootstrapper("", "", "", "", "")
+// TestConfigureCNIWithInvalidInputs tests if ConfigureCNI returns the expected error when CNI inputs are not present
+func TestConfigureCNIWithInvalidInputs(t *testing.T) {
+	wnb, err := New(WithServiceManager(newFakeServiceManager()))
 	require.NoError(t, err, "error instantiating bootstrapper")
-	err = wnb.Configure()
-	require.Error(t, err, "no error thrown when Configure is called with no CNI inputs")
+	err = wnb.ConfigureCNI(context.Background())
+	require.Error(t, err, "no error thrown when ConfigureCNI is called with no CNI inputs")
 	assert.Contains(t, err.Error(), "cannot configure without required plugin inputs")
+	var inputErr *InvalidInputError
+	assert.True(t, errors.As(err, &inputErr), "error is not an InvalidInputError")
 }
 
 // TestDeconstructKubeletCmd tests deconstructKubeletCmd() with valid and invalid inputs
@@ -443,6 +529,7 @@ func TestCNI(t *testing.T) {
 	t.Run("ensureDirIsPresent()", testCNIEnsureDirIsPresent)
 	// This can run only after ensureDirIsPresent() test is run
 	t.Run("copyFiles()", testCNICopyFiles)
+	t.Run("verifyManifest()", testCNIVerifyManifest)
 	t.Run("updateKubeletArgs()", testCNIUpdateKubeletArgs)
 }
 
@@ -486,6 +573,23 @@ func testCheckCNIInputs(t *testing.T) {
 		assert.Contains(t, err.Error(), "CNI config cannot be a directory", "incorrect error thrown")
 	})
 
+	t.Run("CNI config without its plugin", func(t *testing.T) {
+		config := filepath.Join(cniTest.k8sInstallDir, "bridge.conf")
+		require.NoError(t, ioutil.WriteFile(config, []byte(`{"name":"net","type":"win-bridge"}`), 0644))
+		err := checkCNIInputs(cniTest.k8sInstallDir, cniTest.dir, config)
+		assert.Error(t, err, "no error on passing CNI config without its plugin")
+		assert.Contains(t, err.Error(), "no win-bridge binary in CNI dir", "incorrect error thrown")
+	})
+
+	t.Run("invalid CNI config", func(t *testing.T) {
+		config := filepath.Join(cniTest.k8sInstallDir, "invalid.conf")
+		require.NoError(t, ioutil.WriteFile(config, []byte(`{"name":"net","type":"win-overlay",`+
+			`"ipam":{"subnet":"{{ ovn_host_subnet.stdout }}"}}`), 0644))
+		err := checkCNIInputs(cniTest.k8sInstallDir, cniTest.dir, config)
+		assert.Error(t, err, "no error on passing invalid CNI config")
+		assert.Contains(t, err.Error(), "invalid IPAM subnet", "incorrect error thrown")
+	})
+
 	t.Run("no files in CNI directory", func(t *testing.T) {
 		emptyCNIDir, err := ioutil.TempDir(cniTest.k8sInstallDir, "cni")
 		err = checkCNIInputs(cniTest.k8sInstallDir, emptyCNIDir, cniTest.config)
@@ -496,13 +600,32 @@ func testCheckCNIInputs(t *testing.T) {
 
 // testCNICopyFiles tests if copyCNIFiles() copies the CNI input binaries and config to the appropriate install location
 func testCNICopyFiles(t *testing.T) {
-	err := cniTest.cni.copyFiles()
+	err := cniTest.cni.copyFiles(context.Background())
 	assert.NoError(t, err, "unexpected error")
 	assert.FileExists(t, filepath.Join(cniTest.cni.k8sInstallDir, "cni", filepath.Base(cniTest.exe)), "CNI exe was not copied")
 	assert.FileExists(t, filepath.Join(cniTest.cni.k8sInstallDir, "cni", "config", filepath.Base(cniTest.cni.config)),
 		"CNI config file was not copied")
 }
 
+// testCNIVerifyManifest tests that the CNI binaries are verified against the digests listed in a manifest, which does
+// not list the CNI config
+func testCNIVerifyManifest(t *testing.T) {
+	manifest := filepath.Join(cniTest.k8sInstallDir, "cni.sha256")
+	digest := sha256.Sum256([]byte("win-overlay"))
+	require.NoError(t, ioutil.WriteFile(manifest, []byte(hex.EncodeToString(digest[:])+"  win-overlay.exe\n"), 0644))
+	assert.NoError(t, cniTest.cni.verifyManifest(manifest), "error verifying matching manifest")
+
+	digest = sha256.Sum256([]byte("corrupted"))
+	require.NoError(t, ioutil.WriteFile(manifest, []byte(hex.EncodeToString(digest[:])+"  win-overlay.exe\n"), 0644))
+	err := cniTest.cni.verifyManifest(manifest)
+	require.Error(t, err, "no error verifying mismatching manifest")
+	assert.Contains(t, err.Error(), "sha256 digest of win-overlay.exe", "incorrect error thrown")
+
+	err = cniTest.cni.verifyManifest(filepath.Join(cniTest.k8sInstallDir, "missing.sha256"))
+	require.Error(t, err, "no error verifying missing manifest")
+	assert.Contains(t, err.Error(), "error reading CNI manifest", "incorrect error thrown")
+}
+
 // checkKubeletCmd asserts that the CNI arguments were added correctly
 func checkKubeletCmd(t *testing.T, kubeletCmd string, cni *cniOptions) {
 	assert.True(t, strings.HasPrefix(kubeletCmd, "c:\\k\\kubelet.exe"), "kubelet.exe missing in kubelet args")
@@ -570,8 +693,9 @@ func TestKubeletDirectoriesCreation(t *testing.T) {
 		installDir:  dir,
 		logDir:      logDirectory,
 		kubeletArgs: make(map[string]string),
+		osInfo:      osinfo.Static{Build: 17763},
 	}
-	err = wnb.initializeKubeletFiles()
+	err = wnb.initializeKubeletFiles(context.Background())
 	assert.NoError(t, err, "error initializing kubelet files")
 	assert.DirExists(t, podManifestDirectory, "pod manifest directory was not created")
 	assert.DirExists(t, logDirectory, "log directory was not created")
@@ -0,0 +1,47 @@
+package bootstrapper
+
+import (
+	"context"
+	"time"
+)
+
+// uncancelableContext is a context that carries the values of its parent, but is never cancelled and has no deadline
+type uncancelableContext struct {
+	parent context.Context
+}
+
+func (uncancelableContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (uncancelableContext) Done() <-chan struct{} {
+	return nil
+}
+
+func (uncancelableContext) Err() error {
+	return nil
+}
+
+func (c uncancelableContext) Value(key interface{}) interface{} {
+	return c.parent.Value(key)
+}
+
+// withoutCancel returns a context that is not cancelled when the given context is. It is used for the steps that have
+// to be completed once they have begun, such as starting the kubelet again after it has been stopped, so that
+// cancelling an operation does not leave the node in an inconsistent state. These steps are still bounded by the
+// service wait time.
+func withoutCancel(ctx context.Context) context.Context {
+	return uncancelableContext{parent: ctx}
+}
+
+// sleep waits for the given duration, returning early with the context error if the context is cancelled
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
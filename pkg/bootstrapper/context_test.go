@@ -0,0 +1,61 @@
+package bootstrapper
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestSleep tests that sleep returns early when the context is cancelled
+func TestSleep(t *testing.T) {
+	assert.NoError(t, sleep(context.Background(), time.Millisecond))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	start := time.Now()
+	assert.Equal(t, context.Canceled, sleep(ctx, time.Minute))
+	assert.True(t, time.Since(start) < time.Second, "sleep did not return when the context was cancelled")
+}
+
+// TestWithoutCancel tests that the context returned by withoutCancel is not cancelled along with its parent, but
+// keeps its values
+func TestWithoutCancel(t *testing.T) {
+	type key struct{}
+	ctx, cancel := context.WithTimeout(context.WithValue(context.Background(), key{}, "value"), time.Millisecond)
+	detached := withoutCancel(ctx)
+	cancel()
+
+	assert.Error(t, ctx.Err())
+	assert.NoError(t, detached.Err())
+	assert.Nil(t, detached.Done())
+	_, hasDeadline := detached.Deadline()
+	assert.False(t, hasDeadline)
+	assert.Equal(t, "value", detached.Value(key{}))
+}
+
+// TestCopyFileCancelled tests that copyFile does not touch the destination once the context is cancelled
+func TestCopyFileCancelled(t *testing.T) {
+	dir, err := ioutil.TempDir("", "copy")
+	require.NoError(t, err, "error creating temp directory")
+	// Ignore the return error as there is not much we can do if the temporary directory is not deleted
+	defer os.RemoveAll(dir)
+	src := filepath.Join(dir, "src")
+	dest := filepath.Join(dir, "dest")
+	require.NoError(t, ioutil.WriteFile(src, []byte("contents"), 0644))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Equal(t, context.Canceled, copyFile(ctx, src, dest))
+	assert.NoFileExists(t, dest)
+
+	require.NoError(t, copyFile(context.Background(), src, dest))
+	contents, err := ioutil.ReadFile(dest)
+	require.NoError(t, err)
+	assert.Equal(t, "contents", string(contents))
+}
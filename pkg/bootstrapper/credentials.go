@@ -0,0 +1,224 @@
+package bootstrapper
+
+import (
+	"context"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/health"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/ignition"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/nodecerts"
+)
+
+const (
+	// apiServerProbeTimeout is the timeout of the request made to the API server /readyz endpoint
+	apiServerProbeTimeout = 10 * time.Second
+	// kubeletClientCertPattern matches the client certificates the kubelet obtained through its TLS bootstrap, including
+	// the kubelet-client-current.pem link to the one in use
+	kubeletClientCertPattern = "kubelet-client-*.pem"
+)
+
+// translateBootstrapKubeconfig applies the API server override to the bootstrap kubeconfig and validates it, so that
+// expired or incomplete bootstrap credentials are reported instead of leaving the kubelet looping on its TLS bootstrap
+func translateBootstrapKubeconfig(wmcb *winNodeBootstrapper, contents []byte) ([]byte, error) {
+	config, err := clientcmd.Load(contents)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing kubeconfig: %v", err)
+	}
+	if wmcb.apiServerOverride != "" {
+		if err = setServer(config, wmcb.apiServerOverride); err != nil {
+			return nil, fmt.Errorf("unable to override API server: %v", err)
+		}
+		if contents, err = clientcmd.Write(*config); err != nil {
+			return nil, fmt.Errorf("error writing kubeconfig: %v", err)
+		}
+	}
+	if _, err = nodecerts.ValidateBootstrapKubeconfig(config, time.Now()); err != nil {
+		return nil, fmt.Errorf("invalid bootstrap kubeconfig: %v", err)
+	}
+	return contents, nil
+}
+
+// probeAPIServerReady returns an error if the API server does not report ready when reached with the given bootstrap
+// kubeconfig. Nothing is probed unless probeAPIServer is set, or if no kubeconfig is given.
+func (wmcb *winNodeBootstrapper) probeAPIServerReady(ctx context.Context, kubeconfig []byte) error {
+	if !wmcb.probeAPIServer || kubeconfig == nil {
+		return nil
+	}
+	config, err := clientcmd.Load(kubeconfig)
+	if err != nil {
+		return fmt.Errorf("error parsing bootstrap kubeconfig: %v", err)
+	}
+	if err = checkReadyz(ctx, config, apiServerProbeTimeout); err != nil {
+		return fmt.Errorf("API server is not ready: %v", err)
+	}
+	return nil
+}
+
+// bootstrapKubeconfig returns the desired contents of the bootstrap kubeconfig if it is one of the given files
+func (wmcb *winNodeBootstrapper) bootstrapKubeconfig(files []nodeFile) []byte {
+	for _, f := range files {
+		if f.path == filepath.Join(wmcb.installDir, "bootstrap-kubeconfig") {
+			return f.contents
+		}
+	}
+	return nil
+}
+
+// setServer replaces the server of the cluster of the current context of the given kubeconfig
+func setServer(config *clientcmdapi.Config, server string) error {
+	if err := nodecerts.ValidateServer(server); err != nil {
+		return err
+	}
+	current, ok := config.Contexts[config.CurrentContext]
+	if !ok {
+		return fmt.Errorf("current context %q not found in kubeconfig", config.CurrentContext)
+	}
+	cluster, ok := config.Clusters[current.Cluster]
+	if !ok {
+		return fmt.Errorf("cluster %q not found in kubeconfig", current.Cluster)
+	}
+	cluster.Server = server
+	return nil
+}
+
+// apiServerClient returns a client for the API server of the current context of the given kubeconfig, authenticated
+// with the credentials of its user, along with the address of the API server
+func apiServerClient(config *clientcmdapi.Config, timeout time.Duration) (*http.Client, string, error) {
+	restConfig, err := clientcmd.NewDefaultClientConfig(*config, &clientcmd.ConfigOverrides{}).ClientConfig()
+	if err != nil {
+		return nil, "", err
+	}
+	transport, err := rest.TransportFor(restConfig)
+	if err != nil {
+		return nil, "", fmt.Errorf("error creating API server client: %v", err)
+	}
+	return &http.Client{Transport: transport, Timeout: timeout}, restConfig.Host, nil
+}
+
+// checkReadyz returns nil if the API server of the current context of the given kubeconfig reports ready on its
+// /readyz endpoint
+func checkReadyz(ctx context.Context, config *clientcmdapi.Config, timeout time.Duration) error {
+	client, server, err := apiServerClient(config, timeout)
+	if err != nil {
+		return err
+	}
+	return health.CheckHealthz(ctx, client, strings.TrimSuffix(server, "/")+"/readyz")
+}
+
+// RotateBootstrapCredentials replaces the bootstrap kubeconfig and the kubelet CA with the ones of the ignition given
+// to the bootstrapper, and restarts the kubelet so that it picks them up. With purgeClientCerts, the client
+// certificates in the certificate directory and the kubeconfig they are referenced from are removed as well, so that
+// the kubelet goes through its TLS bootstrap again. The kubelet service, and the services depending on it, are the
+// only ones restarted, and nothing is restarted if the credentials are up to date and no certificates are purged.
+func (wmcb *winNodeBootstrapper) RotateBootstrapCredentials(ctx context.Context, purgeClientCerts bool) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if wmcb.kubeletSVC == nil {
+		return kubeletNotInstalled()
+	}
+	files, err := wmcb.desiredCredentialFiles()
+	if err != nil {
+		return err
+	}
+	if err = wmcb.probeAPIServerReady(ctx, wmcb.bootstrapKubeconfig(files)); err != nil {
+		return err
+	}
+	outdated, err := outdatedFiles(files)
+	if err != nil {
+		return err
+	}
+	if len(outdated) == 0 && !purgeClientCerts {
+		wmcb.log.Info("bootstrap credentials are up to date")
+		return nil
+	}
+
+	// The kubelet is stopped while the credentials are replaced, as it may hold the client certificates open. Once it
+	// has been stopped, it is started again even if the context is cancelled.
+	wmcb.log.Info("rotating bootstrap credentials", "files", len(outdated), "purgeClientCerts", purgeClientCerts)
+	if err = wmcb.kubeletSVC.stop(withoutCancel(ctx)); err != nil {
+		return kubeletServiceError("stop", err)
+	}
+	rotateErr := writeFiles(withoutCancel(ctx), outdated)
+	if rotateErr == nil && purgeClientCerts {
+		rotateErr = wmcb.purgeClientCerts()
+	}
+	if err = wmcb.kubeletSVC.start(); err != nil {
+		if rotateErr != nil {
+			err = fmt.Errorf("%v, after failing to rotate bootstrap credentials: %v", err, rotateErr)
+		}
+		return kubeletServiceError("start", err)
+	}
+	if rotateErr != nil {
+		return rotateErr
+	}
+	return wmcb.verifyKubelet(ctx)
+}
+
+// desiredCredentialFiles returns the bootstrap kubeconfig and kubelet CA read from the ignition, along with where they
+// are written on the node
+func (wmcb *winNodeBootstrapper) desiredCredentialFiles() ([]nodeFile, error) {
+	contents, found, err := wmcb.readIgnition()
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, &InvalidInputError{Err: fmt.Errorf("an ignition file is required to rotate bootstrap credentials")}
+	}
+	configuration, err := ignition.Parse(contents)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse ignition file: %v", err)
+	}
+
+	var files []nodeFile
+	for _, path := range []string{ignition.BootstrapKubeconfigPath, ignition.KubeletCAPath} {
+		contents, found, err := ignition.ReadFile(configuration, path)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			return nil, fmt.Errorf("ignition file has no %s", path)
+		}
+		if path == ignition.KubeletCAPath {
+			if block, _ := pem.Decode(contents); block == nil {
+				return nil, fmt.Errorf("could not process %s: no PEM data found", path)
+			}
+		}
+		dest := wmcb.kubeletFilesToTranslate()[path]
+		if dest.translationFunc != nil {
+			if contents, err = dest.translationFunc(wmcb, contents); err != nil {
+				return nil, fmt.Errorf("could not process %s: %v", path, err)
+			}
+		}
+		files = append(files, nodeFile{path: dest.dest, contents: contents})
+	}
+	return files, nil
+}
+
+// purgeClientCerts removes the kubelet client certificates and the kubeconfig referencing them
+func (wmcb *winNodeBootstrapper) purgeClientCerts() error {
+	certs, err := filepath.Glob(filepath.Join(wmcb.certDir, kubeletClientCertPattern))
+	if err != nil {
+		return fmt.Errorf("unable to list kubelet client certificates: %v", err)
+	}
+	for _, path := range append(certs, wmcb.kubeconfigPath) {
+		if err = os.Remove(path); err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return fmt.Errorf("unable to remove %s: %v", path, err)
+		}
+		wmcb.log.Info("removed kubelet client credentials", "path", path)
+	}
+	return nil
+}
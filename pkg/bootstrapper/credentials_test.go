@@ -0,0 +1,249 @@
+package bootstrapper
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/windows/svc"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// testBootstrapKubeconfig returns a bootstrap kubeconfig with the given server and token, and a CA valid between the
+// given times
+func testBootstrapKubeconfig(t *testing.T, server, token string, notBefore, notAfter time.Time) []byte {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "kube-apiserver-lb-signer"},
+		NotBefore:             notBefore,
+		NotAfter:              notAfter,
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	return []byte(fmt.Sprintf(`apiVersion: v1
+clusters:
+- cluster:
+    certificate-authority-data: %s
+    server: %s
+  name: local
+contexts:
+- context:
+    cluster: local
+    user: kubelet
+  name: kubelet
+current-context: kubelet
+kind: Config
+users:
+- name: kubelet
+  user:
+    token: %q
+`, base64.StdEncoding.EncodeToString(ca), server, token))
+}
+
+// TestTranslateBootstrapKubeconfig tests that the bootstrap kubeconfig is validated and gets the API server override
+func TestTranslateBootstrapKubeconfig(t *testing.T) {
+	now := time.Now()
+	server := "https://api-int.cluster.example.com:6443"
+	tests := []struct {
+		name      string
+		contents  []byte
+		override  string
+		expServer string
+		errMsg    string
+	}{
+		{
+			name:      "valid kubeconfig",
+			contents:  testBootstrapKubeconfig(t, server, "secret", now.Add(-time.Hour), now.Add(time.Hour)),
+			expServer: server,
+		},
+		{
+			name:      "API server override",
+			contents:  testBootstrapKubeconfig(t, server, "secret", now.Add(-time.Hour), now.Add(time.Hour)),
+			override:  "https://10.0.0.10:6443",
+			expServer: "https://10.0.0.10:6443",
+		},
+		{
+			name:      "API server override of a cluster without server",
+			contents:  testBootstrapKubeconfig(t, "", "secret", now.Add(-time.Hour), now.Add(time.Hour)),
+			override:  "https://10.0.0.10:6443",
+			expServer: "https://10.0.0.10:6443",
+		},
+		{
+			name:     "invalid API server override",
+			contents: testBootstrapKubeconfig(t, server, "secret", now.Add(-time.Hour), now.Add(time.Hour)),
+			override: "10.0.0.10:6443",
+			errMsg:   "unable to override API server",
+		},
+		{
+			name:     "expired CA",
+			contents: testBootstrapKubeconfig(t, server, "secret", now.Add(-2*time.Hour), now.Add(-time.Hour)),
+			errMsg:   "invalid bootstrap kubeconfig: no valid CA certificate",
+		},
+		{
+			name:     "missing token",
+			contents: testBootstrapKubeconfig(t, server, "", now.Add(-time.Hour), now.Add(time.Hour)),
+			errMsg:   "invalid bootstrap kubeconfig: kubeconfig has no token",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wmcb := &winNodeBootstrapper{apiServerOverride: tt.override}
+			out, err := translateBootstrapKubeconfig(wmcb, tt.contents)
+			if tt.errMsg != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.errMsg)
+				return
+			}
+			require.NoError(t, err)
+			config, err := clientcmd.Load(out)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expServer, config.Clusters[config.Contexts[config.CurrentContext].Cluster].Server)
+		})
+	}
+}
+
+// TestCheckReadyz tests probing the readyz endpoint of the API server with the CA and credentials of the kubeconfig
+func TestCheckReadyz(t *testing.T) {
+	ready := true
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/readyz" || r.Header.Get("Authorization") != "Bearer secret" || !ready {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "wmcb")
+	require.NoError(t, err, "error creating temp directory")
+	defer os.RemoveAll(dir)
+	tokenFile := filepath.Join(dir, "token")
+	require.NoError(t, ioutil.WriteFile(tokenFile, []byte("secret"), 0600))
+
+	config := clientcmdapi.NewConfig()
+	config.Clusters["local"] = &clientcmdapi.Cluster{Server: server.URL,
+		CertificateAuthorityData: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})}
+	config.AuthInfos["kubelet"] = &clientcmdapi.AuthInfo{Token: "secret"}
+	config.AuthInfos["kubelet-token-file"] = &clientcmdapi.AuthInfo{TokenFile: tokenFile}
+	config.Contexts["kubelet"] = &clientcmdapi.Context{Cluster: "local", AuthInfo: "kubelet"}
+	config.Contexts["kubelet-token-file"] = &clientcmdapi.Context{Cluster: "local", AuthInfo: "kubelet-token-file"}
+
+	config.CurrentContext = "kubelet"
+	assert.NoError(t, checkReadyz(context.Background(), config, 10*time.Second))
+	config.CurrentContext = "kubelet-token-file"
+	assert.NoError(t, checkReadyz(context.Background(), config, 10*time.Second), "token file not used")
+
+	ready = false
+	assert.Error(t, checkReadyz(context.Background(), config, 10*time.Second),
+		"no error returned for an API server that is not ready")
+}
+
+// credentialsIgnition returns an ignition file holding the given bootstrap kubeconfig and kubelet CA
+func credentialsIgnition(t *testing.T, kubeconfig, ca []byte) []byte {
+	contents, err := json.Marshal(map[string]interface{}{
+		"ignition": map[string]string{"version": "3.1.0"},
+		"storage": map[string]interface{}{
+			"files": []map[string]interface{}{
+				{"path": "/etc/kubernetes/kubeconfig",
+					"contents": map[string]string{"source": "data:," + url.PathEscape(string(kubeconfig))}},
+				{"path": "/etc/kubernetes/kubelet-ca.crt",
+					"contents": map[string]string{"source": "data:," + url.PathEscape(string(ca))}},
+			},
+		},
+	})
+	require.NoError(t, err)
+	return contents
+}
+
+// TestRotateBootstrapCredentials tests that only the bootstrap kubeconfig and kubelet CA are replaced, that the client
+// certificates are purged on request and that the kubelet is only restarted when something changed
+func TestRotateBootstrapCredentials(t *testing.T) {
+	installDir, err := ioutil.TempDir("", "wmcb")
+	require.NoError(t, err, "error creating temp directory")
+	// Ignore the return error as there is not much we can do if the temporary directory is not deleted
+	defer os.RemoveAll(installDir)
+	certDir := filepath.Join(installDir, "pki")
+	require.NoError(t, os.MkdirAll(certDir, 0755))
+	for _, name := range []string{"kubelet-client-current.pem", "kubelet-client-2020-01-01.pem",
+		"kubelet-server-current.pem"} {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(certDir, name), []byte(name), 0644))
+	}
+	require.NoError(t, ioutil.WriteFile(filepath.Join(installDir, "kubeconfig"), []byte("kubeconfig"), 0644))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(installDir, "kubelet.conf"), []byte("kubelet.conf"), 0644))
+
+	now := time.Now()
+	kubeconfig := testBootstrapKubeconfig(t, "https://api-int.cluster.example.com:6443", "secret",
+		now.Add(-time.Hour), now.Add(time.Hour))
+	ca := []byte("-----BEGIN CERTIFICATE-----\nY2E=\n-----END CERTIFICATE-----\n")
+	kubelet := &fakeService{serviceName: KubeletServiceName, state: svc.Running}
+	svcMgr := newFakeServiceManager(kubelet)
+	rotate := func(purge bool) error {
+		wmcb := newTestBootstrapper(t, installDir, "", svcMgr)
+		wmcb.certDir = certDir
+		wmcb.ignitionContents = credentialsIgnition(t, kubeconfig, ca)
+		return wmcb.RotateBootstrapCredentials(context.Background(), purge)
+	}
+
+	require.NoError(t, rotate(false))
+	assert.Equal(t, 1, kubelet.stops, "kubelet was not restarted")
+	assert.Equal(t, svc.Running, kubelet.state, "kubelet is not running")
+	written, err := ioutil.ReadFile(filepath.Join(installDir, "bootstrap-kubeconfig"))
+	require.NoError(t, err)
+	assert.Equal(t, kubeconfig, written)
+	written, err = ioutil.ReadFile(filepath.Join(installDir, "kubelet-ca.crt"))
+	require.NoError(t, err)
+	assert.Equal(t, ca, written)
+	assert.FileExists(t, filepath.Join(certDir, "kubelet-client-current.pem"), "client certificate was purged")
+	conf, err := ioutil.ReadFile(filepath.Join(installDir, "kubelet.conf"))
+	require.NoError(t, err)
+	assert.Equal(t, "kubelet.conf", string(conf), "kubelet.conf was changed")
+
+	t.Run("up to date", func(t *testing.T) {
+		require.NoError(t, rotate(false))
+		assert.Equal(t, 1, kubelet.stops, "kubelet was restarted even though nothing changed")
+	})
+
+	t.Run("purge client certificates", func(t *testing.T) {
+		require.NoError(t, rotate(true))
+		assert.Equal(t, 2, kubelet.stops, "kubelet was not restarted")
+		assert.NoFileExists(t, filepath.Join(certDir, "kubelet-client-current.pem"))
+		assert.NoFileExists(t, filepath.Join(certDir, "kubelet-client-2020-01-01.pem"))
+		assert.NoFileExists(t, filepath.Join(installDir, "kubeconfig"))
+		assert.FileExists(t, filepath.Join(certDir, "kubelet-server-current.pem"), "server certificate was purged")
+	})
+
+	t.Run("expired bootstrap credentials", func(t *testing.T) {
+		kubeconfig = testBootstrapKubeconfig(t, "https://api-int.cluster.example.com:6443", "secret",
+			now.Add(-2*time.Hour), now.Add(-time.Hour))
+		err := rotate(false)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "no valid CA certificate")
+		assert.Equal(t, 2, kubelet.stops, "kubelet was restarted with invalid credentials")
+	})
+}
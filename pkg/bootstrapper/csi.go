@@ -0,0 +1,330 @@
+package bootstrapper
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/svc/mgr"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/csiproxy"
+)
+
+/*
+	CSI node plugins run in containers on Windows, which cannot perform privileged storage operations. csi-proxy runs
+	on the host as a Windows service and performs them on behalf of the plugins, which reach it through a named pipe per
+	API group and version. The plugins register with the kubelet through sockets in the plugin registration directory
+	of the kubelet root dir, which the kubelet watches, so that CSI does not require restarting the kubelet unless its
+	root dir has to be changed.
+*/
+
+const (
+	// csiProxyExe is the name of the csi-proxy binary in the install dir
+	csiProxyExe = "csi-proxy.exe"
+	// rootDirOption is the kubelet CLI option setting the directory the kubelet keeps its state in
+	rootDirOption = "--root-dir"
+	// csiPipeInterval is how often the csi-proxy named pipes are looked for after csi-proxy has been started
+	csiPipeInterval = time.Second
+)
+
+// csiKubeletOptions are the kubelet CLI options that configure-csi adds to the kubelet service. They are carried over
+// when reconciling the kubelet service, in the same way as the CNI options.
+var csiKubeletOptions = []string{rootDirOption}
+
+// csiOptions is responsible for installing csi-proxy and preparing the kubelet for the CSI node plugins
+type csiOptions struct {
+	// proxyPath is the input csi-proxy binary
+	proxyPath string
+	// binPath is where the csi-proxy binary is installed
+	binPath string
+	// logDir is the directory csi-proxy writes its log to
+	logDir string
+	// kubeletRootDir is the directory the kubelet keeps its state in, where the plugin directories are created
+	kubeletRootDir string
+	// apiVersions are the csi-proxy API versions the CSI node plugins of the node use
+	apiVersions csiproxy.APIVersions
+	// pipeExists returns true if the named pipe is present. It is replaced in unit tests.
+	pipeExists func(name string) bool
+}
+
+// newCSIOptions returns the csiOptions installing the given csi-proxy binary to the install dir. The default kubelet
+// root dir and API versions are used if they are not given.
+func newCSIOptions(installDir, logDir, proxyPath, kubeletRootDir string,
+	apiVersions csiproxy.APIVersions) (*csiOptions, error) {
+	info, err := os.Stat(proxyPath)
+	if err != nil {
+		return nil, fmt.Errorf("error accessing csi-proxy binary %s: %v", proxyPath, err)
+	}
+	if info.IsDir() {
+		return nil, fmt.Errorf("csi-proxy binary %s cannot be a directory", proxyPath)
+	}
+	if kubeletRootDir == "" {
+		kubeletRootDir = csiproxy.DefaultKubeletRootDir
+	}
+	if apiVersions == nil {
+		apiVersions = csiproxy.DefaultAPIVersions()
+	}
+	if err = apiVersions.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid csi-proxy API versions: %v", err)
+	}
+	return &csiOptions{
+		proxyPath:      proxyPath,
+		binPath:        filepath.Join(installDir, csiProxyExe),
+		logDir:         logDir,
+		kubeletRootDir: kubeletRootDir,
+		apiVersions:    apiVersions,
+		pipeExists:     pipeExists,
+	}, nil
+}
+
+// pipeExists returns true if the named pipe is present. The attributes of the pipe are read instead of opening it, as
+// opening it would take up one of the instances csi-proxy serves.
+func pipeExists(name string) bool {
+	path, err := windows.UTF16PtrFromString(name)
+	if err != nil {
+		return false
+	}
+	_, err = windows.GetFileAttributes(path)
+	return err == nil
+}
+
+// pluginDirs returns the directories the CSI node plugins place their registration sockets and endpoints in
+func (csi *csiOptions) pluginDirs() []string {
+	return []string{
+		filepath.Join(csi.kubeletRootDir, csiproxy.PluginRegistryDirName),
+		filepath.Join(csi.kubeletRootDir, csiproxy.PluginsDirName),
+	}
+}
+
+// ensurePluginDirs creates the plugin directories if they are not present
+func (csi *csiOptions) ensurePluginDirs() error {
+	for _, dir := range csi.pluginDirs() {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// serviceArgs returns the arguments the csi-proxy service is run with
+func (csi *csiOptions) serviceArgs() []string {
+	return []string{
+		"-windows-service",
+		"-logtostderr=false",
+		"-log_file=" + filepath.Join(csi.logDir, "csi-proxy.log"),
+	}
+}
+
+// serviceCmd returns the command line the csi-proxy service should run with, escaped in the same way the Windows
+// service API escapes the command line when the service is created
+func (csi *csiOptions) serviceCmd() string {
+	cmd := syscall.EscapeArg(csi.binPath)
+	for _, arg := range csi.serviceArgs() {
+		cmd += " " + syscall.EscapeArg(arg)
+	}
+	return cmd
+}
+
+// serviceConfig returns the Windows service config for the csi-proxy service
+func (csi *csiOptions) serviceConfig() mgr.Config {
+	return mgr.Config{
+		// StartAutomatic will start the service again if the node restarts
+		StartType:   mgr.StartAutomatic,
+		Description: "CSI Proxy",
+	}
+}
+
+// desiredServiceConfig returns the desired csi-proxy service config given the current one, along with whether the
+// service needs to be updated
+func (csi *csiOptions) desiredServiceConfig(current mgr.Config) (mgr.Config, bool) {
+	desired := current
+	defaults := csi.serviceConfig()
+	desired.BinaryPathName = csi.serviceCmd()
+	desired.StartType = defaults.StartType
+	desired.Description = defaults.Description
+	return desired, !reflect.DeepEqual(current, desired)
+}
+
+// waitForPipes waits up to the given timeout for csi-proxy to listen on the named pipes of the API versions, so that a
+// csi-proxy that does not serve them is reported before the CSI node plugins are scheduled onto the node
+func (csi *csiOptions) waitForPipes(ctx context.Context, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for _, pipe := range csi.apiVersions.Pipes() {
+		for !csi.pipeExists(pipe) {
+			if time.Now().After(deadline) {
+				return fmt.Errorf("%s is not present after %v", pipe, timeout)
+			}
+			if err := sleep(ctx, csiPipeInterval); err != nil {
+				return fmt.Errorf("stopped waiting for %s: %v", pipe, err)
+			}
+		}
+	}
+	return nil
+}
+
+// updateKubeletArgs updates the given kubelet command with the CSI args. The kubelet root dir is only set if it is not
+// the default one, or if the kubelet is already given one, so that the kubelet command is left alone otherwise.
+func (csi *csiOptions) updateKubeletArgs(kubeletCmd *string) error {
+	if kubeletCmd == nil {
+		return fmt.Errorf("nil kubelet cmd passed")
+	}
+	kubeletKeyValueArgs, err := deconstructKubeletCmd(kubeletCmd)
+	if err != nil {
+		return fmt.Errorf("unable to deconstruct kubelet command %s: %v", *kubeletCmd, err)
+	}
+
+	current, found := kubeletKeyValueArgs[rootDirOption]
+	// Windows paths are case insensitive
+	if !found && strings.EqualFold(filepath.Clean(csi.kubeletRootDir), csiproxy.DefaultKubeletRootDir) {
+		return nil
+	}
+	if found && strings.EqualFold(filepath.Clean(current), filepath.Clean(csi.kubeletRootDir)) {
+		return nil
+	}
+	kubeletKeyValueArgs[rootDirOption] = csi.kubeletRootDir
+
+	if *kubeletCmd, err = reconstructKubeletCmd(kubeletKeyValueArgs); err != nil {
+		return fmt.Errorf("unable to reconstruct kubelet command %v: %v", kubeletKeyValueArgs, err)
+	}
+	return nil
+}
+
+// csiProxyServiceError returns a ServiceError for the given action on the csi-proxy service
+func csiProxyServiceError(action string, err error) error {
+	return &ServiceError{Service: csiproxy.ServiceName, Action: action, Err: err}
+}
+
+// reconcileCSIProxy installs the csi-proxy binary and creates the csi-proxy service if it is not present. Otherwise the
+// service is only stopped, to replace its binary or update its config, if either differs from the desired state. The
+// service is left running in both cases. Once csi-proxy has been stopped, the changes are applied even if the context
+// is cancelled, so that csi-proxy is not left stopped.
+func (wmcb *winNodeBootstrapper) reconcileCSIProxy(ctx context.Context) error {
+	outdated, err := outdatedFiles([]nodeFile{{path: wmcb.csi.binPath, src: wmcb.csi.proxyPath}})
+	if err != nil {
+		return fmt.Errorf("unable to determine csi-proxy files: %v", err)
+	}
+
+	service, err := wmcb.svcMgr.OpenService(csiproxy.ServiceName)
+	if err != nil {
+		if err = writeFiles(ctx, outdated); err != nil {
+			return fmt.Errorf("unable to install csi-proxy: %v", err)
+		}
+		service, err = wmcb.svcMgr.CreateService(csiproxy.ServiceName, wmcb.csi.binPath, wmcb.csi.serviceConfig(),
+			wmcb.csi.serviceArgs()...)
+		if err != nil {
+			return csiProxyServiceError("create", err)
+		}
+		defer service.Close()
+		if err = setServiceRecoveryActions(service, wmcb.recoveryPolicy); err != nil {
+			return csiProxyServiceError("set recovery actions of", err)
+		}
+		if err = startService(service); err != nil {
+			return csiProxyServiceError("start", err)
+		}
+		return nil
+	}
+	defer service.Close()
+
+	current, err := service.Config()
+	if err != nil {
+		return csiProxyServiceError("query", err)
+	}
+	desired, changed := wmcb.csi.desiredServiceConfig(current)
+	if len(outdated) != 0 || changed {
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+		critical := withoutCancel(ctx)
+		// csi-proxy.exe cannot be replaced while it is running
+		if err = stopService(critical, service, wmcb.serviceWaitTime); err != nil {
+			return csiProxyServiceError("stop", err)
+		}
+		if err = writeFiles(critical, outdated); err != nil {
+			return fmt.Errorf("unable to install csi-proxy: %v", err)
+		}
+		if changed {
+			if err = service.UpdateConfig(desired); err != nil {
+				return csiProxyServiceError("update", err)
+			}
+		}
+	}
+	if err = startService(service); err != nil {
+		return csiProxyServiceError("start", err)
+	}
+	return nil
+}
+
+// configureCSI installs csi-proxy as a Windows service, creates the directories the CSI node plugins register with the
+// kubelet through, waits for csi-proxy to serve the API versions the plugins use, and updates the kubelet arguments if
+// they need to change. Only the differences are applied: csi-proxy is only restarted if its binary or service config
+// changed, and the kubelet only if its arguments changed.
+func (wmcb *winNodeBootstrapper) configureCSI(ctx context.Context) error {
+	if wmcb.csi == nil {
+		return &InvalidInputError{Err: fmt.Errorf("cannot configure CSI without the csi-proxy binary")}
+	}
+	// The kubelet has to be present for the plugins to register with it
+	if wmcb.kubeletSVC == nil {
+		return kubeletNotInstalled()
+	}
+
+	if err := wmcb.csi.ensurePluginDirs(); err != nil {
+		return fmt.Errorf("unable to create CSI plugin directories: %v", err)
+	}
+	if err := wmcb.reconcileCSIProxy(ctx); err != nil {
+		return err
+	}
+	if err := wmcb.csi.waitForPipes(ctx, wmcb.serviceWaitTime); err != nil {
+		return fmt.Errorf("csi-proxy is not serving the expected API versions: %v", err)
+	}
+
+	config, err := wmcb.kubeletSVC.config()
+	if err != nil {
+		return fmt.Errorf("error getting kubelet service config: %v", err)
+	}
+	desiredCmd := config.BinaryPathName
+	if err = wmcb.csi.updateKubeletArgs(&desiredCmd); err != nil {
+		return fmt.Errorf("unable to update the kubelet arguments: %v", err)
+	}
+	argsChanged, err := kubeletCmdChanged(config.BinaryPathName, desiredCmd)
+	if err != nil {
+		return fmt.Errorf("unable to compare the kubelet arguments: %v", err)
+	}
+	if !argsChanged {
+		// Nothing has changed, but the kubelet should still be running
+		if err = wmcb.kubeletSVC.start(); err != nil {
+			return kubeletServiceError("start", err)
+		}
+		return nil
+	}
+
+	config.BinaryPathName = desiredCmd
+	if err = wmcb.applyKubeletChanges(ctx, nil, &config); err != nil {
+		return fmt.Errorf("error configuring kubelet service for CSI: %v", err)
+	}
+	if err = wmcb.verifyKubelet(ctx); err != nil {
+		return fmt.Errorf("kubelet windows service is not healthy: %w", err)
+	}
+	return nil
+}
+
+// removeCSIProxy stops and removes the csi-proxy service if it is present
+func (wmcb *winNodeBootstrapper) removeCSIProxy(ctx context.Context) error {
+	service, err := wmcb.svcMgr.OpenService(csiproxy.ServiceName)
+	if err != nil {
+		return nil
+	}
+	defer service.Close()
+	if err = stopService(ctx, service, wmcb.serviceWaitTime); err != nil {
+		return csiProxyServiceError("stop", err)
+	}
+	if err = service.Delete(); err != nil {
+		return csiProxyServiceError("remove", err)
+	}
+	return nil
+}
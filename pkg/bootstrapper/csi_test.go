@@ -0,0 +1,147 @@
+package bootstrapper
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/csiproxy"
+)
+
+// TestConfigureCSI tests that configureCSI installs and starts csi-proxy, creates the plugin directories, and only
+// restarts csi-proxy and the kubelet when something has changed
+func TestConfigureCSI(t *testing.T) {
+	installDir, err := ioutil.TempDir("", "wmcb")
+	require.NoError(t, err, "error creating temp directory")
+	// Ignore the return error as there is not much we can do if the temporary directory is not deleted
+	defer os.RemoveAll(installDir)
+	srcDir, err := ioutil.TempDir("", "csi")
+	require.NoError(t, err, "error creating temp directory")
+	defer os.RemoveAll(srcDir)
+
+	proxyPath := filepath.Join(srcDir, csiProxyExe)
+	require.NoError(t, ioutil.WriteFile(proxyPath, []byte("csi-proxy v1"), 0644))
+	rootDir := filepath.Join(installDir, "kubelet-root")
+	kubelet := &fakeService{
+		serviceName: KubeletServiceName,
+		config: mgr.Config{BinaryPathName: filepath.Join(installDir, "kubelet.exe") +
+			" --windows-service --config=" + filepath.Join(installDir, "kubelet.conf")},
+		state: svc.Running,
+	}
+	svcMgr := newFakeServiceManager(kubelet)
+	// servedPipes are the named pipes the fake csi-proxy listens on
+	servedPipes := map[string]bool{}
+	for _, pipe := range csiproxy.DefaultAPIVersions().Pipes() {
+		servedPipes[pipe] = true
+	}
+
+	configureCSI := func(apiVersions csiproxy.APIVersions) error {
+		wmcb := newTestBootstrapper(t, installDir, "", svcMgr)
+		var err error
+		wmcb.csi, err = newCSIOptions(installDir, wmcb.logDir, proxyPath, rootDir, apiVersions)
+		require.NoError(t, err, "error initializing CSI options")
+		wmcb.csi.pipeExists = func(name string) bool { return servedPipes[name] }
+		return wmcb.configureCSI(context.Background())
+	}
+
+	require.NoError(t, configureCSI(nil), "error configuring CSI")
+	proxy, found := svcMgr.services[csiproxy.ServiceName]
+	require.True(t, found, "csi-proxy service was not created")
+	assert.Equal(t, svc.Running, proxy.state, "csi-proxy service is not running")
+	assert.Equal(t, 1, proxy.starts)
+	assert.NotEmpty(t, proxy.recoveryActions, "csi-proxy recovery actions were not set")
+	assert.FileExists(t, filepath.Join(installDir, csiProxyExe), "csi-proxy binary was not installed")
+	assert.DirExists(t, filepath.Join(rootDir, csiproxy.PluginRegistryDirName))
+	assert.DirExists(t, filepath.Join(rootDir, csiproxy.PluginsDirName))
+	assert.Equal(t, 1, kubelet.starts, "kubelet was not restarted with the kubelet root dir")
+	assert.Contains(t, kubelet.config.BinaryPathName, rootDirOption+"="+rootDir)
+
+	t.Run("no changes", func(t *testing.T) {
+		require.NoError(t, configureCSI(nil), "error configuring CSI")
+		assert.Equal(t, 1, proxy.starts, "csi-proxy was restarted even though nothing changed")
+		assert.Equal(t, 0, proxy.stops, "csi-proxy was stopped even though nothing changed")
+		assert.Equal(t, 1, kubelet.starts, "kubelet was restarted even though nothing changed")
+	})
+
+	t.Run("csi-proxy binary changed", func(t *testing.T) {
+		require.NoError(t, ioutil.WriteFile(proxyPath, []byte("v2"), 0644))
+		require.NoError(t, configureCSI(nil), "error configuring CSI")
+		assert.Equal(t, 2, proxy.starts, "csi-proxy was not restarted")
+		assert.Equal(t, 1, kubelet.starts, "kubelet was restarted even though its arguments did not change")
+		contents, err := ioutil.ReadFile(filepath.Join(installDir, csiProxyExe))
+		require.NoError(t, err)
+		assert.Equal(t, "v2", string(contents), "csi-proxy binary was not replaced")
+	})
+
+	t.Run("stopped csi-proxy is started", func(t *testing.T) {
+		proxy.state = svc.Stopped
+		require.NoError(t, configureCSI(nil), "error configuring CSI")
+		assert.Equal(t, svc.Running, proxy.state, "csi-proxy service is not running")
+		assert.Equal(t, 3, proxy.starts)
+	})
+
+	t.Run("API version not served", func(t *testing.T) {
+		wmcb := newTestBootstrapper(t, installDir, "", svcMgr)
+		wmcb.serviceWaitTime = 0
+		var err error
+		wmcb.csi, err = newCSIOptions(installDir, wmcb.logDir, proxyPath, rootDir, csiproxy.APIVersions{"smb": "v1"})
+		require.NoError(t, err, "error initializing CSI options")
+		wmcb.csi.pipeExists = func(name string) bool { return servedPipes[name] }
+		err = wmcb.configureCSI(context.Background())
+		require.Error(t, err, "missing named pipe not reported")
+		assert.Contains(t, err.Error(), csiproxy.PipeName("smb", "v1"))
+	})
+}
+
+// TestCSIUpdateKubeletArgs tests that the kubelet root dir is only set when it is not the default one
+func TestCSIUpdateKubeletArgs(t *testing.T) {
+	kubeletCmd := `C:\k\kubelet.exe --windows-service --config=C:\k\kubelet.conf`
+	tests := []struct {
+		name     string
+		cmd      string
+		rootDir  string
+		expected string
+	}{
+		{
+			name:     "default root dir",
+			cmd:      kubeletCmd,
+			rootDir:  csiproxy.DefaultKubeletRootDir,
+			expected: kubeletCmd,
+		},
+		{
+			name:     "default root dir in another case",
+			cmd:      kubeletCmd,
+			rootDir:  `c:\VAR\lib\kubelet\`,
+			expected: kubeletCmd,
+		},
+		{
+			name:     "custom root dir",
+			cmd:      kubeletCmd,
+			rootDir:  `D:\kubelet`,
+			expected: kubeletCmd + ` --root-dir=D:\kubelet`,
+		},
+		{
+			name:     "root dir back to the default",
+			cmd:      kubeletCmd + ` --root-dir=D:\kubelet`,
+			rootDir:  csiproxy.DefaultKubeletRootDir,
+			expected: kubeletCmd + ` --root-dir=C:\var\lib\kubelet`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			csi := &csiOptions{kubeletRootDir: test.rootDir}
+			cmd := test.cmd
+			require.NoError(t, csi.updateKubeletArgs(&cmd))
+			changed, err := kubeletCmdChanged(test.expected, cmd)
+			require.NoError(t, err)
+			assert.False(t, changed, "expected %s, got %s", test.expected, cmd)
+		})
+	}
+}
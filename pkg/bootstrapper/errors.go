@@ -0,0 +1,84 @@
+package bootstrapper
+
+import (
+	"fmt"
+	"strings"
+)
+
+// errServiceNotInstalled is the cause of a ServiceError for a service that is not present on the node
+var errServiceNotInstalled = fmt.Errorf("service is not present")
+
+// InvalidInputError is returned when the options given to the bootstrapper are missing or invalid. Retrying with the
+// same options fails in the same way.
+type InvalidInputError struct {
+	// Err describes what is wrong with the options
+	Err error
+}
+
+func (e *InvalidInputError) Error() string {
+	return fmt.Sprintf("invalid bootstrapper input: %v", e.Err)
+}
+
+func (e *InvalidInputError) Unwrap() error {
+	return e.Err
+}
+
+// ServiceError is returned when a Windows service cannot be found or controlled through the service manager
+type ServiceError struct {
+	// Service is the name of the Windows service
+	Service string
+	// Action is what was being done to the service, such as create or start
+	Action string
+	// Err is the error returned by the service manager
+	Err error
+}
+
+func (e *ServiceError) Error() string {
+	if e.NotInstalled() {
+		return fmt.Sprintf("%s service is not present", e.Service)
+	}
+	return fmt.Sprintf("failed to %s %s windows service: %v", e.Action, e.Service, e.Err)
+}
+
+func (e *ServiceError) Unwrap() error {
+	return e.Err
+}
+
+// NotInstalled returns true if the error was caused by the service not being present on the node
+func (e *ServiceError) NotInstalled() bool {
+	return e.Err == errServiceNotInstalled
+}
+
+// KubeletHealthError is returned when the kubelet does not report healthy after it has been started
+type KubeletHealthError struct {
+	// Err describes why the kubelet is considered unhealthy
+	Err error
+	// LogPath is the kubelet log the tail is read from
+	LogPath string
+	// LogTail holds the last lines of the kubelet log. It is empty if the log could not be read.
+	LogTail []string
+	// logErr is the error reading the kubelet log
+	logErr error
+}
+
+func (e *KubeletHealthError) Error() string {
+	if e.logErr != nil {
+		return fmt.Sprintf("%v (unable to read %s: %v)", e.Err, e.LogPath, e.logErr)
+	}
+	return fmt.Sprintf("%v\nlast %d lines of %s:\n%s", e.Err, len(e.LogTail), e.LogPath,
+		strings.Join(e.LogTail, "\n"))
+}
+
+func (e *KubeletHealthError) Unwrap() error {
+	return e.Err
+}
+
+// kubeletServiceError returns a ServiceError for the given action on the kubelet service
+func kubeletServiceError(action string, err error) error {
+	return &ServiceError{Service: KubeletServiceName, Action: action, Err: err}
+}
+
+// kubeletNotInstalled returns the error for operations that require the kubelet service to be present
+func kubeletNotInstalled() error {
+	return &ServiceError{Service: KubeletServiceName, Err: errServiceNotInstalled}
+}
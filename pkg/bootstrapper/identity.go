@@ -0,0 +1,28 @@
+package bootstrapper
+
+import (
+	"context"
+	"fmt"
+)
+
+// resolveNodeIdentity determines the IP address and the hostname the kubelet registers the node with
+func (wmcb *winNodeBootstrapper) resolveNodeIdentity(ctx context.Context) error {
+	identity, err := wmcb.identityResolver.Resolve(ctx, wmcb.nodeIdentity)
+	if err != nil {
+		return fmt.Errorf("unable to determine node identity: %v", err)
+	}
+	wmcb.identity = identity
+	return nil
+}
+
+// identityKubeletArgs returns the kubelet arguments setting the node IP and hostname, if they were determined by WMCB
+func (wmcb *winNodeBootstrapper) identityKubeletArgs() []string {
+	var args []string
+	if wmcb.identity.NodeIP != "" {
+		args = append(args, "--node-ip="+wmcb.identity.NodeIP)
+	}
+	if wmcb.identity.Hostname != "" {
+		args = append(args, "--hostname-override="+wmcb.identity.Hostname)
+	}
+	return args
+}
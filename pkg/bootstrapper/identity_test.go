@@ -0,0 +1,40 @@
+package bootstrapper
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/nodeidentity"
+)
+
+// fakeInterfaces is a nodeidentity.InterfaceLister returning fixed interfaces
+type fakeInterfaces []nodeidentity.Interface
+
+func (f fakeInterfaces) Interfaces() ([]nodeidentity.Interface, error) {
+	return f, nil
+}
+
+// TestNodeIdentity tests that the resolved node IP and hostname are passed to the kubelet
+func TestNodeIdentity(t *testing.T) {
+	wmcb := &winNodeBootstrapper{}
+	require.NoError(t, wmcb.resolveNodeIdentity(context.Background()), "error resolving empty node identity")
+	assert.Empty(t, wmcb.identityKubeletArgs(), "node identity set even though it was left to the kubelet")
+
+	wmcb = &winNodeBootstrapper{
+		nodeIdentity: nodeidentity.Options{NodeIPInterface: "Ethernet 2", Hostname: "WIN-Node-1"},
+		identityResolver: nodeidentity.Resolver{Interfaces: fakeInterfaces{
+			{Name: "Ethernet", Addrs: []net.IP{net.ParseIP("10.0.1.5")}},
+			{Name: "Ethernet 2", Addrs: []net.IP{net.ParseIP("192.168.10.7")}},
+		}},
+	}
+	require.NoError(t, wmcb.resolveNodeIdentity(context.Background()), "error resolving node identity")
+	assert.Contains(t, wmcb.kubeletServiceArgs(), "--node-ip=192.168.10.7")
+	assert.Contains(t, wmcb.kubeletServiceArgs(), "--hostname-override=win-node-1")
+
+	wmcb.nodeIdentity = nodeidentity.Options{NodeIPInterface: "Ethernet 3"}
+	assert.Error(t, wmcb.resolveNodeIdentity(context.Background()), "no error returned for a missing interface")
+}
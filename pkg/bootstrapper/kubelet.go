@@ -1,29 +1,36 @@
 package bootstrapper
 
 import (
+	"context"
 	"fmt"
 	"time"
 
 	"golang.org/x/sys/windows/svc"
 	"golang.org/x/sys/windows/svc/mgr"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/config"
 )
 
 // kubeletService struct contains the kubelet specific service information
 type kubeletService struct {
-	// obj is a pointer to the Windows service object
-	obj *mgr.Service
+	// obj is the Windows service object
+	obj WindowsService
 	// dependents contains a list of services dependent on the current service
-	dependents []*mgr.Service
+	dependents []WindowsService
+	// waitTime is how long to wait for the service and its dependents to change state
+	waitTime time.Duration
 }
 
 // newKubeletService creates and returns a new kubeletService object
-func newKubeletService(ksvc *mgr.Service, dependents []*mgr.Service) (*kubeletService, error) {
+func newKubeletService(ksvc WindowsService, dependents []WindowsService,
+	waitTime time.Duration) (*kubeletService, error) {
 	if ksvc == nil {
 		return nil, fmt.Errorf("service object should not be nil")
 	}
 	return &kubeletService{
 		obj:        ksvc,
 		dependents: dependents,
+		waitTime:   waitTime,
 	}, nil
 }
 
@@ -59,36 +66,20 @@ func (k *kubeletService) start() error {
 	for _, dependent := range k.dependents {
 		err := startService(dependent)
 		if err != nil {
-			return fmt.Errorf("failed to start dependent service %s", dependent.Name)
+			return fmt.Errorf("failed to start dependent service %s", dependent.ServiceName())
 		}
 	}
 	return nil
 }
 
 // control sends a signal to the service and waits until it changes state in response to the signal
-func (k *kubeletService) control(cmd svc.Cmd, desiredState svc.State) error {
-	status, err := k.obj.Control(cmd)
-	if err != nil {
-		return err
-	}
-	// Most of the rest of the function borrowed from https://godoc.org/golang.org/x/sys/windows/svc/mgr#Service.Control
-	timeout := time.Now().Add(serviceWaitTime)
-	for status.State != desiredState {
-		if timeout.Before(time.Now()) {
-			return fmt.Errorf("timeout waiting for service to go to state=%d", desiredState)
-		}
-		time.Sleep(300 * time.Millisecond)
-		status, err = k.obj.Query()
-		if err != nil {
-			return fmt.Errorf("could not retrieve service status: %v", err)
-		}
-	}
-	return nil
+func (k *kubeletService) control(ctx context.Context, cmd svc.Cmd, desiredState svc.State) error {
+	return controlService(ctx, k.obj, cmd, desiredState, k.waitTime)
 }
 
 // stop ensures that the kubelet service and its dependent services are stopped,
 // the list of dependent services is static and contains one level of dependencies
-func (k *kubeletService) stop() error {
+func (k *kubeletService) stop(ctx context.Context) error {
 	isServiceRunning, err := k.isRunning()
 	if err != nil {
 		return fmt.Errorf("unable to check if kubelet service is running: %v", err)
@@ -99,22 +90,26 @@ func (k *kubeletService) stop() error {
 	// the list of dependents is static here and contains one level of dependencies
 	if len(k.dependents) != 0 {
 		for _, dependent := range k.dependents {
-			if err := stopService(dependent); err != nil {
-				return fmt.Errorf("failed to stop dependent service %s", dependent.Name)
+			if err := stopService(ctx, dependent, k.waitTime); err != nil {
+				return fmt.Errorf("failed to stop dependent service %s", dependent.ServiceName())
 			}
 		}
 	}
 
-	if err := k.control(svc.Stop, svc.Stopped); err != nil {
+	if err := k.control(ctx, svc.Stop, svc.Stopped); err != nil {
 		return fmt.Errorf("unable to stop Windows Service %s", KubeletServiceName)
 	}
 
 	return nil
 }
 
-// refresh updates the kubelet service with the given config and restarts the service
-func (k *kubeletService) refresh(config mgr.Config) error {
-	if err := k.stop(); err != nil {
+// refresh updates the kubelet service with the given config and restarts the service. Once the kubelet has been
+// stopped, the refresh is completed even if the context is cancelled, so that the kubelet is not left stopped.
+func (k *kubeletService) refresh(ctx context.Context, config mgr.Config) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := k.stop(withoutCancel(ctx)); err != nil {
 		return fmt.Errorf("error stopping kubelet service: %v", err)
 	}
 
@@ -129,6 +124,23 @@ func (k *kubeletService) refresh(config mgr.Config) error {
 	return nil
 }
 
+// restart stops the kubelet service along with its dependents and starts them again. Once it has begun, the restart is
+// completed even if the context is cancelled, so that the kubelet is not left stopped.
+func (k *kubeletService) restart(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := k.stop(withoutCancel(ctx)); err != nil {
+		return fmt.Errorf("error stopping kubelet service: %v", err)
+	}
+
+	if err := k.start(); err != nil {
+		return fmt.Errorf("error starting kubelet service: %v", err)
+	}
+
+	return nil
+}
+
 // remove deletes the kubelet service via the Windows service API
 func (k *kubeletService) remove() error {
 	if k.obj == nil {
@@ -147,17 +159,17 @@ func (k *kubeletService) isRunning() (bool, error) {
 }
 
 // stopAndRemove stops and removes the kubelet service
-func (k *kubeletService) stopAndRemove() error {
+func (k *kubeletService) stopAndRemove(ctx context.Context) error {
 	if k.obj == nil {
 		return nil
 	}
-	k.stop()
+	k.stop(ctx)
 	return k.remove()
 }
 
 // disconnect removes all connections to the Windows service svcMgr api, and allows services to be deleted
 func (k *kubeletService) disconnect() error {
-	if k.obj == nil {
+	if k == nil || k.obj == nil {
 		return nil
 	}
 	err := k.obj.Close()
@@ -167,14 +179,33 @@ func (k *kubeletService) disconnect() error {
 	return nil
 }
 
+// recoveryActionTypes maps the recovery actions of the configuration to the ones of the Windows service API
+var recoveryActionTypes = map[string]int{
+	config.RecoveryRestart: mgr.ServiceRestart,
+	config.RecoveryReboot:  mgr.ComputerReboot,
+	config.RecoveryNone:    mgr.NoAction,
+}
+
 // setRecoveryActions sets the recovery actions for service on a failure
-func (k *kubeletService) setRecoveryActions() error {
+func (k *kubeletService) setRecoveryActions(policy config.RecoveryPolicy) error {
 	if k.obj == nil {
 		return fmt.Errorf("kubelet service object should not be nil")
 	}
-	err := k.obj.SetRecoveryActions([]mgr.RecoveryAction{
-		{Type: mgr.ServiceRestart, Delay: 5},
-	}, 600)
+	return setServiceRecoveryActions(k.obj, policy)
+}
+
+// setServiceRecoveryActions sets the recovery actions of the given service on a failure according to the policy
+func setServiceRecoveryActions(serviceObj WindowsService, policy config.RecoveryPolicy) error {
+	actions := make([]mgr.RecoveryAction, 0, len(policy.Actions))
+	for _, action := range policy.Actions {
+		actionType, ok := recoveryActionTypes[action.Type]
+		if !ok {
+			return fmt.Errorf("unsupported recovery action %q", action.Type)
+		}
+		actions = append(actions, mgr.RecoveryAction{Type: actionType, Delay: action.Delay})
+	}
+	// The reset period is given to the Windows service API in seconds
+	err := serviceObj.SetRecoveryActions(actions, uint32(policy.ResetPeriod/time.Second))
 	if err != nil {
 		return err
 	}
@@ -182,7 +213,7 @@ func (k *kubeletService) setRecoveryActions() error {
 }
 
 // startService is a helper to start a given service
-func startService(serviceObj *mgr.Service) error {
+func startService(serviceObj WindowsService) error {
 	if serviceObj == nil {
 		return fmt.Errorf("service object should not be nil")
 	}
@@ -199,8 +230,10 @@ func startService(serviceObj *mgr.Service) error {
 	return nil
 }
 
-// controlService is a helper to send control signal to a given service
-func controlService(serviceObj *mgr.Service, cmd svc.Cmd, desiredState svc.State) error {
+// controlService is a helper to send control signal to a given service and wait up to waitTime for it to reach the
+// desired state. The wait is cut short if the context is cancelled.
+func controlService(ctx context.Context, serviceObj WindowsService, cmd svc.Cmd, desiredState svc.State,
+	waitTime time.Duration) error {
 	if serviceObj == nil {
 		return fmt.Errorf("service object should not be nil")
 	}
@@ -209,13 +242,14 @@ func controlService(serviceObj *mgr.Service, cmd svc.Cmd, desiredState svc.State
 		return err
 	}
 	// Most of the rest of the function borrowed from https://godoc.org/golang.org/x/sys/windows/svc/mgr#Service.Control
-	// Arbitrary service wait time of 20 seconds
-	timeout := time.Now().Add(serviceWaitTime)
+	timeout := time.Now().Add(waitTime)
 	for status.State != desiredState {
 		if timeout.Before(time.Now()) {
 			return fmt.Errorf("timeout waiting for service to go to state=%d", desiredState)
 		}
-		time.Sleep(300 * time.Millisecond)
+		if err = sleep(ctx, 300*time.Millisecond); err != nil {
+			return fmt.Errorf("stopped waiting for service to go to state=%d: %v", desiredState, err)
+		}
 		status, err = serviceObj.Query()
 		if err != nil {
 			return fmt.Errorf("could not retrieve service status: %v", err)
@@ -225,7 +259,7 @@ func controlService(serviceObj *mgr.Service, cmd svc.Cmd, desiredState svc.State
 }
 
 // stopService is a helper to stop a given service
-func stopService(serviceObj *mgr.Service) error {
+func stopService(ctx context.Context, serviceObj WindowsService, waitTime time.Duration) error {
 	if serviceObj == nil {
 		return fmt.Errorf("service object should not be nil")
 	}
@@ -234,16 +268,36 @@ func stopService(serviceObj *mgr.Service) error {
 		return fmt.Errorf("unable to check if service is running: %v", err)
 	}
 	if isServiceRunning {
-		err := controlService(serviceObj, svc.Stop, svc.Stopped)
+		err := controlService(ctx, serviceObj, svc.Stop, svc.Stopped, waitTime)
 		if err != nil {
-			return fmt.Errorf("unable to stop %s service", serviceObj.Name)
+			return fmt.Errorf("unable to stop %s service", serviceObj.ServiceName())
 		}
 	}
 	return nil
 }
 
+// restartService stops and starts the Windows service with the given name. Once the service has been stopped, it is
+// started again even if the context is cancelled.
+func restartService(ctx context.Context, svcMgr ServiceManager, name string, waitTime time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	service, err := svcMgr.OpenService(name)
+	if err != nil {
+		return fmt.Errorf("unable to open %s service: %v", name, err)
+	}
+	defer service.Close()
+	if err = stopService(withoutCancel(ctx), service, waitTime); err != nil {
+		return err
+	}
+	if err = startService(service); err != nil {
+		return fmt.Errorf("unable to start %s service: %v", name, err)
+	}
+	return nil
+}
+
 // isServiceRunning returns true if the given service is running
-func isServiceRunning(serviceObj *mgr.Service) (bool, error) {
+func isServiceRunning(serviceObj WindowsService) (bool, error) {
 	if serviceObj == nil {
 		return false, fmt.Errorf("service object should not be nil")
 	}
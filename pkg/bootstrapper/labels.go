@@ -0,0 +1,51 @@
+package bootstrapper
+
+import (
+	"fmt"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/nodelabels"
+)
+
+const (
+	// nodeLabelsOption is the kubelet option registering the node with labels
+	nodeLabelsOption = "node-labels"
+	// registerWithTaintsOption is the kubelet option registering the node with taints
+	registerWithTaintsOption = "register-with-taints"
+)
+
+// setUnitLabels takes the labels and taints from the flags of the kubelet unit of the ignition. Labels and taints the
+// API server would reject, such as os_id=${ID} which references the environment of the Linux kubelet unit, are skipped.
+func (wmcb *winNodeBootstrapper) setUnitLabels(unitFlags map[string]string) {
+	wmcb.ignitionLabels, _ = nodelabels.ParseLabels(unitFlags[nodeLabelsOption])
+	wmcb.ignitionTaints, _ = nodelabels.ParseTaints(unitFlags[registerWithTaintsOption])
+}
+
+// resolveWindowsLabels determines the labels describing the Windows version of the host
+func (wmcb *winNodeBootstrapper) resolveWindowsLabels() error {
+	info, err := wmcb.osInfo.OSInfo()
+	if err != nil {
+		return fmt.Errorf("unable to determine Windows version labels: %v", err)
+	}
+	wmcb.windowsLabels = nodelabels.Windows(info)
+	return nil
+}
+
+// nodeLabelKubeletArgs returns the kubelet arguments registering the node with its taints and labels. The taints and
+// labels of the kubelet unit of the ignition, such as node-role.kubernetes.io/worker, are merged with the Windows
+// version labels and the configured ones, the configured ones taking precedence.
+func (wmcb *winNodeBootstrapper) nodeLabelKubeletArgs() []string {
+	var args []string
+	// The configured taints are os=Windows:NoSchedule by default, so that linux pods won't get scheduled onto
+	// Windows nodes
+	// TODO: Write a `against the cluster` e2e test which checks for the Windows node object created
+	// and check for taint.
+	if taints := nodelabels.MergeTaints(wmcb.ignitionTaints, wmcb.taints); len(taints) != 0 {
+		args = append(args, "--"+registerWithTaintsOption+"="+nodelabels.FormatTaints(taints))
+	}
+	// The configured labels include node.openshift.io/os_id=Windows by default, which identifies the nodes managed by
+	// WSU and WMCO
+	if labels := nodelabels.MergeLabels(wmcb.ignitionLabels, wmcb.windowsLabels, wmcb.labels); len(labels) != 0 {
+		args = append(args, "--"+nodeLabelsOption+"="+nodelabels.FormatLabels(labels))
+	}
+	return args
+}
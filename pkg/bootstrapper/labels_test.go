@@ -0,0 +1,40 @@
+package bootstrapper
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/config"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/osinfo"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/platform"
+)
+
+// TestNodeLabelKubeletArgs tests that the taints and labels of the ignition, the Windows version labels and the
+// configured ones are merged without duplicates
+func TestNodeLabelKubeletArgs(t *testing.T) {
+	cfg := config.Default()
+	wmcb := &winNodeBootstrapper{
+		taints: append(cfg.Taints, config.Taint{Key: "dedicated", Value: "gpu", Effect: "NoExecute"}),
+		labels: map[string]string{"node.openshift.io/os_id": "Windows", "pool": "gpu"},
+		osInfo: osinfo.Static{Build: 17763, ReleaseID: "1809", EditionID: "ServerDatacenter"},
+	}
+	wmcb.setUnitLabels(platform.ParseUnitFlags(
+		"--node-labels=node-role.kubernetes.io/worker,node.openshift.io/os_id=${ID},pool=default " +
+			"--register-with-taints=os=Windows:NoSchedule,node-role.kubernetes.io/worker:PreferNoSchedule"))
+	require.NoError(t, wmcb.resolveWindowsLabels(), "error resolving Windows labels")
+
+	assert.Equal(t, []string{
+		"--register-with-taints=os=Windows:NoSchedule,node-role.kubernetes.io/worker:PreferNoSchedule," +
+			"dedicated=gpu:NoExecute",
+		"--node-labels=node-role.kubernetes.io/worker=,node.kubernetes.io/windows-build=10.0.17763," +
+			"node.openshift.io/os_id=Windows,node.openshift.io/windows-edition=ServerDatacenter," +
+			"node.openshift.io/windows-version=1809,pool=gpu",
+	}, wmcb.nodeLabelKubeletArgs())
+
+	wmcb = &winNodeBootstrapper{osInfo: osinfo.Static{Build: 17763}}
+	require.NoError(t, wmcb.resolveWindowsLabels(), "error resolving Windows labels")
+	assert.Equal(t, []string{"--node-labels=node.kubernetes.io/windows-build=10.0.17763"},
+		wmcb.nodeLabelKubeletArgs(), "taints registered even though none were configured")
+}
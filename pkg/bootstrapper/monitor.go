@@ -0,0 +1,299 @@
+package bootstrapper
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/config"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/monitor"
+)
+
+const (
+	// MonitorServiceName is the name of the Windows service the monitor is installed as
+	MonitorServiceName = "wmcb-monitor"
+	// monitorHTTPTimeout is the timeout of the healthz requests made by the monitor
+	monitorHTTPTimeout = 10 * time.Second
+)
+
+var (
+	// vmcompute exposes the Host Networking Service API
+	vmcompute   = windows.NewLazySystemDLL("vmcompute.dll")
+	procHNSCall = vmcompute.NewProc("HNSCall")
+	// ole32 is needed to free the responses of the HNS API
+	ole32             = windows.NewLazySystemDLL("ole32.dll")
+	procCoTaskMemFree = ole32.NewProc("CoTaskMemFree")
+)
+
+// nodeHost is the monitor.Host backed by the Windows API
+type nodeHost struct{}
+
+// nodeRemediator is the monitor.Remediator that acts on the node through the bootstrapper
+type nodeRemediator struct {
+	// installDir is the directory the kubelet is installed in
+	installDir string
+	// cfg is the WMCB configuration the bootstrapper is built with
+	cfg config.Configuration
+}
+
+// monitorHandler runs the monitor as a Windows service
+type monitorHandler struct {
+	// ctx is the parent of the context the monitor runs with
+	ctx     context.Context
+	monitor *monitor.Monitor
+	report  func(monitor.Status, error)
+}
+
+// RunMonitor runs the node component checks of the given config until the context is cancelled, or until the service
+// is stopped when running as the monitor Windows service. report is called after every round of checks. The
+// remediations are applied with the WMCB configuration file of the monitor config, if any.
+func RunMonitor(ctx context.Context, monitorConfig monitor.Config, report func(monitor.Status, error)) error {
+	cfg, err := config.Load(monitorConfig.BootstrapperConfig)
+	if err != nil {
+		return err
+	}
+	m := monitor.New(monitorConfig, nodeHost{}, &nodeRemediator{installDir: monitorConfig.InstallDir, cfg: cfg},
+		&http.Client{Timeout: monitorHTTPTimeout})
+
+	interactive, err := svc.IsAnInteractiveSession()
+	if err != nil {
+		return fmt.Errorf("unable to determine if running as a Windows service: %v", err)
+	}
+	if !interactive {
+		return svc.Run(MonitorServiceName, &monitorHandler{ctx: ctx, monitor: m, report: report})
+	}
+
+	m.Run(ctx, report)
+	return nil
+}
+
+// Execute runs the monitor until the service control manager asks the service to stop. Stopping the service cancels
+// the context the monitor runs with, cutting short the check or the remediation in progress.
+func (h *monitorHandler) Execute(args []string, requests <-chan svc.ChangeRequest,
+	changes chan<- svc.Status) (bool, uint32) {
+	changes <- svc.Status{State: svc.StartPending}
+	ctx, cancel := context.WithCancel(h.ctx)
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		h.monitor.Run(ctx, h.report)
+		close(done)
+	}()
+	accepted := svc.AcceptStop | svc.AcceptShutdown
+	changes <- svc.Status{State: svc.Running, Accepts: accepted}
+
+	for request := range requests {
+		switch request.Cmd {
+		case svc.Interrogate:
+			changes <- request.CurrentStatus
+		case svc.Stop, svc.Shutdown:
+			changes <- svc.Status{State: svc.StopPending}
+			cancel()
+			<-done
+			return false, 0
+		}
+	}
+	return false, 0
+}
+
+// InstallMonitorService registers the monitor as a Windows service that runs the current executable with the given
+// config file, and starts it
+func InstallMonitorService(configPath string) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("unable to find the path of the current executable: %v", err)
+	}
+	args := []string{"monitor"}
+	if configPath != "" {
+		// The service does not run in the current working directory
+		if configPath, err = filepath.Abs(configPath); err != nil {
+			return fmt.Errorf("unable to find the absolute path of %s: %v", configPath, err)
+		}
+		args = append(args, "--config", configPath)
+	}
+
+	svcMgr, err := connectSCM()
+	if err != nil {
+		return fmt.Errorf("could not connect to Windows SCM: %s", err)
+	}
+	defer svcMgr.Disconnect()
+
+	config := mgr.Config{
+		DisplayName: MonitorServiceName,
+		Description: "OpenShift Windows node component monitor",
+		StartType:   mgr.StartAutomatic,
+	}
+	service, err := svcMgr.CreateService(MonitorServiceName, exe, config, args...)
+	if err != nil {
+		return fmt.Errorf("unable to create %s service: %v", MonitorServiceName, err)
+	}
+	defer service.Close()
+	// The monitor only covers the node components, so let the SCM cover the monitor itself
+	if err = service.SetRecoveryActions([]mgr.RecoveryAction{{Type: mgr.ServiceRestart, Delay: 5 * time.Second}},
+		600); err != nil {
+		return fmt.Errorf("unable to set recovery actions of %s service: %v", MonitorServiceName, err)
+	}
+	if err = service.Start(); err != nil {
+		return fmt.Errorf("unable to start %s service: %v", MonitorServiceName, err)
+	}
+	return nil
+}
+
+// UninstallMonitorService stops and removes the monitor Windows service
+func UninstallMonitorService() error {
+	svcMgr, err := connectSCM()
+	if err != nil {
+		return fmt.Errorf("could not connect to Windows SCM: %s", err)
+	}
+	defer svcMgr.Disconnect()
+
+	service, err := svcMgr.OpenService(MonitorServiceName)
+	if err != nil {
+		return fmt.Errorf("unable to open %s service: %v", MonitorServiceName, err)
+	}
+	defer service.Close()
+	if err = stopService(context.Background(), service, config.Default().ServiceWaitTime); err != nil {
+		return err
+	}
+	return service.Delete()
+}
+
+// bootstrapper returns a bootstrapper for the install directory of the node, built with the given options on top of
+// the WMCB configuration of the monitor
+func (r *nodeRemediator) bootstrapper(opts ...Option) (*winNodeBootstrapper, error) {
+	return newWinNodeBootstrapper(newOptions(append([]Option{WithConfiguration(r.cfg), WithInstallDir(r.installDir)},
+		opts...)...))
+}
+
+// RestartService restarts the given Windows service. The kubelet is restarted along with its dependents and verified
+// to be healthy afterwards.
+func (r *nodeRemediator) RestartService(ctx context.Context, name string) error {
+	wmcb, err := r.bootstrapper()
+	if err != nil {
+		return err
+	}
+	defer wmcb.Disconnect()
+
+	if name != KubeletServiceName {
+		return restartService(ctx, wmcb.svcMgr, name, wmcb.serviceWaitTime)
+	}
+	if wmcb.kubeletSVC == nil {
+		return kubeletNotInstalled()
+	}
+	if err = wmcb.kubeletSVC.restart(ctx); err != nil {
+		return err
+	}
+	return wmcb.verifyKubelet(ctx)
+}
+
+// ConfigureCNI re-runs configure-cni with the given CNI settings
+func (r *nodeRemediator) ConfigureCNI(ctx context.Context, cni monitor.CNIConfig) error {
+	wmcb, err := r.bootstrapper(WithCNI(cni.Dir, cni.Config))
+	if err != nil {
+		return err
+	}
+	defer wmcb.Disconnect()
+	return wmcb.configure(ctx)
+}
+
+// ProcessRunning returns true if a process with the given executable name is running
+func (nodeHost) ProcessRunning(name string) (bool, error) {
+	snapshot, err := windows.CreateToolhelp32Snapshot(windows.TH32CS_SNAPPROCESS, 0)
+	if err != nil {
+		return false, err
+	}
+	defer windows.CloseHandle(snapshot)
+
+	var entry windows.ProcessEntry32
+	entry.Size = uint32(unsafe.Sizeof(entry))
+	for err = windows.Process32First(snapshot, &entry); err == nil; err = windows.Process32Next(snapshot, &entry) {
+		if strings.EqualFold(windows.UTF16ToString(entry.ExeFile[:]), name) {
+			return true, nil
+		}
+	}
+	if err != windows.ERROR_NO_MORE_FILES {
+		return false, err
+	}
+	return false, nil
+}
+
+// HNSNetworkExists returns true if an HNS network with the given name exists
+func (nodeHost) HNSNetworkExists(name string) (bool, error) {
+	response, err := hnsCall("GET", "/networks/", "")
+	if err != nil {
+		return false, err
+	}
+	var networks struct {
+		Success bool
+		Error   string
+		Output  []struct {
+			Name string
+		}
+	}
+	if err = json.Unmarshal([]byte(response), &networks); err != nil {
+		return false, fmt.Errorf("error parsing HNS response: %v", err)
+	}
+	if !networks.Success {
+		return false, fmt.Errorf("HNS request failed: %s", networks.Error)
+	}
+	for _, network := range networks.Output {
+		if network.Name == name {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// FreeDiskSpace returns the number of bytes available on the volume containing the given path
+func (nodeHost) FreeDiskSpace(path string) (uint64, error) {
+	dir, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, err
+	}
+	var available, total, free uint64
+	if err = windows.GetDiskFreeSpaceEx(dir, &available, &total, &free); err != nil {
+		return 0, err
+	}
+	return available, nil
+}
+
+// hnsCall makes a request to the Host Networking Service and returns its JSON response
+func hnsCall(method, path, request string) (string, error) {
+	methodPtr, err := windows.UTF16PtrFromString(method)
+	if err != nil {
+		return "", err
+	}
+	pathPtr, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return "", err
+	}
+	requestPtr, err := windows.UTF16PtrFromString(request)
+	if err != nil {
+		return "", err
+	}
+	if err = procHNSCall.Find(); err != nil {
+		return "", fmt.Errorf("HNS API is not available: %v", err)
+	}
+
+	var response *uint16
+	hr, _, _ := procHNSCall.Call(uintptr(unsafe.Pointer(methodPtr)), uintptr(unsafe.Pointer(pathPtr)),
+		uintptr(unsafe.Pointer(requestPtr)), uintptr(unsafe.Pointer(&response)))
+	if response != nil {
+		defer procCoTaskMemFree.Call(uintptr(unsafe.Pointer(response)))
+	}
+	if int32(hr) < 0 {
+		return "", fmt.Errorf("HNS %s %s failed: %v", method, path, syscall.Errno(hr))
+	}
+	return windows.UTF16PtrToString(response), nil
+}
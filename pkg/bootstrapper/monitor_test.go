@@ -0,0 +1,31 @@
+package bootstrapper
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/windows/svc"
+)
+
+// TestRestartService tests that the monitor remediation restarts a running service and starts a stopped one
+func TestRestartService(t *testing.T) {
+	kubeProxy := &fakeService{serviceName: "kube-proxy", state: svc.Running}
+	hybridOverlay := &fakeService{serviceName: "hybrid-overlay-node", state: svc.Stopped}
+	svcMgr := newFakeServiceManager(kubeProxy, hybridOverlay)
+
+	require.NoError(t, restartService(context.Background(), svcMgr, "kube-proxy", time.Second))
+	assert.Equal(t, 1, kubeProxy.stops)
+	assert.Equal(t, 1, kubeProxy.starts)
+	assert.Equal(t, svc.Running, kubeProxy.state)
+
+	require.NoError(t, restartService(context.Background(), svcMgr, "hybrid-overlay-node", time.Second))
+	assert.Equal(t, 0, hybridOverlay.stops)
+	assert.Equal(t, svc.Running, hybridOverlay.state)
+
+	err := restartService(context.Background(), svcMgr, "missing", time.Second)
+	require.Error(t, err, "no error returned for a missing service")
+	assert.Contains(t, err.Error(), "unable to open missing service")
+}
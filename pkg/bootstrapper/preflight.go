@@ -0,0 +1,100 @@
+package bootstrapper
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os/exec"
+
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/svc"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/pauseimage"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/preflight"
+)
+
+// preflightHost is the preflight.Host backed by the Windows API and the service manager of the bootstrapper
+type preflightHost struct {
+	nodeHost
+	svcMgr ServiceManager
+}
+
+// Preflight runs the preflight checks against the node with the settings of the bootstrapper. The kubelet binary is
+// checked if the bootstrapper was built with WithKubeletPath, and the ignition file if it was built with
+// WithIgnitionFile. The kubelet is also expected to have the given version if it is not empty.
+func (wmcb *winNodeBootstrapper) Preflight(ctx context.Context, kubeletVersion string) (preflight.Results, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	manifest := pauseimage.DefaultManifest()
+	if wmcb.pauseImageManifest != "" {
+		var err error
+		if manifest, err = pauseimage.LoadManifest(wmcb.pauseImageManifest); err != nil {
+			return nil, &InvalidInputError{Err: err}
+		}
+	}
+	opts := preflight.Options{
+		InstallDir:     wmcb.installDir,
+		RuntimeService: wmcb.runtimeService(),
+		KubeletPath:    wmcb.initialKubeletPath,
+		KubeletVersion: kubeletVersion,
+		IgnitionFile:   wmcb.ignitionFilePath,
+		PauseImages:    manifest,
+	}
+	host := &preflightHost{svcMgr: wmcb.svcMgr}
+	return preflight.NewRegistry(host, wmcb.osInfo, opts).Run(ctx), nil
+}
+
+// ServiceState returns whether the Windows service with the given name is present and whether it is running
+func (h *preflightHost) ServiceState(name string) (bool, bool, error) {
+	service, err := h.svcMgr.OpenService(name)
+	if err == windows.ERROR_SERVICE_DOES_NOT_EXIST {
+		return false, false, nil
+	} else if err != nil {
+		return false, false, err
+	}
+	defer service.Close()
+	status, err := service.Query()
+	if err != nil {
+		return true, false, err
+	}
+	return true, status.State == svc.Running, nil
+}
+
+// PortInUse returns true if the given TCP port cannot be listened on
+func (h *preflightHost) PortInUse(port int) (bool, error) {
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		return true, nil
+	}
+	return false, listener.Close()
+}
+
+// HNSAvailable returns an error if the Host Networking Service cannot be reached
+func (h *preflightHost) HNSAvailable() error {
+	response, err := hnsCall("GET", "/networks/", "")
+	if err != nil {
+		return err
+	}
+	var result struct {
+		Success bool
+		Error   string
+	}
+	if err = json.Unmarshal([]byte(response), &result); err != nil {
+		return fmt.Errorf("error parsing HNS response: %v", err)
+	}
+	if !result.Success {
+		return fmt.Errorf("HNS request failed: %s", result.Error)
+	}
+	return nil
+}
+
+// KubeletVersion runs the kubelet binary at the given path with --version and returns its output
+func (h *preflightHost) KubeletVersion(ctx context.Context, path string) (string, error) {
+	out, err := exec.CommandContext(ctx, path, "--version").CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("%v: %s", err, out)
+	}
+	return string(out), nil
+}
@@ -0,0 +1,495 @@
+package bootstrapper
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"syscall"
+
+	"golang.org/x/sys/windows/svc/mgr"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/fileutil"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/progress"
+)
+
+/*
+	Reconciliation computes the desired state of the node, compares it with the actual state and applies only the
+	differences. WMCO re-invokes WMCB frequently, so running it against a healthy node must not restart the kubelet or
+	rewrite files that pods depend on. The desired state is made up of:
+	- the contents of the files the kubelet and CNI depend on, compared using their sha256 digests
+	- the kubelet service config, including the kubelet command line
+	- the CNI arguments that configure-cni adds to the kubelet command line
+	- the W32Time configuration taken from the chrony config of the ignition
+*/
+
+// cniKubeletOptions are the kubelet CLI options that configure-cni adds to the kubelet service. They are carried over
+// when reconciling the kubelet service, so that reconciling the kubelet does not undo the CNI configuration.
+var cniKubeletOptions = []string{resolvOption, networkPluginOption, cniBinDirOption, cniConfDirOption}
+
+// nodeFile is a file managed by WMCB on the node along with its desired contents
+type nodeFile struct {
+	// path is the location of the file on the node
+	path string
+	// contents holds the desired contents of the file. It is ignored if src is set.
+	contents []byte
+	// src is the location of a file whose contents should be copied to path. This is used for binaries, which we do not
+	// want to hold in memory.
+	src string
+	// restartService is the Windows service that has to be restarted for a change to the file to take effect, if any
+	restartService string
+	// remove is set for files that are no longer desired and have to be removed from the node
+	remove bool
+}
+
+// desiredDigest returns the hex encoded sha256 digest of the desired contents of the file
+func (f nodeFile) desiredDigest() (string, error) {
+	if f.src != "" {
+		return fileDigest(f.src)
+	}
+	digest := sha256.Sum256(f.contents)
+	return hex.EncodeToString(digest[:]), nil
+}
+
+// upToDate returns true if the file on the node already has the desired contents, or is absent if it is to be removed
+func (f nodeFile) upToDate() (bool, error) {
+	current, err := fileDigest(f.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return f.remove, nil
+		}
+		return false, err
+	}
+	if f.remove {
+		return false, nil
+	}
+	desired, err := f.desiredDigest()
+	if err != nil {
+		return false, err
+	}
+	return current == desired, nil
+}
+
+// write replaces the file on the node with its desired contents, creating its parent directories if needed, or removes
+// it if it is no longer desired
+func (f nodeFile) write(ctx context.Context) error {
+	if f.remove {
+		if err := os.Remove(f.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(f.path), 0755); err != nil {
+		return err
+	}
+	if f.src == "" {
+		return fileutil.WriteFile(f.path, f.contents)
+	}
+	return copyFile(ctx, f.src, f.path)
+}
+
+// fileDigest returns the hex encoded sha256 digest of the file at the given path
+func fileDigest(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// outdatedFiles returns the files that do not have the desired contents on the node
+func outdatedFiles(files []nodeFile) ([]nodeFile, error) {
+	var outdated []nodeFile
+	for _, f := range files {
+		ok, err := f.upToDate()
+		if err != nil {
+			return nil, fmt.Errorf("error comparing %s with its desired contents: %v", f.path, err)
+		}
+		if !ok {
+			outdated = append(outdated, f)
+		}
+	}
+	return outdated, nil
+}
+
+// writeFiles writes the desired contents of the given files to the node. Writing stops between files if the context is
+// cancelled.
+func writeFiles(ctx context.Context, files []nodeFile) error {
+	for _, f := range files {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := f.write(ctx); err != nil {
+			return fmt.Errorf("could not write to %s: %v", f.path, err)
+		}
+	}
+	return nil
+}
+
+// writeNodeFiles writes the desired contents of the given files to the node and restarts the services that need to
+// pick up the changes
+func (wmcb *winNodeBootstrapper) writeNodeFiles(ctx context.Context, files []nodeFile) error {
+	if err := writeFiles(ctx, files); err != nil {
+		return err
+	}
+	restarted := make(map[string]bool)
+	for _, f := range files {
+		if f.restartService == "" || restarted[f.restartService] {
+			continue
+		}
+		if err := restartService(ctx, wmcb.svcMgr, f.restartService, wmcb.serviceWaitTime); err != nil {
+			return fmt.Errorf("unable to restart %s service after updating %s: %v", f.restartService, f.path, err)
+		}
+		restarted[f.restartService] = true
+	}
+	return nil
+}
+
+// kubeletCmdChanged returns true if the given kubelet commands differ in anything other than argument order
+func kubeletCmdChanged(current, desired string) (bool, error) {
+	currentArgs, err := deconstructKubeletCmd(&current)
+	if err != nil {
+		return false, fmt.Errorf("unable to deconstruct kubelet command %s: %v", current, err)
+	}
+	desiredArgs, err := deconstructKubeletCmd(&desired)
+	if err != nil {
+		return false, fmt.Errorf("unable to deconstruct kubelet command %s: %v", desired, err)
+	}
+	return !reflect.DeepEqual(currentArgs, desiredArgs), nil
+}
+
+// kubeletServiceCmd returns the kubelet command line the kubelet service should run with, escaped in the same way the
+// Windows service API escapes the command line when the service is created
+func (wmcb *winNodeBootstrapper) kubeletServiceCmd() string {
+	cmd := syscall.EscapeArg(filepath.Join(wmcb.installDir, "kubelet.exe"))
+	for _, arg := range wmcb.kubeletServiceArgs() {
+		cmd += " " + syscall.EscapeArg(arg)
+	}
+	return cmd
+}
+
+// desiredKubeletFiles returns the files required by the kubelet along with their desired contents, given the files
+// described by the ignition file
+func (wmcb *winNodeBootstrapper) desiredKubeletFiles(ignitionFiles []nodeFile) ([]nodeFile, error) {
+	kubeletConfData, err := wmcb.renderKubeletConf()
+	if err != nil {
+		return nil, fmt.Errorf("error creating kubelet configuration %v", err)
+	}
+	files := []nodeFile{{path: filepath.Join(wmcb.installDir, "kubelet.conf"), contents: kubeletConfData}}
+
+	runtimeFiles, err := wmcb.desiredRuntimeFiles()
+	if err != nil {
+		return nil, fmt.Errorf("error creating container runtime configuration: %v", err)
+	}
+	files = append(files, runtimeFiles...)
+
+	if wmcb.initialKubeletPath != "" {
+		files = append(files, nodeFile{path: filepath.Join(wmcb.installDir, "kubelet.exe"),
+			src: wmcb.initialKubeletPath})
+	}
+
+	return append(files, ignitionFiles...), nil
+}
+
+// prepareKubeletFiles parses the ignition file, renders the files required by the kubelet and probes the API server
+// with the bootstrap kubeconfig, without writing anything to the node. The files are returned along with their desired
+// contents.
+func (wmcb *winNodeBootstrapper) prepareKubeletFiles(ctx context.Context) ([]nodeFile, error) {
+	var ignitionFiles []nodeFile
+	err := wmcb.progress.Run(progress.ParseIgnition, func() error {
+		var err error
+		ignitionFiles, err = wmcb.parseIgnition()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var files []nodeFile
+	err = wmcb.progress.Run(progress.RenderConfig, func() error {
+		if err := wmcb.resolvePauseImage(); err != nil {
+			return err
+		}
+		if err := wmcb.resolveNodeIdentity(ctx); err != nil {
+			return err
+		}
+		if err := wmcb.resolveWindowsLabels(); err != nil {
+			return err
+		}
+		var err error
+		files, err = wmcb.desiredKubeletFiles(ignitionFiles)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if wmcb.probeAPIServer {
+		err = wmcb.progress.Run(progress.ProbeAPIServer, func() error {
+			return wmcb.probeAPIServerReady(ctx, wmcb.bootstrapKubeconfig(files))
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// desiredKubeletServiceConfig returns the desired kubelet service config given the current one, along with whether
+// the service needs to be updated. CNI and CSI arguments present in the current kubelet command are preserved.
+func (wmcb *winNodeBootstrapper) desiredKubeletServiceConfig(current mgr.Config) (mgr.Config, bool, error) {
+	desiredCmd := wmcb.kubeletServiceCmd()
+	desiredArgs, err := deconstructKubeletCmd(&desiredCmd)
+	if err != nil {
+		return mgr.Config{}, false, fmt.Errorf("unable to deconstruct kubelet command %s: %v", desiredCmd, err)
+	}
+	currentArgs, err := deconstructKubeletCmd(&current.BinaryPathName)
+	if err != nil {
+		return mgr.Config{}, false, fmt.Errorf("unable to deconstruct kubelet command %s: %v",
+			current.BinaryPathName, err)
+	}
+	for _, option := range append(cniKubeletOptions, csiKubeletOptions...) {
+		if value, found := currentArgs[option]; found {
+			desiredArgs[option] = value
+		}
+	}
+
+	desired := current
+	defaults := wmcb.kubeletServiceConfig()
+	desired.StartType = defaults.StartType
+	desired.Dependencies = defaults.Dependencies
+	desired.Description = defaults.Description
+
+	changed := !reflect.DeepEqual(currentArgs, desiredArgs) || current.StartType != desired.StartType ||
+		current.Description != desired.Description || !reflect.DeepEqual(current.Dependencies, desired.Dependencies)
+	if !changed {
+		return current, false, nil
+	}
+	if desired.BinaryPathName, err = reconstructKubeletCmd(desiredArgs); err != nil {
+		return mgr.Config{}, false, fmt.Errorf("unable to reconstruct kubelet command %v: %v", desiredArgs, err)
+	}
+	return desired, true, nil
+}
+
+// applyKubeletChanges stops the kubelet service, writes the given files, updates the service config if one is given
+// and starts the kubelet service again. The kubelet has to be stopped first as kubelet.exe could have open file
+// handles on the files being replaced, and as the services it depends on cannot be restarted while it is running. Once
+// the kubelet has been stopped, the changes are applied even if the context is cancelled, so that the kubelet is not
+// left stopped.
+func (wmcb *winNodeBootstrapper) applyKubeletChanges(ctx context.Context, files []nodeFile, config *mgr.Config) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	critical := withoutCancel(ctx)
+	if err := wmcb.progress.Run(progress.StopService, func() error { return wmcb.kubeletSVC.stop(critical) }); err != nil {
+		return kubeletServiceError("stop", err)
+	}
+	if err := wmcb.progress.Run(progress.WriteFiles, func() error {
+		return wmcb.writeNodeFiles(critical, files)
+	}); err != nil {
+		return err
+	}
+	if config != nil {
+		if err := wmcb.progress.Run(progress.UpdateService, func() error {
+			return wmcb.kubeletSVC.obj.UpdateConfig(*config)
+		}); err != nil {
+			return fmt.Errorf("error updating kubelet service: %v", err)
+		}
+	}
+	if err := wmcb.progress.Run(progress.StartService, func() error { return wmcb.kubeletSVC.start() }); err != nil {
+		return fmt.Errorf("error starting kubelet service: %v", err)
+	}
+	return nil
+}
+
+// reconcileKubelet brings the kubelet files and service in line with their desired state, applying only the
+// differences. Unlike initializeKubelet, the kubelet service is not recreated, and it is only restarted when its
+// binary, configuration or arguments have changed. Running it against a node that is already in the desired state is
+// a no-op.
+func (wmcb *winNodeBootstrapper) reconcileKubelet(ctx context.Context) error {
+	files, err := wmcb.prepareKubeletFiles(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to initialize kubelet: %v", err)
+	}
+	outdated, err := outdatedFiles(files)
+	if err != nil {
+		return fmt.Errorf("failed to initialize kubelet: %v", err)
+	}
+
+	if wmcb.kubeletSVC == nil {
+		err = wmcb.progress.Run(progress.WriteFiles, func() error {
+			if err := wmcb.ensureKubeletDirs(); err != nil {
+				return err
+			}
+			// The clock has to be in sync before the kubelet goes through its TLS bootstrap
+			if err := wmcb.configureTimeService(ctx); err != nil {
+				return err
+			}
+			if err := wmcb.writeNodeFiles(ctx, outdated); err != nil {
+				return err
+			}
+			return wmcb.loadPauseImageArchive(ctx)
+		})
+		if err != nil {
+			return fmt.Errorf("failed to initialize kubelet: %v", err)
+		}
+		if err = wmcb.progress.Run(progress.CreateService, wmcb.createKubeletService); err != nil {
+			return kubeletServiceError("create", err)
+		}
+		if err = wmcb.progress.Run(progress.StartService, func() error { return wmcb.kubeletSVC.start() }); err != nil {
+			return kubeletServiceError("start", err)
+		}
+		if err = wmcb.progress.Run(progress.VerifyHealth, func() error { return wmcb.verifyKubelet(ctx) }); err != nil {
+			return fmt.Errorf("kubelet windows service is not healthy: %w", err)
+		}
+		return nil
+	}
+
+	current, err := wmcb.kubeletSVC.config()
+	if err != nil {
+		return fmt.Errorf("error getting kubelet service config: %v", err)
+	}
+	desired, serviceChanged, err := wmcb.desiredKubeletServiceConfig(current)
+	if err != nil {
+		return fmt.Errorf("error computing kubelet service config: %v", err)
+	}
+	changed := len(outdated) != 0 || serviceChanged
+
+	// The directories, the time service and the pause image do not need the kubelet to be stopped, so they are taken
+	// care of before it is
+	err = wmcb.progress.Run(progress.WriteFiles, func() error {
+		if err := wmcb.ensureKubeletDirs(); err != nil {
+			return err
+		}
+		if err := wmcb.configureTimeService(ctx); err != nil {
+			return err
+		}
+		if !changed {
+			return nil
+		}
+		return wmcb.loadPauseImageArchive(ctx)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to reconcile kubelet: %v", err)
+	}
+
+	if !changed {
+		// Nothing has changed, but the kubelet should still be running
+		if err = wmcb.progress.Run(progress.StartService, func() error { return wmcb.kubeletSVC.start() }); err != nil {
+			return kubeletServiceError("start", err)
+		}
+		return nil
+	}
+
+	var config *mgr.Config
+	if serviceChanged {
+		config = &desired
+	}
+	if err = wmcb.applyKubeletChanges(ctx, outdated, config); err != nil {
+		return fmt.Errorf("failed to reconcile kubelet: %v", err)
+	}
+	if err = wmcb.progress.Run(progress.VerifyHealth, func() error { return wmcb.verifyKubelet(ctx) }); err != nil {
+		return fmt.Errorf("kubelet windows service is not healthy: %w", err)
+	}
+	return nil
+}
+
+// desiredFiles returns the CNI binaries and config along with their desired contents, followed by the installed CNI
+// binaries that are no longer desired and have to be removed
+func (cni *cniOptions) desiredFiles() ([]nodeFile, error) {
+	binaries, err := cni.sourceFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	var desired []nodeFile
+	for _, binary := range binaries {
+		desired = append(desired, nodeFile{path: filepath.Join(cni.binDir, binary),
+			src: filepath.Join(cni.dir, binary)})
+	}
+	desired = append(desired, cni.configFile())
+
+	stale, err := cni.staleFiles(desired)
+	if err != nil {
+		return nil, err
+	}
+	return append(desired, stale...), nil
+}
+
+// reconcileCNI brings the CNI files and the CNI arguments of the kubelet service in line with their desired state,
+// applying only the differences. The kubelet service is only restarted if something has changed.
+func (wmcb *winNodeBootstrapper) reconcileCNI(ctx context.Context) error {
+	if wmcb.cni == nil {
+		return fmt.Errorf("cannot configure without required plugin inputs")
+	}
+	if wmcb.kubeletSVC == nil {
+		return kubeletNotInstalled()
+	}
+
+	var outdated []nodeFile
+	var config mgr.Config
+	var desiredCmd string
+	var argsChanged bool
+	err := wmcb.progress.Run(progress.RenderConfig, func() error {
+		if err := wmcb.cni.ensureDirIsPresent(); err != nil {
+			return fmt.Errorf("unable to create CNI directory %s: %v", filepath.Join(wmcb.cni.dir, cniConfigDirName),
+				err)
+		}
+		files, err := wmcb.cni.desiredFiles()
+		if err != nil {
+			return fmt.Errorf("unable to determine CNI files: %v", err)
+		}
+		outdated, err = outdatedFiles(files)
+		if err != nil {
+			return fmt.Errorf("unable to determine CNI files: %v", err)
+		}
+
+		config, err = wmcb.kubeletSVC.config()
+		if err != nil {
+			return fmt.Errorf("error getting kubelet service config: %v", err)
+		}
+		desiredCmd = config.BinaryPathName
+		if err = wmcb.cni.updateKubeletArgs(&desiredCmd); err != nil {
+			return fmt.Errorf("unable to update the kubelet arguments: %v", err)
+		}
+		argsChanged, err = kubeletCmdChanged(config.BinaryPathName, desiredCmd)
+		if err != nil {
+			return fmt.Errorf("unable to compare the kubelet arguments: %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(outdated) == 0 && !argsChanged {
+		// Nothing has changed, but the kubelet should still be running
+		if err = wmcb.progress.Run(progress.StartService, func() error { return wmcb.kubeletSVC.start() }); err != nil {
+			return kubeletServiceError("start", err)
+		}
+		return nil
+	}
+
+	var updatedConfig *mgr.Config
+	if argsChanged {
+		config.BinaryPathName = desiredCmd
+		updatedConfig = &config
+	}
+	if err = wmcb.applyKubeletChanges(ctx, outdated, updatedConfig); err != nil {
+		return fmt.Errorf("error configuring kubelet service for CNI: %v", err)
+	}
+	if err = wmcb.progress.Run(progress.VerifyHealth, func() error { return wmcb.verifyKubelet(ctx) }); err != nil {
+		return fmt.Errorf("kubelet windows service is not healthy: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,280 @@
+package bootstrapper
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+	crlog "sigs.k8s.io/controller-runtime/pkg/log"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/cniconf"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/config"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/osinfo"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/progress"
+)
+
+// newTestBootstrapper returns a bootstrapper installing to the given directory that uses the given fake service
+// manager, in the same way New does on every WMCB invocation
+func newTestBootstrapper(t *testing.T, installDir, kubeletPath string,
+	svcMgr *fakeServiceManager) *winNodeBootstrapper {
+	cfg := config.Default()
+	wmcb := &winNodeBootstrapper{
+		kubeconfigPath:     filepath.Join(installDir, "kubeconfig"),
+		kubeletConfPath:    filepath.Join(installDir, "kubelet.conf"),
+		installDir:         installDir,
+		logDir:             filepath.Join(installDir, "log"),
+		certDir:            cfg.CertDirectory,
+		taints:             cfg.Taints,
+		labels:             cfg.Labels,
+		clusterDNS:         cfg.ClusterDNS,
+		runtime:            cfg.Runtime,
+		serviceWaitTime:    cfg.ServiceWaitTime,
+		recoveryPolicy:     cfg.RecoveryPolicy,
+		initialKubeletPath: kubeletPath,
+		svcMgr:             svcMgr,
+		kubeletArgs:        make(map[string]string),
+		osInfo:             osinfo.Static{Build: 17763},
+		log:                crlog.NullLogger{},
+	}
+	if ksvc, err := svcMgr.OpenService(KubeletServiceName); err == nil {
+		var err error
+		wmcb.kubeletSVC, err = newKubeletService(ksvc, nil, cfg.ServiceWaitTime)
+		require.NoError(t, err, "error initializing kubelet service")
+	}
+	return wmcb
+}
+
+// TestReconcileKubelet tests that reconcileKubelet only updates the node and restarts the kubelet when the desired
+// state differs from the actual state
+func TestReconcileKubelet(t *testing.T) {
+	installDir, err := ioutil.TempDir("", "wmcb")
+	require.NoError(t, err, "error creating temp directory")
+	// Ignore the return error as there is not much we can do if the temporary directory is not deleted
+	defer os.RemoveAll(installDir)
+	srcDir, err := ioutil.TempDir("", "kubelet")
+	require.NoError(t, err, "error creating temp directory")
+	defer os.RemoveAll(srcDir)
+
+	kubeletPath := filepath.Join(srcDir, "kubelet.exe")
+	require.NoError(t, ioutil.WriteFile(kubeletPath, []byte("kubelet v1"), 0644))
+	svcMgr := newFakeServiceManager()
+
+	err = newTestBootstrapper(t, installDir, kubeletPath, svcMgr).reconcileKubelet(context.Background())
+	require.NoError(t, err, "error reconciling kubelet on a new node")
+	kubelet, found := svcMgr.services[KubeletServiceName]
+	require.True(t, found, "kubelet service was not created")
+	assert.Equal(t, svc.Running, kubelet.state, "kubelet service is not running")
+	assert.Equal(t, 1, kubelet.starts)
+	assert.FileExists(t, filepath.Join(installDir, "kubelet.conf"), "kubelet.conf was not created")
+
+	t.Run("no changes", func(t *testing.T) {
+		err := newTestBootstrapper(t, installDir, kubeletPath, svcMgr).reconcileKubelet(context.Background())
+		require.NoError(t, err, "error reconciling kubelet")
+		assert.Equal(t, 1, kubelet.starts, "kubelet was restarted even though nothing changed")
+		assert.Equal(t, 0, kubelet.stops, "kubelet was stopped even though nothing changed")
+	})
+
+	t.Run("kubelet binary changed", func(t *testing.T) {
+		require.NoError(t, ioutil.WriteFile(kubeletPath, []byte("v2"), 0644))
+		err := newTestBootstrapper(t, installDir, kubeletPath, svcMgr).reconcileKubelet(context.Background())
+		require.NoError(t, err, "error reconciling kubelet")
+		assert.Equal(t, 2, kubelet.starts, "kubelet was not restarted")
+		contents, err := ioutil.ReadFile(filepath.Join(installDir, "kubelet.exe"))
+		require.NoError(t, err)
+		assert.Equal(t, "v2", string(contents), "kubelet.exe was not replaced")
+	})
+
+	t.Run("CNI arguments are preserved", func(t *testing.T) {
+		cni := &cniOptions{binDir: filepath.Join(installDir, "cni"), confDir: filepath.Join(installDir, "cni", "config")}
+		require.NoError(t, cni.updateKubeletArgs(&kubelet.config.BinaryPathName))
+
+		err := newTestBootstrapper(t, installDir, kubeletPath, svcMgr).reconcileKubelet(context.Background())
+		require.NoError(t, err, "error reconciling kubelet")
+		assert.Equal(t, 2, kubelet.starts, "kubelet was restarted even though nothing changed")
+		assert.Contains(t, kubelet.config.BinaryPathName, networkPluginOption+"="+networkPluginValue)
+	})
+
+	t.Run("kubelet arguments changed", func(t *testing.T) {
+		kubelet.config.BinaryPathName = strings.Replace(kubelet.config.BinaryPathName, "--logtostderr=false",
+			"--logtostderr=true", 1)
+		err := newTestBootstrapper(t, installDir, kubeletPath, svcMgr).reconcileKubelet(context.Background())
+		require.NoError(t, err, "error reconciling kubelet")
+		assert.Equal(t, 3, kubelet.starts, "kubelet was not restarted")
+		assert.Contains(t, kubelet.config.BinaryPathName, "--logtostderr=false", "kubelet arguments were not updated")
+		assert.Contains(t, kubelet.config.BinaryPathName, networkPluginOption+"="+networkPluginValue,
+			"CNI arguments were not preserved")
+	})
+
+	t.Run("stopped kubelet is started", func(t *testing.T) {
+		kubelet.state = svc.Stopped
+		err := newTestBootstrapper(t, installDir, kubeletPath, svcMgr).reconcileKubelet(context.Background())
+		require.NoError(t, err, "error reconciling kubelet")
+		assert.Equal(t, svc.Running, kubelet.state, "kubelet service is not running")
+		assert.Equal(t, 4, kubelet.starts)
+	})
+}
+
+// TestReconcileKubeletProgress tests that the phases of a kubelet reconciliation are recorded, and written to the
+// progress file
+func TestReconcileKubeletProgress(t *testing.T) {
+	installDir, err := ioutil.TempDir("", "wmcb")
+	require.NoError(t, err, "error creating temp directory")
+	// Ignore the return error as there is not much we can do if the temporary directory is not deleted
+	defer os.RemoveAll(installDir)
+	srcDir, err := ioutil.TempDir("", "kubelet")
+	require.NoError(t, err, "error creating temp directory")
+	defer os.RemoveAll(srcDir)
+
+	kubeletPath := filepath.Join(srcDir, "kubelet.exe")
+	require.NoError(t, ioutil.WriteFile(kubeletPath, []byte("kubelet v1"), 0644))
+	progressFile := filepath.Join(srcDir, "progress.json")
+	svcMgr := newFakeServiceManager()
+	reconcile := func() progress.Report {
+		wmcb := newTestBootstrapper(t, installDir, kubeletPath, svcMgr)
+		wmcb.reconcile = true
+		wmcb.progressFile = progressFile
+		require.NoError(t, wmcb.InitializeKubelet(context.Background()), "error reconciling kubelet")
+		report, err := progress.ReadFile(progressFile)
+		require.NoError(t, err, "error reading progress file")
+		assert.Equal(t, wmcb.Progress(), report, "progress file does not hold the final report")
+		return report
+	}
+	phases := func(report progress.Report) []progress.Phase {
+		var names []progress.Phase
+		for _, phase := range report.Phases {
+			names = append(names, phase.Name)
+			assert.NotNil(t, phase.End, "phase %s has no end", phase.Name)
+			assert.Empty(t, phase.Error, "phase %s failed", phase.Name)
+		}
+		return names
+	}
+
+	report := reconcile()
+	assert.Equal(t, "reconcile-kubelet", report.Operation)
+	assert.Equal(t, progress.Succeeded, report.State)
+	assert.Equal(t, []progress.Phase{progress.ParseIgnition, progress.RenderConfig, progress.WriteFiles,
+		progress.CreateService, progress.StartService, progress.VerifyHealth}, phases(report))
+
+	t.Run("no changes", func(t *testing.T) {
+		assert.Equal(t, []progress.Phase{progress.ParseIgnition, progress.RenderConfig, progress.WriteFiles,
+			progress.StartService}, phases(reconcile()))
+	})
+
+	t.Run("kubelet binary changed", func(t *testing.T) {
+		require.NoError(t, ioutil.WriteFile(kubeletPath, []byte("v2"), 0644))
+		assert.Equal(t, []progress.Phase{progress.ParseIgnition, progress.RenderConfig, progress.WriteFiles,
+			progress.StopService, progress.WriteFiles, progress.StartService, progress.VerifyHealth},
+			phases(reconcile()))
+	})
+}
+
+// TestReconcileCNI tests that reconcileCNI only copies the CNI files and restarts the kubelet when the desired state
+// differs from the actual state
+func TestReconcileCNI(t *testing.T) {
+	installDir, err := ioutil.TempDir("", "wmcb")
+	require.NoError(t, err, "error creating temp directory")
+	// Ignore the return error as there is not much we can do if the temporary directory is not deleted
+	defer os.RemoveAll(installDir)
+	cniDir, err := ioutil.TempDir("", "cni")
+	require.NoError(t, err, "error creating temp directory")
+	defer os.RemoveAll(cniDir)
+	cniConfigDir, err := ioutil.TempDir("", "cniconfig")
+	require.NoError(t, err, "error creating temp directory")
+	defer os.RemoveAll(cniConfigDir)
+
+	require.NoError(t, ioutil.WriteFile(filepath.Join(cniDir, "win-overlay.exe"), []byte("win-overlay"), 0644))
+	cniConfig := filepath.Join(cniConfigDir, "cni.conf")
+	require.NoError(t, ioutil.WriteFile(cniConfig, []byte(`{"name":"net","type":"win-overlay"}`), 0644))
+
+	kubelet := &fakeService{
+		serviceName: KubeletServiceName,
+		config: mgr.Config{BinaryPathName: filepath.Join(installDir, "kubelet.exe") +
+			" --windows-service --config=" + filepath.Join(installDir, "kubelet.conf")},
+		state: svc.Running,
+	}
+	svcMgr := newFakeServiceManager(kubelet)
+
+	reconcileCNI := func() error {
+		wmcb := newTestBootstrapper(t, installDir, "", svcMgr)
+		var err error
+		wmcb.cni, err = newCNIOptions(installDir, cniDir, cniConfig, nil)
+		require.NoError(t, err, "error initializing CNI options")
+		return wmcb.reconcileCNI(context.Background())
+	}
+
+	require.NoError(t, reconcileCNI(), "error reconciling CNI")
+	assert.Equal(t, 1, kubelet.starts, "kubelet was not restarted")
+	assert.FileExists(t, filepath.Join(installDir, "cni", "win-overlay.exe"), "CNI binary was not copied")
+	assert.FileExists(t, filepath.Join(installDir, "cni", "config", "cni.conf"), "CNI config was not copied")
+	assert.Contains(t, kubelet.config.BinaryPathName, networkPluginOption+"="+networkPluginValue)
+
+	t.Run("no changes", func(t *testing.T) {
+		require.NoError(t, reconcileCNI(), "error reconciling CNI")
+		assert.Equal(t, 1, kubelet.starts, "kubelet was restarted even though nothing changed")
+	})
+
+	t.Run("CNI config changed", func(t *testing.T) {
+		require.NoError(t, ioutil.WriteFile(cniConfig, []byte(`{"name":"changed","type":"win-overlay"}`), 0644))
+		require.NoError(t, reconcileCNI(), "error reconciling CNI")
+		assert.Equal(t, 2, kubelet.starts, "kubelet was not restarted")
+		contents, err := ioutil.ReadFile(filepath.Join(installDir, "cni", "config", "cni.conf"))
+		require.NoError(t, err)
+		assert.Equal(t, `{"name":"changed","type":"win-overlay"}`, string(contents), "CNI config was not updated")
+	})
+
+	t.Run("nested and stale CNI binaries", func(t *testing.T) {
+		require.NoError(t, os.Mkdir(filepath.Join(cniDir, "flannel"), 0755))
+		require.NoError(t, ioutil.WriteFile(filepath.Join(cniDir, "flannel", "flannel.exe"), []byte("flannel"), 0644))
+		stale := filepath.Join(installDir, "cni", "removed-plugin.exe")
+		require.NoError(t, ioutil.WriteFile(stale, []byte("removed-plugin"), 0644))
+
+		require.NoError(t, reconcileCNI(), "error reconciling CNI")
+		assert.Equal(t, 3, kubelet.starts, "kubelet was not restarted")
+		assert.FileExists(t, filepath.Join(installDir, "cni", "flannel", "flannel.exe"), "nested binary was not copied")
+		assert.NoFileExists(t, stale, "stale binary was not removed")
+		assert.FileExists(t, filepath.Join(installDir, "cni", "config", "cni.conf"), "CNI config was removed")
+
+		require.NoError(t, reconcileCNI(), "error reconciling CNI")
+		assert.Equal(t, 3, kubelet.starts, "kubelet was restarted even though nothing changed")
+	})
+
+	t.Run("CNI binary replaced by a smaller one", func(t *testing.T) {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(cniDir, "win-overlay.exe"), []byte("small"), 0644))
+		require.NoError(t, reconcileCNI(), "error reconciling CNI")
+		assert.Equal(t, 4, kubelet.starts, "kubelet was not restarted")
+		contents, err := ioutil.ReadFile(filepath.Join(installDir, "cni", "win-overlay.exe"))
+		require.NoError(t, err)
+		assert.Equal(t, "small", string(contents), "CNI binary was not replaced")
+	})
+
+	t.Run("rendered CNI config", func(t *testing.T) {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(cniDir, "host-local.exe"), []byte("host-local"), 0644))
+		network := &cniconf.Overlay{HostSubnets: []string{"10.132.0.0/24"}, ServiceCIDRs: []string{"172.30.0.0/16"},
+			DNS: true}
+		rendered, err := network.Render()
+		require.NoError(t, err)
+		reconcileOverlay := func() error {
+			wmcb := newTestBootstrapper(t, installDir, "", svcMgr)
+			var err error
+			wmcb.cni, err = newCNIOptions(installDir, cniDir, "", network)
+			require.NoError(t, err, "error initializing CNI options")
+			return wmcb.reconcileCNI(context.Background())
+		}
+
+		require.NoError(t, reconcileOverlay(), "error reconciling CNI")
+		assert.Equal(t, 5, kubelet.starts, "kubelet was not restarted")
+		contents, err := ioutil.ReadFile(filepath.Join(installDir, "cni", "config", cniconf.ConfigFileName))
+		require.NoError(t, err)
+		assert.Equal(t, rendered, contents, "CNI config was not rendered")
+
+		require.NoError(t, reconcileOverlay(), "error reconciling CNI")
+		assert.Equal(t, 5, kubelet.starts, "kubelet was restarted even though nothing changed")
+	})
+}
@@ -0,0 +1,183 @@
+package bootstrapper
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"text/template"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/config"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/pauseimage"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/runtimeconf"
+)
+
+const (
+	// ContainerRuntimeDocker runs the containers with docker through the dockershim built into the kubelet
+	ContainerRuntimeDocker = config.ContainerRuntimeDocker
+	// ContainerRuntimeContainerd runs the containers with containerd through its CRI plugin
+	ContainerRuntimeContainerd = config.ContainerRuntimeContainerd
+	// containerdEndpoint is the named pipe the containerd CRI plugin listens on
+	containerdEndpoint = "npipe:////./pipe/containerd-containerd"
+)
+
+// containerdConf defines the fields of the containerd config.toml that are defined by WMCB variables
+type containerdConf struct {
+	// PauseImage is the image used for the pod sandbox
+	PauseImage string
+	// CNIBinDir is the directory containing the CNI plugin binaries
+	CNIBinDir string
+	// CNIConfDir is the directory containing the CNI config
+	CNIConfDir string
+	// DataRoot is where containerd keeps its images and containers
+	DataRoot string
+	// Registries are the registry mirrors and the insecure registries
+	Registries runtimeconf.ContainerdRegistries
+}
+
+// runtimeService returns the name of the Windows service of the container runtime, which the kubelet service
+// depends on
+func (wmcb *winNodeBootstrapper) runtimeService() string {
+	if wmcb.containerRuntime == ContainerRuntimeContainerd {
+		return ContainerRuntimeContainerd
+	}
+	return ContainerRuntimeDocker
+}
+
+// runtimeKubeletArgs returns the kubelet arguments needed to use the container runtime
+func (wmcb *winNodeBootstrapper) runtimeKubeletArgs() []string {
+	if wmcb.containerRuntime != ContainerRuntimeContainerd {
+		return nil
+	}
+	return []string{
+		"--container-runtime=remote",
+		"--container-runtime-endpoint=" + containerdEndpoint,
+	}
+}
+
+// renderContainerdConf renders the containerd config.toml, setting the pause image and the CNI directories to the ones
+// configure-cni installs the CNI plugins to, along with the data root and the registries
+func (wmcb *winNodeBootstrapper) renderContainerdConf(registries runtimeconf.Registries) ([]byte, error) {
+	content, err := Asset("templates/containerd_config.toml")
+	if err != nil {
+		return nil, fmt.Errorf("error reading containerd config template: %v", err)
+	}
+	containerdConfTmpl, err := template.New("containerdconf").Parse(string(content))
+	if err != nil {
+		return nil, err
+	}
+	variableFields := containerdConf{
+		PauseImage: wmcb.pauseImage,
+		CNIBinDir:  cniBinDir(wmcb.installDir),
+		CNIConfDir: cniConfDir(wmcb.installDir),
+		DataRoot:   wmcb.runtime.DataRoot,
+	}
+	if variableFields.DataRoot == "" {
+		variableFields.DataRoot = runtimeconf.DefaultContainerdRoot
+	}
+	if variableFields.Registries, err = runtimeconf.Containerd(wmcb.runtime, registries); err != nil {
+		return nil, fmt.Errorf("invalid containerd config: %v", err)
+	}
+	var containerdConfData bytes.Buffer
+	if err = containerdConfTmpl.Execute(&containerdConfData, variableFields); err != nil {
+		return nil, fmt.Errorf("error rendering containerd config template: %v", err)
+	}
+	return containerdConfData.Bytes(), nil
+}
+
+// registries returns the registry sources of the cluster image config, if one was given, after checking that the
+// pause image may be pulled from its registry
+func (wmcb *winNodeBootstrapper) registries() (runtimeconf.Registries, error) {
+	if wmcb.runtime.ImageConfigPath == "" {
+		return runtimeconf.Registries{}, nil
+	}
+	registries, err := runtimeconf.LoadImageConfig(wmcb.runtime.ImageConfigPath)
+	if err != nil {
+		return runtimeconf.Registries{}, err
+	}
+	if wmcb.pauseImage != "" {
+		if err = registries.CheckImage(wmcb.pauseImage); err != nil {
+			return runtimeconf.Registries{}, fmt.Errorf("invalid pause image: %v", err)
+		}
+	}
+	return registries, nil
+}
+
+// desiredRuntimeFiles returns the container runtime configuration files along with their desired contents. A change to
+// any of them requires the container runtime to be restarted. The docker daemon.json is only managed if its path is
+// set.
+func (wmcb *winNodeBootstrapper) desiredRuntimeFiles() ([]nodeFile, error) {
+	if wmcb.containerRuntime != ContainerRuntimeContainerd && wmcb.dockerConfigPath == "" {
+		return nil, nil
+	}
+	registries, err := wmcb.registries()
+	if err != nil {
+		return nil, err
+	}
+	if wmcb.containerRuntime != ContainerRuntimeContainerd {
+		daemonData, err := runtimeconf.Docker(wmcb.runtime, registries)
+		if err != nil {
+			return nil, fmt.Errorf("invalid docker daemon config: %v", err)
+		}
+		return []nodeFile{{path: wmcb.dockerConfigPath, contents: daemonData,
+			restartService: ContainerRuntimeDocker}}, nil
+	}
+	containerdConfData, err := wmcb.renderContainerdConf(registries)
+	if err != nil {
+		return nil, err
+	}
+	return []nodeFile{{path: wmcb.containerdConfigPath, contents: containerdConfData,
+		restartService: ContainerRuntimeContainerd}}, nil
+}
+
+// resolvePauseImage picks the pause image matching the host Windows build from the pause image manifest, unless the
+// pause image was overridden
+func (wmcb *winNodeBootstrapper) resolvePauseImage() error {
+	manifest := pauseimage.DefaultManifest()
+	if wmcb.pauseImageManifest != "" {
+		var err error
+		if manifest, err = pauseimage.LoadManifest(wmcb.pauseImageManifest); err != nil {
+			return err
+		}
+	}
+	pauseImage, err := pauseimage.Resolve(wmcb.osInfo, manifest, wmcb.pauseImage, wmcb.log)
+	if err != nil {
+		return fmt.Errorf("unable to determine pause image: %v", err)
+	}
+	wmcb.pauseImage = pauseImage
+	return nil
+}
+
+// imageLoadCommand returns the command that loads the given image tarball into the container runtime
+func (wmcb *winNodeBootstrapper) imageLoadCommand(archive string) (string, []string) {
+	if wmcb.containerRuntime == ContainerRuntimeContainerd {
+		// The kubelet only sees the images in the k8s.io namespace
+		return "ctr", []string{"--namespace", "k8s.io", "images", "import", archive}
+	}
+	return "docker", []string{"load", "--input", archive}
+}
+
+// loadPauseImageArchive loads the pause image tarball into the container runtime, if one was given, so that the node
+// does not need to reach the registry to start pods
+func (wmcb *winNodeBootstrapper) loadPauseImageArchive(ctx context.Context) error {
+	if wmcb.pauseImageArchive == "" {
+		return nil
+	}
+	name, args := wmcb.imageLoadCommand(wmcb.pauseImageArchive)
+	out, err := exec.CommandContext(ctx, name, args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("error loading pause image archive %s: %v: %s", wmcb.pauseImageArchive, err, out)
+	}
+	return nil
+}
+
+// cniBinDir returns the directory within the given install dir where the CNI binaries are placed
+func cniBinDir(k8sInstallDir string) string {
+	return filepath.Join(k8sInstallDir, cniDirName)
+}
+
+// cniConfDir returns the directory within the given install dir where the CNI config is placed
+func cniConfDir(k8sInstallDir string) string {
+	return filepath.Join(k8sInstallDir, cniConfigDirName)
+}
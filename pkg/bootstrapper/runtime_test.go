@@ -0,0 +1,194 @@
+package bootstrapper
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/windows/svc"
+	crlog "sigs.k8s.io/controller-runtime/pkg/log"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/osinfo"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/pauseimage"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/runtimeconf"
+)
+
+// TestContainerdRuntime tests that the kubelet service is set up for containerd and that the containerd config is
+// rendered and picked up by containerd
+func TestContainerdRuntime(t *testing.T) {
+	installDir, err := ioutil.TempDir("", "wmcb")
+	require.NoError(t, err, "error creating temp directory")
+	// Ignore the return error as there is not much we can do if the temporary directory is not deleted
+	defer os.RemoveAll(installDir)
+
+	containerd := &fakeService{serviceName: ContainerRuntimeContainerd, state: svc.Running}
+	svcMgr := newFakeServiceManager(containerd)
+	containerdConfigPath := filepath.Join(installDir, "config.toml")
+	newContainerdBootstrapper := func() *winNodeBootstrapper {
+		wmcb := newTestBootstrapper(t, installDir, "", svcMgr)
+		wmcb.containerRuntime = ContainerRuntimeContainerd
+		wmcb.containerdConfigPath = containerdConfigPath
+		return wmcb
+	}
+
+	t.Run("kubelet service", func(t *testing.T) {
+		wmcb := newContainerdBootstrapper()
+		assert.Contains(t, wmcb.kubeletServiceArgs(), "--container-runtime=remote")
+		assert.Contains(t, wmcb.kubeletServiceArgs(), "--container-runtime-endpoint="+containerdEndpoint)
+		assert.Equal(t, []string{ContainerRuntimeContainerd}, wmcb.kubeletServiceConfig().Dependencies)
+
+		wmcb.containerRuntime = ContainerRuntimeDocker
+		assert.NotContains(t, wmcb.kubeletServiceArgs(), "--container-runtime=remote")
+		assert.Equal(t, []string{ContainerRuntimeDocker}, wmcb.kubeletServiceConfig().Dependencies)
+	})
+
+	t.Run("containerd config", func(t *testing.T) {
+		wmcb := newContainerdBootstrapper()
+		wmcb.pauseImage = "registry.example.com/pause:test"
+		conf, err := wmcb.renderContainerdConf(runtimeconf.Registries{})
+		require.NoError(t, err, "error rendering containerd config")
+		assert.Contains(t, string(conf), "sandbox_image = 'registry.example.com/pause:test'")
+		assert.Contains(t, string(conf), "bin_dir = '"+cniBinDir(installDir)+"'")
+		assert.Contains(t, string(conf), "conf_dir = '"+cniConfDir(installDir)+"'")
+		assert.Contains(t, string(conf), `root = 'C:\ProgramData\containerd\root'`)
+		assert.NotContains(t, string(conf), "registry", "registry settings rendered without any registries")
+
+		wmcb.runtime.DataRoot = `D:\containerd`
+		wmcb.runtime.Mirrors = []runtimeconf.Mirror{{Source: "docker.io",
+			Endpoints: []string{"https://mirror.local", "https://mirror2.local"}}}
+		conf, err = wmcb.renderContainerdConf(runtimeconf.Registries{Insecure: []string{"registry.local:5000"}})
+		require.NoError(t, err, "error rendering containerd config")
+		assert.Contains(t, string(conf), `root = 'D:\containerd'`)
+		assert.Contains(t, string(conf), `[plugins."io.containerd.grpc.v1.cri".registry.mirrors."docker.io"]
+        endpoint = ['https://mirror.local', 'https://mirror2.local']`)
+		assert.Contains(t, string(conf), `[plugins."io.containerd.grpc.v1.cri".registry.configs."registry.local:5000".tls]
+        insecure_skip_verify = true`)
+	})
+
+	t.Run("reconcile", func(t *testing.T) {
+		require.NoError(t, newContainerdBootstrapper().reconcileKubelet(context.Background()), "error reconciling kubelet")
+		assert.FileExists(t, containerdConfigPath, "containerd config was not written")
+		assert.Equal(t, 1, containerd.stops, "containerd was not restarted after its config was written")
+		assert.Equal(t, svc.Running, containerd.state, "containerd is not running")
+		kubelet, found := svcMgr.services[KubeletServiceName]
+		require.True(t, found, "kubelet service was not created")
+		assert.Equal(t, []string{ContainerRuntimeContainerd}, kubelet.config.Dependencies)
+
+		require.NoError(t, newContainerdBootstrapper().reconcileKubelet(context.Background()), "error reconciling kubelet")
+		assert.Equal(t, 1, containerd.stops, "containerd was restarted even though its config did not change")
+	})
+}
+
+// TestDockerRuntime tests that the docker daemon.json is rendered from the runtime settings and the cluster image
+// config, and that docker is only restarted when it changes
+func TestDockerRuntime(t *testing.T) {
+	installDir, err := ioutil.TempDir("", "wmcb")
+	require.NoError(t, err, "error creating temp directory")
+	// Ignore the return error as there is not much we can do if the temporary directory is not deleted
+	defer os.RemoveAll(installDir)
+
+	imageConfigPath := filepath.Join(installDir, "image-config.yaml")
+	require.NoError(t, ioutil.WriteFile(imageConfigPath, []byte(`apiVersion: config.openshift.io/v1
+kind: Image
+spec:
+  registrySources:
+    insecureRegistries:
+    - registry.local:5000
+`), 0644))
+	docker := &fakeService{serviceName: ContainerRuntimeDocker, state: svc.Running}
+	svcMgr := newFakeServiceManager(docker)
+	dockerConfigPath := filepath.Join(installDir, "docker", "config", "daemon.json")
+	newDockerBootstrapper := func() *winNodeBootstrapper {
+		wmcb := newTestBootstrapper(t, installDir, "", svcMgr)
+		wmcb.containerRuntime = ContainerRuntimeDocker
+		wmcb.dockerConfigPath = dockerConfigPath
+		wmcb.runtime.ImageConfigPath = imageConfigPath
+		wmcb.pauseImage = "mcr.microsoft.com/oss/kubernetes/pause:1.4.1"
+		return wmcb
+	}
+	// writeRuntimeConfig writes the container runtime configuration files that are not up to date, restarting the
+	// container runtime if any was written
+	writeRuntimeConfig := func(wmcb *winNodeBootstrapper) error {
+		files, err := wmcb.desiredRuntimeFiles()
+		if err != nil {
+			return err
+		}
+		outdated, err := outdatedFiles(files)
+		if err != nil {
+			return err
+		}
+		return wmcb.writeNodeFiles(context.Background(), outdated)
+	}
+
+	require.NoError(t, writeRuntimeConfig(newDockerBootstrapper()),
+		"error initializing docker config")
+	daemon, err := ioutil.ReadFile(dockerConfigPath)
+	require.NoError(t, err, "docker daemon.json was not written")
+	assert.Contains(t, string(daemon), `"max-size": "50m"`)
+	assert.Contains(t, string(daemon), `"max-file": "5"`)
+	assert.Contains(t, string(daemon), `"insecure-registries": [
+    "registry.local:5000"
+  ]`)
+	assert.Equal(t, 1, docker.stops, "docker was not restarted after its config was written")
+	assert.Equal(t, svc.Running, docker.state, "docker is not running")
+
+	t.Run("no changes", func(t *testing.T) {
+		require.NoError(t, writeRuntimeConfig(newDockerBootstrapper()),
+			"error initializing docker config")
+		assert.Equal(t, 1, docker.stops, "docker was restarted even though its config did not change")
+	})
+
+	t.Run("log size changed", func(t *testing.T) {
+		wmcb := newDockerBootstrapper()
+		wmcb.runtime.LogMaxSize = "100Mi"
+		require.NoError(t, writeRuntimeConfig(wmcb), "error initializing docker config")
+		assert.Equal(t, 2, docker.stops, "docker was not restarted after its config changed")
+		conf, err := wmcb.renderKubeletConf()
+		require.NoError(t, err, "error rendering kubelet config")
+		assert.Contains(t, string(conf), `"containerLogMaxSize":"100Mi"`, "kubelet log rotation is not aligned")
+	})
+
+	t.Run("blocked pause image", func(t *testing.T) {
+		require.NoError(t, ioutil.WriteFile(imageConfigPath, []byte(`apiVersion: config.openshift.io/v1
+kind: Image
+spec:
+  registrySources:
+    blockedRegistries:
+    - mcr.microsoft.com
+`), 0644))
+		err := writeRuntimeConfig(newDockerBootstrapper())
+		require.Error(t, err, "pause image from a blocked registry accepted")
+		assert.Contains(t, err.Error(), "is from blocked registry mcr.microsoft.com")
+		assert.Equal(t, 2, docker.stops, "docker was restarted even though its config was not rendered")
+	})
+}
+
+// TestPauseImage tests that the pause image is picked based on the host build unless it is overridden, and that the
+// pause image archive is loaded with the tool of the container runtime
+func TestPauseImage(t *testing.T) {
+	wmcb := &winNodeBootstrapper{osInfo: osinfo.Static{Build: 19041}}
+	require.NoError(t, wmcb.resolvePauseImage(), "error resolving pause image")
+	assert.Equal(t, "mcr.microsoft.com/oss/kubernetes/pause:1.4.1", wmcb.pauseImage)
+	assert.Contains(t, wmcb.kubeletServiceArgs(),
+		"--pod-infra-container-image=mcr.microsoft.com/oss/kubernetes/pause:1.4.1")
+
+	wmcb = &winNodeBootstrapper{osInfo: osinfo.Static{Build: 99999}, log: crlog.NullLogger{}}
+	require.NoError(t, wmcb.resolvePauseImage(), "error resolving pause image for an unknown Windows build")
+	assert.Equal(t, pauseimage.DefaultImage, wmcb.pauseImage)
+
+	wmcb = &winNodeBootstrapper{osInfo: osinfo.Static{Build: 99999}, pauseImage: "registry.example.com/pause:test"}
+	require.NoError(t, wmcb.resolvePauseImage(), "error resolving overridden pause image")
+	assert.Equal(t, "registry.example.com/pause:test", wmcb.pauseImage)
+
+	name, args := wmcb.imageLoadCommand("C:\\pause.tar")
+	assert.Equal(t, "docker", name)
+	assert.Equal(t, []string{"load", "--input", "C:\\pause.tar"}, args)
+	wmcb.containerRuntime = ContainerRuntimeContainerd
+	name, args = wmcb.imageLoadCommand("C:\\pause.tar")
+	assert.Equal(t, "ctr", name)
+	assert.Equal(t, []string{"--namespace", "k8s.io", "images", "import", "C:\\pause.tar"}, args)
+}
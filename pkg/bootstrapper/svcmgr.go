@@ -0,0 +1,73 @@
+package bootstrapper
+
+import (
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+// ServiceManager is the subset of the Windows service control manager API that WMCB uses. It exists so that the SCM
+// can be swapped out, with WithServiceManager, for a fake in unit tests or for a connection managed by the caller.
+type ServiceManager interface {
+	// CreateService installs a new service with the given name and config
+	CreateService(name, exepath string, c mgr.Config, args ...string) (WindowsService, error)
+	// OpenService retrieves access to the service with the given name
+	OpenService(name string) (WindowsService, error)
+	// Disconnect closes the connection to the service control manager
+	Disconnect() error
+}
+
+// WindowsService is the subset of the *mgr.Service API that WMCB uses
+type WindowsService interface {
+	// ServiceName returns the name of the service
+	ServiceName() string
+	Close() error
+	Config() (mgr.Config, error)
+	Control(c svc.Cmd) (svc.Status, error)
+	Delete() error
+	Query() (svc.Status, error)
+	SetRecoveryActions(recoveryActions []mgr.RecoveryAction, resetPeriod uint32) error
+	Start(args ...string) error
+	UpdateConfig(c mgr.Config) error
+}
+
+// scm is the ServiceManager backed by the Windows service control manager
+type scm struct {
+	*mgr.Mgr
+}
+
+// scmService is the WindowsService backed by a service registered with the Windows service control manager
+type scmService struct {
+	*mgr.Service
+}
+
+// connectSCM establishes a connection to the Windows service control manager
+func connectSCM() (ServiceManager, error) {
+	m, err := mgr.Connect()
+	if err != nil {
+		return nil, err
+	}
+	return &scm{m}, nil
+}
+
+// CreateService installs a new service with the given name and config
+func (m *scm) CreateService(name, exepath string, c mgr.Config, args ...string) (WindowsService, error) {
+	s, err := m.Mgr.CreateService(name, exepath, c, args...)
+	if err != nil {
+		return nil, err
+	}
+	return &scmService{s}, nil
+}
+
+// OpenService retrieves access to the service with the given name
+func (m *scm) OpenService(name string) (WindowsService, error) {
+	s, err := m.Mgr.OpenService(name)
+	if err != nil {
+		return nil, err
+	}
+	return &scmService{s}, nil
+}
+
+// ServiceName returns the name of the service
+func (s *scmService) ServiceName() string {
+	return s.Name
+}
@@ -0,0 +1,123 @@
+package bootstrapper
+
+import (
+	"fmt"
+	"syscall"
+
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+// fakeServiceManager is an in-memory ServiceManager used to test the service handling without touching the Windows
+// service control manager
+type fakeServiceManager struct {
+	// services holds the services known to the fake, keyed by name
+	services map[string]*fakeService
+}
+
+// fakeService is an in-memory WindowsService
+type fakeService struct {
+	// serviceName is the name the service was created with
+	serviceName string
+	// config is the current service config
+	config mgr.Config
+	// state is the current state of the service
+	state svc.State
+	// starts counts the number of times the service has been started
+	starts int
+	// stops counts the number of times the service has been stopped
+	stops int
+	// deleted is true if the service has been marked for deletion
+	deleted bool
+	// recoveryActions holds the recovery actions set on the service
+	recoveryActions []mgr.RecoveryAction
+}
+
+// newFakeServiceManager returns a fakeServiceManager with the given services already present
+func newFakeServiceManager(services ...*fakeService) *fakeServiceManager {
+	m := &fakeServiceManager{services: make(map[string]*fakeService)}
+	for _, s := range services {
+		m.services[s.serviceName] = s
+	}
+	return m
+}
+
+// CreateService adds a new stopped service, building the command line the same way the Windows service API does
+func (m *fakeServiceManager) CreateService(name, exepath string, c mgr.Config, args ...string) (WindowsService,
+	error) {
+	if _, found := m.services[name]; found {
+		return nil, fmt.Errorf("service %s already exists", name)
+	}
+	c.BinaryPathName = syscall.EscapeArg(exepath)
+	for _, arg := range args {
+		c.BinaryPathName += " " + syscall.EscapeArg(arg)
+	}
+	s := &fakeService{serviceName: name, config: c, state: svc.Stopped}
+	m.services[name] = s
+	return s, nil
+}
+
+// OpenService returns the service with the given name
+func (m *fakeServiceManager) OpenService(name string) (WindowsService, error) {
+	s, found := m.services[name]
+	if !found || s.deleted {
+		return nil, windows.ERROR_SERVICE_DOES_NOT_EXIST
+	}
+	return s, nil
+}
+
+// Disconnect is a no-op
+func (m *fakeServiceManager) Disconnect() error {
+	return nil
+}
+
+func (s *fakeService) ServiceName() string {
+	return s.serviceName
+}
+
+func (s *fakeService) Close() error {
+	return nil
+}
+
+func (s *fakeService) Config() (mgr.Config, error) {
+	return s.config, nil
+}
+
+// Control only supports stopping the service
+func (s *fakeService) Control(c svc.Cmd) (svc.Status, error) {
+	if c != svc.Stop {
+		return svc.Status{}, fmt.Errorf("unsupported control command %d", c)
+	}
+	s.state = svc.Stopped
+	s.stops++
+	return svc.Status{State: s.state}, nil
+}
+
+func (s *fakeService) Delete() error {
+	s.deleted = true
+	return nil
+}
+
+func (s *fakeService) Query() (svc.Status, error) {
+	return svc.Status{State: s.state}, nil
+}
+
+func (s *fakeService) SetRecoveryActions(recoveryActions []mgr.RecoveryAction, _ uint32) error {
+	s.recoveryActions = recoveryActions
+	return nil
+}
+
+func (s *fakeService) Start(_ ...string) error {
+	if s.state == svc.Running {
+		return fmt.Errorf("service %s is already running", s.serviceName)
+	}
+	s.state = svc.Running
+	s.starts++
+	return nil
+}
+
+func (s *fakeService) UpdateConfig(c mgr.Config) error {
+	s.config = c
+	return nil
+}
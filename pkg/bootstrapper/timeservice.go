@@ -0,0 +1,62 @@
+package bootstrapper
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	ignitionCfgv3Types "github.com/coreos/ignition/v2/config/v3_1/types"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/ignition"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/timesync"
+)
+
+const (
+	// chronyConfPath is where the MachineConfigs setting the NTP servers of the cluster place the chrony config
+	chronyConfPath = "/etc/chrony.conf"
+	// timeServiceName is the name of the Windows time service
+	timeServiceName = "W32Time"
+)
+
+// setTimePlan takes the W32Time configuration from the NTP servers of the chrony config of the ignition. The time
+// service is left alone if the ignition has no chrony config, or one without servers, as the cluster then uses the
+// default NTP servers of RHCOS, which Windows has no reason to sync with instead of its own.
+func (wmcb *winNodeBootstrapper) setTimePlan(configuration ignitionCfgv3Types.Config) error {
+	wmcb.timePlan = nil
+	chronyConf, found, err := ignition.ReadFile(configuration, chronyConfPath)
+	if err != nil || !found {
+		return err
+	}
+	servers, err := timesync.ParseChrony(chronyConf)
+	if err != nil {
+		return fmt.Errorf("could not process %s: %v", chronyConfPath, err)
+	}
+	if plan, ok := timesync.NewPlan(servers); ok {
+		wmcb.timePlan = &plan
+	}
+	return nil
+}
+
+// configureTimeService applies the W32Time configuration taken from the ignition, and restarts the time service so that
+// it syncs with the NTP servers of the cluster. Nothing is done if the time service already has the configuration.
+func (wmcb *winNodeBootstrapper) configureTimeService(ctx context.Context) error {
+	if wmcb.timePlan == nil {
+		return nil
+	}
+	current, err := wmcb.timeHost.Current()
+	if err != nil {
+		return fmt.Errorf("unable to read time service configuration: %v", err)
+	}
+	if reflect.DeepEqual(current, *wmcb.timePlan) {
+		return nil
+	}
+	wmcb.log.Info("configuring time service", "ntpServer", wmcb.timePlan.NtpServer(),
+		"minPollInterval", wmcb.timePlan.MinPollInterval, "maxPollInterval", wmcb.timePlan.MaxPollInterval)
+	if err = wmcb.timeHost.Apply(*wmcb.timePlan); err != nil {
+		return fmt.Errorf("unable to configure time service: %v", err)
+	}
+	if err = restartService(ctx, wmcb.svcMgr, timeServiceName, wmcb.serviceWaitTime); err != nil {
+		return fmt.Errorf("unable to restart %s service after configuring it: %v", timeServiceName, err)
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package bootstrapper
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/windows/svc"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/timesync"
+)
+
+// fakeTimeHost is an in-memory timesync.Host
+type fakeTimeHost struct {
+	// plan is the current configuration of the time service
+	plan timesync.Plan
+	// applies counts the number of times a configuration has been applied
+	applies int
+}
+
+// Current returns the current configuration of the time service
+func (h *fakeTimeHost) Current() (timesync.Plan, error) {
+	return h.plan, nil
+}
+
+// Apply replaces the current configuration of the time service
+func (h *fakeTimeHost) Apply(plan timesync.Plan) error {
+	h.plan = plan
+	h.applies++
+	return nil
+}
+
+// chronyIgnition returns an ignition file holding the given chrony config
+func chronyIgnition(t *testing.T, chronyConf string) []byte {
+	contents, err := json.Marshal(map[string]interface{}{
+		"ignition": map[string]string{"version": "3.1.0"},
+		"storage": map[string]interface{}{
+			"files": []map[string]interface{}{
+				{"path": chronyConfPath, "contents": map[string]string{"source": "data:," + url.PathEscape(chronyConf)}},
+			},
+		},
+	})
+	require.NoError(t, err)
+	return contents
+}
+
+// TestConfigureTimeService tests that the time service is configured with the NTP servers of the chrony config of the
+// ignition, and that it is only reconfigured and restarted when they change
+func TestConfigureTimeService(t *testing.T) {
+	installDir, err := ioutil.TempDir("", "wmcb")
+	require.NoError(t, err, "error creating temp directory")
+	// Ignore the return error as there is not much we can do if the temporary directory is not deleted
+	defer os.RemoveAll(installDir)
+
+	w32time := &fakeService{serviceName: timeServiceName, state: svc.Running}
+	svcMgr := newFakeServiceManager(w32time)
+	timeHost := &fakeTimeHost{plan: timesync.Plan{Type: "NT5DS",
+		Peers: []timesync.Peer{{Address: "time.windows.com", Flags: 0x9}}, MinPollInterval: 10, MaxPollInterval: 15}}
+	reconcile := func(ignition []byte) error {
+		wmcb := newTestBootstrapper(t, installDir, "", svcMgr)
+		wmcb.ignitionContents = ignition
+		wmcb.timeHost = timeHost
+		return wmcb.reconcileKubelet(context.Background())
+	}
+
+	require.NoError(t, reconcile(chronyIgnition(t, "server ntp1.example.com iburst\nserver ntp2.example.com\n")),
+		"error reconciling kubelet")
+	assert.Equal(t, 1, timeHost.applies, "time service was not configured")
+	assert.Equal(t, timesync.TypeNTP, timeHost.plan.Type)
+	assert.Equal(t, "ntp1.example.com,0x8 ntp2.example.com,0x8", timeHost.plan.NtpServer())
+	assert.Equal(t, 1, w32time.stops, "time service was not restarted")
+	assert.Equal(t, svc.Running, w32time.state, "time service is not running")
+
+	t.Run("no changes", func(t *testing.T) {
+		require.NoError(t, reconcile(chronyIgnition(t, "server ntp1.example.com iburst\nserver ntp2.example.com\n")),
+			"error reconciling kubelet")
+		assert.Equal(t, 1, timeHost.applies, "time service was configured even though nothing changed")
+		assert.Equal(t, 1, w32time.stops, "time service was restarted even though nothing changed")
+	})
+
+	t.Run("servers changed", func(t *testing.T) {
+		require.NoError(t, reconcile(chronyIgnition(t, "pool ntp.example.com maxpoll 12\n")),
+			"error reconciling kubelet")
+		assert.Equal(t, 2, timeHost.applies, "time service was not reconfigured")
+		assert.Equal(t, "ntp.example.com,0x8", timeHost.plan.NtpServer())
+		assert.Equal(t, uint32(12), timeHost.plan.MaxPollInterval)
+		assert.Equal(t, 2, w32time.stops, "time service was not restarted")
+	})
+
+	t.Run("no chrony config", func(t *testing.T) {
+		require.NoError(t, reconcile(chronyIgnition(t, "driftfile /var/lib/chrony/drift\n")),
+			"error reconciling kubelet")
+		assert.Equal(t, 2, timeHost.applies, "time service was configured without NTP servers")
+	})
+
+	t.Run("invalid chrony config", func(t *testing.T) {
+		err := reconcile(chronyIgnition(t, "server ntp.example.com minpoll fast\n"))
+		require.Error(t, err, "invalid chrony config accepted")
+		assert.Contains(t, err.Error(), chronyConfPath)
+	})
+}
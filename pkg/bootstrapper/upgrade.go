@@ -0,0 +1,146 @@
+package bootstrapper
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"k8s.io/client-go/tools/clientcmd"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/kubeversion"
+)
+
+const (
+	// apiServerTimeout is the timeout for requests to the API server
+	apiServerTimeout = 30 * time.Second
+	// kubeletNewSuffix is appended to kubelet.exe for the staged copy of the new kubelet
+	kubeletNewSuffix = ".new"
+	// kubeletBackupSuffix is appended to kubelet.exe for the copy of the previous kubelet, kept for rollback
+	kubeletBackupSuffix = ".bak"
+)
+
+// upgradeKubelet replaces the kubelet binary in the install directory with the given one, without rerunning the
+// bootstrap. The new binary must match the given sha256 digest, and its version must be within the Kubernetes version
+// skew policy relative to the API server found in the bootstrap kubeconfig. The kubelet and its dependents are
+// stopped, the binary is swapped and the kubelet is started again. If the kubelet does not report healthy, the
+// previous binary is restored.
+func (wmcb *winNodeBootstrapper) upgradeKubelet(ctx context.Context, kubeletPath, digest string) error {
+	if wmcb.kubeletSVC == nil {
+		return kubeletNotInstalled()
+	}
+
+	actualDigest, err := fileDigest(kubeletPath)
+	if err != nil {
+		return fmt.Errorf("error computing digest of %s: %v", kubeletPath, err)
+	}
+	if !strings.EqualFold(actualDigest, digest) {
+		return fmt.Errorf("sha256 digest of %s is %s, expected %s", kubeletPath, actualDigest, digest)
+	}
+
+	kubeletExe := filepath.Join(wmcb.installDir, "kubelet.exe")
+	if currentDigest, err := fileDigest(kubeletExe); err == nil && currentDigest == actualDigest {
+		// The kubelet is already at the desired version
+		return nil
+	}
+
+	if err = wmcb.checkKubeletVersion(ctx, kubeletPath); err != nil {
+		return err
+	}
+	return wmcb.swapKubelet(ctx, kubeletPath)
+}
+
+// checkKubeletVersion checks that the version of the given kubelet binary is supported with the version of the API
+// server found in the bootstrap kubeconfig
+func (wmcb *winNodeBootstrapper) checkKubeletVersion(ctx context.Context, kubeletPath string) error {
+	out, err := exec.CommandContext(ctx, kubeletPath, "--version").CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("error getting version of %s: %v: %s", kubeletPath, err, out)
+	}
+	kubeletVersion, err := kubeversion.Parse(string(out))
+	if err != nil {
+		return fmt.Errorf("error parsing version of %s: %v", kubeletPath, err)
+	}
+
+	config, err := clientcmd.LoadFromFile(filepath.Join(wmcb.installDir, "bootstrap-kubeconfig"))
+	if err != nil {
+		return fmt.Errorf("error reading bootstrap kubeconfig: %v", err)
+	}
+	client, server, err := apiServerClient(config, apiServerTimeout)
+	if err != nil {
+		return err
+	}
+	serverVersion, err := kubeversion.ServerVersion(ctx, client, server)
+	if err != nil {
+		return err
+	}
+
+	if err = kubeversion.CheckKubeletSkew(kubeletVersion, serverVersion); err != nil {
+		return fmt.Errorf("unsupported kubelet version: %v", err)
+	}
+	return nil
+}
+
+// swapKubelet stops the kubelet service, atomically replaces kubelet.exe with the given binary, starts the kubelet
+// service and verifies that it is healthy. The previous binary is restored if any of these steps fail, or if the
+// context is cancelled while waiting for the kubelet to become healthy. Once the kubelet has been stopped, the swap or
+// the rollback is completed even if the context is cancelled.
+func (wmcb *winNodeBootstrapper) swapKubelet(ctx context.Context, kubeletPath string) error {
+	kubeletExe := filepath.Join(wmcb.installDir, "kubelet.exe")
+	staged := kubeletExe + kubeletNewSuffix
+	backup := kubeletExe + kubeletBackupSuffix
+
+	// Stage the new kubelet next to the current one first, so that the swap is a rename within the same volume
+	if err := copyFile(ctx, kubeletPath, staged); err != nil {
+		return fmt.Errorf("error staging %s: %v", kubeletPath, err)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	critical := withoutCancel(ctx)
+	if err := wmcb.kubeletSVC.stop(critical); err != nil {
+		return kubeletServiceError("stop", err)
+	}
+	if err := os.Rename(kubeletExe, backup); err != nil {
+		return wmcb.rollbackKubelet(critical, backup, fmt.Errorf("error backing up %s: %v", kubeletExe, err))
+	}
+	if err := os.Rename(staged, kubeletExe); err != nil {
+		return wmcb.rollbackKubelet(critical, backup, fmt.Errorf("error replacing %s: %v", kubeletExe, err))
+	}
+	if err := wmcb.kubeletSVC.start(); err != nil {
+		return wmcb.rollbackKubelet(critical, backup, fmt.Errorf("error starting kubelet service: %v", err))
+	}
+	if err := wmcb.verifyKubelet(ctx); err != nil {
+		return wmcb.rollbackKubelet(critical, backup, err)
+	}
+
+	if err := os.Remove(backup); err != nil {
+		return fmt.Errorf("kubelet upgraded, but unable to remove %s: %v", backup, err)
+	}
+	return nil
+}
+
+// rollbackKubelet restores the kubelet binary from the given backup and starts the kubelet service. The given cause
+// is returned along with any errors encountered during the rollback.
+func (wmcb *winNodeBootstrapper) rollbackKubelet(ctx context.Context, backup string, cause error) error {
+	kubeletExe := filepath.Join(wmcb.installDir, "kubelet.exe")
+	if err := wmcb.kubeletSVC.stop(ctx); err != nil {
+		return fmt.Errorf("%v, and unable to stop kubelet service for rollback: %v", cause, err)
+	}
+	if _, err := os.Stat(backup); err == nil {
+		if err = os.Remove(kubeletExe); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("%v, and unable to remove %s for rollback: %v", cause, kubeletExe, err)
+		}
+		if err = os.Rename(backup, kubeletExe); err != nil {
+			return fmt.Errorf("%v, and unable to restore %s: %v", cause, backup, err)
+		}
+	}
+	if err := wmcb.kubeletSVC.start(); err != nil {
+		return fmt.Errorf("%v, and unable to start kubelet service after rollback: %v", cause, err)
+	}
+	return fmt.Errorf("kubelet upgrade rolled back: %v", cause)
+}
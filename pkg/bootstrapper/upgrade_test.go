@@ -0,0 +1,89 @@
+package bootstrapper
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/windows/svc"
+)
+
+// TestUpgradeKubelet tests that the kubelet binary is only replaced if it matches the expected digest, and that the
+// kubelet is restarted once the binary has been swapped
+func TestUpgradeKubelet(t *testing.T) {
+	installDir, err := ioutil.TempDir("", "wmcb")
+	require.NoError(t, err, "error creating temp directory")
+	// Ignore the return error as there is not much we can do if the temporary directory is not deleted
+	defer os.RemoveAll(installDir)
+	srcDir, err := ioutil.TempDir("", "kubelet")
+	require.NoError(t, err, "error creating temp directory")
+	defer os.RemoveAll(srcDir)
+
+	kubeletExe := filepath.Join(installDir, "kubelet.exe")
+	require.NoError(t, ioutil.WriteFile(kubeletExe, []byte("old kubelet"), 0644))
+	newKubelet := filepath.Join(srcDir, "kubelet.exe")
+	require.NoError(t, ioutil.WriteFile(newKubelet, []byte("new kubelet"), 0644))
+
+	healthy := true
+	healthz := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !healthy {
+			http.Error(w, "not healthy", http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer healthz.Close()
+
+	kubelet := &fakeService{serviceName: KubeletServiceName, state: svc.Running}
+	wmcb := newTestBootstrapper(t, installDir, "", newFakeServiceManager(kubelet))
+	wmcb.kubeletHealthCheck = kubeletHealthCheck{url: healthz.URL, timeout: time.Second,
+		interval: 10 * time.Millisecond}
+
+	t.Run("digest mismatch", func(t *testing.T) {
+		err := wmcb.upgradeKubelet(context.Background(), newKubelet, "0000")
+		require.Error(t, err, "no error returned on digest mismatch")
+		assert.Contains(t, err.Error(), "expected 0000")
+		assert.Equal(t, 0, kubelet.stops, "kubelet was stopped")
+	})
+
+	t.Run("swap", func(t *testing.T) {
+		require.NoError(t, wmcb.swapKubelet(context.Background(), newKubelet), "error swapping kubelet")
+		contents, err := ioutil.ReadFile(kubeletExe)
+		require.NoError(t, err)
+		assert.Equal(t, "new kubelet", string(contents), "kubelet.exe was not replaced")
+		assert.Equal(t, svc.Running, kubelet.state, "kubelet service is not running")
+		assert.Equal(t, 1, kubelet.stops)
+		_, err = os.Stat(kubeletExe + kubeletBackupSuffix)
+		assert.True(t, os.IsNotExist(err), "kubelet backup was not removed")
+	})
+
+	t.Run("already upgraded", func(t *testing.T) {
+		digest, err := fileDigest(newKubelet)
+		require.NoError(t, err)
+		require.NoError(t, wmcb.upgradeKubelet(context.Background(), newKubelet, digest),
+			"error upgrading to the installed kubelet")
+		assert.Equal(t, 1, kubelet.stops, "kubelet was restarted")
+	})
+
+	t.Run("rollback on unhealthy kubelet", func(t *testing.T) {
+		healthy = false
+		defer func() { healthy = true }()
+		brokenKubelet := filepath.Join(srcDir, "broken-kubelet.exe")
+		require.NoError(t, ioutil.WriteFile(brokenKubelet, []byte("broken kubelet"), 0644))
+
+		err := wmcb.swapKubelet(context.Background(), brokenKubelet)
+		require.Error(t, err, "no error returned for an unhealthy kubelet")
+		assert.Contains(t, err.Error(), "rolled back")
+		contents, err := ioutil.ReadFile(kubeletExe)
+		require.NoError(t, err)
+		assert.Equal(t, "new kubelet", string(contents), "previous kubelet.exe was not restored")
+		assert.Equal(t, svc.Running, kubelet.state, "kubelet service is not running after rollback")
+	})
+}
@@ -0,0 +1,144 @@
+package bootstrapper
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/windows/svc"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/health"
+)
+
+const (
+	// kubeletHealthzURL is the default kubelet healthz endpoint
+	kubeletHealthzURL = "http://127.0.0.1:10248/healthz"
+	// kubeletHealthInterval is how often the kubelet health is checked
+	kubeletHealthInterval = 2 * time.Second
+	// kubeletHealthyChecks is the number of consecutive checks the kubelet has to pass before it is considered
+	// healthy. This catches a kubelet that reports healthy and then crashes on a bad config.
+	kubeletHealthyChecks = 3
+	// kubeletLogTailLines is the number of lines of the kubelet log included in the error when the kubelet is not
+	// healthy
+	kubeletLogTailLines = 20
+	// kubeletLogTailBytes is how much of the end of the kubelet log is read to find its last lines
+	kubeletLogTailBytes = 16 * 1024
+)
+
+// kubeletHealthCheck holds the settings used to verify that the kubelet is healthy after it has been started
+type kubeletHealthCheck struct {
+	// url is the kubelet healthz endpoint
+	url string
+	// timeout is how long we wait for the kubelet to report healthy. The kubelet is not verified if it is zero.
+	timeout time.Duration
+	// interval is how often the kubelet health is checked
+	interval time.Duration
+}
+
+// verifyKubelet waits until the kubelet service is running and the kubelet healthz endpoint has reported healthy for
+// kubeletHealthyChecks consecutive checks. If the kubelet service stops or the timeout is reached, an error containing
+// the last lines of the kubelet log is returned. Waiting stops if the context is cancelled.
+func (wmcb *winNodeBootstrapper) verifyKubelet(ctx context.Context) error {
+	check := wmcb.kubeletHealthCheck
+	if check.timeout <= 0 {
+		return nil
+	}
+	client := &http.Client{Timeout: check.interval}
+	deadline := time.Now().Add(check.timeout)
+	healthyChecks := 0
+	for {
+		status, err := wmcb.kubeletSVC.obj.Query()
+		if err != nil {
+			return fmt.Errorf("could not retrieve kubelet service status: %v", err)
+		}
+
+		var checkErr error
+		switch status.State {
+		case svc.Running:
+			checkErr = health.CheckHealthz(ctx, client, check.url)
+		case svc.Stopped:
+			return wmcb.kubeletFailure(fmt.Errorf("kubelet service stopped after it was started"))
+		default:
+			checkErr = fmt.Errorf("kubelet service is in state %d", status.State)
+		}
+
+		if checkErr == nil {
+			healthyChecks++
+			if healthyChecks == kubeletHealthyChecks {
+				return nil
+			}
+		} else {
+			healthyChecks = 0
+		}
+
+		if time.Now().Add(check.interval).After(deadline) {
+			if checkErr == nil {
+				checkErr = fmt.Errorf("kubelet did not stay healthy")
+			}
+			return wmcb.kubeletFailure(fmt.Errorf("timed out after %s waiting for kubelet to become healthy: %v",
+				check.timeout, checkErr))
+		}
+		if err = sleep(ctx, check.interval); err != nil {
+			return fmt.Errorf("stopped waiting for kubelet to become healthy: %w", err)
+		}
+	}
+}
+
+// kubeletHealthy returns true if the kubelet healthz endpoint reports healthy
+func (wmcb *winNodeBootstrapper) kubeletHealthy(ctx context.Context) bool {
+	check := wmcb.kubeletHealthCheck
+	client := &http.Client{Timeout: check.interval}
+	return health.CheckHealthz(ctx, client, check.url) == nil
+}
+
+// kubeletFailure returns a KubeletHealthError holding the given cause and the last lines of the kubelet log
+func (wmcb *winNodeBootstrapper) kubeletFailure(cause error) error {
+	kubeletLog := filepath.Join(wmcb.logDir, "kubelet.log")
+	lines, err := tailFile(kubeletLog, kubeletLogTailLines)
+	return &KubeletHealthError{Err: cause, LogPath: kubeletLog, LogTail: lines, logErr: err}
+}
+
+// tailFile returns the last n lines of the given file. Only the last kubeletLogTailBytes of the file are read, as the
+// kubelet log can grow large, so fewer lines are returned if they do not fit in them. A line cut short by the start of
+// the read is left out, unless it is the only one.
+func tailFile(path string, n int) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	offset := info.Size() - kubeletLogTailBytes
+	if offset < 0 {
+		offset = 0
+	}
+	tail := make([]byte, info.Size()-offset)
+	if _, err = f.ReadAt(tail, offset); err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	contents := strings.TrimSuffix(strings.TrimSuffix(string(tail), "\n"), "\r")
+	if contents == "" {
+		return nil, nil
+	}
+	lines := strings.Split(contents, "\n")
+	if offset > 0 && len(lines) > 1 {
+		lines = lines[1:]
+	}
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	for i := range lines {
+		lines[i] = strings.TrimSuffix(lines[i], "\r")
+	}
+	return lines, nil
+}
@@ -0,0 +1,117 @@
+package bootstrapper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/windows/svc"
+)
+
+// TestVerifyKubelet tests the kubelet health verification against a stand-in healthz endpoint and the fake service
+// manager
+func TestVerifyKubelet(t *testing.T) {
+	logDir, err := ioutil.TempDir("", "kubeletlog")
+	require.NoError(t, err, "error creating temp directory")
+	// Ignore the return error as there is not much we can do if the temporary directory is not deleted
+	defer os.RemoveAll(logDir)
+	var logLines []string
+	for i := 1; i <= 30; i++ {
+		logLines = append(logLines, fmt.Sprintf("log line %d", i))
+	}
+	require.NoError(t, ioutil.WriteFile(filepath.Join(logDir, "kubelet.log"), []byte(strings.Join(logLines, "\n")),
+		0644))
+
+	healthz := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/healthz" {
+			http.Error(w, "not healthy", http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer healthz.Close()
+
+	newVerifier := func(state svc.State, path string) *winNodeBootstrapper {
+		kubelet := &fakeService{serviceName: KubeletServiceName, state: state}
+		wmcb := &winNodeBootstrapper{
+			logDir: logDir,
+			kubeletHealthCheck: kubeletHealthCheck{url: healthz.URL + path, timeout: 200 * time.Millisecond,
+				interval: 10 * time.Millisecond},
+		}
+		wmcb.kubeletSVC, err = newKubeletService(kubelet, nil, time.Second)
+		require.NoError(t, err, "error initializing kubelet service")
+		return wmcb
+	}
+
+	t.Run("healthy kubelet", func(t *testing.T) {
+		assert.NoError(t, newVerifier(svc.Running, "/healthz").verifyKubelet(context.Background()))
+	})
+
+	t.Run("stopped kubelet", func(t *testing.T) {
+		err := newVerifier(svc.Stopped, "/healthz").verifyKubelet(context.Background())
+		require.Error(t, err, "no error returned for a stopped kubelet")
+		assert.Contains(t, err.Error(), "kubelet service stopped")
+		assert.Contains(t, err.Error(), "log line 30", "kubelet log was not included in the error")
+		assert.NotContains(t, err.Error(), "log line 10\n", "more than the last lines of the log were included")
+		var healthErr *KubeletHealthError
+		require.True(t, errors.As(err, &healthErr), "error is not a KubeletHealthError")
+		assert.Len(t, healthErr.LogTail, kubeletLogTailLines)
+	})
+
+	t.Run("unhealthy kubelet", func(t *testing.T) {
+		err := newVerifier(svc.Running, "/unhealthy").verifyKubelet(context.Background())
+		require.Error(t, err, "no error returned for an unhealthy kubelet")
+		assert.Contains(t, err.Error(), "timed out")
+		assert.Contains(t, err.Error(), "not healthy")
+		assert.Contains(t, err.Error(), "log line 30", "kubelet log was not included in the error")
+	})
+
+	t.Run("verification disabled", func(t *testing.T) {
+		wmcb := newVerifier(svc.Stopped, "/unhealthy")
+		wmcb.kubeletHealthCheck.timeout = 0
+		assert.NoError(t, wmcb.verifyKubelet(context.Background()))
+	})
+}
+
+// TestTailFile tests that tailFile returns the last lines of a file
+func TestTailFile(t *testing.T) {
+	f, err := ioutil.TempFile("", "tail")
+	require.NoError(t, err)
+	// Ignore the return error as there is not much we can do if the temporary file is not deleted
+	defer os.Remove(f.Name())
+	_, err = f.WriteString("one\ntwo\nthree\n")
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	lines, err := tailFile(f.Name(), 2)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"two", "three"}, lines)
+
+	lines, err = tailFile(f.Name(), 10)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"one", "two", "three"}, lines)
+
+	t.Run("large file", func(t *testing.T) {
+		f, err := ioutil.TempFile("", "tail")
+		require.NoError(t, err)
+		defer os.Remove(f.Name())
+		// The first line is longer than both the tail that is read and the longest line bufio.Scanner accepts
+		_, err = f.WriteString(strings.Repeat("x", 100*1024) + "\r\nfour\r\nfive\r\n")
+		require.NoError(t, err)
+		require.NoError(t, f.Close())
+
+		lines, err := tailFile(f.Name(), 10)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"four", "five"}, lines)
+	})
+}
@@ -0,0 +1,250 @@
+// Package cniconf parses and validates the CNI network config of Windows nodes, and verifies the CNI binaries against a
+// manifest of their digests, so that a broken config or a corrupted plugin is rejected before it takes the pod
+// networking of the node down
+package cniconf
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/containernetworking/cni/libcni"
+	"github.com/containernetworking/cni/pkg/types"
+)
+
+const (
+	// PolicyOutBoundNAT is the endpoint policy type listing the destinations excluded from outbound NAT
+	PolicyOutBoundNAT = "OutBoundNAT"
+	// PolicyRoute is the endpoint policy type routing a destination prefix, such as the service network
+	PolicyRoute = "ROUTE"
+)
+
+// NetConf is the network config of a Windows CNI plugin such as win-overlay or win-bridge
+type NetConf struct {
+	types.NetConf
+	// IPAM replaces the IPAM of types.NetConf with the fields used by host-local
+	IPAM IPAM `json:"ipam,omitempty"`
+	// DNS replaces the DNS of types.NetConf so that it is left out of rendered configs when not set
+	DNS *types.DNS `json:"dns,omitempty"`
+	// Policies are the HNS endpoint policies applied to the pods of the network
+	Policies []Policy `json:"policies,omitempty"`
+}
+
+// IPAM is the IPAM config of a Windows CNI plugin
+type IPAM struct {
+	// Type is the IPAM plugin, such as host-local
+	Type string `json:"type,omitempty"`
+	// Subnet is the CIDR pod addresses are allocated from
+	Subnet string `json:"subnet,omitempty"`
+	// Ranges are the sets of ranges pod addresses are allocated from, one address per set. Dual-stack networks have a
+	// set per IP family.
+	Ranges [][]Range `json:"ranges,omitempty"`
+	// Routes are the routes added to the pods
+	Routes []Route `json:"routes,omitempty"`
+}
+
+// Range is a range pod addresses are allocated from
+type Range struct {
+	// Subnet is the CIDR of the range
+	Subnet string `json:"subnet"`
+	// Gateway is the gateway of the range
+	Gateway string `json:"gateway,omitempty"`
+}
+
+// subnets returns the subnet and the subnets of the ranges pod addresses are allocated from
+func (i IPAM) subnets() ([]*net.IPNet, error) {
+	var subnets []*net.IPNet
+	if i.Subnet != "" {
+		_, subnet, err := net.ParseCIDR(i.Subnet)
+		if err != nil {
+			return nil, fmt.Errorf("invalid IPAM subnet %q: %v", i.Subnet, err)
+		}
+		subnets = append(subnets, subnet)
+	}
+	for _, set := range i.Ranges {
+		for _, r := range set {
+			_, subnet, err := net.ParseCIDR(r.Subnet)
+			if err != nil {
+				return nil, fmt.Errorf("invalid IPAM range subnet %q: %v", r.Subnet, err)
+			}
+			if r.Gateway != "" && !subnet.Contains(net.ParseIP(r.Gateway)) {
+				return nil, fmt.Errorf("IPAM range gateway %q is not within %s", r.Gateway, subnet)
+			}
+			subnets = append(subnets, subnet)
+		}
+	}
+	return subnets, nil
+}
+
+// Route is a route added to the pods
+type Route struct {
+	// Dst is the destination CIDR of the route
+	Dst string `json:"dst"`
+	// GW is the gateway of the route
+	GW string `json:"gw,omitempty"`
+}
+
+// Policy is an HNS policy of a Windows CNI plugin
+type Policy struct {
+	// Name is the kind of policy, such as EndpointPolicy
+	Name string `json:"name"`
+	// Value is the HNS policy itself, which is decoded by EndpointPolicy
+	Value json.RawMessage `json:"value"`
+}
+
+// EndpointPolicy holds the fields of the endpoint policies that are rendered or validated
+type EndpointPolicy struct {
+	// Type is the type of the policy, such as OutBoundNAT or ROUTE
+	Type string `json:"Type"`
+	// ExceptionList are the destinations an OutBoundNAT policy does not NAT
+	ExceptionList []string `json:"ExceptionList,omitempty"`
+	// DestinationPrefix is the destination of a ROUTE policy
+	DestinationPrefix string `json:"DestinationPrefix,omitempty"`
+	// NeedEncap is set on a ROUTE policy whose traffic is encapsulated
+	NeedEncap bool `json:"NeedEncap,omitempty"`
+	// VSID is the virtual subnet ID of a VSID policy
+	VSID uint32 `json:"VSID,omitempty"`
+}
+
+// EndpointPolicy decodes the value of the policy
+func (p Policy) EndpointPolicy() (EndpointPolicy, error) {
+	var policy EndpointPolicy
+	if err := json.Unmarshal(p.Value, &policy); err != nil {
+		return EndpointPolicy{}, fmt.Errorf("unable to parse %s: %v", p.Name, err)
+	}
+	return policy, nil
+}
+
+// Config is a CNI network config, read either from a single plugin conf or from a conflist
+type Config struct {
+	// Name is the name of the network
+	Name string
+	// List is true if the config is a conflist
+	List bool
+	// Plugins are the plugins of the network, in the order they are run
+	Plugins []NetConf
+}
+
+// Parse parses a CNI conf, or a conflist if it has a plugins key
+func Parse(data []byte) (Config, error) {
+	var keys map[string]json.RawMessage
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return Config{}, fmt.Errorf("invalid JSON: %v", err)
+	}
+
+	var config Config
+	var plugins []*libcni.NetworkConfig
+	if _, ok := keys["plugins"]; ok {
+		list, err := libcni.ConfListFromBytes(data)
+		if err != nil {
+			return Config{}, err
+		}
+		config.Name, config.List, plugins = list.Name, true, list.Plugins
+	} else {
+		conf, err := libcni.ConfFromBytes(data)
+		if err != nil {
+			return Config{}, err
+		}
+		config.Name, plugins = conf.Network.Name, []*libcni.NetworkConfig{conf}
+	}
+	if len(plugins) == 0 {
+		return Config{}, fmt.Errorf("no plugins in network %s", config.Name)
+	}
+	for _, plugin := range plugins {
+		var netConf NetConf
+		if err := json.Unmarshal(plugin.Bytes, &netConf); err != nil {
+			return Config{}, fmt.Errorf("invalid config of plugin %s: %v", plugin.Network.Type, err)
+		}
+		config.Plugins = append(config.Plugins, netConf)
+	}
+	return config, nil
+}
+
+// Validate returns an error if a plugin of the config has no binary in binDir, or if its IPAM subnet, routes or
+// endpoint policies are invalid or inconsistent with each other
+func (c Config) Validate(binDir string) error {
+	for _, plugin := range c.Plugins {
+		if err := plugin.validate(binDir); err != nil {
+			return fmt.Errorf("invalid config of plugin %s: %v", plugin.Type, err)
+		}
+	}
+	return nil
+}
+
+// validate validates a single plugin of the config
+func (n NetConf) validate(binDir string) error {
+	if err := checkBinary(binDir, n.Type); err != nil {
+		return err
+	}
+	if n.IPAM.Type != "" {
+		if err := checkBinary(binDir, n.IPAM.Type); err != nil {
+			return fmt.Errorf("IPAM: %v", err)
+		}
+	}
+	subnets, err := n.IPAM.subnets()
+	if err != nil {
+		return err
+	}
+	for _, route := range n.IPAM.Routes {
+		if _, _, err := net.ParseCIDR(route.Dst); err != nil {
+			return fmt.Errorf("invalid IPAM route destination %q: %v", route.Dst, err)
+		}
+		if route.GW != "" && net.ParseIP(route.GW) == nil {
+			return fmt.Errorf("invalid IPAM route gateway %q", route.GW)
+		}
+	}
+
+	for _, p := range n.Policies {
+		policy, err := p.EndpointPolicy()
+		if err != nil {
+			return err
+		}
+		switch policy.Type {
+		case PolicyOutBoundNAT:
+			for _, exception := range policy.ExceptionList {
+				if _, _, err := net.ParseCIDR(exception); err != nil && net.ParseIP(exception) == nil {
+					return fmt.Errorf("invalid %s exception %q, must be an IP address or CIDR", PolicyOutBoundNAT,
+						exception)
+				}
+			}
+		case PolicyRoute:
+			_, prefix, err := net.ParseCIDR(policy.DestinationPrefix)
+			if err != nil {
+				return fmt.Errorf("invalid %s destination prefix %q: %v", PolicyRoute, policy.DestinationPrefix, err)
+			}
+			for _, subnet := range subnets {
+				if overlaps(subnet, prefix) {
+					return fmt.Errorf("%s destination prefix %s overlaps with IPAM subnet %s", PolicyRoute, prefix,
+						subnet)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// checkBinary returns an error if the given plugin has no binary in binDir. Windows plugins are looked up with and
+// without the .exe extension.
+func checkBinary(binDir, plugin string) error {
+	if plugin == "" {
+		return fmt.Errorf("no plugin type")
+	}
+	if strings.ContainsAny(plugin, `/\`) {
+		return fmt.Errorf("invalid plugin type %q", plugin)
+	}
+	for _, name := range []string{plugin + ".exe", plugin} {
+		info, err := os.Stat(filepath.Join(binDir, name))
+		if err == nil && !info.IsDir() {
+			return nil
+		}
+	}
+	return fmt.Errorf("no %s binary in CNI dir %s", plugin, binDir)
+}
+
+// overlaps returns true if the given networks have addresses in common
+func overlaps(a, b *net.IPNet) bool {
+	return a.Contains(b.IP) || b.Contains(a.IP)
+}
@@ -0,0 +1,195 @@
+package cniconf
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// winOverlayConf is the win-overlay config of the hybrid overlay network
+const winOverlayConf = `{
+    "cniVersion":"0.2.0",
+    "name":"OVNKubernetesHybridOverlayNetwork",
+    "type":"win-overlay",
+    "capabilities": {
+        "dns": true
+    },
+    "ipam": {
+        "type": "host-local",
+        "subnet": "10.132.0.0/24"
+    },
+    "policies":[
+        {
+            "name":"EndpointPolicy",
+            "value":{
+                "Type":"OutBoundNAT",
+                "ExceptionList":[
+                    "172.30.0.0/16"
+                ]
+            }
+        },
+        {
+            "name":"EndpointPolicy",
+            "value":{
+                "Type":"ROUTE",
+                "DestinationPrefix":"172.30.0.0/16",
+                "NeedEncap":true
+            }
+        }
+    ]
+}`
+
+// TestParse tests parsing conf and conflist files into typed plugin configs
+func TestParse(t *testing.T) {
+	config, err := Parse([]byte(winOverlayConf))
+	require.NoError(t, err)
+	assert.Equal(t, "OVNKubernetesHybridOverlayNetwork", config.Name)
+	assert.False(t, config.List)
+	require.Len(t, config.Plugins, 1)
+	plugin := config.Plugins[0]
+	assert.Equal(t, "win-overlay", plugin.Type)
+	assert.Equal(t, IPAM{Type: "host-local", Subnet: "10.132.0.0/24"}, plugin.IPAM)
+	require.Len(t, plugin.Policies, 2)
+	policy, err := plugin.Policies[1].EndpointPolicy()
+	require.NoError(t, err)
+	assert.Equal(t, EndpointPolicy{Type: PolicyRoute, DestinationPrefix: "172.30.0.0/16", NeedEncap: true}, policy)
+
+	config, err = Parse([]byte(`{"cniVersion":"0.3.1","name":"net","plugins":[` + winOverlayConf +
+		`,{"type":"portmap"}]}`))
+	require.NoError(t, err)
+	assert.Equal(t, "net", config.Name)
+	assert.True(t, config.List)
+	require.Len(t, config.Plugins, 2)
+	assert.Equal(t, "win-overlay", config.Plugins[0].Type)
+	assert.Equal(t, "portmap", config.Plugins[1].Type)
+
+	for name, data := range map[string]string{
+		"invalid JSON":     `{"type":`,
+		"no type":          `{"name":"net"}`,
+		"no plugins":       `{"name":"net","plugins":[]}`,
+		"conflist no name": `{"plugins":[{"type":"win-overlay"}]}`,
+	} {
+		_, err := Parse([]byte(data))
+		assert.Error(t, err, name)
+	}
+}
+
+// TestValidate tests the validation of the plugin binaries, IPAM subnet, routes and endpoint policies
+func TestValidate(t *testing.T) {
+	binDir, err := ioutil.TempDir("", "cni")
+	require.NoError(t, err, "error creating temp directory")
+	// Ignore the return error as there is not much we can do if the temporary directory is not deleted
+	defer os.RemoveAll(binDir)
+	for _, name := range []string{"win-overlay.exe", "host-local.exe", "portmap"} {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(binDir, name), nil, 0755))
+	}
+	require.NoError(t, os.Mkdir(filepath.Join(binDir, "win-bridge.exe"), 0755))
+
+	tests := []struct {
+		name    string
+		replace []string
+		error   string
+	}{
+		{
+			name: "valid",
+		},
+		{
+			name:    "unknown plugin",
+			replace: []string{`"type":"win-overlay"`, `"type":"win-overlayy"`},
+			error:   "no win-overlayy binary in CNI dir",
+		},
+		{
+			name:    "plugin is a directory",
+			replace: []string{`"type":"win-overlay"`, `"type":"win-bridge"`},
+			error:   "no win-bridge binary in CNI dir",
+		},
+		{
+			name:    "plugin with a path",
+			replace: []string{`"type":"win-overlay"`, `"type":"..\\\\win-overlay"`},
+			error:   "invalid plugin type",
+		},
+		{
+			name:    "unknown IPAM plugin",
+			replace: []string{`"host-local"`, `"dhcp"`},
+			error:   "IPAM: no dhcp binary",
+		},
+		{
+			name:    "invalid IPAM subnet",
+			replace: []string{`"10.132.0.0/24"`, `"10.132.0.0/33"`},
+			error:   "invalid IPAM subnet",
+		},
+		{
+			name: "invalid OutBoundNAT exception",
+			replace: []string{`"172.30.0.0/16"
+                ]`, `"172.30.0/16"
+                ]`},
+			error: "invalid OutBoundNAT exception",
+		},
+		{
+			name:    "invalid ROUTE prefix",
+			replace: []string{`"DestinationPrefix":"172.30.0.0/16"`, `"DestinationPrefix":"{{ service_network_cidr }}"`},
+			error:   "invalid ROUTE destination prefix",
+		},
+		{
+			name:    "ROUTE prefix overlapping the IPAM subnet",
+			replace: []string{`"DestinationPrefix":"172.30.0.0/16"`, `"DestinationPrefix":"10.132.0.0/16"`},
+			error:   "overlaps with IPAM subnet",
+		},
+		{
+			name:    "invalid policy value",
+			replace: []string{`"NeedEncap":true`, `"NeedEncap":"yes"`},
+			error:   "unable to parse EndpointPolicy",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := winOverlayConf
+			if tt.replace != nil {
+				require.Contains(t, data, tt.replace[0])
+				data = strings.Replace(data, tt.replace[0], tt.replace[1], 1)
+			}
+			config, err := Parse([]byte(data))
+			require.NoError(t, err)
+			err = config.Validate(binDir)
+			if tt.error == "" {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.error)
+		})
+	}
+
+	t.Run("dual-stack ranges", func(t *testing.T) {
+		data := strings.Replace(winOverlayConf, `"subnet": "10.132.0.0/24"`,
+			`"ranges": [[{"subnet": "10.132.0.0/24"}], [{"subnet": "fd02::/64", "gateway": "fd02::1"}]]`, 1)
+		config, err := Parse([]byte(data))
+		require.NoError(t, err)
+		assert.NoError(t, config.Validate(binDir))
+
+		for _, tt := range []struct{ replace, with, error string }{
+			{`"fd02::/64"`, `"fd02::"`, "invalid IPAM range subnet"},
+			{`"fd02::1"`, `"fd03::1"`, "IPAM range gateway"},
+		} {
+			config, err := Parse([]byte(strings.Replace(data, tt.replace, tt.with, 1)))
+			require.NoError(t, err)
+			err = config.Validate(binDir)
+			require.Error(t, err, tt.replace)
+			assert.Contains(t, err.Error(), tt.error)
+		}
+	})
+
+	t.Run("conflist", func(t *testing.T) {
+		config, err := Parse([]byte(`{"name":"net","plugins":[` + winOverlayConf + `,{"type":"bandwidth"}]}`))
+		require.NoError(t, err)
+		err = config.Validate(binDir)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "invalid config of plugin bandwidth")
+	})
+}
@@ -0,0 +1,112 @@
+package cniconf
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Manifest holds the sha256 digests of the CNI binaries, keyed by their path relative to the CNI dir. Paths use forward
+// slashes.
+type Manifest map[string]string
+
+// ParseManifest parses a manifest in the format of sha256sum, where each line holds the hex encoded sha256 digest of a
+// file followed by its path relative to the CNI dir. Empty lines and lines starting with # are ignored.
+func ParseManifest(data []byte) (Manifest, error) {
+	manifest := make(Manifest)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		// The path is everything after the digest, as it may contain spaces
+		fields := strings.SplitN(line, " ", 2)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("line %d: expected a digest and a path", lineNum)
+		}
+		digest := strings.ToLower(fields[0])
+		if decoded, err := hex.DecodeString(digest); err != nil || len(decoded) != sha256.Size {
+			return nil, fmt.Errorf("line %d: invalid sha256 digest %q", lineNum, fields[0])
+		}
+		// sha256sum marks files read in binary mode with a leading *
+		file := strings.TrimPrefix(strings.TrimSpace(fields[1]), "*")
+		name := manifestPath(file)
+		if file == "" || name == "." || name == ".." || strings.HasPrefix(name, "../") || path.IsAbs(name) ||
+			strings.Contains(name, ":") {
+			return nil, fmt.Errorf("line %d: path %q is not within the CNI dir", lineNum, file)
+		}
+		if _, ok := manifest[name]; ok {
+			return nil, fmt.Errorf("line %d: %s is listed more than once", lineNum, name)
+		}
+		manifest[name] = digest
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(manifest) == 0 {
+		return nil, fmt.Errorf("no files listed")
+	}
+	return manifest, nil
+}
+
+// Verify returns an error unless the given files, relative to dir, are exactly the files listed in the manifest and
+// match their digests
+func (m Manifest) Verify(dir string, files []string) error {
+	present := make(map[string]bool, len(files))
+	for _, file := range files {
+		name := manifestPath(file)
+		present[name] = true
+		expected, ok := m[name]
+		if !ok {
+			return fmt.Errorf("%s is not listed in the manifest", name)
+		}
+		actual, err := fileDigest(filepath.Join(dir, file))
+		if err != nil {
+			return fmt.Errorf("error computing sha256 digest of %s: %v", name, err)
+		}
+		if actual != expected {
+			return fmt.Errorf("sha256 digest of %s is %s, expected %s", name, actual, expected)
+		}
+	}
+
+	var missing []string
+	for name := range m {
+		if !present[name] {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return fmt.Errorf("%s listed in the manifest but missing from %s", strings.Join(missing, ", "), dir)
+	}
+	return nil
+}
+
+// manifestPath returns the given relative path in the form it is listed in a manifest
+func manifestPath(name string) string {
+	return path.Clean(strings.ReplaceAll(filepath.ToSlash(name), `\`, "/"))
+}
+
+// fileDigest returns the hex encoded sha256 digest of the file at the given path
+func fileDigest(name string) (string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
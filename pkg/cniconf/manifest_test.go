@@ -0,0 +1,102 @@
+package cniconf
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// digestOf returns the hex encoded sha256 digest of the given contents
+func digestOf(contents string) string {
+	digest := sha256.Sum256([]byte(contents))
+	return hex.EncodeToString(digest[:])
+}
+
+// TestParseManifest tests parsing sha256sum style manifests
+func TestParseManifest(t *testing.T) {
+	manifest, err := ParseManifest([]byte("# CNI plugins\n" +
+		digestOf("win-overlay") + "  win-overlay.exe\n\n" +
+		digestOf("host-local") + " *./ipam/host-local.exe\n" +
+		digestOf("flannel") + "  flannel\\flannel plugin.exe\n"))
+	require.NoError(t, err)
+	assert.Equal(t, Manifest{
+		"win-overlay.exe":            digestOf("win-overlay"),
+		"ipam/host-local.exe":        digestOf("host-local"),
+		"flannel/flannel plugin.exe": digestOf("flannel"),
+	}, manifest)
+
+	for name, data := range map[string]string{
+		"empty":            "# nothing\n",
+		"no path":          digestOf("win-overlay") + "\n",
+		"invalid digest":   "abc  win-overlay.exe\n",
+		"duplicate":        digestOf("a") + "  a.exe\n" + digestOf("b") + "  ./a.exe\n",
+		"outside CNI dir":  digestOf("a") + "  ../a.exe\n",
+		"absolute path":    digestOf("a") + "  /k/cni/a.exe\n",
+		"windows abs path": digestOf("a") + "  C:\\k\\cni\\a.exe\n",
+	} {
+		_, err := ParseManifest([]byte(data))
+		assert.Error(t, err, name)
+	}
+}
+
+// TestManifestVerify tests that verification fails on unlisted, missing and mismatching files
+func TestManifestVerify(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cni")
+	require.NoError(t, err, "error creating temp directory")
+	// Ignore the return error as there is not much we can do if the temporary directory is not deleted
+	defer os.RemoveAll(dir)
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "ipam"), 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "win-overlay.exe"), []byte("win-overlay"), 0644))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "ipam", "host-local.exe"), []byte("host-local"), 0644))
+	files := []string{"win-overlay.exe", filepath.Join("ipam", "host-local.exe")}
+	manifest := Manifest{"win-overlay.exe": digestOf("win-overlay"), "ipam/host-local.exe": digestOf("host-local")}
+
+	tests := []struct {
+		name     string
+		manifest Manifest
+		files    []string
+		error    string
+	}{
+		{
+			name:     "valid",
+			manifest: manifest,
+			files:    files,
+		},
+		{
+			name:     "unlisted file",
+			manifest: Manifest{"win-overlay.exe": digestOf("win-overlay")},
+			files:    files,
+			error:    "ipam/host-local.exe is not listed in the manifest",
+		},
+		{
+			name:     "missing file",
+			manifest: manifest,
+			files:    files[:1],
+			error:    "ipam/host-local.exe listed in the manifest but missing",
+		},
+		{
+			name:     "digest mismatch",
+			manifest: Manifest{"win-overlay.exe": digestOf("corrupted"), "ipam/host-local.exe": digestOf("host-local")},
+			files:    files,
+			error:    "sha256 digest of win-overlay.exe is " + digestOf("win-overlay"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.manifest.Verify(dir, tt.files)
+			if tt.error == "" {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.error)
+		})
+	}
+}
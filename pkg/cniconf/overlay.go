@@ -0,0 +1,105 @@
+package cniconf
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/containernetworking/cni/pkg/types"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/ipfamily"
+)
+
+const (
+	// DefaultOverlayNetworkName is the name of the HNS network created by the OVN hybrid overlay
+	DefaultOverlayNetworkName = "OVNKubernetesHybridOverlayNetwork"
+	// ConfigFileName is the name the rendered config is installed with
+	ConfigFileName = "cni.conf"
+	// overlayCNIVersion is the CNI version of the rendered config
+	overlayCNIVersion = "0.2.0"
+	// overlayPluginType is the plugin the rendered config is run with
+	overlayPluginType = "win-overlay"
+	// overlayIPAMType is the IPAM plugin of the rendered config
+	overlayIPAMType = "host-local"
+	// endpointPolicyName is the name of the policies applied to the endpoints of the pods
+	endpointPolicyName = "EndpointPolicy"
+	// policyVSID is the endpoint policy type setting the virtual subnet ID of the endpoints
+	policyVSID = "VSID"
+)
+
+// Overlay holds the network parameters the win-overlay config of the OVN hybrid overlay is rendered from
+type Overlay struct {
+	// Name is the name of the HNS network, DefaultOverlayNetworkName if empty
+	Name string
+	// HostSubnets are the CIDRs the pods of the node get their addresses from, as given by the hybrid overlay node
+	// subnet annotation. Dual-stack nodes have one subnet per IP family.
+	HostSubnets []string
+	// ServiceCIDRs are the service networks of the cluster, at most one per IP family and of the same families as the
+	// host subnets. Traffic to them is neither NATed nor routed outside of the overlay.
+	ServiceCIDRs []string
+	// VNI is the virtual network identifier set on the endpoints through a VSID policy. The one of the HNS network is
+	// used if it is 0.
+	VNI uint32
+	// DNS enables the dns capability, through which the kubelet passes the DNS settings of the pods to the plugin
+	DNS bool
+}
+
+// Render returns the win-overlay config of the network
+func (o Overlay) Render() ([]byte, error) {
+	if len(o.HostSubnets) == 0 {
+		return nil, fmt.Errorf("at least one host subnet is required")
+	}
+	hostSubnets, err := ipfamily.ParseCIDRs(o.HostSubnets)
+	if err != nil {
+		return nil, fmt.Errorf("invalid host subnets: %v", err)
+	}
+	if len(o.ServiceCIDRs) == 0 {
+		return nil, fmt.Errorf("at least one service CIDR is required")
+	}
+	serviceCIDRs, err := ipfamily.ParseCIDRs(o.ServiceCIDRs)
+	if err != nil {
+		return nil, fmt.Errorf("invalid service CIDRs: %v", err)
+	}
+	hostFamilies, serviceFamilies := ipfamily.OfCIDRs(hostSubnets), ipfamily.OfCIDRs(serviceCIDRs)
+	if !hostFamilies.Equal(serviceFamilies) {
+		return nil, fmt.Errorf("host subnets are %s while service CIDRs are %s, they must be of the same IP families",
+			hostFamilies, serviceFamilies)
+	}
+
+	conf := NetConf{
+		NetConf: types.NetConf{
+			CNIVersion: overlayCNIVersion,
+			Name:       o.Name,
+			Type:       overlayPluginType,
+		},
+		IPAM: IPAM{Type: overlayIPAMType},
+	}
+	// A single subnet is rendered as such, keeping the config of single-stack nodes as it was before dual-stack support
+	if len(o.HostSubnets) == 1 {
+		conf.IPAM.Subnet = o.HostSubnets[0]
+	} else {
+		for _, subnet := range o.HostSubnets {
+			conf.IPAM.Ranges = append(conf.IPAM.Ranges, []Range{{Subnet: subnet}})
+		}
+	}
+	if conf.Name == "" {
+		conf.Name = DefaultOverlayNetworkName
+	}
+	if o.DNS {
+		conf.Capabilities = map[string]bool{"dns": true}
+	}
+	policies := []EndpointPolicy{{Type: PolicyOutBoundNAT, ExceptionList: o.ServiceCIDRs}}
+	for _, cidr := range o.ServiceCIDRs {
+		policies = append(policies, EndpointPolicy{Type: PolicyRoute, DestinationPrefix: cidr, NeedEncap: true})
+	}
+	if o.VNI != 0 {
+		policies = append(policies, EndpointPolicy{Type: policyVSID, VSID: o.VNI})
+	}
+	for _, policy := range policies {
+		value, err := json.Marshal(policy)
+		if err != nil {
+			return nil, err
+		}
+		conf.Policies = append(conf.Policies, Policy{Name: endpointPolicyName, Value: value})
+	}
+	return json.MarshalIndent(conf, "", "    ")
+}
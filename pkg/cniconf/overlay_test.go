@@ -0,0 +1,72 @@
+package cniconf
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestOverlayRender tests that the rendered config matches the one of the hybrid overlay template, and the handling of
+// dual-stack subnets and service CIDRs, the network name, VNI and DNS capability
+func TestOverlayRender(t *testing.T) {
+	t.Run("hybrid overlay template", func(t *testing.T) {
+		rendered, err := Overlay{HostSubnets: []string{"10.132.0.0/24"}, ServiceCIDRs: []string{"172.30.0.0/16"},
+			DNS: true}.Render()
+		require.NoError(t, err)
+		assert.JSONEq(t, winOverlayConf, string(rendered))
+	})
+
+	t.Run("dual-stack", func(t *testing.T) {
+		rendered, err := Overlay{Name: "net", HostSubnets: []string{"10.132.0.0/24", "fd01:0:0:1::/64"},
+			ServiceCIDRs: []string{"172.30.0.0/16", "fd02::/112"}, VNI: 4097}.Render()
+		require.NoError(t, err)
+		config, err := Parse(rendered)
+		require.NoError(t, err)
+		assert.Equal(t, "net", config.Name)
+		require.Len(t, config.Plugins, 1)
+		assert.Nil(t, config.Plugins[0].Capabilities, "dns capability set")
+		assert.Equal(t, IPAM{Type: "host-local", Ranges: [][]Range{{{Subnet: "10.132.0.0/24"}},
+			{{Subnet: "fd01:0:0:1::/64"}}}}, config.Plugins[0].IPAM)
+
+		var policies []EndpointPolicy
+		for _, p := range config.Plugins[0].Policies {
+			assert.Equal(t, "EndpointPolicy", p.Name)
+			policy, err := p.EndpointPolicy()
+			require.NoError(t, err)
+			policies = append(policies, policy)
+		}
+		assert.Equal(t, []EndpointPolicy{
+			{Type: PolicyOutBoundNAT, ExceptionList: []string{"172.30.0.0/16", "fd02::/112"}},
+			{Type: PolicyRoute, DestinationPrefix: "172.30.0.0/16", NeedEncap: true},
+			{Type: PolicyRoute, DestinationPrefix: "fd02::/112", NeedEncap: true},
+			{Type: policyVSID, VSID: 4097},
+		}, policies)
+
+		var keys map[string]json.RawMessage
+		require.NoError(t, json.Unmarshal(rendered, &keys))
+		assert.NotContains(t, keys, "dns", "empty DNS rendered")
+	})
+
+	v4Subnet, v6Subnet := "10.132.0.0/24", "fd01:0:0:1::/64"
+	for name, overlay := range map[string]Overlay{
+		"no host subnet":       {ServiceCIDRs: []string{"172.30.0.0/16"}},
+		"invalid host subnet":  {HostSubnets: []string{"10.132.0.0"}, ServiceCIDRs: []string{"172.30.0.0/16"}},
+		"no service CIDR":      {HostSubnets: []string{v4Subnet}},
+		"invalid service CIDR": {HostSubnets: []string{v4Subnet}, ServiceCIDRs: []string{"172.30.0.0/16", ""}},
+		"two IPv4 service CIDRs": {HostSubnets: []string{v4Subnet},
+			ServiceCIDRs: []string{"172.30.0.0/16", "172.31.0.0/16"}},
+		"two IPv4 host subnets": {HostSubnets: []string{v4Subnet, "10.133.0.0/24"},
+			ServiceCIDRs: []string{"172.30.0.0/16"}},
+		"IPv6 service CIDR on IPv4 node": {HostSubnets: []string{v4Subnet},
+			ServiceCIDRs: []string{"172.30.0.0/16", "fd02::/112"}},
+		"IPv4 service CIDR on dual-stack node": {HostSubnets: []string{v4Subnet, v6Subnet},
+			ServiceCIDRs: []string{"172.30.0.0/16"}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := overlay.Render()
+			assert.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,364 @@
+// Package config holds the WMCB configuration read from the file given with --config. The file is versioned, the
+// versions live in subpackages, and is converted to the Configuration used by the bootstrapper after being defaulted.
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/config/v1alpha1"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/ipfamily"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/nodeidentity"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/nodesizing"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/runtimeconf"
+)
+
+const (
+	// ContainerRuntimeDocker runs the containers with docker through the dockershim built into the kubelet
+	ContainerRuntimeDocker = "docker"
+	// ContainerRuntimeContainerd runs the containers with containerd through its CRI plugin
+	ContainerRuntimeContainerd = "containerd"
+	// SizingFixed reserves a fixed amount of resources for the system
+	SizingFixed = "fixed"
+	// SizingAuto computes the resources reserved for the system from the node capacity
+	SizingAuto = "auto"
+	// RecoveryRestart restarts the service when it fails
+	RecoveryRestart = "restart"
+	// RecoveryReboot reboots the node when the service fails
+	RecoveryReboot = "reboot"
+	// RecoveryNone does nothing when the service fails
+	RecoveryNone = "none"
+)
+
+// taintEffects are the effects a node taint can have
+var taintEffects = map[string]bool{"NoSchedule": true, "PreferNoSchedule": true, "NoExecute": true}
+
+// Configuration is the defaulted WMCB configuration, independent of the version of the file it was read from
+type Configuration struct {
+	// InstallDir is the directory the kubelet and its files are installed in
+	InstallDir string
+	// LogDir is the directory the kubelet logs to
+	LogDir string
+	// CertDirectory is where the kubelet keeps its certificates
+	CertDirectory string
+	// ContainerRuntime is the container runtime used by the kubelet, either docker or containerd
+	ContainerRuntime string
+	// ContainerdConfigPath is where the containerd config.toml is written when the container runtime is containerd
+	ContainerdConfigPath string
+	// DockerConfigPath is where the docker daemon.json is written when the container runtime is docker
+	DockerConfigPath string
+	// Runtime configures the container log rotation, the data root and the registries of the container runtime
+	Runtime runtimeconf.Options
+	// PauseImage overrides the pause image picked based on the host Windows build
+	PauseImage string
+	// PauseImageManifest is a YAML file mapping Windows builds to pause images. The built-in manifest is used if it is
+	// empty.
+	PauseImageManifest string
+	// PauseImageArchive is a tarball of the pause image that is loaded into the container runtime before the kubelet
+	// is started
+	PauseImageArchive string
+	// Taints are registered with the node
+	Taints []Taint
+	// Labels are registered with the node
+	Labels map[string]string
+	// ServiceWaitTime is how long to wait for a Windows service to change state
+	ServiceWaitTime time.Duration
+	// KubeletHealthTimeout is how long to wait for the kubelet to report healthy after it has been started. The
+	// kubelet health is not verified if it is zero.
+	KubeletHealthTimeout time.Duration
+	// RecoveryPolicy is what the Windows service manager does when the kubelet service fails
+	RecoveryPolicy RecoveryPolicy
+	// Sizing configures the systemReserved, kubeReserved and evictionHard kubelet config fields
+	Sizing nodesizing.Options
+	// NodeIdentity selects the IP address and hostname the node registers with
+	NodeIdentity nodeidentity.Options
+	// ClusterDNS are the IP addresses of the cluster DNS service, at most one per IP family
+	ClusterDNS []string
+	// APIServerOverride replaces the API server address of the bootstrap kubeconfig, for nodes that reach the API
+	// server through a different address or load balancer than the one in the ignition file
+	APIServerOverride string
+	// ProbeAPIServer makes the bootstrap fail if the API server does not report ready when reached with the bootstrap
+	// kubeconfig
+	ProbeAPIServer bool
+}
+
+// Taint is a taint registered with the node
+type Taint struct {
+	Key    string
+	Value  string
+	Effect string
+}
+
+// String returns the taint in the key=value:effect format of the kubelet --register-with-taints option
+func (t Taint) String() string {
+	if t.Value == "" {
+		return t.Key + ":" + t.Effect
+	}
+	return t.Key + "=" + t.Value + ":" + t.Effect
+}
+
+// ParseTaint parses a taint in the key=value:effect format of the kubelet --register-with-taints option. The value
+// is optional.
+func ParseTaint(s string) (Taint, error) {
+	sep := strings.LastIndex(s, ":")
+	if sep == -1 {
+		return Taint{}, fmt.Errorf("invalid taint %q, must be key=value:effect", s)
+	}
+	taint := Taint{Key: s[:sep], Effect: s[sep+1:]}
+	if eq := strings.Index(taint.Key, "="); eq != -1 {
+		taint.Key, taint.Value = taint.Key[:eq], taint.Key[eq+1:]
+	}
+	if errs := taint.validate(); len(errs) != 0 {
+		return Taint{}, fmt.Errorf("%s", strings.Join(errs, ", "))
+	}
+	return taint, nil
+}
+
+// validate returns the reasons the taint would be rejected by the API server
+func (t Taint) validate() []string {
+	var errs []string
+	for _, msg := range validation.IsQualifiedName(t.Key) {
+		errs = append(errs, fmt.Sprintf("invalid taint key %q: %s", t.Key, msg))
+	}
+	for _, msg := range validation.IsValidLabelValue(t.Value) {
+		errs = append(errs, fmt.Sprintf("invalid taint value %q: %s", t.Value, msg))
+	}
+	if !taintEffects[t.Effect] {
+		errs = append(errs, fmt.Sprintf("invalid taint effect %q, must be NoSchedule, PreferNoSchedule or NoExecute",
+			t.Effect))
+	}
+	return errs
+}
+
+// RecoveryPolicy is what the Windows service manager does when a service fails
+type RecoveryPolicy struct {
+	// Actions are taken on the first, second and subsequent failures, the last one being repeated
+	Actions []RecoveryAction
+	// ResetPeriod is how long the service has to run without failing for the failure count to be reset
+	ResetPeriod time.Duration
+}
+
+// RecoveryAction is taken by the Windows service manager when a service fails
+type RecoveryAction struct {
+	// Type is RecoveryRestart, RecoveryReboot or RecoveryNone
+	Type string
+	// Delay is how long to wait before taking the action
+	Delay time.Duration
+}
+
+// Default returns the configuration used when no configuration file is given
+func Default() Configuration {
+	var external v1alpha1.WMCBConfiguration
+	v1alpha1.SetDefaults(&external)
+	return fromV1alpha1(external)
+}
+
+// Load reads, defaults and validates the configuration file at the given path. The default configuration is returned
+// if the path is empty.
+func Load(path string) (Configuration, error) {
+	if path == "" {
+		return Default(), nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return Configuration{}, fmt.Errorf("could not read configuration file %s: %v", path, err)
+	}
+	c, err := Decode(data)
+	if err != nil {
+		return Configuration{}, fmt.Errorf("invalid configuration file %s: %v", path, err)
+	}
+	return c, nil
+}
+
+// Decode parses, defaults and validates a configuration file. Unknown fields are rejected, so that a typo does not
+// silently leave a setting to its default.
+func Decode(data []byte) (Configuration, error) {
+	var typeMeta struct {
+		APIVersion string `yaml:"apiVersion"`
+		Kind       string `yaml:"kind"`
+	}
+	if err := yaml.Unmarshal(data, &typeMeta); err != nil {
+		return Configuration{}, fmt.Errorf("could not parse configuration: %v", err)
+	}
+	if typeMeta.Kind != v1alpha1.Kind {
+		return Configuration{}, fmt.Errorf("unsupported kind %q, must be %s", typeMeta.Kind, v1alpha1.Kind)
+	}
+	switch typeMeta.APIVersion {
+	case v1alpha1.APIVersion:
+		var external v1alpha1.WMCBConfiguration
+		if err := yaml.UnmarshalStrict(data, &external); err != nil {
+			return Configuration{}, fmt.Errorf("could not parse configuration: %v", err)
+		}
+		v1alpha1.SetDefaults(&external)
+		// The sizing mode is a boolean once converted, so it has to be validated beforehand
+		if err := ValidateSizing(external.SystemReserved.Sizing); err != nil {
+			return Configuration{}, fmt.Errorf("invalid configuration: %v", err)
+		}
+		c := fromV1alpha1(external)
+		if err := c.Validate(); err != nil {
+			return Configuration{}, err
+		}
+		return c, nil
+	default:
+		return Configuration{}, fmt.Errorf("unsupported apiVersion %q, must be %s", typeMeta.APIVersion,
+			v1alpha1.APIVersion)
+	}
+}
+
+// Encode returns the configuration as a file of the latest version
+func Encode(c Configuration) ([]byte, error) {
+	data, err := yaml.Marshal(toV1alpha1(c))
+	if err != nil {
+		return nil, fmt.Errorf("could not encode configuration: %v", err)
+	}
+	return data, nil
+}
+
+// Validate returns an error describing every invalid setting of the configuration
+func (c Configuration) Validate() error {
+	var errs []string
+	addErr := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Sprintf(format, args...))
+	}
+
+	for _, dir := range []struct{ name, value string }{{"installDir", c.InstallDir}, {"logDir", c.LogDir},
+		{"certDirectory", c.CertDirectory}} {
+		if dir.value == "" {
+			addErr("%s must not be empty", dir.name)
+		}
+	}
+	if err := ValidateContainerRuntime(c.ContainerRuntime); err != nil {
+		addErr("%v", err)
+	}
+	validateRuntime := c.Runtime.Validate
+	if c.ContainerRuntime == ContainerRuntimeDocker {
+		validateRuntime = c.Runtime.ValidateDocker
+	}
+	if err := validateRuntime(); err != nil {
+		addErr("%v", err)
+	}
+
+	seenTaints := make(map[string]bool)
+	for _, taint := range c.Taints {
+		errs = append(errs, taint.validate()...)
+		// The API server rejects a node with two taints of the same key and effect
+		if seenTaints[taint.Key+":"+taint.Effect] {
+			addErr("duplicate taint %s", taint)
+		}
+		seenTaints[taint.Key+":"+taint.Effect] = true
+	}
+	for _, key := range sortedKeys(c.Labels) {
+		for _, msg := range validation.IsQualifiedName(key) {
+			addErr("invalid label key %q: %s", key, msg)
+		}
+		for _, msg := range validation.IsValidLabelValue(c.Labels[key]) {
+			addErr("invalid label value %q: %s", c.Labels[key], msg)
+		}
+	}
+
+	if c.ServiceWaitTime <= 0 {
+		addErr("serviceWaitTime must be positive")
+	}
+	if c.KubeletHealthTimeout < 0 {
+		addErr("kubeletHealthTimeout must not be negative")
+	}
+	for _, action := range c.RecoveryPolicy.Actions {
+		switch action.Type {
+		case RecoveryRestart, RecoveryReboot, RecoveryNone:
+		default:
+			addErr("invalid recovery action %q, must be %s, %s or %s", action.Type, RecoveryRestart, RecoveryReboot,
+				RecoveryNone)
+		}
+		if action.Delay < 0 {
+			addErr("recovery action delay must not be negative")
+		}
+	}
+	if c.RecoveryPolicy.ResetPeriod < 0 {
+		addErr("recovery policy resetPeriod must not be negative")
+	}
+
+	if c.Sizing.KubeReservedPercent < 0 || c.Sizing.KubeReservedPercent > 100 {
+		addErr("kubeReservedPercent must be between 0 and 100")
+	}
+
+	switch c.NodeIdentity.HostnameSource {
+	case nodeidentity.HostnameSourceOS, nodeidentity.HostnameSourceAWS, nodeidentity.HostnameSourceAzure:
+	default:
+		addErr("invalid hostnameSource %q, must be %s or %s", c.NodeIdentity.HostnameSource,
+			nodeidentity.HostnameSourceAWS, nodeidentity.HostnameSourceAzure)
+	}
+	// The IP families of the node are known from nodeIP, or else from nodeIPCIDR
+	var nodeFamilies ipfamily.Families
+	if c.NodeIdentity.NodeIP != "" {
+		if ips, err := ipfamily.ParseIPs(ipfamily.Split(c.NodeIdentity.NodeIP)); err != nil {
+			addErr("invalid nodeIP %q: %v", c.NodeIdentity.NodeIP, err)
+		} else {
+			nodeFamilies = ipfamily.OfIPs(ips)
+		}
+	}
+	if c.NodeIdentity.NodeIPCIDR != "" {
+		if cidrs, err := ipfamily.ParseCIDRs(ipfamily.Split(c.NodeIdentity.NodeIPCIDR)); err != nil {
+			addErr("invalid nodeIPCIDR %q: %v", c.NodeIdentity.NodeIPCIDR, err)
+		} else if nodeFamilies == nil {
+			nodeFamilies = ipfamily.OfCIDRs(cidrs)
+		}
+	}
+	if len(c.ClusterDNS) == 0 {
+		addErr("clusterDNS must not be empty")
+	} else if dns, err := ipfamily.ParseIPs(c.ClusterDNS); err != nil {
+		addErr("invalid clusterDNS: %v", err)
+	} else if dnsFamilies := ipfamily.OfIPs(dns); nodeFamilies != nil && !nodeFamilies.Contains(dnsFamilies) {
+		// The pods of the node can only reach the cluster DNS over the IP families the node has an address of
+		addErr("clusterDNS is %s while the node IP is %s, the node needs an address of every clusterDNS IP family",
+			dnsFamilies, nodeFamilies)
+	}
+
+	if c.APIServerOverride != "" {
+		if u, err := url.Parse(c.APIServerOverride); err != nil || u.Scheme != "https" || u.Host == "" {
+			addErr("invalid apiServerOverride %q, must be an https URL", c.APIServerOverride)
+		}
+	}
+
+	if len(errs) != 0 {
+		return fmt.Errorf("invalid configuration: %s", strings.Join(errs, ", "))
+	}
+	return nil
+}
+
+// ValidateContainerRuntime returns an error if the given container runtime is not supported
+func ValidateContainerRuntime(runtime string) error {
+	switch runtime {
+	case ContainerRuntimeDocker, ContainerRuntimeContainerd:
+		return nil
+	default:
+		return fmt.Errorf("unsupported container runtime %q, must be %s or %s", runtime, ContainerRuntimeDocker,
+			ContainerRuntimeContainerd)
+	}
+}
+
+// ValidateSizing returns an error if the given system reserved sizing mode is not supported
+func ValidateSizing(sizing string) error {
+	switch sizing {
+	case SizingFixed, SizingAuto:
+		return nil
+	default:
+		return fmt.Errorf("unsupported system reserved sizing %q, must be %s or %s", sizing, SizingFixed, SizingAuto)
+	}
+}
+
+// sortedKeys returns the keys of the given map in order
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,351 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/nodeidentity"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/nodesizing"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/runtimeconf"
+)
+
+// TestDefault tests that the default configuration matches what WMCB did before it could be configured
+func TestDefault(t *testing.T) {
+	c := Default()
+	assert.Equal(t, Configuration{
+		InstallDir:           "C:\\k",
+		LogDir:               "C:\\var\\log\\kubelet",
+		CertDirectory:        "c:\\var\\lib\\kubelet\\pki\\",
+		ContainerRuntime:     ContainerRuntimeDocker,
+		ContainerdConfigPath: "C:\\Program Files\\containerd\\config.toml",
+		DockerConfigPath:     "C:\\ProgramData\\docker\\config\\daemon.json",
+		Runtime:              runtimeconf.Options{LogMaxSize: "50Mi", LogMaxFiles: 5},
+		Taints:               []Taint{{Key: "os", Value: "Windows", Effect: "NoSchedule"}},
+		Labels:               map[string]string{"node.openshift.io/os_id": "Windows"},
+		ServiceWaitTime:      20 * time.Second,
+		KubeletHealthTimeout: 2 * time.Minute,
+		RecoveryPolicy: RecoveryPolicy{
+			Actions:     []RecoveryAction{{Type: RecoveryRestart, Delay: 5 * time.Second}},
+			ResetPeriod: 10 * time.Minute,
+		},
+		ClusterDNS: []string{"172.30.0.10"},
+	}, c)
+	assert.NoError(t, c.Validate())
+	assert.Equal(t, "os=Windows:NoSchedule", c.Taints[0].String())
+}
+
+// TestDecode tests parsing and defaulting configuration files
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   string
+		check  func(t *testing.T, c Configuration)
+		errMsg string
+	}{
+		{
+			name: "only type meta",
+			data: "apiVersion: wmcb.openshift.io/v1alpha1\nkind: WMCBConfiguration\n",
+			check: func(t *testing.T, c Configuration) {
+				assert.Equal(t, Default(), c)
+			},
+		},
+		{
+			name: "log dir on another drive and no taints",
+			data: "apiVersion: wmcb.openshift.io/v1alpha1\nkind: WMCBConfiguration\nlogDir: D:\\logs\\kubelet\n" +
+				"taints: []\nkubeletHealthTimeout: 0s\n",
+			check: func(t *testing.T, c Configuration) {
+				assert.Equal(t, "D:\\logs\\kubelet", c.LogDir)
+				assert.Empty(t, c.Taints)
+				assert.Equal(t, time.Duration(0), c.KubeletHealthTimeout)
+				assert.Equal(t, Default().Labels, c.Labels)
+			},
+		},
+		{
+			name: "every field",
+			data: `apiVersion: wmcb.openshift.io/v1alpha1
+kind: WMCBConfiguration
+installDir: D:\k
+containerRuntime: containerd
+containerLogMaxSize: 100Mi
+containerLogMaxFiles: 3
+runtimeDataRoot: D:\containerd
+imageConfig: C:\k\image-config.yaml
+registryMirrors:
+- source: quay.io
+  mirrors:
+  - https://quay-mirror.local
+taints:
+- key: dedicated
+  value: gpu
+  effect: NoExecute
+labels:
+  pool: gpu
+serviceWaitTime: 1m
+recoveryPolicy:
+  actions:
+  - type: restart
+    delay: 10s
+  - type: reboot
+    delay: 1m
+  resetPeriod: 1h
+systemReserved:
+  sizing: auto
+  max:
+    memory: 8Gi
+  kubeReservedPercent: 25
+nodeIdentity:
+  nodeIPCIDR: 10.0.0.0/16,fd00::/64
+  hostnameSource: aws
+clusterDNS:
+- 172.30.0.10
+- fd02::a
+apiServerOverride: https://10.0.0.10:6443
+probeAPIServer: true
+`,
+			check: func(t *testing.T, c Configuration) {
+				assert.Equal(t, "D:\\k", c.InstallDir)
+				assert.Equal(t, ContainerRuntimeContainerd, c.ContainerRuntime)
+				assert.Equal(t, runtimeconf.Options{LogMaxSize: "100Mi", LogMaxFiles: 3, DataRoot: "D:\\containerd",
+					ImageConfigPath: "C:\\k\\image-config.yaml", Mirrors: []runtimeconf.Mirror{{Source: "quay.io",
+						Endpoints: []string{"https://quay-mirror.local"}}}}, c.Runtime)
+				assert.Equal(t, []Taint{{Key: "dedicated", Value: "gpu", Effect: "NoExecute"}}, c.Taints)
+				assert.Equal(t, map[string]string{"pool": "gpu"}, c.Labels)
+				assert.Equal(t, time.Minute, c.ServiceWaitTime)
+				assert.Equal(t, RecoveryPolicy{Actions: []RecoveryAction{{Type: RecoveryRestart, Delay: 10 * time.Second},
+					{Type: RecoveryReboot, Delay: time.Minute}}, ResetPeriod: time.Hour}, c.RecoveryPolicy)
+				assert.Equal(t, nodesizing.Options{Auto: true, Max: map[string]string{"memory": "8Gi"},
+					KubeReservedPercent: 25}, c.Sizing)
+				assert.Equal(t, nodeidentity.Options{NodeIPCIDR: "10.0.0.0/16,fd00::/64",
+					HostnameSource: nodeidentity.HostnameSourceAWS}, c.NodeIdentity)
+				assert.Equal(t, []string{"172.30.0.10", "fd02::a"}, c.ClusterDNS)
+				assert.Equal(t, "https://10.0.0.10:6443", c.APIServerOverride)
+				assert.True(t, c.ProbeAPIServer)
+			},
+		},
+		{
+			name:   "unknown field",
+			data:   "apiVersion: wmcb.openshift.io/v1alpha1\nkind: WMCBConfiguration\nlogdir: D:\\logs\n",
+			errMsg: "field logdir not found",
+		},
+		{
+			name:   "unsupported version",
+			data:   "apiVersion: wmcb.openshift.io/v2\nkind: WMCBConfiguration\n",
+			errMsg: "unsupported apiVersion",
+		},
+		{
+			name:   "wrong kind",
+			data:   "apiVersion: wmcb.openshift.io/v1alpha1\nkind: KubeletConfiguration\n",
+			errMsg: "unsupported kind",
+		},
+		{
+			name:   "invalid duration",
+			data:   "apiVersion: wmcb.openshift.io/v1alpha1\nkind: WMCBConfiguration\nserviceWaitTime: soon\n",
+			errMsg: "invalid duration",
+		},
+		{
+			name: "explicit zeros",
+			data: "apiVersion: wmcb.openshift.io/v1alpha1\nkind: WMCBConfiguration\ncontainerLogMaxFiles: 0\n" +
+				"serviceWaitTime: 0s\n",
+			errMsg: "containerLogMaxFiles must be at least 2, serviceWaitTime must be positive",
+		},
+		{
+			name: "invalid sizing",
+			data: "apiVersion: wmcb.openshift.io/v1alpha1\nkind: WMCBConfiguration\nsystemReserved:\n" +
+				"  sizing: dynamic\n",
+			errMsg: "unsupported system reserved sizing",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c, err := Decode([]byte(test.data))
+			if test.errMsg != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), test.errMsg)
+				return
+			}
+			require.NoError(t, err)
+			test.check(t, c)
+		})
+	}
+}
+
+// TestValidate tests that invalid settings are rejected
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(c *Configuration)
+		errMsg string
+	}{
+		{
+			name:   "empty log dir",
+			modify: func(c *Configuration) { c.LogDir = "" },
+			errMsg: "logDir must not be empty",
+		},
+		{
+			name:   "unsupported container runtime",
+			modify: func(c *Configuration) { c.ContainerRuntime = "cri-o" },
+			errMsg: "unsupported container runtime \"cri-o\"",
+		},
+		{
+			name:   "invalid taint key",
+			modify: func(c *Configuration) { c.Taints = []Taint{{Key: "a b", Effect: "NoSchedule"}} },
+			errMsg: "invalid taint key \"a b\"",
+		},
+		{
+			name:   "invalid taint effect",
+			modify: func(c *Configuration) { c.Taints = []Taint{{Key: "os", Value: "Windows", Effect: "Never"}} },
+			errMsg: "invalid taint effect \"Never\"",
+		},
+		{
+			name: "duplicate taint",
+			modify: func(c *Configuration) {
+				c.Taints = append(c.Taints, Taint{Key: "os", Value: "windows", Effect: "NoSchedule"})
+			},
+			errMsg: "duplicate taint os=windows:NoSchedule",
+		},
+		{
+			name:   "invalid label value",
+			modify: func(c *Configuration) { c.Labels["pool"] = "a/b" },
+			errMsg: "invalid label value \"a/b\"",
+		},
+		{
+			name:   "zero service wait time",
+			modify: func(c *Configuration) { c.ServiceWaitTime = 0 },
+			errMsg: "serviceWaitTime must be positive",
+		},
+		{
+			name: "invalid recovery action",
+			modify: func(c *Configuration) {
+				c.RecoveryPolicy.Actions = []RecoveryAction{{Type: "shutdown"}}
+			},
+			errMsg: "invalid recovery action \"shutdown\"",
+		},
+		{
+			name:   "kube reserved percent above 100",
+			modify: func(c *Configuration) { c.Sizing.KubeReservedPercent = 150 },
+			errMsg: "kubeReservedPercent must be between 0 and 100",
+		},
+		{
+			name:   "invalid hostname source",
+			modify: func(c *Configuration) { c.NodeIdentity.HostnameSource = "gcp" },
+			errMsg: "invalid hostnameSource \"gcp\"",
+		},
+		{
+			name:   "invalid node IP CIDR",
+			modify: func(c *Configuration) { c.NodeIdentity.NodeIPCIDR = "10.0.0.0" },
+			errMsg: "invalid nodeIPCIDR \"10.0.0.0\"",
+		},
+		{
+			name:   "two node IPs of the same family",
+			modify: func(c *Configuration) { c.NodeIdentity.NodeIP = "10.0.0.5,10.0.0.6" },
+			errMsg: "invalid nodeIP \"10.0.0.5,10.0.0.6\"",
+		},
+		{
+			name:   "empty cluster DNS",
+			modify: func(c *Configuration) { c.ClusterDNS = nil },
+			errMsg: "clusterDNS must not be empty",
+		},
+		{
+			name:   "invalid cluster DNS",
+			modify: func(c *Configuration) { c.ClusterDNS = []string{"172.30.0"} },
+			errMsg: "invalid clusterDNS",
+		},
+		{
+			name: "cluster DNS family without node IP",
+			modify: func(c *Configuration) {
+				c.NodeIdentity.NodeIPCIDR = "10.0.0.0/16"
+				c.ClusterDNS = []string{"172.30.0.10", "fd02::a"}
+			},
+			errMsg: "clusterDNS is IPv4,IPv6 while the node IP is IPv4",
+		},
+		{
+			name:   "invalid container log max size",
+			modify: func(c *Configuration) { c.Runtime.LogMaxSize = "50MB" },
+			errMsg: "invalid containerLogMaxSize \"50MB\"",
+		},
+		{
+			name: "docker mirror of another registry",
+			modify: func(c *Configuration) {
+				c.Runtime.Mirrors = []runtimeconf.Mirror{{Source: "quay.io", Endpoints: []string{"https://mirror.local"}}}
+			},
+			errMsg: "docker only supports mirrors of docker.io",
+		},
+		{
+			name:   "API server override without scheme",
+			modify: func(c *Configuration) { c.APIServerOverride = "10.0.0.10:6443" },
+			errMsg: "invalid apiServerOverride \"10.0.0.10:6443\", must be an https URL",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := Default()
+			test.modify(&c)
+			err := c.Validate()
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), test.errMsg)
+		})
+	}
+}
+
+// TestRoundTrip tests that a configuration is unchanged after being encoded and decoded again
+func TestRoundTrip(t *testing.T) {
+	configurations := map[string]Configuration{"default": Default()}
+
+	c := Default()
+	c.LogDir = "D:\\logs\\kubelet"
+	c.Taints = nil
+	c.Labels = map[string]string{}
+	c.KubeletHealthTimeout = 0
+	c.RecoveryPolicy = RecoveryPolicy{Actions: []RecoveryAction{{Type: RecoveryRestart, Delay: time.Second},
+		{Type: RecoveryNone}}, ResetPeriod: time.Hour}
+	c.Sizing = nodesizing.Options{Auto: true, Min: map[string]string{"cpu": "500m"}, EvictionHard: true}
+	c.NodeIdentity = nodeidentity.Options{NodeIP: "10.0.0.5,fd00::5", Hostname: "node"}
+	c.ClusterDNS = []string{"172.30.0.10", "fd02::a"}
+	c.APIServerOverride = "https://api-lb.cluster.example.com:6443"
+	c.ProbeAPIServer = true
+	c.ContainerRuntime = ContainerRuntimeContainerd
+	c.Runtime = runtimeconf.Options{LogMaxSize: "10Mi", LogMaxFiles: 2, DataRoot: "D:\\containerd",
+		ImageConfigPath: "C:\\k\\image-config.yaml", Mirrors: []runtimeconf.Mirror{{Source: "docker.io",
+			Endpoints: []string{"https://a.local", "https://b.local"}}}}
+	configurations["customized"] = c
+
+	for name, c := range configurations {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, c, fromV1alpha1(toV1alpha1(c)))
+
+			data, err := Encode(c)
+			require.NoError(t, err)
+			decoded, err := Decode(data)
+			require.NoError(t, err, "could not decode\n%s", data)
+			assert.Equal(t, c, decoded)
+		})
+	}
+}
+
+// TestLoad tests reading the configuration file from disk
+func TestLoad(t *testing.T) {
+	c, err := Load("")
+	require.NoError(t, err)
+	assert.Equal(t, Default(), c)
+
+	dir, err := ioutil.TempDir("", "wmcb-config")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config.yaml")
+	require.NoError(t, ioutil.WriteFile(path,
+		[]byte("apiVersion: wmcb.openshift.io/v1alpha1\nkind: WMCBConfiguration\ncertDirectory: D:\\pki\n"), 0644))
+	c, err = Load(path)
+	require.NoError(t, err)
+	assert.Equal(t, "D:\\pki", c.CertDirectory)
+
+	_, err = Load(filepath.Join(dir, "missing.yaml"))
+	assert.Error(t, err)
+}
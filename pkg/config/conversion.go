@@ -0,0 +1,137 @@
+package config
+
+import (
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/config/v1alpha1"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/nodeidentity"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/nodesizing"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/runtimeconf"
+)
+
+// fromV1alpha1 converts a defaulted v1alpha1 configuration to the internal configuration
+func fromV1alpha1(in v1alpha1.WMCBConfiguration) Configuration {
+	out := Configuration{
+		InstallDir:           in.InstallDir,
+		LogDir:               in.LogDir,
+		CertDirectory:        in.CertDirectory,
+		ContainerRuntime:     in.ContainerRuntime,
+		ContainerdConfigPath: in.ContainerdConfigPath,
+		DockerConfigPath:     in.DockerConfigPath,
+		Runtime: runtimeconf.Options{
+			LogMaxSize:      in.ContainerLogMaxSize,
+			DataRoot:        in.RuntimeDataRoot,
+			ImageConfigPath: in.ImageConfig,
+		},
+		PauseImage:         in.PauseImage,
+		PauseImageManifest: in.PauseImageManifest,
+		PauseImageArchive:  in.PauseImageArchive,
+		Labels:             in.Labels,
+		Sizing: nodesizing.Options{
+			Auto:                in.SystemReserved.Sizing == SizingAuto,
+			Min:                 in.SystemReserved.Min,
+			Max:                 in.SystemReserved.Max,
+			Override:            in.SystemReserved.Override,
+			KubeReservedPercent: in.SystemReserved.KubeReservedPercent,
+			EvictionHard:        in.SystemReserved.EvictionHard,
+		},
+		NodeIdentity: nodeidentity.Options{
+			NodeIP:          in.NodeIdentity.NodeIP,
+			NodeIPCIDR:      in.NodeIdentity.NodeIPCIDR,
+			NodeIPInterface: in.NodeIdentity.NodeIPInterface,
+			Hostname:        in.NodeIdentity.Hostname,
+			HostnameSource:  in.NodeIdentity.HostnameSource,
+		},
+		ClusterDNS:        in.ClusterDNS,
+		APIServerOverride: in.APIServerOverride,
+		ProbeAPIServer:    in.ProbeAPIServer,
+	}
+	for _, mirror := range in.RegistryMirrors {
+		out.Runtime.Mirrors = append(out.Runtime.Mirrors,
+			runtimeconf.Mirror{Source: mirror.Source, Endpoints: mirror.Mirrors})
+	}
+	for _, taint := range in.Taints {
+		out.Taints = append(out.Taints, Taint{Key: taint.Key, Value: taint.Value, Effect: taint.Effect})
+	}
+	if in.ContainerLogMaxFiles != nil {
+		out.Runtime.LogMaxFiles = *in.ContainerLogMaxFiles
+	}
+	if in.ServiceWaitTime != nil {
+		out.ServiceWaitTime = in.ServiceWaitTime.Duration
+	}
+	if in.KubeletHealthTimeout != nil {
+		out.KubeletHealthTimeout = in.KubeletHealthTimeout.Duration
+	}
+	if in.RecoveryPolicy != nil {
+		out.RecoveryPolicy.ResetPeriod = in.RecoveryPolicy.ResetPeriod.Duration
+		for _, action := range in.RecoveryPolicy.Actions {
+			out.RecoveryPolicy.Actions = append(out.RecoveryPolicy.Actions,
+				RecoveryAction{Type: action.Type, Delay: action.Delay.Duration})
+		}
+	}
+	return out
+}
+
+// toV1alpha1 converts the internal configuration to a v1alpha1 configuration. Empty taints and labels are kept empty
+// rather than left out, so that they are not defaulted when the configuration is read back.
+func toV1alpha1(in Configuration) v1alpha1.WMCBConfiguration {
+	out := v1alpha1.WMCBConfiguration{
+		APIVersion:           v1alpha1.APIVersion,
+		Kind:                 v1alpha1.Kind,
+		InstallDir:           in.InstallDir,
+		LogDir:               in.LogDir,
+		CertDirectory:        in.CertDirectory,
+		ContainerRuntime:     in.ContainerRuntime,
+		ContainerdConfigPath: in.ContainerdConfigPath,
+		DockerConfigPath:     in.DockerConfigPath,
+		ContainerLogMaxSize:  in.Runtime.LogMaxSize,
+		ContainerLogMaxFiles: &in.Runtime.LogMaxFiles,
+		RuntimeDataRoot:      in.Runtime.DataRoot,
+		ImageConfig:          in.Runtime.ImageConfigPath,
+		PauseImage:           in.PauseImage,
+		PauseImageManifest:   in.PauseImageManifest,
+		PauseImageArchive:    in.PauseImageArchive,
+		Taints:               []v1alpha1.Taint{},
+		Labels:               in.Labels,
+		ServiceWaitTime:      &v1alpha1.Duration{Duration: in.ServiceWaitTime},
+		KubeletHealthTimeout: &v1alpha1.Duration{Duration: in.KubeletHealthTimeout},
+		RecoveryPolicy: &v1alpha1.RecoveryPolicy{
+			Actions:     []v1alpha1.RecoveryAction{},
+			ResetPeriod: v1alpha1.Duration{Duration: in.RecoveryPolicy.ResetPeriod},
+		},
+		SystemReserved: v1alpha1.SystemReserved{
+			Sizing:              SizingFixed,
+			Min:                 in.Sizing.Min,
+			Max:                 in.Sizing.Max,
+			Override:            in.Sizing.Override,
+			KubeReservedPercent: in.Sizing.KubeReservedPercent,
+			EvictionHard:        in.Sizing.EvictionHard,
+		},
+		NodeIdentity: v1alpha1.NodeIdentity{
+			NodeIP:          in.NodeIdentity.NodeIP,
+			NodeIPCIDR:      in.NodeIdentity.NodeIPCIDR,
+			NodeIPInterface: in.NodeIdentity.NodeIPInterface,
+			Hostname:        in.NodeIdentity.Hostname,
+			HostnameSource:  in.NodeIdentity.HostnameSource,
+		},
+		ClusterDNS:        in.ClusterDNS,
+		APIServerOverride: in.APIServerOverride,
+		ProbeAPIServer:    in.ProbeAPIServer,
+	}
+	if in.Sizing.Auto {
+		out.SystemReserved.Sizing = SizingAuto
+	}
+	if out.Labels == nil {
+		out.Labels = map[string]string{}
+	}
+	for _, mirror := range in.Runtime.Mirrors {
+		out.RegistryMirrors = append(out.RegistryMirrors,
+			v1alpha1.RegistryMirror{Source: mirror.Source, Mirrors: mirror.Endpoints})
+	}
+	for _, taint := range in.Taints {
+		out.Taints = append(out.Taints, v1alpha1.Taint{Key: taint.Key, Value: taint.Value, Effect: taint.Effect})
+	}
+	for _, action := range in.RecoveryPolicy.Actions {
+		out.RecoveryPolicy.Actions = append(out.RecoveryPolicy.Actions,
+			v1alpha1.RecoveryAction{Type: action.Type, Delay: v1alpha1.Duration{Duration: action.Delay}})
+	}
+	return out
+}
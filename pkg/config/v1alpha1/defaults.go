@@ -0,0 +1,82 @@
+package v1alpha1
+
+import (
+	"time"
+)
+
+// The default values of the configuration, which match what WMCB did before it could be configured
+const (
+	DefaultInstallDir           = "C:\\k"
+	DefaultLogDir               = "C:\\var\\log\\kubelet"
+	DefaultCertDirectory        = "c:\\var\\lib\\kubelet\\pki\\"
+	DefaultContainerRuntime     = "docker"
+	DefaultContainerdConfigPath = "C:\\Program Files\\containerd\\config.toml"
+	DefaultDockerConfigPath     = "C:\\ProgramData\\docker\\config\\daemon.json"
+	DefaultContainerLogMaxSize  = "50Mi"
+	DefaultContainerLogMaxFiles = 5
+	DefaultServiceWaitTime      = 20 * time.Second
+	DefaultKubeletHealthTimeout = 2 * time.Minute
+	DefaultSizing               = "fixed"
+	DefaultClusterDNS           = "172.30.0.10"
+)
+
+// SetDefaults fills in the fields of the given configuration that were left empty
+func SetDefaults(c *WMCBConfiguration) {
+	if c.APIVersion == "" {
+		c.APIVersion = APIVersion
+	}
+	if c.Kind == "" {
+		c.Kind = Kind
+	}
+	if c.InstallDir == "" {
+		c.InstallDir = DefaultInstallDir
+	}
+	if c.LogDir == "" {
+		c.LogDir = DefaultLogDir
+	}
+	if c.CertDirectory == "" {
+		c.CertDirectory = DefaultCertDirectory
+	}
+	if c.ContainerRuntime == "" {
+		c.ContainerRuntime = DefaultContainerRuntime
+	}
+	if c.ContainerdConfigPath == "" {
+		c.ContainerdConfigPath = DefaultContainerdConfigPath
+	}
+	if c.DockerConfigPath == "" {
+		c.DockerConfigPath = DefaultDockerConfigPath
+	}
+	if c.ContainerLogMaxSize == "" {
+		c.ContainerLogMaxSize = DefaultContainerLogMaxSize
+	}
+	if c.ContainerLogMaxFiles == nil {
+		maxFiles := int32(DefaultContainerLogMaxFiles)
+		c.ContainerLogMaxFiles = &maxFiles
+	}
+	if c.Taints == nil {
+		// Keeps Linux pods from being scheduled onto Windows nodes
+		c.Taints = []Taint{{Key: "os", Value: "Windows", Effect: "NoSchedule"}}
+	}
+	if c.Labels == nil {
+		// Identifies the nodes managed by WSU and WMCO
+		c.Labels = map[string]string{"node.openshift.io/os_id": "Windows"}
+	}
+	if c.ServiceWaitTime == nil {
+		c.ServiceWaitTime = &Duration{DefaultServiceWaitTime}
+	}
+	if c.KubeletHealthTimeout == nil {
+		c.KubeletHealthTimeout = &Duration{DefaultKubeletHealthTimeout}
+	}
+	if c.RecoveryPolicy == nil {
+		c.RecoveryPolicy = &RecoveryPolicy{
+			Actions:     []RecoveryAction{{Type: "restart", Delay: Duration{5 * time.Second}}},
+			ResetPeriod: Duration{10 * time.Minute},
+		}
+	}
+	if c.SystemReserved.Sizing == "" {
+		c.SystemReserved.Sizing = DefaultSizing
+	}
+	if len(c.ClusterDNS) == 0 {
+		c.ClusterDNS = []string{DefaultClusterDNS}
+	}
+}
@@ -0,0 +1,166 @@
+package v1alpha1
+
+import (
+	"time"
+)
+
+const (
+	// APIVersion is the apiVersion of the configuration files of this version
+	APIVersion = "wmcb.openshift.io/v1alpha1"
+	// Kind is the kind of the WMCB configuration files
+	Kind = "WMCBConfiguration"
+)
+
+// Duration is a time.Duration that is read from and written to YAML as a string such as "20s"
+type Duration struct {
+	time.Duration
+}
+
+// UnmarshalYAML parses a duration string
+func (d *Duration) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	duration, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	d.Duration = duration
+	return nil
+}
+
+// MarshalYAML writes the duration as a string
+func (d Duration) MarshalYAML() (interface{}, error) {
+	return d.Duration.String(), nil
+}
+
+// WMCBConfiguration configures how WMCB sets up the kubelet on a Windows node. Fields left empty are defaulted. The
+// fields whose zero value is not a valid setting are pointers, so that a zero given explicitly is rejected rather than
+// defaulted.
+type WMCBConfiguration struct {
+	// APIVersion must be APIVersion
+	APIVersion string `yaml:"apiVersion"`
+	// Kind must be Kind
+	Kind string `yaml:"kind"`
+	// InstallDir is the directory the kubelet and its files are installed in
+	InstallDir string `yaml:"installDir,omitempty"`
+	// LogDir is the directory the kubelet logs to
+	LogDir string `yaml:"logDir,omitempty"`
+	// CertDirectory is where the kubelet keeps its certificates
+	CertDirectory string `yaml:"certDirectory,omitempty"`
+	// ContainerRuntime is the container runtime used by the kubelet, either docker or containerd
+	ContainerRuntime string `yaml:"containerRuntime,omitempty"`
+	// ContainerdConfigPath is where the containerd config.toml is written when the container runtime is containerd
+	ContainerdConfigPath string `yaml:"containerdConfigPath,omitempty"`
+	// DockerConfigPath is where the docker daemon.json is written when the container runtime is docker
+	DockerConfigPath string `yaml:"dockerConfigPath,omitempty"`
+	// ContainerLogMaxSize is the size a container log is rotated at, such as 50Mi
+	ContainerLogMaxSize string `yaml:"containerLogMaxSize,omitempty"`
+	// ContainerLogMaxFiles is the number of log files kept per container
+	ContainerLogMaxFiles *int32 `yaml:"containerLogMaxFiles,omitempty"`
+	// RuntimeDataRoot is where the container runtime keeps its images and containers. The default of the container
+	// runtime is used if it is empty.
+	RuntimeDataRoot string `yaml:"runtimeDataRoot,omitempty"`
+	// ImageConfig is a YAML or JSON file holding the image.config.openshift.io object of the cluster, which the
+	// insecure, allowed and blocked registries are read from
+	ImageConfig string `yaml:"imageConfig,omitempty"`
+	// RegistryMirrors are the registries images are pulled from instead of the registry of the image
+	RegistryMirrors []RegistryMirror `yaml:"registryMirrors,omitempty"`
+	// PauseImage overrides the pause image picked based on the host Windows build
+	PauseImage string `yaml:"pauseImage,omitempty"`
+	// PauseImageManifest is a YAML file mapping Windows builds to pause images
+	PauseImageManifest string `yaml:"pauseImageManifest,omitempty"`
+	// PauseImageArchive is a tarball of the pause image loaded into the container runtime
+	PauseImageArchive string `yaml:"pauseImageArchive,omitempty"`
+	// Taints are registered with the node. An empty list registers no taints, while leaving the field out registers
+	// the default os=Windows:NoSchedule taint.
+	Taints []Taint `yaml:"taints"`
+	// Labels are registered with the node. An empty map registers no labels, while leaving the field out registers
+	// the default node.openshift.io/os_id=Windows label.
+	Labels map[string]string `yaml:"labels"`
+	// ServiceWaitTime is how long to wait for a Windows service to change state
+	ServiceWaitTime *Duration `yaml:"serviceWaitTime,omitempty"`
+	// KubeletHealthTimeout is how long to wait for the kubelet to report healthy after it has been started. The kubelet
+	// health is not verified if it is 0.
+	KubeletHealthTimeout *Duration `yaml:"kubeletHealthTimeout,omitempty"`
+	// RecoveryPolicy is what the Windows service manager does when the kubelet service fails
+	RecoveryPolicy *RecoveryPolicy `yaml:"recoveryPolicy,omitempty"`
+	// SystemReserved configures the resources reserved for the system and Kubernetes components
+	SystemReserved SystemReserved `yaml:"systemReserved,omitempty"`
+	// NodeIdentity selects the IP address and hostname the node registers with
+	NodeIdentity NodeIdentity `yaml:"nodeIdentity,omitempty"`
+	// ClusterDNS are the IP addresses of the cluster DNS service the pods resolve names with, at most one per IP
+	// family
+	ClusterDNS []string `yaml:"clusterDNS,omitempty"`
+	// APIServerOverride replaces the API server address of the bootstrap kubeconfig, for example
+	// https://10.0.0.10:6443
+	APIServerOverride string `yaml:"apiServerOverride,omitempty"`
+	// ProbeAPIServer makes the bootstrap fail if the API server does not report ready on /readyz
+	ProbeAPIServer bool `yaml:"probeAPIServer,omitempty"`
+}
+
+// Taint is a taint registered with the node
+type Taint struct {
+	// Key is the taint key
+	Key string `yaml:"key"`
+	// Value is the taint value
+	Value string `yaml:"value,omitempty"`
+	// Effect is NoSchedule, PreferNoSchedule or NoExecute
+	Effect string `yaml:"effect"`
+}
+
+// RegistryMirror lists the endpoints the images of a registry are pulled from, in order of preference
+type RegistryMirror struct {
+	// Source is the registry host, such as docker.io
+	Source string `yaml:"source"`
+	// Mirrors are the URLs of the mirrors, such as https://mirror.local
+	Mirrors []string `yaml:"mirrors"`
+}
+
+// RecoveryPolicy is what the Windows service manager does when a service fails
+type RecoveryPolicy struct {
+	// Actions are taken on the first, second and subsequent failures, the last one being repeated
+	Actions []RecoveryAction `yaml:"actions"`
+	// ResetPeriod is how long the service has to run without failing for the failure count to be reset
+	ResetPeriod Duration `yaml:"resetPeriod,omitempty"`
+}
+
+// RecoveryAction is taken by the Windows service manager when a service fails
+type RecoveryAction struct {
+	// Type is restart, reboot or none
+	Type string `yaml:"type"`
+	// Delay is how long to wait before taking the action
+	Delay Duration `yaml:"delay,omitempty"`
+}
+
+// SystemReserved configures the resources reserved for the system and Kubernetes components
+type SystemReserved struct {
+	// Sizing is fixed to reserve 500m CPU and 1Gi memory, or auto to compute the reservation from the node capacity
+	Sizing string `yaml:"sizing,omitempty"`
+	// Min is the smallest reservation, keyed by resource name
+	Min map[string]string `yaml:"min,omitempty"`
+	// Max is the largest reservation, keyed by resource name
+	Max map[string]string `yaml:"max,omitempty"`
+	// Override is the reserved amount of the given resources, replacing the sizing
+	Override map[string]string `yaml:"override,omitempty"`
+	// KubeReservedPercent is the share of the CPU and memory reservation set as kubeReserved
+	KubeReservedPercent int64 `yaml:"kubeReservedPercent,omitempty"`
+	// EvictionHard sets the hard eviction thresholds based on the node memory
+	EvictionHard bool `yaml:"evictionHard,omitempty"`
+}
+
+// NodeIdentity selects the IP address and hostname the node registers with
+type NodeIdentity struct {
+	// NodeIP is the IP address of the node. Dual-stack nodes have an address per IP family, separated by a comma.
+	NodeIP string `yaml:"nodeIP,omitempty"`
+	// NodeIPCIDR picks the first address of the node within the CIDR. Dual-stack nodes have a CIDR per IP family,
+	// separated by a comma.
+	NodeIPCIDR string `yaml:"nodeIPCIDR,omitempty"`
+	// NodeIPInterface picks the first address of the network interface with the given name
+	NodeIPInterface string `yaml:"nodeIPInterface,omitempty"`
+	// Hostname is the name of the node
+	Hostname string `yaml:"hostname,omitempty"`
+	// HostnameSource is where the name of the node is read from: empty for the OS, aws or azure
+	HostnameSource string `yaml:"hostnameSource,omitempty"`
+}
@@ -0,0 +1,122 @@
+// Package csiproxy describes the named-pipe APIs csi-proxy exposes to the CSI node plugins of Windows nodes. The
+// plugins run in containers that cannot perform privileged storage operations, such as formatting a disk or mounting an
+// SMB share, and ask csi-proxy to perform them on the host through a named pipe per API group and version.
+package csiproxy
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	// ServiceName is the name of the Windows service csi-proxy runs as
+	ServiceName = "csi-proxy"
+	// DefaultKubeletRootDir is the directory the kubelet keeps its state in on Windows, unless given --root-dir
+	DefaultKubeletRootDir = `C:\var\lib\kubelet`
+	// PluginRegistryDirName is the directory within the kubelet root dir where the CSI node plugins place their
+	// registration sockets, which the kubelet watches
+	PluginRegistryDirName = "plugins_registry"
+	// PluginsDirName is the directory within the kubelet root dir where the CSI node plugins place their endpoints
+	PluginsDirName = "plugins"
+	// pipePrefix is the prefix of the named pipes csi-proxy listens on
+	pipePrefix = `\\.\pipe\csi-proxy-`
+)
+
+// versionRegex matches Kubernetes style API versions, such as v1, v1beta2 or v1alpha1
+var versionRegex = regexp.MustCompile(`^v[1-9][0-9]*((alpha|beta)[1-9][0-9]*)?$`)
+
+// supportedVersions are the API versions csi-proxy serves, by API group
+var supportedVersions = map[string][]string{
+	"disk":       {"v1alpha1", "v1beta1", "v1beta2", "v1beta3", "v1"},
+	"filesystem": {"v1alpha1", "v1beta1", "v1beta2", "v1"},
+	"iscsi":      {"v1alpha1", "v1alpha2"},
+	"smb":        {"v1alpha1", "v1beta1", "v1beta2", "v1"},
+	"system":     {"v1alpha1", "v1alpha2"},
+	"volume":     {"v1alpha1", "v1beta1", "v1beta2", "v1beta3", "v1"},
+}
+
+// APIVersions maps the csi-proxy API groups the CSI node plugins of the node use to the version they use
+type APIVersions map[string]string
+
+// DefaultAPIVersions returns the API versions of the csi-proxy release the Azure Disk, vSphere and SMB CSI drivers
+// are built against
+func DefaultAPIVersions() APIVersions {
+	return APIVersions{
+		"disk":       "v1beta2",
+		"filesystem": "v1beta1",
+		"iscsi":      "v1alpha2",
+		"smb":        "v1beta1",
+		"system":     "v1alpha1",
+		"volume":     "v1beta2",
+	}
+}
+
+// Validate returns an error if an API group is unknown or if csi-proxy does not serve the given version of it
+func (a APIVersions) Validate() error {
+	if len(a) == 0 {
+		return fmt.Errorf("no API versions given")
+	}
+	for _, group := range a.groups() {
+		version := a[group]
+		supported, ok := supportedVersions[group]
+		if !ok {
+			return fmt.Errorf("unknown csi-proxy API group %q, must be one of %s", group,
+				strings.Join(supportedGroups(), ", "))
+		}
+		if !versionRegex.MatchString(version) {
+			return fmt.Errorf("invalid %s API version %q", group, version)
+		}
+		if !contains(supported, version) {
+			return fmt.Errorf("csi-proxy does not serve %s API version %s, must be one of %s", group, version,
+				strings.Join(supported, ", "))
+		}
+	}
+	return nil
+}
+
+// Pipes returns the named pipes csi-proxy listens on for the API versions, in the order of their API groups
+func (a APIVersions) Pipes() []string {
+	pipes := make([]string, 0, len(a))
+	for _, group := range a.groups() {
+		pipes = append(pipes, PipeName(group, a[group]))
+	}
+	return pipes
+}
+
+// groups returns the API groups in sorted order
+func (a APIVersions) groups() []string {
+	groups := make([]string, 0, len(a))
+	for group := range a {
+		groups = append(groups, group)
+	}
+	sort.Strings(groups)
+	return groups
+}
+
+// PipeName returns the named pipe csi-proxy listens on for the given API group and version, for example
+// \\.\pipe\csi-proxy-filesystem-v1beta1
+func PipeName(group, version string) string {
+	return pipePrefix + group + "-" + version
+}
+
+// supportedGroups returns the API groups csi-proxy serves in sorted order
+func supportedGroups() []string {
+	groups := make([]string, 0, len(supportedVersions))
+	for group := range supportedVersions {
+		groups = append(groups, group)
+	}
+	sort.Strings(groups)
+	return groups
+}
+
+// contains returns true if the given value is in the list
+func contains(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,53 @@
+package csiproxy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestValidate tests that only the API versions csi-proxy serves are accepted
+func TestValidate(t *testing.T) {
+	assert.NoError(t, DefaultAPIVersions().Validate())
+	assert.NoError(t, APIVersions{"filesystem": "v1", "smb": "v1"}.Validate())
+
+	tests := []struct {
+		name        string
+		apiVersions APIVersions
+		errMsg      string
+	}{
+		{
+			name:   "none",
+			errMsg: "no API versions given",
+		},
+		{
+			name:        "unknown group",
+			apiVersions: APIVersions{"nfs": "v1"},
+			errMsg:      `unknown csi-proxy API group "nfs"`,
+		},
+		{
+			name:        "invalid version",
+			apiVersions: APIVersions{"disk": "1beta2"},
+			errMsg:      `invalid disk API version "1beta2"`,
+		},
+		{
+			name:        "unserved version",
+			apiVersions: APIVersions{"system": "v1"},
+			errMsg:      "csi-proxy does not serve system API version v1, must be one of v1alpha1, v1alpha2",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.apiVersions.Validate()
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), test.errMsg)
+		})
+	}
+}
+
+// TestPipes tests the named pipes the API versions are served on
+func TestPipes(t *testing.T) {
+	assert.Equal(t, []string{`\\.\pipe\csi-proxy-disk-v1beta2`, `\\.\pipe\csi-proxy-filesystem-v1beta1`},
+		APIVersions{"filesystem": "v1beta1", "disk": "v1beta2"}.Pipes())
+}
@@ -0,0 +1,43 @@
+// Package fileutil replaces files atomically, so that a reader never sees a partially written file.
+package fileutil
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// Replace atomically replaces the file at the given path with the contents written by the given function. The contents
+// are written to a temporary file next to it, which is then renamed over it, so that the file never holds partially
+// written contents or trailing bytes of a larger file it replaced. The temporary file is removed if the file cannot be
+// replaced.
+func Replace(path string, write func(io.Writer) error) (err error) {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			// Ignore the return errors as the temporary file may already be closed, and the error replacing the file
+			// is the one worth reporting
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+	if err = write(tmp); err != nil {
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// WriteFile atomically replaces the file at the given path with the given contents
+func WriteFile(path string, contents []byte) error {
+	return Replace(path, func(w io.Writer) error {
+		_, err := w.Write(contents)
+		return err
+	})
+}
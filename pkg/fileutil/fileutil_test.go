@@ -0,0 +1,53 @@
+package fileutil
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestReplace tests that a file is replaced as a whole, and that no temporary file is left behind when it cannot be
+func TestReplace(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fileutil")
+	require.NoError(t, err, "error creating temp directory")
+	// Ignore the return error as there is not much we can do if the temporary directory is not deleted
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "file")
+
+	require.NoError(t, WriteFile(path, []byte("longer contents")))
+	require.NoError(t, WriteFile(path, []byte("short")))
+	contents, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "short", string(contents), "trailing bytes of the replaced file were kept")
+
+	err = Replace(path, func(w io.Writer) error {
+		w.Write([]byte("partial"))
+		return fmt.Errorf("write failed")
+	})
+	assert.EqualError(t, err, "write failed")
+	contents, err = ioutil.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "short", string(contents), "file was replaced even though writing failed")
+
+	err = WriteFile(filepath.Join(dir, "missing", "file"), []byte("contents"))
+	assert.Error(t, err, "no error returned for a missing directory")
+
+	// A directory cannot be renamed over
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "dir"), 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "dir", "child"), nil, 0644))
+	assert.Error(t, WriteFile(filepath.Join(dir, "dir"), []byte("contents")), "directory was replaced")
+
+	entries, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	assert.Equal(t, []string{"dir", "file"}, names, "temporary files were left behind")
+}
@@ -0,0 +1,35 @@
+package health
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestCheckHealthz tests checking a healthy and an unhealthy component
+func TestCheckHealthz(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/unhealthy" {
+			http.Error(w, "not ready", http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	assert.NoError(t, CheckHealthz(context.Background(), server.Client(), server.URL+"/healthz"),
+		"healthy component reported as unhealthy")
+
+	err := CheckHealthz(context.Background(), server.Client(), server.URL+"/unhealthy")
+	if assert.Error(t, err, "no error returned for an unhealthy component") {
+		assert.Contains(t, err.Error(), "not ready")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Error(t, CheckHealthz(ctx, server.Client(), server.URL+"/healthz"),
+		"no error returned when the context was cancelled")
+}
@@ -0,0 +1,137 @@
+// Package ignition reads the files WMCB needs from the worker ignition config served by the Machine Config Server
+package ignition
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	ignitionCfgv24tov31 "github.com/coreos/ign-converter/translate/v24tov31"
+	ignitionCfgv2_4 "github.com/coreos/ignition/config/v2_4"
+	ignitionCfgv2_4Types "github.com/coreos/ignition/config/v2_4/types"
+	ignitionCfgError "github.com/coreos/ignition/v2/config/shared/errors"
+	ignitionCfgv3 "github.com/coreos/ignition/v2/config/v3_1"
+	ignitionCfgv3Types "github.com/coreos/ignition/v2/config/v3_1/types"
+	"github.com/pkg/errors"
+	"github.com/vincent-petithory/dataurl"
+)
+
+const (
+	// BootstrapKubeconfigPath is where the worker ignition places the kubeconfig the kubelet bootstraps with
+	BootstrapKubeconfigPath = "/etc/kubernetes/kubeconfig"
+	// KubeletCAPath is where the worker ignition places the CA bundle the kubelet verifies client certificates with
+	KubeletCAPath = "/etc/kubernetes/kubelet-ca.crt"
+	// acceptHeader asks the Machine Config Server for a spec v3.1 config, falling back to whatever it serves
+	acceptHeader = "application/vnd.coreos.ignition+json;version=3.1.0, */*;q=0.1"
+)
+
+// Load reads and parses the ignition config at the given path
+func Load(path string) (ignitionCfgv3Types.Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return ignitionCfgv3Types.Config{}, fmt.Errorf("could not read ignition file: %s", err)
+	}
+	return Parse(data)
+}
+
+// HTTPClient returns a client for fetching ignition configs. The Machine Config Server is verified with the CA bundle
+// in the given file, or with the system roots if no file is given.
+func HTTPClient(caFile string, timeout time.Duration) (*http.Client, error) {
+	tlsConfig := &tls.Config{}
+	if caFile != "" {
+		ca, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not read ignition CA file: %v", err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no valid certificates found in %s", caFile)
+		}
+	}
+	return &http.Client{
+		Transport: &http.Transport{Proxy: http.ProxyFromEnvironment, TLSClientConfig: tlsConfig},
+		Timeout:   timeout,
+	}, nil
+}
+
+// Fetch downloads the ignition config at the given URL, such as the worker config of the Machine Config Server at
+// https://api-int.<cluster domain>:22623/config/worker
+func Fetch(ctx context.Context, client *http.Client, url string) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ignition URL %s: %v", url, err)
+	}
+	req.Header.Set("Accept", acceptHeader)
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("could not fetch ignition from %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading ignition from %s: %v", url, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("could not fetch ignition from %s: %s", url, resp.Status)
+	}
+	return body, nil
+}
+
+// Parse parses the given ignition config. Spec v2 configs, up to spec v2.4, are converted to spec v3.1.
+func Parse(data []byte) (ignitionCfgv3Types.Config, error) {
+	configuration, report, err := ignitionCfgv3.Parse(data)
+	if err != nil && err.Error() == ignitionCfgError.ErrUnknownVersion.Error() {
+		// the Ignition config spec v2.4 parser supports parsing all spec versions up to 2.4
+		configV2, reportV2, errV2 := ignitionCfgv2_4.Parse(data)
+		if errV2 != nil || reportV2.IsFatal() {
+			return ignitionCfgv3Types.Config{}, errors.Errorf("failed to parse Ign spec v2 config: %v\nReport: %v",
+				errV2, reportV2)
+		}
+		return convertIgnition2to3(configV2)
+	} else if err != nil || report.IsFatal() {
+		return ignitionCfgv3Types.Config{}, errors.Errorf("failed to parse Ign spec v3.1 config: %v\nReport: %v", err,
+			report)
+	}
+	return configuration, nil
+}
+
+// convertIgnition2to3 takes an ignition spec v2.4 config and returns a v3.1 config
+func convertIgnition2to3(ign2config ignitionCfgv2_4Types.Config) (ignitionCfgv3Types.Config, error) {
+	// only support writing to root file system
+	fsMap := map[string]string{
+		"root": "/",
+	}
+	dedupedIgn2config, err := ignitionCfgv24tov31.RemoveDuplicateFilesAndUnits(ign2config)
+	if err != nil {
+		return ignitionCfgv3Types.Config{}, errors.Errorf("unable to deduplicate Ignition spec v2 config: %v", err)
+	}
+	ign3_1config, err := ignitionCfgv24tov31.Translate(dedupedIgn2config, fsMap)
+	if err != nil {
+		return ignitionCfgv3Types.Config{}, errors.Errorf("unable to convert Ignition spec v2 config to v3: %v", err)
+	}
+
+	return ign3_1config, nil
+}
+
+// ReadFile decodes the contents of the file with the given path in the given ignition config. found is false if the
+// config does not describe the file.
+func ReadFile(configuration ignitionCfgv3Types.Config, path string) (contents []byte, found bool, err error) {
+	for _, ignFile := range configuration.Storage.Files {
+		if ignFile.Node.Path != path {
+			continue
+		}
+		if ignFile.Contents.Source == nil {
+			return nil, true, fmt.Errorf("could not process %s: File is empty", path)
+		}
+		decoded, err := dataurl.DecodeString(*ignFile.Contents.Source)
+		if err != nil {
+			return nil, true, fmt.Errorf("could not process %s: %s", path, err)
+		}
+		return decoded.Data, true, nil
+	}
+	return nil, false, nil
+}
@@ -0,0 +1,96 @@
+package ignition
+
+import (
+	"context"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestParse tests parsing spec v3.1 and spec v2 ignition configs and reading the files they describe
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name     string
+		contents string
+	}{
+		{
+			name: "spec v3.1",
+			contents: `{"ignition":{"version":"3.1.0"},"storage":{"files":[` +
+				`{"path":"/etc/kubernetes/kubeconfig","contents":{"source":"data:,kubeconfig"}},` +
+				`{"path":"/etc/kubernetes/kubelet-ca.crt"}]}}`,
+		},
+		{
+			name: "spec v2.2",
+			contents: `{"ignition":{"version":"2.2.0"},"storage":{"files":[` +
+				`{"filesystem":"root","path":"/etc/kubernetes/kubeconfig","contents":{"source":"data:,kubeconfig"}},` +
+				`{"filesystem":"root","path":"/etc/kubernetes/kubelet-ca.crt"}]}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := Parse([]byte(tt.contents))
+			require.NoError(t, err)
+
+			contents, found, err := ReadFile(config, BootstrapKubeconfigPath)
+			require.NoError(t, err)
+			assert.True(t, found)
+			assert.Equal(t, "kubeconfig", string(contents))
+
+			_, found, err = ReadFile(config, KubeletCAPath)
+			assert.True(t, found)
+			assert.Error(t, err, "no error returned for a file without contents")
+
+			_, found, err = ReadFile(config, "/etc/kubernetes/cloud.conf")
+			require.NoError(t, err)
+			assert.False(t, found)
+		})
+	}
+
+	_, err := Parse([]byte(`{"ignition":{"version":"9.9.9"}}`))
+	assert.Error(t, err, "no error returned for an unknown spec version")
+}
+
+// TestFetch tests downloading an ignition config from a server verified with the given CA file
+func TestFetch(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/config/worker" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		assert.Contains(t, r.Header.Get("Accept"), "version=3.1.0")
+		w.Write([]byte(`{"ignition":{"version":"3.1.0"}}`))
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "ignition")
+	require.NoError(t, err, "error creating temp directory")
+	// Ignore the return error as there is not much we can do if the temporary directory is not deleted
+	defer os.RemoveAll(dir)
+	caFile := filepath.Join(dir, "ca.crt")
+	require.NoError(t, ioutil.WriteFile(caFile,
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0644))
+
+	client, err := HTTPClient(caFile, 10*time.Second)
+	require.NoError(t, err)
+	contents, err := Fetch(context.Background(), client, server.URL+"/config/worker")
+	require.NoError(t, err)
+	_, err = Parse(contents)
+	assert.NoError(t, err)
+
+	_, err = Fetch(context.Background(), client, server.URL+"/config/master")
+	assert.Error(t, err, "no error returned for a missing config")
+
+	client, err = HTTPClient("", 10*time.Second)
+	require.NoError(t, err)
+	_, err = Fetch(context.Background(), client, server.URL+"/config/worker")
+	assert.Error(t, err, "no error returned for a server not signed by the system roots")
+}
@@ -0,0 +1,128 @@
+// Package ipfamily parses the lists of IP addresses and CIDRs of dual-stack clusters, which hold at most one entry per
+// IP family, and compares the families they cover
+package ipfamily
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+)
+
+// Family is an IP address family
+type Family string
+
+const (
+	// IPv4 is the family of IPv4 addresses, including IPv4-mapped IPv6 addresses
+	IPv4 Family = "IPv4"
+	// IPv6 is the family of IPv6 addresses
+	IPv6 Family = "IPv6"
+)
+
+// Of returns the family of the given IP address
+func Of(ip net.IP) Family {
+	if ip.To4() != nil {
+		return IPv4
+	}
+	return IPv6
+}
+
+// Families is a set of IP families
+type Families map[Family]bool
+
+// OfIPs returns the families of the given IP addresses
+func OfIPs(ips []net.IP) Families {
+	families := make(Families)
+	for _, ip := range ips {
+		families[Of(ip)] = true
+	}
+	return families
+}
+
+// OfCIDRs returns the families of the given CIDRs
+func OfCIDRs(cidrs []*net.IPNet) Families {
+	families := make(Families)
+	for _, cidr := range cidrs {
+		families[Of(cidr.IP)] = true
+	}
+	return families
+}
+
+// Contains returns true if every family of other is in f
+func (f Families) Contains(other Families) bool {
+	for family := range other {
+		if !f[family] {
+			return false
+		}
+	}
+	return true
+}
+
+// Equal returns true if f and other hold the same families
+func (f Families) Equal(other Families) bool {
+	return f.Contains(other) && other.Contains(f)
+}
+
+// String returns the families in order, separated by commas
+func (f Families) String() string {
+	names := make([]string, 0, len(f))
+	for family := range f {
+		names = append(names, string(family))
+	}
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
+
+// Split splits a comma separated list, trimming spaces and dropping empty entries
+func Split(list string) []string {
+	var entries []string
+	for _, entry := range strings.Split(list, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// ParseIPs parses the given IP addresses, of which there can be at most one per family
+func ParseIPs(list []string) ([]net.IP, error) {
+	ips := make([]net.IP, 0, len(list))
+	seen := make(map[Family]string)
+	for _, entry := range list {
+		ip := net.ParseIP(entry)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid IP address %q", entry)
+		}
+		if err := checkFamily(seen, Of(ip), entry); err != nil {
+			return nil, err
+		}
+		ips = append(ips, ip)
+	}
+	return ips, nil
+}
+
+// ParseCIDRs parses the given CIDRs, of which there can be at most one per family
+func ParseCIDRs(list []string) ([]*net.IPNet, error) {
+	cidrs := make([]*net.IPNet, 0, len(list))
+	seen := make(map[Family]string)
+	for _, entry := range list {
+		_, cidr, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q: %v", entry, err)
+		}
+		if err = checkFamily(seen, Of(cidr.IP), entry); err != nil {
+			return nil, err
+		}
+		cidrs = append(cidrs, cidr)
+	}
+	return cidrs, nil
+}
+
+// checkFamily returns an error if the given family was already seen, and records it otherwise
+func checkFamily(seen map[Family]string, family Family, entry string) error {
+	if previous, ok := seen[family]; ok {
+		return fmt.Errorf("%s and %s are both %s, at most one per IP family is allowed", previous, entry, family)
+	}
+	seen[family] = entry
+	return nil
+}
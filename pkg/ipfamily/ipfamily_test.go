@@ -0,0 +1,64 @@
+package ipfamily
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestSplit tests splitting comma separated lists
+func TestSplit(t *testing.T) {
+	assert.Equal(t, []string{"10.0.0.5", "fd00::5"}, Split(" 10.0.0.5, fd00::5 ,"))
+	assert.Nil(t, Split(""))
+}
+
+// TestParseIPs tests parsing single and dual-stack IP address lists
+func TestParseIPs(t *testing.T) {
+	ips, err := ParseIPs([]string{"10.0.0.5", "fd00::5"})
+	require.NoError(t, err)
+	assert.Equal(t, Families{IPv4: true, IPv6: true}, OfIPs(ips))
+
+	ips, err = ParseIPs([]string{"::ffff:10.0.0.5"})
+	require.NoError(t, err)
+	assert.Equal(t, Families{IPv4: true}, OfIPs(ips), "IPv4-mapped address is not IPv4")
+
+	for name, list := range map[string][]string{
+		"invalid address": {"10.0.0"},
+		"two IPv4":        {"10.0.0.5", "10.0.0.6"},
+		"two IPv6":        {"fd00::5", "fd00::6"},
+	} {
+		_, err := ParseIPs(list)
+		assert.Error(t, err, name)
+	}
+}
+
+// TestParseCIDRs tests parsing single and dual-stack CIDR lists
+func TestParseCIDRs(t *testing.T) {
+	cidrs, err := ParseCIDRs([]string{"172.30.0.0/16", "fd02::/112"})
+	require.NoError(t, err)
+	require.Len(t, cidrs, 2)
+	assert.Equal(t, "fd02::/112", cidrs[1].String())
+	assert.Equal(t, "IPv4,IPv6", OfCIDRs(cidrs).String())
+
+	for name, list := range map[string][]string{
+		"invalid CIDR": {"172.30.0.0"},
+		"two IPv4":     {"172.30.0.0/16", "172.31.0.0/16"},
+	} {
+		_, err := ParseCIDRs(list)
+		assert.Error(t, err, name)
+	}
+}
+
+// TestFamilies tests comparing sets of families
+func TestFamilies(t *testing.T) {
+	dual := OfIPs([]net.IP{net.ParseIP("10.0.0.5"), net.ParseIP("fd00::5")})
+	v4 := OfIPs([]net.IP{net.ParseIP("10.0.0.5")})
+	v6 := OfIPs([]net.IP{net.ParseIP("fd00::5")})
+	assert.True(t, dual.Contains(v4))
+	assert.False(t, v4.Contains(dual))
+	assert.False(t, v4.Contains(v6))
+	assert.True(t, v4.Equal(Families{IPv4: true}))
+	assert.False(t, dual.Equal(v6))
+}
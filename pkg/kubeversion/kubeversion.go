@@ -0,0 +1,97 @@
+package kubeversion
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// maxKubeletMinorSkew is the number of minor versions the kubelet is allowed to be behind the API server:
+// https://kubernetes.io/docs/setup/release/version-skew-policy/#kubelet
+const maxKubeletMinorSkew = 2
+
+// versionRegex matches Kubernetes versions like v1.19.0, v1.19.0-rc.2 and v1.19.0+0f5d5ab, as reported by
+// `kubelet --version` and the API server /version endpoint
+var versionRegex = regexp.MustCompile(`v(\d+)\.(\d+)\.(\d+)\S*`)
+
+// Version is a Kubernetes version
+type Version struct {
+	Major int
+	Minor int
+	Patch int
+	// GitVersion is the full version string, including any pre-release and build metadata
+	GitVersion string
+}
+
+// String returns the full version string
+func (v Version) String() string {
+	return v.GitVersion
+}
+
+// Parse extracts the Kubernetes version from the given string, for example "Kubernetes v1.19.0+0f5d5ab"
+func Parse(s string) (Version, error) {
+	results := versionRegex.FindStringSubmatch(s)
+	if len(results) != 4 {
+		return Version{}, fmt.Errorf("no Kubernetes version found in %q", s)
+	}
+	var numbers [3]int
+	for i, result := range results[1:] {
+		n, err := strconv.Atoi(result)
+		if err != nil {
+			return Version{}, fmt.Errorf("invalid Kubernetes version %s: %v", results[0], err)
+		}
+		numbers[i] = n
+	}
+	return Version{Major: numbers[0], Minor: numbers[1], Patch: numbers[2], GitVersion: results[0]}, nil
+}
+
+// CheckKubeletSkew returns an error if the given kubelet version is not supported with the given API server version.
+// The kubelet must not be newer than the API server, and may be up to two minor versions older.
+func CheckKubeletSkew(kubelet, apiServer Version) error {
+	if kubelet.Major != apiServer.Major {
+		return fmt.Errorf("kubelet %s and API server %s have different major versions", kubelet, apiServer)
+	}
+	if kubelet.Minor > apiServer.Minor {
+		return fmt.Errorf("kubelet %s is newer than API server %s", kubelet, apiServer)
+	}
+	if apiServer.Minor-kubelet.Minor > maxKubeletMinorSkew {
+		return fmt.Errorf("kubelet %s is more than %d minor versions older than API server %s", kubelet,
+			maxKubeletMinorSkew, apiServer)
+	}
+	return nil
+}
+
+// ServerVersion queries the /version endpoint of the given API server. The request is abandoned if the context is
+// cancelled.
+func ServerVersion(ctx context.Context, client *http.Client, server string) (Version, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(server, "/")+"/version", nil)
+	if err != nil {
+		return Version{}, fmt.Errorf("error querying API server version: %v", err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return Version{}, fmt.Errorf("error querying API server version: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return Version{}, fmt.Errorf("error reading API server version: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return Version{}, fmt.Errorf("unexpected status %s querying API server version: %s", resp.Status, body)
+	}
+
+	// info holds the fields we need from the k8s.io/apimachinery/pkg/version.Info response
+	var info struct {
+		GitVersion string `json:"gitVersion"`
+	}
+	if err = json.Unmarshal(body, &info); err != nil {
+		return Version{}, fmt.Errorf("error parsing API server version: %v", err)
+	}
+	return Parse(info.GitVersion)
+}
@@ -0,0 +1,94 @@
+package kubeversion
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestParse tests extracting versions from kubelet and API server version strings
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    Version
+		wantErr bool
+	}{
+		{
+			name:  "kubelet --version output",
+			input: "Kubernetes v1.19.0-rc.2.1023+f5121a6a6a02dd\n",
+			want:  Version{Major: 1, Minor: 19, Patch: 0, GitVersion: "v1.19.0-rc.2.1023+f5121a6a6a02dd"},
+		},
+		{
+			name:  "API server git version",
+			input: "v1.18.3+2fbd7c7",
+			want:  Version{Major: 1, Minor: 18, Patch: 3, GitVersion: "v1.18.3+2fbd7c7"},
+		},
+		{
+			name:    "no version",
+			input:   "Kubernetes",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.input)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+// TestCheckKubeletSkew tests the kubelet version skew rules
+func TestCheckKubeletSkew(t *testing.T) {
+	apiServer := Version{Major: 1, Minor: 19, Patch: 2, GitVersion: "v1.19.2"}
+	tests := []struct {
+		name    string
+		kubelet Version
+		wantErr bool
+	}{
+		{"same version", Version{1, 19, 2, "v1.19.2"}, false},
+		{"newer patch", Version{1, 19, 5, "v1.19.5"}, false},
+		{"two minor versions older", Version{1, 17, 0, "v1.17.0"}, false},
+		{"three minor versions older", Version{1, 16, 2, "v1.16.2"}, true},
+		{"newer minor version", Version{1, 20, 0, "v1.20.0"}, true},
+		{"different major version", Version{2, 19, 2, "v2.19.2"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckKubeletSkew(tt.kubelet, apiServer)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+// TestServerVersion tests querying the API server version endpoint
+func TestServerVersion(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/version" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"major":"1","minor":"19","gitVersion":"v1.19.0+7070803"}`))
+	}))
+	defer server.Close()
+
+	got, err := ServerVersion(context.Background(), server.Client(), server.URL+"/")
+	require.NoError(t, err)
+	assert.Equal(t, Version{Major: 1, Minor: 19, Patch: 0, GitVersion: "v1.19.0+7070803"}, got)
+
+	_, err = ServerVersion(context.Background(), server.Client(), server.URL+"/notfound")
+	assert.Error(t, err, "no error returned for a non 200 response")
+}
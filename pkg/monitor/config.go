@@ -0,0 +1,293 @@
+package monitor
+
+import (
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// CheckType identifies what a check looks at
+type CheckType string
+
+const (
+	// CheckHealthz checks that a healthz endpoint reports healthy
+	CheckHealthz CheckType = "healthz"
+	// CheckProcess checks that a process with the given executable name is running
+	CheckProcess CheckType = "process"
+	// CheckHNSNetwork checks that the given HNS network exists
+	CheckHNSNetwork CheckType = "hns-network"
+	// CheckDiskSpace checks that a volume has enough free space
+	CheckDiskSpace CheckType = "disk-space"
+)
+
+// Remediation is the action taken once a check has failed FailureThreshold consecutive times
+type Remediation string
+
+const (
+	// RemediationMarkStatus flags the check as needing attention in the status file and takes no other action
+	RemediationMarkStatus Remediation = "mark-status"
+	// RemediationRestartService restarts the Windows service named in the check
+	RemediationRestartService Remediation = "restart-service"
+	// RemediationConfigureCNI re-runs configure-cni with the CNI settings from the config
+	RemediationConfigureCNI Remediation = "configure-cni"
+)
+
+const (
+	// defaultInterval is how often checks are run if the config does not say otherwise
+	defaultInterval = 30 * time.Second
+	// defaultFailureThreshold is the number of consecutive failures after which a check is remediated if the config
+	// does not say otherwise
+	defaultFailureThreshold = 3
+	// defaultInstallDir is the directory the node components are installed in
+	defaultInstallDir = "C:\\k"
+	// defaultStatusFile is where the status of the checks is written to
+	defaultStatusFile = "C:\\k\\log\\wmcb-monitor-status.json"
+	// defaultNetworkName is the name of the HNS network created by hybrid-overlay
+	defaultNetworkName = "OVNKubernetesHybridOverlayNetwork"
+	// defaultMinFreeMB is the minimum free disk space in MB below which the disk check fails
+	defaultMinFreeMB = 2048
+)
+
+// Duration is a time.Duration that is read from and written to YAML as a string such as "30s"
+type Duration struct {
+	time.Duration
+}
+
+// UnmarshalYAML parses a duration string
+func (d *Duration) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	duration, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	d.Duration = duration
+	return nil
+}
+
+// MarshalYAML writes the duration as a string
+func (d Duration) MarshalYAML() (interface{}, error) {
+	return d.Duration.String(), nil
+}
+
+// Check describes a single node component check and how it is remediated
+type Check struct {
+	// Name identifies the check in the status file
+	Name string `yaml:"name"`
+	// Type is what the check looks at
+	Type CheckType `yaml:"type"`
+	// Interval is how often the check is run. Defaults to the interval of the config.
+	Interval Duration `yaml:"interval,omitempty"`
+	// FailureThreshold is the number of consecutive failures after which the check is remediated. Defaults to the
+	// failure threshold of the config.
+	FailureThreshold int `yaml:"failureThreshold,omitempty"`
+	// Remediation is the action taken once the failure threshold is reached. Defaults to mark-status.
+	Remediation Remediation `yaml:"remediation,omitempty"`
+	// Service is the Windows service restarted by the restart-service remediation
+	Service string `yaml:"service,omitempty"`
+	// URL is the endpoint of a healthz check
+	URL string `yaml:"url,omitempty"`
+	// Process is the executable name of a process check, for example kube-proxy.exe
+	Process string `yaml:"process,omitempty"`
+	// Network is the name of the network of an hns-network check
+	Network string `yaml:"network,omitempty"`
+	// Path is a path on the volume of a disk-space check
+	Path string `yaml:"path,omitempty"`
+	// MinFreeMB is the free space in MB below which a disk-space check fails
+	MinFreeMB uint64 `yaml:"minFreeMB,omitempty"`
+}
+
+// CNIConfig holds the arguments configure-cni is re-run with by the configure-cni remediation
+type CNIConfig struct {
+	// Dir is the directory containing the CNI plugin binaries
+	Dir string `yaml:"dir"`
+	// Config is the CNI configuration file
+	Config string `yaml:"config"`
+}
+
+// Config is the monitor configuration file
+type Config struct {
+	// Interval is how often checks are run unless a check sets its own interval
+	Interval Duration `yaml:"interval,omitempty"`
+	// FailureThreshold is the number of consecutive failures after which a check is remediated unless a check sets its
+	// own threshold
+	FailureThreshold int `yaml:"failureThreshold,omitempty"`
+	// InstallDir is the directory the node components are installed in
+	InstallDir string `yaml:"installDir,omitempty"`
+	// BootstrapperConfig is the WMCB configuration file the remediations are applied with, as given to
+	// initialize-kubelet with --config. The default WMCB configuration is used if it is empty. InstallDir takes
+	// precedence over the install directory of the file.
+	BootstrapperConfig string `yaml:"bootstrapperConfig,omitempty"`
+	// StatusFile is where the status of the checks is written to after every round of checks
+	StatusFile string `yaml:"statusFile,omitempty"`
+	// CNI holds the configure-cni arguments used by the configure-cni remediation
+	CNI CNIConfig `yaml:"cni,omitempty"`
+	// Checks are the checks that are run. The default checks are used if none are given.
+	Checks []Check `yaml:"checks,omitempty"`
+}
+
+// DefaultChecks returns the checks run when the config does not list any: the kubelet healthz, the hybrid-overlay and
+// kube-proxy processes, the hybrid-overlay HNS network and the free space of the install volume
+func DefaultChecks() []Check {
+	return []Check{
+		{
+			Name:        "kubelet",
+			Type:        CheckHealthz,
+			URL:         "http://127.0.0.1:10248/healthz",
+			Remediation: RemediationRestartService,
+			Service:     "kubelet",
+		},
+		{
+			Name:        "hybrid-overlay",
+			Type:        CheckProcess,
+			Process:     "hybrid-overlay-node.exe",
+			Remediation: RemediationRestartService,
+			Service:     "hybrid-overlay-node",
+		},
+		{
+			Name:        "kube-proxy",
+			Type:        CheckProcess,
+			Process:     "kube-proxy.exe",
+			Remediation: RemediationRestartService,
+			Service:     "kube-proxy",
+		},
+		{
+			Name:        "hns-network",
+			Type:        CheckHNSNetwork,
+			Network:     defaultNetworkName,
+			Remediation: RemediationMarkStatus,
+		},
+		{
+			Name:        "disk-space",
+			Type:        CheckDiskSpace,
+			Path:        defaultInstallDir,
+			MinFreeMB:   defaultMinFreeMB,
+			Remediation: RemediationMarkStatus,
+		},
+	}
+}
+
+// LoadConfig reads the monitor config from the given file, fills in the defaults and validates it. The default config
+// is returned if path is empty.
+func LoadConfig(path string) (Config, error) {
+	var config Config
+	if path != "" {
+		contents, err := ioutil.ReadFile(path)
+		if err != nil {
+			return Config{}, fmt.Errorf("error reading monitor config %s: %v", path, err)
+		}
+		if err = yaml.UnmarshalStrict(contents, &config); err != nil {
+			return Config{}, fmt.Errorf("error parsing monitor config %s: %v", path, err)
+		}
+	}
+	config.setDefaults()
+	if err := config.Validate(); err != nil {
+		return Config{}, fmt.Errorf("invalid monitor config: %v", err)
+	}
+	return config, nil
+}
+
+// setDefaults fills in the fields that were not set
+func (c *Config) setDefaults() {
+	if c.Interval.Duration == 0 {
+		c.Interval.Duration = defaultInterval
+	}
+	if c.FailureThreshold == 0 {
+		c.FailureThreshold = defaultFailureThreshold
+	}
+	if c.InstallDir == "" {
+		c.InstallDir = defaultInstallDir
+	}
+	if c.StatusFile == "" {
+		c.StatusFile = defaultStatusFile
+	}
+	if len(c.Checks) == 0 {
+		c.Checks = DefaultChecks()
+	}
+	for i := range c.Checks {
+		check := &c.Checks[i]
+		if check.Interval.Duration == 0 {
+			check.Interval = c.Interval
+		}
+		if check.FailureThreshold == 0 {
+			check.FailureThreshold = c.FailureThreshold
+		}
+		if check.Remediation == "" {
+			check.Remediation = RemediationMarkStatus
+		}
+	}
+}
+
+// Validate returns an error if the config cannot be acted upon
+func (c *Config) Validate() error {
+	if c.Interval.Duration < 0 {
+		return fmt.Errorf("interval must not be negative")
+	}
+	if c.FailureThreshold < 0 {
+		return fmt.Errorf("failureThreshold must not be negative")
+	}
+	names := make(map[string]bool)
+	for _, check := range c.Checks {
+		if check.Name == "" {
+			return fmt.Errorf("check of type %q has no name", check.Type)
+		}
+		if names[check.Name] {
+			return fmt.Errorf("duplicate check %s", check.Name)
+		}
+		names[check.Name] = true
+		if err := c.validateCheck(check); err != nil {
+			return fmt.Errorf("check %s: %v", check.Name, err)
+		}
+	}
+	return nil
+}
+
+// validateCheck returns an error if the given check is missing the fields its type or remediation needs
+func (c *Config) validateCheck(check Check) error {
+	if check.Interval.Duration <= 0 {
+		return fmt.Errorf("interval must be positive")
+	}
+	if check.FailureThreshold <= 0 {
+		return fmt.Errorf("failureThreshold must be positive")
+	}
+
+	switch check.Type {
+	case CheckHealthz:
+		if check.URL == "" {
+			return fmt.Errorf("url is required for %s checks", check.Type)
+		}
+	case CheckProcess:
+		if check.Process == "" {
+			return fmt.Errorf("process is required for %s checks", check.Type)
+		}
+	case CheckHNSNetwork:
+		if check.Network == "" {
+			return fmt.Errorf("network is required for %s checks", check.Type)
+		}
+	case CheckDiskSpace:
+		if check.Path == "" {
+			return fmt.Errorf("path is required for %s checks", check.Type)
+		}
+	default:
+		return fmt.Errorf("unknown type %q", check.Type)
+	}
+
+	switch check.Remediation {
+	case RemediationMarkStatus:
+	case RemediationRestartService:
+		if check.Service == "" {
+			return fmt.Errorf("service is required for the %s remediation", check.Remediation)
+		}
+	case RemediationConfigureCNI:
+		if c.CNI.Dir == "" || c.CNI.Config == "" {
+			return fmt.Errorf("cni dir and config are required for the %s remediation", check.Remediation)
+		}
+	default:
+		return fmt.Errorf("unknown remediation %q", check.Remediation)
+	}
+	return nil
+}
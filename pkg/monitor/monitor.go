@@ -0,0 +1,247 @@
+package monitor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/fileutil"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/health"
+)
+
+// Host gives access to the state of the node that is not reachable over HTTP
+type Host interface {
+	// ProcessRunning returns true if a process with the given executable name is running
+	ProcessRunning(name string) (bool, error)
+	// HNSNetworkExists returns true if an HNS network with the given name exists
+	HNSNetworkExists(name string) (bool, error)
+	// FreeDiskSpace returns the number of bytes available on the volume containing the given path
+	FreeDiskSpace(path string) (uint64, error)
+}
+
+// Remediator applies the remediations of failing checks. A remediation is cut short if the context is cancelled.
+type Remediator interface {
+	// RestartService restarts the Windows service with the given name
+	RestartService(ctx context.Context, name string) error
+	// ConfigureCNI re-runs configure-cni with the given CNI settings
+	ConfigureCNI(ctx context.Context, cni CNIConfig) error
+}
+
+// CheckStatus is the outcome of the last run of a check
+type CheckStatus struct {
+	// Name is the name of the check
+	Name string `json:"name"`
+	// Healthy is true if the last run of the check passed
+	Healthy bool `json:"healthy"`
+	// Message explains why the check failed
+	Message string `json:"message,omitempty"`
+	// ConsecutiveFailures is the number of failures since the check last passed or was remediated
+	ConsecutiveFailures int `json:"consecutiveFailures"`
+	// LastChecked is when the check was last run
+	LastChecked time.Time `json:"lastChecked"`
+	// NeedsAttention is set by the mark-status remediation and cleared once the check passes again
+	NeedsAttention bool `json:"needsAttention,omitempty"`
+	// LastRemediation is when the check was last remediated
+	LastRemediation *time.Time `json:"lastRemediation,omitempty"`
+	// RemediationError is the error returned by the last remediation
+	RemediationError string `json:"remediationError,omitempty"`
+}
+
+// Status is the content of the status file
+type Status struct {
+	// Healthy is true if all checks passed on their last run
+	Healthy bool `json:"healthy"`
+	// Updated is when the status was last written
+	Updated time.Time `json:"updated"`
+	// Checks holds the status of every check
+	Checks []CheckStatus `json:"checks"`
+}
+
+// Monitor periodically runs the configured checks and remediates the ones that keep failing
+type Monitor struct {
+	config     Config
+	host       Host
+	remediator Remediator
+	// client is used for healthz checks
+	client *http.Client
+	// checks holds the state of every check, in the order of the config
+	checks []*checkState
+}
+
+// checkState tracks a check across runs
+type checkState struct {
+	Check
+	// lastRun is when the check was last run, zero if it has never run
+	lastRun time.Time
+	status  CheckStatus
+}
+
+// New returns a Monitor running the checks of the given config. The config is expected to have gone through
+// LoadConfig.
+func New(config Config, host Host, remediator Remediator, client *http.Client) *Monitor {
+	m := &Monitor{
+		config:     config,
+		host:       host,
+		remediator: remediator,
+		client:     client,
+	}
+	for _, check := range config.Checks {
+		m.checks = append(m.checks, &checkState{Check: check, status: CheckStatus{Name: check.Name, Healthy: true}})
+	}
+	return m
+}
+
+// Run runs the checks as they become due until the context is cancelled, which also cuts short the check or the
+// remediation in progress. report is called with the status after every round of checks, along with any error
+// encountered writing the status file.
+func (m *Monitor) Run(ctx context.Context, report func(Status, error)) {
+	ticker := time.NewTicker(m.tick())
+	defer ticker.Stop()
+	for {
+		status, err := m.RunOnce(ctx, time.Now())
+		report(status, err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// tick returns how often Run looks for checks that are due, which is the shortest check interval
+func (m *Monitor) tick() time.Duration {
+	tick := m.config.Interval.Duration
+	for _, check := range m.checks {
+		if check.Interval.Duration < tick {
+			tick = check.Interval.Duration
+		}
+	}
+	return tick
+}
+
+// RunOnce runs the checks that are due at the given time, remediates the ones that reached their failure threshold
+// and writes the status file
+func (m *Monitor) RunOnce(ctx context.Context, now time.Time) (Status, error) {
+	for _, check := range m.checks {
+		if !check.lastRun.IsZero() && now.Sub(check.lastRun) < check.Interval.Duration {
+			continue
+		}
+		check.lastRun = now
+		m.runCheck(ctx, check, now)
+	}
+
+	status := m.Status(now)
+	if err := writeStatus(m.config.StatusFile, status); err != nil {
+		return status, fmt.Errorf("error writing status file %s: %v", m.config.StatusFile, err)
+	}
+	return status, nil
+}
+
+// Status returns the status of all checks as of their last run
+func (m *Monitor) Status(now time.Time) Status {
+	status := Status{Healthy: true, Updated: now}
+	for _, check := range m.checks {
+		status.Checks = append(status.Checks, check.status)
+		if !check.status.Healthy {
+			status.Healthy = false
+		}
+	}
+	return status
+}
+
+// runCheck runs the given check, updates its status and remediates it if it reached its failure threshold
+func (m *Monitor) runCheck(ctx context.Context, check *checkState, now time.Time) {
+	check.status.LastChecked = now
+	err := m.check(ctx, check.Check)
+	if err == nil {
+		check.status.Healthy = true
+		check.status.Message = ""
+		check.status.ConsecutiveFailures = 0
+		check.status.NeedsAttention = false
+		return
+	}
+
+	check.status.Healthy = false
+	check.status.Message = err.Error()
+	check.status.ConsecutiveFailures++
+	if check.status.ConsecutiveFailures < check.FailureThreshold {
+		return
+	}
+
+	check.status.LastRemediation = &now
+	check.status.RemediationError = ""
+	if err = m.remediate(ctx, check.Check); err != nil {
+		check.status.RemediationError = err.Error()
+	}
+	if check.Remediation == RemediationMarkStatus {
+		check.status.NeedsAttention = true
+	} else {
+		// Give the remediated component a full threshold to recover before it is remediated again
+		check.status.ConsecutiveFailures = 0
+	}
+}
+
+// check returns an error if the node component the given check looks at is not healthy
+func (m *Monitor) check(ctx context.Context, check Check) error {
+	switch check.Type {
+	case CheckHealthz:
+		return health.CheckHealthz(ctx, m.client, check.URL)
+	case CheckProcess:
+		running, err := m.host.ProcessRunning(check.Process)
+		if err != nil {
+			return fmt.Errorf("error looking for process %s: %v", check.Process, err)
+		}
+		if !running {
+			return fmt.Errorf("process %s is not running", check.Process)
+		}
+	case CheckHNSNetwork:
+		exists, err := m.host.HNSNetworkExists(check.Network)
+		if err != nil {
+			return fmt.Errorf("error looking for HNS network %s: %v", check.Network, err)
+		}
+		if !exists {
+			return fmt.Errorf("HNS network %s does not exist", check.Network)
+		}
+	case CheckDiskSpace:
+		free, err := m.host.FreeDiskSpace(check.Path)
+		if err != nil {
+			return fmt.Errorf("error getting free disk space of %s: %v", check.Path, err)
+		}
+		if freeMB := free / (1024 * 1024); freeMB < check.MinFreeMB {
+			return fmt.Errorf("%d MB free on the volume of %s, less than %d MB", freeMB, check.Path, check.MinFreeMB)
+		}
+	default:
+		return fmt.Errorf("unknown check type %q", check.Type)
+	}
+	return nil
+}
+
+// remediate applies the remediation of the given check
+func (m *Monitor) remediate(ctx context.Context, check Check) error {
+	switch check.Remediation {
+	case RemediationMarkStatus:
+		return nil
+	case RemediationRestartService:
+		return m.remediator.RestartService(ctx, check.Service)
+	case RemediationConfigureCNI:
+		return m.remediator.ConfigureCNI(ctx, m.config.CNI)
+	default:
+		return fmt.Errorf("unknown remediation %q", check.Remediation)
+	}
+}
+
+// writeStatus atomically replaces the status file with the given status
+func writeStatus(path string, status Status) error {
+	contents, err := json.MarshalIndent(status, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+	return fileutil.WriteFile(path, contents)
+}
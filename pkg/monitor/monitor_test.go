@@ -0,0 +1,286 @@
+package monitor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeHost is a Host whose state is set by the test
+type fakeHost struct {
+	processes map[string]bool
+	networks  map[string]bool
+	freeBytes uint64
+}
+
+func (h *fakeHost) ProcessRunning(name string) (bool, error) {
+	return h.processes[name], nil
+}
+
+func (h *fakeHost) HNSNetworkExists(name string) (bool, error) {
+	return h.networks[name], nil
+}
+
+func (h *fakeHost) FreeDiskSpace(path string) (uint64, error) {
+	return h.freeBytes, nil
+}
+
+// fakeRemediator records the remediations applied
+type fakeRemediator struct {
+	restarted    []string
+	cniConfigs   []CNIConfig
+	restartError error
+}
+
+func (r *fakeRemediator) RestartService(_ context.Context, name string) error {
+	r.restarted = append(r.restarted, name)
+	return r.restartError
+}
+
+func (r *fakeRemediator) ConfigureCNI(_ context.Context, cni CNIConfig) error {
+	r.cniConfigs = append(r.cniConfigs, cni)
+	return nil
+}
+
+// TestLoadConfig tests reading the monitor config and filling in its defaults
+func TestLoadConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "monitor")
+	require.NoError(t, err, "error creating temp directory")
+	// Ignore the return error as there is not much we can do if the temporary directory is not deleted
+	defer os.RemoveAll(dir)
+
+	writeConfig := func(contents string) string {
+		path := filepath.Join(dir, "monitor.yaml")
+		require.NoError(t, ioutil.WriteFile(path, []byte(contents), 0644))
+		return path
+	}
+
+	t.Run("default config", func(t *testing.T) {
+		config, err := LoadConfig("")
+		require.NoError(t, err)
+		assert.Equal(t, defaultInterval, config.Interval.Duration)
+		assert.Equal(t, defaultStatusFile, config.StatusFile)
+		require.Len(t, config.Checks, len(DefaultChecks()))
+		for _, check := range config.Checks {
+			assert.Equal(t, defaultInterval, check.Interval.Duration, "check %s", check.Name)
+			assert.Equal(t, defaultFailureThreshold, check.FailureThreshold, "check %s", check.Name)
+		}
+	})
+
+	t.Run("custom config", func(t *testing.T) {
+		config, err := LoadConfig(writeConfig(`
+interval: 1m
+failureThreshold: 5
+statusFile: C:\status.json
+bootstrapperConfig: C:\k\wmcb.yaml
+cni:
+  dir: C:\k\cni
+  config: C:\k\cni\config\cni.conf
+checks:
+- name: kubelet
+  type: healthz
+  url: http://127.0.0.1:10248/healthz
+  interval: 10s
+  remediation: restart-service
+  service: kubelet
+- name: hns-network
+  type: hns-network
+  network: OVNKubernetesHybridOverlayNetwork
+  failureThreshold: 2
+  remediation: configure-cni
+`))
+		require.NoError(t, err)
+		assert.Equal(t, "C:\\status.json", config.StatusFile)
+		assert.Equal(t, "C:\\k\\wmcb.yaml", config.BootstrapperConfig)
+		require.Len(t, config.Checks, 2)
+		assert.Equal(t, 10*time.Second, config.Checks[0].Interval.Duration)
+		assert.Equal(t, 5, config.Checks[0].FailureThreshold)
+		assert.Equal(t, time.Minute, config.Checks[1].Interval.Duration)
+		assert.Equal(t, 2, config.Checks[1].FailureThreshold)
+		assert.Equal(t, RemediationConfigureCNI, config.Checks[1].Remediation)
+	})
+
+	invalidConfigs := []struct {
+		name     string
+		contents string
+		errMsg   string
+	}{
+		{
+			name:     "unknown field",
+			contents: "intervall: 1m",
+			errMsg:   "intervall",
+		},
+		{
+			name:     "invalid interval",
+			contents: "interval: often",
+			errMsg:   "often",
+		},
+		{
+			name:     "unknown check type",
+			contents: "checks:\n- name: foo\n  type: bar",
+			errMsg:   "unknown type",
+		},
+		{
+			name:     "missing check field",
+			contents: "checks:\n- name: kube-proxy\n  type: process",
+			errMsg:   "process is required",
+		},
+		{
+			name:     "restart without a service",
+			contents: "checks:\n- name: kubelet\n  type: healthz\n  url: http://localhost\n  remediation: restart-service",
+			errMsg:   "service is required",
+		},
+		{
+			name:     "configure-cni without cni settings",
+			contents: "checks:\n- name: hns\n  type: hns-network\n  network: foo\n  remediation: configure-cni",
+			errMsg:   "cni dir and config are required",
+		},
+		{
+			name:     "duplicate check",
+			contents: "checks:\n- name: a\n  type: disk-space\n  path: C:\\\n- name: a\n  type: disk-space\n  path: D:\\",
+			errMsg:   "duplicate check a",
+		},
+	}
+	for _, test := range invalidConfigs {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := LoadConfig(writeConfig(test.contents))
+			require.Error(t, err, "no error returned for an invalid config")
+			assert.Contains(t, err.Error(), test.errMsg)
+		})
+	}
+}
+
+// TestRunOnce tests that failing checks are remediated once they reach their failure threshold and that the status
+// file reflects the state of the checks
+func TestRunOnce(t *testing.T) {
+	dir, err := ioutil.TempDir("", "monitor")
+	require.NoError(t, err, "error creating temp directory")
+	// Ignore the return error as there is not much we can do if the temporary directory is not deleted
+	defer os.RemoveAll(dir)
+
+	kubeletHealthy := true
+	healthz := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !kubeletHealthy {
+			http.Error(w, "not healthy", http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer healthz.Close()
+
+	statusFile := filepath.Join(dir, "log", "status.json")
+	config := Config{
+		Interval:         Duration{time.Minute},
+		FailureThreshold: 2,
+		StatusFile:       statusFile,
+		CNI:              CNIConfig{Dir: "C:\\k\\cni", Config: "C:\\k\\cni\\config\\cni.conf"},
+		Checks: []Check{
+			{Name: "kubelet", Type: CheckHealthz, URL: healthz.URL, Remediation: RemediationRestartService,
+				Service: "kubelet"},
+			{Name: "kube-proxy", Type: CheckProcess, Process: "kube-proxy.exe", Interval: Duration{2 * time.Minute}},
+			{Name: "hns-network", Type: CheckHNSNetwork, Network: "net", Remediation: RemediationConfigureCNI},
+			{Name: "disk-space", Type: CheckDiskSpace, Path: "C:\\", MinFreeMB: 100},
+		},
+	}
+	config.setDefaults()
+	require.NoError(t, config.Validate())
+
+	host := &fakeHost{
+		processes: map[string]bool{"kube-proxy.exe": true},
+		networks:  map[string]bool{"net": true},
+		freeBytes: 200 * 1024 * 1024,
+	}
+	remediator := &fakeRemediator{}
+	m := New(config, host, remediator, healthz.Client())
+	start := time.Now()
+
+	readStatus := func() Status {
+		contents, err := ioutil.ReadFile(statusFile)
+		require.NoError(t, err, "error reading status file")
+		var status Status
+		require.NoError(t, json.Unmarshal(contents, &status), "error parsing status file")
+		return status
+	}
+
+	t.Run("healthy node", func(t *testing.T) {
+		status, err := m.RunOnce(context.Background(), start)
+		require.NoError(t, err)
+		assert.True(t, status.Healthy)
+		assert.True(t, readStatus().Healthy, "status file does not report a healthy node")
+		assert.Empty(t, remediator.restarted)
+	})
+
+	t.Run("remediation after failure threshold", func(t *testing.T) {
+		kubeletHealthy = false
+		host.networks["net"] = false
+		host.freeBytes = 50 * 1024 * 1024
+
+		status, err := m.RunOnce(context.Background(), start.Add(time.Minute))
+		require.NoError(t, err)
+		assert.False(t, status.Healthy)
+		assert.Empty(t, remediator.restarted, "kubelet was restarted before reaching the failure threshold")
+		assert.Empty(t, remediator.cniConfigs, "CNI was configured before reaching the failure threshold")
+
+		_, err = m.RunOnce(context.Background(), start.Add(2*time.Minute))
+		require.NoError(t, err)
+		assert.Equal(t, []string{"kubelet"}, remediator.restarted)
+		assert.Equal(t, []CNIConfig{config.CNI}, remediator.cniConfigs)
+
+		byName := make(map[string]CheckStatus)
+		for _, check := range readStatus().Checks {
+			byName[check.Name] = check
+		}
+		assert.Equal(t, 0, byName["kubelet"].ConsecutiveFailures, "failures were not reset after a restart")
+		assert.NotNil(t, byName["kubelet"].LastRemediation)
+		assert.True(t, byName["disk-space"].NeedsAttention, "disk-space check was not marked in the status file")
+		assert.Contains(t, byName["disk-space"].Message, "50 MB free")
+		assert.True(t, byName["kube-proxy"].Healthy)
+	})
+
+	t.Run("recovery", func(t *testing.T) {
+		kubeletHealthy = true
+		host.networks["net"] = true
+		host.freeBytes = 200 * 1024 * 1024
+
+		status, err := m.RunOnce(context.Background(), start.Add(3*time.Minute))
+		require.NoError(t, err)
+		assert.True(t, status.Healthy)
+		for _, check := range status.Checks {
+			assert.False(t, check.NeedsAttention, "check %s still needs attention", check.Name)
+		}
+	})
+
+	t.Run("check interval", func(t *testing.T) {
+		host.processes["kube-proxy.exe"] = false
+		// kube-proxy last ran two minutes ago at start+2m, so it is not due yet after one minute
+		status, err := m.RunOnce(context.Background(), start.Add(3*time.Minute+30*time.Second))
+		require.NoError(t, err)
+		assert.True(t, status.Healthy, "kube-proxy check ran before its interval elapsed")
+
+		status, err = m.RunOnce(context.Background(), start.Add(4*time.Minute))
+		require.NoError(t, err)
+		assert.False(t, status.Healthy, "kube-proxy check did not run once its interval elapsed")
+	})
+
+	t.Run("remediation error", func(t *testing.T) {
+		remediator.restartError = fmt.Errorf("access denied")
+		kubeletHealthy = false
+		for i := 0; i < config.FailureThreshold; i++ {
+			_, err := m.RunOnce(context.Background(), start.Add(time.Duration(5+i)*time.Minute))
+			require.NoError(t, err)
+		}
+		status := readStatus()
+		assert.Equal(t, "kubelet", status.Checks[0].Name)
+		assert.Equal(t, "access denied", status.Checks[0].RemediationError)
+	})
+}
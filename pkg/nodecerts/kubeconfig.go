@@ -0,0 +1,119 @@
+package nodecerts
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"strings"
+	"time"
+
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// ValidateBootstrapKubeconfig returns an error if the given kubeconfig cannot be used to bootstrap the kubelet at the
+// given time: the cluster of the current context needs an https server and a CA bundle with at least one certificate
+// that is valid at the given time. Every certificate of the bundle has to be a CA, and the valid ones have to chain up
+// to a root of the bundle. Expired certificates are tolerated as long as another one is valid, as CA bundles keep the
+// previous CAs for a while after they have been rotated. The user of the current context needs a token or a client
+// certificate. The certificates of the CA bundle are returned.
+func ValidateBootstrapKubeconfig(config *clientcmdapi.Config, now time.Time) ([]*x509.Certificate, error) {
+	if err := clientcmd.Validate(*config); err != nil {
+		return nil, err
+	}
+	restConfig, err := clientcmd.NewDefaultClientConfig(*config, &clientcmd.ConfigOverrides{}).ClientConfig()
+	if err != nil {
+		return nil, err
+	}
+	if err = ValidateServer(restConfig.Host); err != nil {
+		return nil, err
+	}
+
+	ca := restConfig.CAData
+	if len(ca) == 0 && restConfig.CAFile != "" {
+		if ca, err = ioutil.ReadFile(restConfig.CAFile); err != nil {
+			return nil, fmt.Errorf("unable to read certificate-authority: %v", err)
+		}
+	}
+	if len(ca) == 0 {
+		return nil, fmt.Errorf("kubeconfig has no certificate authority")
+	}
+	certs, err := verifyCABundle(ca, now)
+	if err != nil {
+		return nil, err
+	}
+
+	if restConfig.BearerToken == "" && len(restConfig.CertData) == 0 && restConfig.CertFile == "" {
+		return nil, fmt.Errorf("kubeconfig has no token or client certificate")
+	}
+	return certs, nil
+}
+
+// ValidateServer returns an error if the given API server address is not an https URL
+func ValidateServer(server string) error {
+	u, err := url.Parse(server)
+	if err != nil {
+		return fmt.Errorf("invalid server %q: %v", server, err)
+	}
+	if u.Scheme != "https" || u.Host == "" {
+		return fmt.Errorf("invalid server %q, must be an https URL", server)
+	}
+	return nil
+}
+
+// verifyCABundle parses the given PEM CA bundle and returns an error if none of its certificates is valid at the given
+// time, if one of them is not a CA, or if one of the valid ones does not chain up to a root of the bundle
+func verifyCABundle(ca []byte, now time.Time) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for block, rest := pem.Decode(ca); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing certificate authority: %v", err)
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no valid certificates found in certificate authority")
+	}
+
+	// The self-signed certificates are the roots, the others have to chain up to one of them
+	roots, intermediates := x509.NewCertPool(), x509.NewCertPool()
+	for _, cert := range certs {
+		if !cert.IsCA {
+			return nil, fmt.Errorf("certificate %s of the CA bundle is not a CA", cert.Subject.CommonName)
+		}
+		if cert.CheckSignatureFrom(cert) == nil {
+			roots.AddCert(cert)
+		} else {
+			intermediates.AddCert(cert)
+		}
+	}
+	var invalid []string
+	for _, cert := range certs {
+		if now.Before(cert.NotBefore) {
+			invalid = append(invalid, fmt.Sprintf("CA certificate %s is not valid before %s", cert.Subject.CommonName,
+				cert.NotBefore.UTC().Format(time.RFC3339)))
+			continue
+		}
+		if now.After(cert.NotAfter) {
+			invalid = append(invalid, fmt.Sprintf("CA certificate %s expired on %s", cert.Subject.CommonName,
+				cert.NotAfter.UTC().Format(time.RFC3339)))
+			continue
+		}
+		_, err := cert.Verify(x509.VerifyOptions{Roots: roots, Intermediates: intermediates, CurrentTime: now,
+			KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny}})
+		if err != nil {
+			return nil, fmt.Errorf("CA certificate %s does not chain up to a root of the bundle: %v",
+				cert.Subject.CommonName, err)
+		}
+	}
+	if len(invalid) == len(certs) {
+		return nil, fmt.Errorf("no valid CA certificate: %s", strings.Join(invalid, ", "))
+	}
+	return certs, nil
+}
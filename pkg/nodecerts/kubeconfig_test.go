@@ -0,0 +1,191 @@
+package nodecerts
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// newCert returns a PEM certificate valid between the given times, signed by the given parent or self-signed if the
+// parent is nil, along with its parsed form and key
+func newCert(t *testing.T, name string, isCA bool, notBefore, notAfter time.Time, parent *x509.Certificate,
+	parentKey *ecdsa.PrivateKey) ([]byte, *x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             notBefore,
+		NotAfter:              notAfter,
+		IsCA:                  isCA,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), cert, key
+}
+
+// concat returns a CA bundle made of the given certificates
+func concat(certs ...[]byte) []byte {
+	var bundle []byte
+	for _, cert := range certs {
+		bundle = append(bundle, cert...)
+	}
+	return bundle
+}
+
+// bootstrapKubeconfig returns a kubeconfig with a single context using the given cluster and user
+func bootstrapKubeconfig(cluster *clientcmdapi.Cluster, authInfo *clientcmdapi.AuthInfo) *clientcmdapi.Config {
+	config := clientcmdapi.NewConfig()
+	config.Clusters["local"] = cluster
+	config.AuthInfos["kubelet"] = authInfo
+	config.Contexts["kubelet"] = &clientcmdapi.Context{Cluster: "local", AuthInfo: "kubelet"}
+	config.CurrentContext = "kubelet"
+	return config
+}
+
+// TestValidateBootstrapKubeconfig tests the validation of the server, CA bundle and credentials of a bootstrap
+// kubeconfig
+func TestValidateBootstrapKubeconfig(t *testing.T) {
+	now := time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC)
+	year := 365 * 24 * time.Hour
+	rootPEM, root, rootKey := newCert(t, "root", true, now.Add(-year), now.Add(year), nil, nil)
+	intermediatePEM, _, _ := newCert(t, "intermediate", true, now.Add(-year), now.Add(year), root, rootKey)
+	_, otherRoot, otherRootKey := newCert(t, "other-root", true, now.Add(-year), now.Add(year), nil, nil)
+	orphanPEM, _, _ := newCert(t, "orphan", true, now.Add(-year), now.Add(year), otherRoot, otherRootKey)
+	expiredPEM, _, _ := newCert(t, "expired", true, now.Add(-2*year), now.Add(-year), nil, nil)
+	futurePEM, _, _ := newCert(t, "future", true, now.Add(year), now.Add(2*year), nil, nil)
+	leafPEM, _, _ := newCert(t, "leaf", false, now.Add(-year), now.Add(year), nil, nil)
+
+	dir, err := ioutil.TempDir("", "nodecerts")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	caFile := filepath.Join(dir, "ca.crt")
+	require.NoError(t, ioutil.WriteFile(caFile, rootPEM, 0644))
+	tokenFile := filepath.Join(dir, "token")
+	require.NoError(t, ioutil.WriteFile(tokenFile, []byte("secret"), 0600))
+	clientCertFile := filepath.Join(dir, "client.crt")
+	require.NoError(t, ioutil.WriteFile(clientCertFile, leafPEM, 0644))
+	clientKeyFile := filepath.Join(dir, "client.key")
+	require.NoError(t, ioutil.WriteFile(clientKeyFile, []byte("key"), 0600))
+
+	server := "https://api-int.cluster.example.com:6443"
+	token := &clientcmdapi.AuthInfo{Token: "secret"}
+	tests := []struct {
+		name     string
+		cluster  *clientcmdapi.Cluster
+		authInfo *clientcmdapi.AuthInfo
+		errMsg   string
+	}{
+		{
+			name:     "valid root",
+			cluster:  &clientcmdapi.Cluster{Server: server, CertificateAuthorityData: rootPEM},
+			authInfo: token,
+		},
+		{
+			name:     "valid chain",
+			cluster:  &clientcmdapi.Cluster{Server: server, CertificateAuthorityData: concat(rootPEM, intermediatePEM)},
+			authInfo: token,
+		},
+		{
+			name:     "intermediate without its root",
+			cluster:  &clientcmdapi.Cluster{Server: server, CertificateAuthorityData: concat(rootPEM, orphanPEM)},
+			authInfo: token,
+			errMsg:   "CA certificate orphan does not chain up to a root of the bundle",
+		},
+		{
+			name:     "expired CA",
+			cluster:  &clientcmdapi.Cluster{Server: server, CertificateAuthorityData: expiredPEM},
+			authInfo: token,
+			errMsg:   "no valid CA certificate: CA certificate expired expired on",
+		},
+		{
+			name:     "expired CA next to a valid one",
+			cluster:  &clientcmdapi.Cluster{Server: server, CertificateAuthorityData: concat(expiredPEM, rootPEM)},
+			authInfo: token,
+		},
+		{
+			name:     "CA not valid yet",
+			cluster:  &clientcmdapi.Cluster{Server: server, CertificateAuthorityData: futurePEM},
+			authInfo: token,
+			errMsg:   "CA certificate future is not valid before",
+		},
+		{
+			name:     "not a CA",
+			cluster:  &clientcmdapi.Cluster{Server: server, CertificateAuthorityData: leafPEM},
+			authInfo: token,
+			errMsg:   "certificate leaf of the CA bundle is not a CA",
+		},
+		{
+			name:     "certificate authority file",
+			cluster:  &clientcmdapi.Cluster{Server: server, CertificateAuthority: caFile},
+			authInfo: token,
+		},
+		{
+			name:     "missing certificate authority file",
+			cluster:  &clientcmdapi.Cluster{Server: server, CertificateAuthority: filepath.Join(dir, "missing.crt")},
+			authInfo: token,
+			errMsg:   "unable to read certificate-authority",
+		},
+		{
+			name:     "no certificate authority",
+			cluster:  &clientcmdapi.Cluster{Server: server},
+			authInfo: token,
+			errMsg:   "kubeconfig has no certificate authority",
+		},
+		{
+			name:     "token file",
+			cluster:  &clientcmdapi.Cluster{Server: server, CertificateAuthorityData: rootPEM},
+			authInfo: &clientcmdapi.AuthInfo{TokenFile: tokenFile},
+		},
+		{
+			name:     "client certificate",
+			cluster:  &clientcmdapi.Cluster{Server: server, CertificateAuthorityData: rootPEM},
+			authInfo: &clientcmdapi.AuthInfo{ClientCertificate: clientCertFile, ClientKey: clientKeyFile},
+		},
+		{
+			name:     "missing credentials",
+			cluster:  &clientcmdapi.Cluster{Server: server, CertificateAuthorityData: rootPEM},
+			authInfo: &clientcmdapi.AuthInfo{},
+			errMsg:   "kubeconfig has no token or client certificate",
+		},
+		{
+			name: "http server",
+			cluster: &clientcmdapi.Cluster{Server: "http://api-int.cluster.example.com:6443",
+				CertificateAuthorityData: rootPEM},
+			authInfo: token,
+			errMsg:   "must be an https URL",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ValidateBootstrapKubeconfig(bootstrapKubeconfig(tt.cluster, tt.authInfo), now)
+			if tt.errMsg == "" {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.errMsg)
+		})
+	}
+}
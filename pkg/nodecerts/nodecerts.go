@@ -0,0 +1,211 @@
+// Package nodecerts inspects the certificates the kubelet of a Windows node authenticates and serves with, so that
+// their expiry is noticed before the node stops being reachable
+package nodecerts
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// ClientCertName is the file in the certificate directory holding the client certificate the kubelet uses
+	ClientCertName = "kubelet-client-current.pem"
+	// ServerCertName is the file in the certificate directory holding the serving certificate of the kubelet, which
+	// is only present once the CSR of the kubelet, made because of serverTLSBootstrap, has been approved
+	ServerCertName = "kubelet-server-current.pem"
+	// CAName is the file in the install directory holding the CA bundle client certificates are verified with
+	CAName = "kubelet-ca.crt"
+	// DefaultWarnBefore is how long before their expiry certificates are reported as expiring
+	DefaultWarnBefore = 720 * time.Hour
+)
+
+// Certificate describes a parsed certificate
+type Certificate struct {
+	// Subject is the distinguished name of the certificate, such as CN=system:node:worker,O=system:nodes
+	Subject string `json:"subject"`
+	// SANs are the DNS names and IP addresses the certificate is valid for
+	SANs []string `json:"sans,omitempty"`
+	// Issuer is the distinguished name of the issuer of the certificate
+	Issuer string `json:"issuer"`
+	// NotBefore is when the certificate becomes valid
+	NotBefore time.Time `json:"notBefore"`
+	// NotAfter is when the certificate expires
+	NotAfter time.Time `json:"notAfter"`
+}
+
+// File is a certificate file of the node along with the certificates read from it
+type File struct {
+	// Name is the name of the file, such as kubelet-server-current.pem
+	Name string `json:"name"`
+	// Path is the location of the file
+	Path string `json:"path"`
+	// CA is true for a CA bundle, which stays valid as long as any of its certificates does. Other files are only
+	// valid as long as their first certificate is.
+	CA bool `json:"ca"`
+	// Certificates are the certificates found in the file, in order
+	Certificates []Certificate `json:"certificates,omitempty"`
+	// Error is why the certificates could not be read
+	Error string `json:"error,omitempty"`
+	// missing is true if the file does not exist
+	missing bool
+}
+
+// Inspect reads the client and serving certificates of the kubelet from the given certificate directory, and the
+// kubelet CA bundle from the given install directory
+func Inspect(certDir, installDir string) []File {
+	return []File{
+		inspectFile(ClientCertName, filepath.Join(certDir, ClientCertName), false),
+		inspectFile(ServerCertName, filepath.Join(certDir, ServerCertName), false),
+		inspectFile(CAName, filepath.Join(installDir, CAName), true),
+	}
+}
+
+// inspectFile reads the certificates of the file at the given path
+func inspectFile(name, path string, ca bool) File {
+	file := File{Name: name, Path: path, CA: ca}
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		file.missing = os.IsNotExist(err)
+		file.Error = err.Error()
+		return file
+	}
+	if file.Certificates, err = parseCertificates(contents); err != nil {
+		file.Error = err.Error()
+	}
+	return file
+}
+
+// parseCertificates parses the PEM encoded certificates in the given data. Other PEM blocks, such as the private key
+// stored along with the kubelet certificates, are skipped.
+func parseCertificates(data []byte) ([]Certificate, error) {
+	var certs []Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse certificate: %v", err)
+		}
+		sans := append([]string{}, cert.DNSNames...)
+		for _, ip := range cert.IPAddresses {
+			sans = append(sans, ip.String())
+		}
+		certs = append(certs, Certificate{
+			Subject:   cert.Subject.String(),
+			SANs:      sans,
+			Issuer:    cert.Issuer.String(),
+			NotBefore: cert.NotBefore,
+			NotAfter:  cert.NotAfter,
+		})
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no certificate found")
+	}
+	return certs, nil
+}
+
+// effective returns the certificate the validity of the file depends on: the first certificate of a certificate file,
+// or the certificate of a CA bundle that expires last
+func (f File) effective() Certificate {
+	cert := f.Certificates[0]
+	if f.CA {
+		for _, c := range f.Certificates[1:] {
+			if c.NotAfter.After(cert.NotAfter) {
+				cert = c
+			}
+		}
+	}
+	return cert
+}
+
+// Status is the outcome of checking a certificate file
+type Status string
+
+const (
+	// StatusOK means the certificate is valid and does not expire soon
+	StatusOK Status = "ok"
+	// StatusExpiring means the certificate expires within the warning window
+	StatusExpiring Status = "expiring"
+	// StatusExpired means the certificate has expired
+	StatusExpired Status = "expired"
+	// StatusMissing means the file does not exist
+	StatusMissing Status = "missing"
+	// StatusInvalid means the file could not be read or parsed, or its certificate is not valid yet
+	StatusInvalid Status = "invalid"
+)
+
+// Result is the outcome of checking a certificate file
+type Result struct {
+	File
+	// Status is the outcome of the check
+	Status Status `json:"status"`
+	// Message describes the outcome
+	Message string `json:"message"`
+}
+
+// Results are the outcomes of checking the certificate files of a node
+type Results []Result
+
+// Failed returns true if any certificate file is not ok
+func (r Results) Failed() bool {
+	for _, result := range r {
+		if result.Status != StatusOK {
+			return true
+		}
+	}
+	return false
+}
+
+// Check reports the files whose certificate is missing, invalid, expired or expiring within warnBefore of now
+func Check(files []File, now time.Time, warnBefore time.Duration) Results {
+	results := make(Results, 0, len(files))
+	for _, file := range files {
+		results = append(results, checkFile(file, now, warnBefore))
+	}
+	return results
+}
+
+// checkFile reports the state of the certificate the given file depends on
+func checkFile(file File, now time.Time, warnBefore time.Duration) Result {
+	result := Result{File: file}
+	switch {
+	case file.missing:
+		result.Status, result.Message = StatusMissing, "not found"
+		if file.Name == ServerCertName {
+			result.Message += ", check that the CSR of the kubelet serving certificate was approved"
+		}
+		return result
+	case file.Error != "":
+		result.Status, result.Message = StatusInvalid, file.Error
+		return result
+	}
+
+	cert := file.effective()
+	switch {
+	case now.Before(cert.NotBefore):
+		result.Status = StatusInvalid
+		result.Message = fmt.Sprintf("%s is not valid before %s", cert.Subject, cert.NotBefore.Format(time.RFC3339))
+	case !now.Before(cert.NotAfter):
+		result.Status = StatusExpired
+		result.Message = fmt.Sprintf("%s expired on %s", cert.Subject, cert.NotAfter.Format(time.RFC3339))
+	case cert.NotAfter.Sub(now) < warnBefore:
+		result.Status = StatusExpiring
+		result.Message = fmt.Sprintf("%s expires on %s, in %s", cert.Subject, cert.NotAfter.Format(time.RFC3339),
+			cert.NotAfter.Sub(now).Round(time.Minute))
+	default:
+		result.Status = StatusOK
+		result.Message = fmt.Sprintf("%s expires on %s", cert.Subject, cert.NotAfter.Format(time.RFC3339))
+	}
+	return result
+}
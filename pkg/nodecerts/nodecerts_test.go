@@ -0,0 +1,155 @@
+package nodecerts
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testCert returns a PEM encoded self-signed certificate with the given common name and validity
+func testCert(t *testing.T, cn string, notBefore, notAfter time.Time) []byte {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: cn, Organization: []string{"system:nodes"}},
+		DNSNames:     []string{"worker"},
+		IPAddresses:  []net.IP{net.ParseIP("10.0.0.5")},
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	return append(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})...)
+}
+
+// TestInspect tests reading the certificates of the kubelet files, including missing and invalid files
+func TestInspect(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nodecerts")
+	require.NoError(t, err, "error creating temp directory")
+	// Ignore the return error as there is not much we can do if the temporary directory is not deleted
+	defer os.RemoveAll(dir)
+
+	notBefore := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	notAfter := notBefore.Add(365 * 24 * time.Hour)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, ClientCertName),
+		testCert(t, "system:node:worker", notBefore, notAfter), 0644))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, CAName), []byte("not a certificate"), 0644))
+
+	files := Inspect(dir, dir)
+	require.Len(t, files, 3)
+
+	assert.Equal(t, ClientCertName, files[0].Name)
+	assert.Empty(t, files[0].Error)
+	assert.Equal(t, []Certificate{{
+		Subject:   "CN=system:node:worker,O=system:nodes",
+		SANs:      []string{"worker", "10.0.0.5"},
+		Issuer:    "CN=system:node:worker,O=system:nodes",
+		NotBefore: notBefore,
+		NotAfter:  notAfter,
+	}}, files[0].Certificates, "private key was not skipped")
+
+	assert.Equal(t, ServerCertName, files[1].Name)
+	assert.True(t, files[1].missing)
+
+	assert.Equal(t, CAName, files[2].Name)
+	assert.True(t, files[2].CA)
+	assert.Equal(t, "no certificate found", files[2].Error)
+}
+
+// TestCheck tests the status of certificate files relative to the warning window
+func TestCheck(t *testing.T) {
+	notBefore := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	notAfter := notBefore.Add(365 * 24 * time.Hour)
+	cert := Certificate{Subject: "CN=system:node:worker", NotBefore: notBefore, NotAfter: notAfter}
+	expired := Certificate{Subject: "CN=old-ca", NotBefore: notBefore.Add(-time.Hour), NotAfter: notBefore}
+
+	tests := []struct {
+		name    string
+		file    File
+		now     time.Time
+		status  Status
+		message string
+	}{
+		{
+			name:    "valid",
+			file:    File{Name: ClientCertName, Certificates: []Certificate{cert}},
+			now:     notBefore.Add(24 * time.Hour),
+			status:  StatusOK,
+			message: "expires on 2020-12-31T00:00:00Z",
+		},
+		{
+			name:    "expiring",
+			file:    File{Name: ClientCertName, Certificates: []Certificate{cert}},
+			now:     notAfter.Add(-48 * time.Hour),
+			status:  StatusExpiring,
+			message: "in 48h0m0s",
+		},
+		{
+			name:    "expired",
+			file:    File{Name: ClientCertName, Certificates: []Certificate{cert}},
+			now:     notAfter,
+			status:  StatusExpired,
+			message: "expired on 2020-12-31T00:00:00Z",
+		},
+		{
+			name:    "not valid yet",
+			file:    File{Name: ClientCertName, Certificates: []Certificate{cert}},
+			now:     notBefore.Add(-time.Hour),
+			status:  StatusInvalid,
+			message: "is not valid before",
+		},
+		{
+			name:    "only the first certificate of a certificate file counts",
+			file:    File{Name: ServerCertName, Certificates: []Certificate{expired, cert}},
+			now:     notBefore.Add(24 * time.Hour),
+			status:  StatusExpired,
+			message: "CN=old-ca",
+		},
+		{
+			name:    "CA bundle with an expired CA",
+			file:    File{Name: CAName, CA: true, Certificates: []Certificate{expired, cert}},
+			now:     notBefore.Add(24 * time.Hour),
+			status:  StatusOK,
+			message: "CN=system:node:worker expires on",
+		},
+		{
+			name:    "missing serving certificate",
+			file:    File{Name: ServerCertName, Error: "not found", missing: true},
+			status:  StatusMissing,
+			message: "CSR of the kubelet serving certificate",
+		},
+		{
+			name:    "invalid",
+			file:    File{Name: CAName, CA: true, Error: "no certificate found"},
+			status:  StatusInvalid,
+			message: "no certificate found",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results := Check([]File{tt.file}, tt.now, DefaultWarnBefore)
+			require.Len(t, results, 1)
+			assert.Equal(t, tt.status, results[0].Status, results[0].Message)
+			assert.Contains(t, results[0].Message, tt.message)
+			assert.Equal(t, tt.status != StatusOK, results.Failed())
+		})
+	}
+}
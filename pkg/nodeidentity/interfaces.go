@@ -0,0 +1,34 @@
+package nodeidentity
+
+import (
+	"net"
+)
+
+// HostInterfaces is the InterfaceLister backed by the network interfaces of the host it runs on
+type HostInterfaces struct{}
+
+// Interfaces returns the network interfaces of the host that are up
+func (HostInterfaces) Interfaces() ([]Interface, error) {
+	netInterfaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+	var interfaces []Interface
+	for _, netInterface := range netInterfaces {
+		if netInterface.Flags&net.FlagUp == 0 {
+			continue
+		}
+		addrs, err := netInterface.Addrs()
+		if err != nil {
+			return nil, err
+		}
+		iface := Interface{Name: netInterface.Name}
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok {
+				iface.Addrs = append(iface.Addrs, ipNet.IP)
+			}
+		}
+		interfaces = append(interfaces, iface)
+	}
+	return interfaces, nil
+}
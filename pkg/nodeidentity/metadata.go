@@ -0,0 +1,124 @@
+package nodeidentity
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultMetadataEndpoint is the link-local address both the AWS and the Azure instance metadata services listen on
+	DefaultMetadataEndpoint = "http://169.254.169.254"
+	// metadataTimeout is the timeout of the requests made to the instance metadata services
+	metadataTimeout = 10 * time.Second
+	// awsTokenTTL is how long the IMDSv2 session token requested from AWS stays valid, in seconds
+	awsTokenTTL = "60"
+	// azureAPIVersion is the Azure instance metadata API version the requests are made with
+	azureAPIVersion = "2020-09-01"
+)
+
+// AWSMetadata reads the hostname from the EC2 instance metadata service. The AWS cloud provider expects nodes to be
+// named after the private DNS name of the instance.
+type AWSMetadata struct {
+	// Endpoint is the base URL of the instance metadata service
+	Endpoint string
+	// Client makes the requests to the instance metadata service
+	Client *http.Client
+}
+
+// NewAWSMetadata returns an AWSMetadata reading from the given endpoint
+func NewAWSMetadata(endpoint string) AWSMetadata {
+	return AWSMetadata{Endpoint: endpoint, Client: newMetadataClient()}
+}
+
+// Hostname returns the private DNS name of the instance. IMDSv2 is used, so that it also works on instances where
+// IMDSv1 is disabled.
+func (m AWSMetadata) Hostname(ctx context.Context) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, m.Endpoint+"/latest/api/token", nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", awsTokenTTL)
+	token, err := doMetadataRequest(m.Client, req)
+	if err != nil {
+		return "", fmt.Errorf("unable to get session token: %v", err)
+	}
+
+	req, err = http.NewRequestWithContext(ctx, http.MethodGet, m.Endpoint+"/latest/meta-data/local-hostname", nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-aws-ec2-metadata-token", token)
+	hostname, err := doMetadataRequest(m.Client, req)
+	if err != nil {
+		return "", err
+	}
+	// Instances in VPCs with custom DHCP options can report several space separated names, the first one is the one
+	// the AWS cloud provider uses
+	return strings.Fields(hostname)[0], nil
+}
+
+// AzureMetadata reads the hostname from the Azure instance metadata service. The Azure cloud provider expects nodes to
+// be named after the VM.
+type AzureMetadata struct {
+	// Endpoint is the base URL of the instance metadata service
+	Endpoint string
+	// Client makes the requests to the instance metadata service
+	Client *http.Client
+}
+
+// NewAzureMetadata returns an AzureMetadata reading from the given endpoint
+func NewAzureMetadata(endpoint string) AzureMetadata {
+	return AzureMetadata{Endpoint: endpoint, Client: newMetadataClient()}
+}
+
+// Hostname returns the name of the VM
+func (m AzureMetadata) Hostname(ctx context.Context) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, m.Endpoint+"/metadata/instance/compute/name", nil)
+	if err != nil {
+		return "", err
+	}
+	query := req.URL.Query()
+	query.Set("api-version", azureAPIVersion)
+	query.Set("format", "text")
+	req.URL.RawQuery = query.Encode()
+	req.Header.Set("Metadata", "true")
+	return doMetadataRequest(m.Client, req)
+}
+
+// newMetadataClient returns the HTTP client used to reach the instance metadata services. The services must be
+// reached directly, as a proxy would answer with its own metadata or not at all.
+func newMetadataClient() *http.Client {
+	return &http.Client{
+		Timeout: metadataTimeout,
+		Transport: &http.Transport{
+			Proxy:       nil,
+			DialContext: (&net.Dialer{Timeout: metadataTimeout}).DialContext,
+		},
+	}
+}
+
+// doMetadataRequest makes the given request and returns the trimmed response body, which must not be empty
+func doMetadataRequest(client *http.Client, req *http.Request) (string, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("error reading response from %s: %v", req.URL, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s %s returned %s", req.Method, req.URL, resp.Status)
+	}
+	value := strings.TrimSpace(string(body))
+	if value == "" {
+		return "", fmt.Errorf("%s %s returned an empty response", req.Method, req.URL)
+	}
+	return value, nil
+}
@@ -0,0 +1,199 @@
+package nodeidentity
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/ipfamily"
+)
+
+const (
+	// HostnameSourceOS leaves the hostname to the kubelet, which uses the hostname of the OS
+	HostnameSourceOS = ""
+	// HostnameSourceAWS reads the hostname from the EC2 instance metadata service
+	HostnameSourceAWS = "aws"
+	// HostnameSourceAzure reads the hostname from the Azure instance metadata service
+	HostnameSourceAzure = "azure"
+)
+
+// Options selects the IP address and the hostname the node registers with
+type Options struct {
+	// NodeIP is the IP address of the node, or a comma separated address per IP family on dual-stack nodes. It takes
+	// precedence over NodeIPCIDR and NodeIPInterface.
+	NodeIP string
+	// NodeIPCIDR picks the first address of the node within the given CIDR. Dual-stack nodes have a comma separated
+	// CIDR per IP family, and an address is picked within each.
+	NodeIPCIDR string
+	// NodeIPInterface picks the first address of the network interface with the given name
+	NodeIPInterface string
+	// Hostname is the name of the node. It takes precedence over HostnameSource.
+	Hostname string
+	// HostnameSource is where the name of the node is read from, either the OS, aws or azure
+	HostnameSource string
+}
+
+// Identity is the IP address and hostname the kubelet registers the node with. Empty fields are left to the kubelet.
+type Identity struct {
+	// NodeIP is passed to the kubelet as --node-ip, with a comma separated address per IP family on dual-stack nodes
+	NodeIP string
+	// Hostname is passed to the kubelet as --hostname-override
+	Hostname string
+}
+
+// Interface is a network interface of the node along with its addresses
+type Interface struct {
+	// Name is the name of the interface, for example "Ethernet 2"
+	Name string
+	// Addrs are the IP addresses assigned to the interface
+	Addrs []net.IP
+}
+
+// InterfaceLister lists the network interfaces of the node
+type InterfaceLister interface {
+	// Interfaces returns the network interfaces that are up, in the order the OS reports them
+	Interfaces() ([]Interface, error)
+}
+
+// MetadataService returns the hostname of the instance from the instance metadata of a cloud
+type MetadataService interface {
+	// Hostname returns the name of the instance as expected by the cloud provider integration. The requests made to
+	// the metadata service are abandoned if the context is cancelled.
+	Hostname(ctx context.Context) (string, error)
+}
+
+// Resolver determines the identity of the node
+type Resolver struct {
+	// Interfaces lists the network interfaces the node IP is picked from
+	Interfaces InterfaceLister
+	// Metadata maps hostname sources to the metadata service the hostname is read from
+	Metadata map[string]MetadataService
+}
+
+// NewResolver returns a Resolver backed by the network interfaces of the host and the default instance metadata
+// endpoints
+func NewResolver() Resolver {
+	return Resolver{
+		Interfaces: HostInterfaces{},
+		Metadata: map[string]MetadataService{
+			HostnameSourceAWS:   NewAWSMetadata(DefaultMetadataEndpoint),
+			HostnameSourceAzure: NewAzureMetadata(DefaultMetadataEndpoint),
+		},
+	}
+}
+
+// Resolve returns the identity of the node described by the given options
+func (r Resolver) Resolve(ctx context.Context, opts Options) (Identity, error) {
+	var identity Identity
+	var err error
+	if identity.NodeIP, err = r.nodeIP(opts); err != nil {
+		return Identity{}, err
+	}
+	if identity.Hostname, err = r.hostname(ctx, opts); err != nil {
+		return Identity{}, err
+	}
+	return identity, nil
+}
+
+// nodeIP returns the node IP selected by the given options, or an empty string if none was requested. Dual-stack nodes
+// get an address per IP family, separated by a comma.
+func (r Resolver) nodeIP(opts Options) (string, error) {
+	if opts.NodeIP != "" {
+		ips, err := ipfamily.ParseIPs(ipfamily.Split(opts.NodeIP))
+		if err != nil {
+			return "", fmt.Errorf("invalid node IP %q: %v", opts.NodeIP, err)
+		}
+		return joinIPs(ips), nil
+	}
+	if opts.NodeIPCIDR == "" && opts.NodeIPInterface == "" {
+		return "", nil
+	}
+	// A nil subnet matches any address
+	subnets := []*net.IPNet{nil}
+	if opts.NodeIPCIDR != "" {
+		var err error
+		if subnets, err = ipfamily.ParseCIDRs(ipfamily.Split(opts.NodeIPCIDR)); err != nil {
+			return "", fmt.Errorf("invalid node IP CIDR %q: %v", opts.NodeIPCIDR, err)
+		}
+	}
+	interfaces, err := r.Interfaces.Interfaces()
+	if err != nil {
+		return "", fmt.Errorf("unable to list network interfaces: %v", err)
+	}
+	var ips []net.IP
+	for _, subnet := range subnets {
+		ip := SelectIP(interfaces, subnet, opts.NodeIPInterface)
+		if ip == nil {
+			cidr := opts.NodeIPCIDR
+			if subnet != nil {
+				cidr = subnet.String()
+			}
+			return "", fmt.Errorf("no address found on the node matching CIDR %q and interface %q", cidr,
+				opts.NodeIPInterface)
+		}
+		ips = append(ips, ip)
+	}
+	return joinIPs(ips), nil
+}
+
+// joinIPs returns the given addresses separated by commas, as expected by the --node-ip kubelet flag
+func joinIPs(ips []net.IP) string {
+	addrs := make([]string, 0, len(ips))
+	for _, ip := range ips {
+		addrs = append(addrs, ip.String())
+	}
+	return strings.Join(addrs, ",")
+}
+
+// hostname returns the hostname selected by the given options, or an empty string if it is left to the kubelet
+func (r Resolver) hostname(ctx context.Context, opts Options) (string, error) {
+	name := opts.Hostname
+	if name == "" {
+		if opts.HostnameSource == HostnameSourceOS {
+			return "", nil
+		}
+		metadata, ok := r.Metadata[opts.HostnameSource]
+		if !ok {
+			return "", fmt.Errorf("unsupported hostname source %q, must be %s or %s", opts.HostnameSource,
+				HostnameSourceAWS, HostnameSourceAzure)
+		}
+		var err error
+		if name, err = metadata.Hostname(ctx); err != nil {
+			return "", fmt.Errorf("unable to get hostname from %s instance metadata: %v", opts.HostnameSource, err)
+		}
+	}
+	return NormalizeHostname(name)
+}
+
+// SelectIP returns the first address of the given interfaces within the given subnet and on the interface with the
+// given name. A nil subnet or an empty name match any address. Loopback and link-local addresses are never selected.
+func SelectIP(interfaces []Interface, subnet *net.IPNet, name string) net.IP {
+	for _, iface := range interfaces {
+		if name != "" && iface.Name != name {
+			continue
+		}
+		for _, ip := range iface.Addrs {
+			if ip.IsLoopback() || ip.IsLinkLocalUnicast() {
+				continue
+			}
+			if subnet != nil && !subnet.Contains(ip) {
+				continue
+			}
+			return ip
+		}
+	}
+	return nil
+}
+
+// NormalizeHostname lowercases the given hostname and verifies that it is a valid node name, which must be a DNS-1123
+// subdomain
+func NormalizeHostname(name string) (string, error) {
+	normalized := strings.TrimSuffix(strings.ToLower(strings.TrimSpace(name)), ".")
+	if errs := validation.IsDNS1123Subdomain(normalized); len(errs) > 0 {
+		return "", fmt.Errorf("invalid hostname %q: %s", name, strings.Join(errs, ", "))
+	}
+	return normalized, nil
+}
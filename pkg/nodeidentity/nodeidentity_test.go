@@ -0,0 +1,199 @@
+package nodeidentity
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeInterfaces is an InterfaceLister returning fixed interfaces
+type fakeInterfaces []Interface
+
+func (f fakeInterfaces) Interfaces() ([]Interface, error) {
+	return f, nil
+}
+
+// fakeMetadata is a MetadataService returning a fixed hostname
+type fakeMetadata struct {
+	hostname string
+	err      error
+}
+
+func (f fakeMetadata) Hostname(context.Context) (string, error) {
+	return f.hostname, f.err
+}
+
+// TestResolve tests selecting the node IP and hostname
+func TestResolve(t *testing.T) {
+	resolver := Resolver{
+		Interfaces: fakeInterfaces{
+			{Name: "Loopback", Addrs: []net.IP{net.ParseIP("127.0.0.1")}},
+			{Name: "Ethernet", Addrs: []net.IP{net.ParseIP("fe80::1"), net.ParseIP("10.0.1.5")}},
+			{Name: "Ethernet 2", Addrs: []net.IP{net.ParseIP("192.168.10.7"), net.ParseIP("fd00::7")}},
+		},
+		Metadata: map[string]MetadataService{
+			HostnameSourceAWS:   fakeMetadata{hostname: "IP-10-0-1-5.ec2.internal"},
+			HostnameSourceAzure: fakeMetadata{err: fmt.Errorf("connection refused")},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		opts     Options
+		expected Identity
+		errMsg   string
+	}{
+		{
+			name: "left to the kubelet",
+		},
+		{
+			name:     "explicit",
+			opts:     Options{NodeIP: "10.0.1.9", Hostname: "Win-Node."},
+			expected: Identity{NodeIP: "10.0.1.9", Hostname: "win-node"},
+		},
+		{
+			name:     "CIDR",
+			opts:     Options{NodeIPCIDR: "192.168.0.0/16"},
+			expected: Identity{NodeIP: "192.168.10.7"},
+		},
+		{
+			name:     "interface",
+			opts:     Options{NodeIPInterface: "Ethernet"},
+			expected: Identity{NodeIP: "10.0.1.5"},
+		},
+		{
+			name:     "interface and CIDR",
+			opts:     Options{NodeIPInterface: "Ethernet 2", NodeIPCIDR: "fd00::/8"},
+			expected: Identity{NodeIP: "fd00::7"},
+		},
+		{
+			name:     "dual-stack explicit",
+			opts:     Options{NodeIP: "10.0.1.9, fd00::9"},
+			expected: Identity{NodeIP: "10.0.1.9,fd00::9"},
+		},
+		{
+			name:     "dual-stack CIDRs",
+			opts:     Options{NodeIPCIDR: "192.168.0.0/16,fd00::/8"},
+			expected: Identity{NodeIP: "192.168.10.7,fd00::7"},
+		},
+		{
+			name:   "dual-stack CIDR without address",
+			opts:   Options{NodeIPInterface: "Ethernet", NodeIPCIDR: "10.0.0.0/8,fd00::/8"},
+			errMsg: `no address found on the node matching CIDR "fd00::/8"`,
+		},
+		{
+			name:   "two node IPs of the same family",
+			opts:   Options{NodeIP: "10.0.1.9,10.0.1.10"},
+			errMsg: "at most one per IP family",
+		},
+		{
+			name:   "no matching address",
+			opts:   Options{NodeIPInterface: "Ethernet", NodeIPCIDR: "192.168.0.0/16"},
+			errMsg: "no address found",
+		},
+		{
+			name:   "invalid CIDR",
+			opts:   Options{NodeIPCIDR: "10.0.0.0"},
+			errMsg: "invalid node IP CIDR",
+		},
+		{
+			name:   "invalid node IP",
+			opts:   Options{NodeIP: "10.0.0"},
+			errMsg: "invalid node IP",
+		},
+		{
+			name:     "AWS metadata",
+			opts:     Options{HostnameSource: HostnameSourceAWS},
+			expected: Identity{Hostname: "ip-10-0-1-5.ec2.internal"},
+		},
+		{
+			name:   "metadata unavailable",
+			opts:   Options{HostnameSource: HostnameSourceAzure},
+			errMsg: "connection refused",
+		},
+		{
+			name:   "unknown hostname source",
+			opts:   Options{HostnameSource: "gcp"},
+			errMsg: "unsupported hostname source",
+		},
+		{
+			name:   "invalid hostname",
+			opts:   Options{Hostname: "win_node"},
+			errMsg: "invalid hostname",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			identity, err := resolver.Resolve(context.Background(), test.opts)
+			if test.errMsg != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), test.errMsg)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, identity)
+		})
+	}
+}
+
+// TestAWSMetadata tests reading the hostname from a stand-in for the EC2 instance metadata service
+func TestAWSMetadata(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPut && r.URL.Path == "/latest/api/token":
+			if r.Header.Get("X-aws-ec2-metadata-token-ttl-seconds") == "" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			fmt.Fprint(w, "token")
+		case r.Method == http.MethodGet && r.URL.Path == "/latest/meta-data/local-hostname":
+			if r.Header.Get("X-aws-ec2-metadata-token") != "token" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			fmt.Fprint(w, "ip-10-0-1-5.ec2.internal ip-10-0-1-5.example.com\n")
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	hostname, err := NewAWSMetadata(server.URL).Hostname(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "ip-10-0-1-5.ec2.internal", hostname)
+
+	_, err = NewAWSMetadata(server.URL + "/missing").Hostname(context.Background())
+	require.Error(t, err, "no error returned when the token could not be retrieved")
+	assert.Contains(t, err.Error(), "unable to get session token")
+}
+
+// TestAzureMetadata tests reading the hostname from a stand-in for the Azure instance metadata service
+func TestAzureMetadata(t *testing.T) {
+	vmName := "Win-VM-1"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/metadata/instance/compute/name" || r.Header.Get("Metadata") != "true" ||
+			r.URL.Query().Get("format") != "text" || r.URL.Query().Get("api-version") == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		fmt.Fprint(w, vmName)
+	}))
+	defer server.Close()
+
+	resolver := Resolver{Metadata: map[string]MetadataService{HostnameSourceAzure: NewAzureMetadata(server.URL)}}
+	identity, err := resolver.Resolve(context.Background(), Options{HostnameSource: HostnameSourceAzure})
+	require.NoError(t, err)
+	assert.Equal(t, "win-vm-1", identity.Hostname)
+
+	vmName = ""
+	_, err = resolver.Resolve(context.Background(), Options{HostnameSource: HostnameSourceAzure})
+	require.Error(t, err, "no error returned for an empty response")
+	assert.Contains(t, err.Error(), "empty response")
+}
@@ -0,0 +1,134 @@
+// Package nodelabels determines the labels and taints the kubelet registers a Windows node with. They are merged from
+// the kubelet unit of the ignition, the labels describing the Windows version of the host and the WMCB configuration.
+package nodelabels
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/config"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/osinfo"
+)
+
+const (
+	// WindowsBuildLabel is the well-known label holding the major, minor and build number of the Windows host, for
+	// example 10.0.17763. Process isolated containers can only be run on a node with the same build as their base
+	// image.
+	WindowsBuildLabel = "node.kubernetes.io/windows-build"
+	// WindowsVersionLabel holds the Windows release of the host, for example 1809
+	WindowsVersionLabel = "node.openshift.io/windows-version"
+	// WindowsEditionLabel holds the Windows edition of the host, for example ServerDatacenter
+	WindowsEditionLabel = "node.openshift.io/windows-edition"
+)
+
+// Windows returns the labels describing the Windows version of the host. Values that are unknown or that are not
+// valid label values are left out.
+func Windows(info osinfo.Info) map[string]string {
+	labels := map[string]string{WindowsBuildLabel: fmt.Sprintf("10.0.%d", info.Build)}
+	for key, value := range map[string]string{WindowsVersionLabel: info.ReleaseID,
+		WindowsEditionLabel: info.EditionID} {
+		if value != "" && len(validation.IsValidLabelValue(value)) == 0 {
+			labels[key] = value
+		}
+	}
+	return labels
+}
+
+// ParseLabels parses the comma separated key=value labels of the kubelet --node-labels option. A label without a value
+// has an empty value. Labels the API server would reject, such as the ones with values referencing environment
+// variables of the Linux kubelet unit, are returned separately as skipped.
+func ParseLabels(value string) (labels map[string]string, skipped []string) {
+	labels = make(map[string]string)
+	for _, label := range strings.Split(value, ",") {
+		label = strings.TrimSpace(label)
+		if label == "" {
+			continue
+		}
+		key, labelValue := label, ""
+		if eq := strings.Index(label, "="); eq != -1 {
+			key, labelValue = label[:eq], label[eq+1:]
+		}
+		if len(validation.IsQualifiedName(key)) != 0 || len(validation.IsValidLabelValue(labelValue)) != 0 {
+			skipped = append(skipped, label)
+			continue
+		}
+		labels[key] = labelValue
+	}
+	return labels, skipped
+}
+
+// ParseTaints parses the comma separated taints of the kubelet --register-with-taints option. Taints the API server
+// would reject are returned separately as skipped.
+func ParseTaints(value string) (taints []config.Taint, skipped []string) {
+	for _, s := range strings.Split(value, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		taint, err := config.ParseTaint(s)
+		if err != nil {
+			skipped = append(skipped, s)
+			continue
+		}
+		taints = append(taints, taint)
+	}
+	return taints, skipped
+}
+
+// MergeLabels merges the given sets of labels. The value of a label present in several sets is taken from the last
+// one.
+func MergeLabels(sets ...map[string]string) map[string]string {
+	merged := make(map[string]string)
+	for _, labels := range sets {
+		for key, value := range labels {
+			merged[key] = value
+		}
+	}
+	return merged
+}
+
+// MergeTaints merges the given lists of taints. The API server allows a single taint per key and effect, so a taint
+// present in several lists keeps its first position and takes its value from the last one.
+func MergeTaints(lists ...[]config.Taint) []config.Taint {
+	var merged []config.Taint
+	index := make(map[string]int)
+	for _, taints := range lists {
+		for _, taint := range taints {
+			id := taint.Key + ":" + taint.Effect
+			if i, ok := index[id]; ok {
+				merged[i] = taint
+				continue
+			}
+			index[id] = len(merged)
+			merged = append(merged, taint)
+		}
+	}
+	return merged
+}
+
+// FormatLabels returns the given labels in the comma separated key=value format of the kubelet --node-labels option,
+// sorted by key so that the kubelet arguments do not change between runs
+func FormatLabels(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	formatted := make([]string, 0, len(labels))
+	for _, key := range keys {
+		formatted = append(formatted, key+"="+labels[key])
+	}
+	return strings.Join(formatted, ",")
+}
+
+// FormatTaints returns the given taints in the comma separated format of the kubelet --register-with-taints option
+func FormatTaints(taints []config.Taint) string {
+	formatted := make([]string, 0, len(taints))
+	for _, taint := range taints {
+		formatted = append(formatted, taint.String())
+	}
+	return strings.Join(formatted, ",")
+}
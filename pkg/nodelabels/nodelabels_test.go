@@ -0,0 +1,66 @@
+package nodelabels
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/config"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/osinfo"
+)
+
+// TestWindows tests the labels describing the Windows version of the host
+func TestWindows(t *testing.T) {
+	assert.Equal(t, map[string]string{
+		WindowsBuildLabel:   "10.0.17763",
+		WindowsVersionLabel: "1809",
+		WindowsEditionLabel: "ServerDatacenter",
+	}, Windows(osinfo.Info{Build: 17763, UBR: 1432, ReleaseID: "1809", ProductName: "Windows Server 2019 Datacenter",
+		EditionID: "ServerDatacenter"}))
+
+	assert.Equal(t, map[string]string{WindowsBuildLabel: "10.0.19041"},
+		Windows(osinfo.Info{Build: 19041, EditionID: "Server Datacenter"}))
+}
+
+// TestParseLabels tests parsing the labels of the kubelet unit of the ignition
+func TestParseLabels(t *testing.T) {
+	labels, skipped := ParseLabels("node-role.kubernetes.io/worker,node.openshift.io/os_id=${ID}, pool=gpu,")
+	assert.Equal(t, map[string]string{"node-role.kubernetes.io/worker": "", "pool": "gpu"}, labels)
+	assert.Equal(t, []string{"node.openshift.io/os_id=${ID}"}, skipped)
+
+	labels, skipped = ParseLabels("")
+	assert.Empty(t, labels)
+	assert.Empty(t, skipped)
+}
+
+// TestParseTaints tests parsing the taints of the kubelet unit of the ignition
+func TestParseTaints(t *testing.T) {
+	taints, skipped := ParseTaints("node-role.kubernetes.io/master:NoSchedule,os=Windows:NoSchedule,bad")
+	assert.Equal(t, []config.Taint{{Key: "node-role.kubernetes.io/master", Effect: "NoSchedule"},
+		{Key: "os", Value: "Windows", Effect: "NoSchedule"}}, taints)
+	assert.Equal(t, []string{"bad"}, skipped)
+}
+
+// TestMerge tests that labels and taints are merged without duplicates, the later ones taking precedence
+func TestMerge(t *testing.T) {
+	labels := MergeLabels(
+		map[string]string{"node-role.kubernetes.io/worker": "", "pool": "default"},
+		map[string]string{WindowsBuildLabel: "10.0.17763"},
+		map[string]string{"pool": "gpu"},
+	)
+	assert.Equal(t, map[string]string{"node-role.kubernetes.io/worker": "", "pool": "gpu",
+		WindowsBuildLabel: "10.0.17763"}, labels)
+	assert.Equal(t, "node-role.kubernetes.io/worker=,node.kubernetes.io/windows-build=10.0.17763,pool=gpu",
+		FormatLabels(labels))
+
+	taints := MergeTaints(
+		[]config.Taint{{Key: "os", Value: "Windows", Effect: "NoSchedule"}},
+		[]config.Taint{{Key: "dedicated", Value: "gpu", Effect: "NoExecute"},
+			{Key: "os", Value: "windows", Effect: "NoSchedule"}, {Key: "os", Value: "Windows", Effect: "NoExecute"}},
+	)
+	assert.Equal(t, []config.Taint{{Key: "os", Value: "windows", Effect: "NoSchedule"},
+		{Key: "dedicated", Value: "gpu", Effect: "NoExecute"}, {Key: "os", Value: "Windows", Effect: "NoExecute"}},
+		taints)
+	assert.Equal(t, "os=windows:NoSchedule,dedicated=gpu:NoExecute,os=Windows:NoExecute", FormatTaints(taints))
+	assert.Empty(t, MergeTaints(nil, nil))
+}
@@ -0,0 +1,42 @@
+package nodesizing
+
+import (
+	"fmt"
+	"runtime"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	// kernel32 exposes the memory status of the host
+	kernel32                 = windows.NewLazySystemDLL("kernel32.dll")
+	procGlobalMemoryStatusEx = kernel32.NewProc("GlobalMemoryStatusEx")
+)
+
+// memoryStatusEx is the MEMORYSTATUSEX structure filled in by GlobalMemoryStatusEx
+type memoryStatusEx struct {
+	length               uint32
+	memoryLoad           uint32
+	totalPhys            uint64
+	availPhys            uint64
+	totalPageFile        uint64
+	availPageFile        uint64
+	totalVirtual         uint64
+	availVirtual         uint64
+	availExtendedVirtual uint64
+}
+
+// NodeHost is the Host backed by the Windows API of the host it runs on
+type NodeHost struct{}
+
+// Capacity returns the total physical memory and the number of logical processors of the host
+func (NodeHost) Capacity() (Capacity, error) {
+	status := memoryStatusEx{}
+	status.length = uint32(unsafe.Sizeof(status))
+	ret, _, err := procGlobalMemoryStatusEx.Call(uintptr(unsafe.Pointer(&status)))
+	if ret == 0 {
+		return Capacity{}, fmt.Errorf("GlobalMemoryStatusEx failed: %v", err)
+	}
+	return Capacity{MemoryBytes: int64(status.totalPhys), CPUs: int64(runtime.NumCPU())}, nil
+}
@@ -0,0 +1,273 @@
+package nodesizing
+
+import (
+	"fmt"
+	"sort"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// Resource names understood in reservations
+const (
+	CPU              = "cpu"
+	Memory           = "memory"
+	EphemeralStorage = "ephemeral-storage"
+)
+
+const (
+	// mi is the number of bytes in a MiB
+	mi = 1024 * 1024
+	// gi is the number of bytes in a GiB
+	gi = 1024 * mi
+	// minEvictionMemory is the smallest hard eviction threshold for memory
+	minEvictionMemory = 100 * mi
+	// nodeFSEviction is the hard eviction threshold for the node filesystem
+	nodeFSEviction = "10%"
+)
+
+// memoryTiers are the tiers of the memory reservation: percent of the memory up to the given number of bytes
+var memoryTiers = []struct {
+	upTo    int64
+	percent int64
+}{
+	{4 * gi, 25},
+	{8 * gi, 20},
+	{16 * gi, 10},
+	{128 * gi, 6},
+	{-1, 2},
+}
+
+// cpuTiers are the tiers of the CPU reservation: tenths of a millicore reserved per core, for cores up to the given
+// count
+var cpuTiers = []struct {
+	upTo        int64
+	tenthsMilli int64
+}{
+	{1, 600},
+	{2, 100},
+	{4, 50},
+	{-1, 25},
+}
+
+// Capacity is the total amount of resources of a node
+type Capacity struct {
+	// MemoryBytes is the total physical memory
+	MemoryBytes int64
+	// CPUs is the number of logical processors
+	CPUs int64
+}
+
+// Host returns the capacity of the node
+type Host interface {
+	// Capacity returns the total memory and the number of logical processors of the node
+	Capacity() (Capacity, error)
+}
+
+// Static is a Host with a fixed capacity. It is used when the capacity is known upfront and in tests.
+type Static Capacity
+
+// Capacity returns the fixed capacity
+func (s Static) Capacity() (Capacity, error) {
+	return Capacity(s), nil
+}
+
+// Options configures how the reservation is computed. Quantities are given in the Kubernetes resource format, for
+// example 500m or 1Gi.
+type Options struct {
+	// Auto computes the reservation from the capacity of the node. The fixed 500m CPU, 1Gi memory and 1Gi ephemeral
+	// storage are reserved otherwise.
+	Auto bool
+	// Min is the smallest computed reservation, keyed by resource name
+	Min map[string]string
+	// Max is the largest computed reservation, keyed by resource name
+	Max map[string]string
+	// Override replaces the systemReserved amount of the given resources
+	Override map[string]string
+	// KubeReservedPercent is the share of the computed CPU and memory reservation that is set as kubeReserved instead
+	// of systemReserved
+	KubeReservedPercent int64
+	// EvictionHard sets the hard eviction thresholds based on the memory of the node
+	EvictionHard bool
+}
+
+// Reservation holds the kubelet config fields that set aside resources for the node
+type Reservation struct {
+	// SystemReserved is the systemReserved kubelet config field
+	SystemReserved map[string]string
+	// KubeReserved is the kubeReserved kubelet config field, empty if nothing is reserved for Kubernetes components
+	KubeReserved map[string]string
+	// EvictionHard is the evictionHard kubelet config field, empty if the kubelet defaults should be used
+	EvictionHard map[string]string
+}
+
+// Compute returns the reservation for the node described by the given host. The automatic reservation follows the
+// tiered formula of the OpenShift node sizing:
+//   - memory: 25% of the first 4GiB, 20% of the next 4GiB, 10% of the next 8GiB, 6% of the next 112GiB and 2% of
+//     anything above 128GiB
+//   - CPU: 6% of the first core, 1% of the second core, 0.5% of the next 2 cores and 0.25% of any remaining cores
+//   - ephemeral storage: the fixed 1Gi
+//
+// A node with 2 cores and 8GiB of memory therefore reserves 70m CPU and 1843Mi of memory, and a node with 16 cores and
+// 64GiB of memory reserves 110m CPU and 5611Mi of memory. The result is clamped to the minimum and maximum, the
+// kubeReserved share is split off and the overrides are applied last. The hard eviction threshold for memory is 1% of
+// the memory of the node, with a minimum of 100Mi.
+func Compute(host Host, opts Options) (Reservation, error) {
+	if opts.KubeReservedPercent < 0 || opts.KubeReservedPercent > 100 {
+		return Reservation{}, fmt.Errorf("kube reserved percent must be between 0 and 100")
+	}
+
+	reserved := map[string]*resource.Quantity{
+		CPU:              resource.NewMilliQuantity(500, resource.DecimalSI),
+		Memory:           resource.NewQuantity(gi, resource.BinarySI),
+		EphemeralStorage: resource.NewQuantity(gi, resource.BinarySI),
+	}
+	var capacity Capacity
+	if opts.Auto || opts.EvictionHard {
+		var err error
+		if capacity, err = host.Capacity(); err != nil {
+			return Reservation{}, fmt.Errorf("unable to determine node capacity: %v", err)
+		}
+		if capacity.MemoryBytes <= 0 || capacity.CPUs <= 0 {
+			return Reservation{}, fmt.Errorf("invalid node capacity: %d bytes of memory and %d CPUs",
+				capacity.MemoryBytes, capacity.CPUs)
+		}
+	}
+	if opts.Auto {
+		reserved[CPU] = resource.NewMilliQuantity(cpuReservation(capacity.CPUs), resource.DecimalSI)
+		reserved[Memory] = resource.NewQuantity(memoryReservation(capacity.MemoryBytes), resource.BinarySI)
+	}
+
+	if err := clamp(reserved, opts.Min, opts.Max); err != nil {
+		return Reservation{}, err
+	}
+
+	var reservation Reservation
+	if opts.KubeReservedPercent > 0 {
+		reservation.KubeReserved = make(map[string]string)
+		kubeCPU := reserved[CPU].MilliValue() * opts.KubeReservedPercent / 100
+		reservation.KubeReserved[CPU] = resource.NewMilliQuantity(kubeCPU, resource.DecimalSI).String()
+		reserved[CPU] = resource.NewMilliQuantity(reserved[CPU].MilliValue()-kubeCPU, resource.DecimalSI)
+		kubeMemory := roundToMi(reserved[Memory].Value() * opts.KubeReservedPercent / 100)
+		reservation.KubeReserved[Memory] = resource.NewQuantity(kubeMemory, resource.BinarySI).String()
+		reserved[Memory] = resource.NewQuantity(reserved[Memory].Value()-kubeMemory, resource.BinarySI)
+	}
+
+	overrides, err := parseQuantities(opts.Override)
+	if err != nil {
+		return Reservation{}, fmt.Errorf("invalid override: %v", err)
+	}
+	for name, quantity := range overrides {
+		reserved[name] = quantity
+	}
+
+	reservation.SystemReserved = make(map[string]string)
+	for name, quantity := range reserved {
+		reservation.SystemReserved[name] = quantity.String()
+	}
+
+	if opts.EvictionHard {
+		evictionMemory := roundToMi(capacity.MemoryBytes / 100)
+		if evictionMemory < minEvictionMemory {
+			evictionMemory = minEvictionMemory
+		}
+		reservation.EvictionHard = map[string]string{
+			"memory.available": resource.NewQuantity(evictionMemory, resource.BinarySI).String(),
+			"nodefs.available": nodeFSEviction,
+		}
+	}
+	return reservation, nil
+}
+
+// memoryReservation returns the number of bytes of memory reserved on a node with the given memory, rounded down to
+// the MiB
+func memoryReservation(memoryBytes int64) int64 {
+	var reserved, previous int64
+	for _, tier := range memoryTiers {
+		upTo := tier.upTo
+		if upTo < 0 || upTo > memoryBytes {
+			upTo = memoryBytes
+		}
+		if upTo <= previous {
+			break
+		}
+		reserved += (upTo - previous) * tier.percent / 100
+		previous = upTo
+	}
+	return roundToMi(reserved)
+}
+
+// cpuReservation returns the number of millicores reserved on a node with the given number of cores, rounded up
+func cpuReservation(cpus int64) int64 {
+	var tenthsMilli, previous int64
+	for _, tier := range cpuTiers {
+		upTo := tier.upTo
+		if upTo < 0 || upTo > cpus {
+			upTo = cpus
+		}
+		if upTo <= previous {
+			break
+		}
+		tenthsMilli += (upTo - previous) * tier.tenthsMilli
+		previous = upTo
+	}
+	return (tenthsMilli + 9) / 10
+}
+
+// clamp bounds the given reservation by the given minimum and maximum
+func clamp(reserved map[string]*resource.Quantity, min, max map[string]string) error {
+	minQuantities, err := parseQuantities(min)
+	if err != nil {
+		return fmt.Errorf("invalid minimum: %v", err)
+	}
+	maxQuantities, err := parseQuantities(max)
+	if err != nil {
+		return fmt.Errorf("invalid maximum: %v", err)
+	}
+	for name, minQuantity := range minQuantities {
+		if maxQuantity, ok := maxQuantities[name]; ok && minQuantity.Cmp(*maxQuantity) > 0 {
+			return fmt.Errorf("minimum %s %s is larger than the maximum %s", name, minQuantity, maxQuantity)
+		}
+		if reserved[name].Cmp(*minQuantity) < 0 {
+			reserved[name] = minQuantity
+		}
+	}
+	for name, maxQuantity := range maxQuantities {
+		if reserved[name].Cmp(*maxQuantity) > 0 {
+			reserved[name] = maxQuantity
+		}
+	}
+	return nil
+}
+
+// parseQuantities parses the given quantities keyed by resource name
+func parseQuantities(values map[string]string) (map[string]*resource.Quantity, error) {
+	quantities := make(map[string]*resource.Quantity)
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	// Sort the names so that the first invalid entry is always the one reported
+	sort.Strings(names)
+	for _, name := range names {
+		switch name {
+		case CPU, Memory, EphemeralStorage:
+		default:
+			return nil, fmt.Errorf("unknown resource %q, must be one of %s, %s or %s", name, CPU, Memory,
+				EphemeralStorage)
+		}
+		quantity, err := resource.ParseQuantity(values[name])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+		if quantity.Sign() < 0 {
+			return nil, fmt.Errorf("%s must not be negative", name)
+		}
+		quantities[name] = &quantity
+	}
+	return quantities, nil
+}
+
+// roundToMi rounds the given number of bytes down to the MiB
+func roundToMi(bytes int64) int64 {
+	return bytes / mi * mi
+}
@@ -0,0 +1,155 @@
+package nodesizing
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeHost is a Host with a fixed capacity
+type fakeHost struct {
+	capacity Capacity
+	err      error
+}
+
+func (h fakeHost) Capacity() (Capacity, error) {
+	return h.capacity, h.err
+}
+
+// TestCompute tests sizing the reservation for nodes of different sizes
+func TestCompute(t *testing.T) {
+	tests := []struct {
+		name     string
+		host     Host
+		opts     Options
+		expected Reservation
+		errMsg   string
+	}{
+		{
+			name: "fixed",
+			host: fakeHost{err: fmt.Errorf("host must not be queried")},
+			expected: Reservation{
+				SystemReserved: map[string]string{CPU: "500m", Memory: "1Gi", EphemeralStorage: "1Gi"},
+			},
+		},
+		{
+			name: "auto small node",
+			host: fakeHost{capacity: Capacity{MemoryBytes: 4 * gi, CPUs: 2}},
+			opts: Options{Auto: true},
+			expected: Reservation{
+				SystemReserved: map[string]string{CPU: "70m", Memory: "1Gi", EphemeralStorage: "1Gi"},
+			},
+		},
+		{
+			name: "auto medium node",
+			host: fakeHost{capacity: Capacity{MemoryBytes: 8 * gi, CPUs: 2}},
+			opts: Options{Auto: true},
+			expected: Reservation{
+				SystemReserved: map[string]string{CPU: "70m", Memory: "1843Mi", EphemeralStorage: "1Gi"},
+			},
+		},
+		{
+			name: "auto large node",
+			host: fakeHost{capacity: Capacity{MemoryBytes: 64 * gi, CPUs: 16}},
+			opts: Options{Auto: true},
+			expected: Reservation{
+				SystemReserved: map[string]string{CPU: "110m", Memory: "5611Mi", EphemeralStorage: "1Gi"},
+			},
+		},
+		{
+			name: "auto very large node",
+			host: fakeHost{capacity: Capacity{MemoryBytes: 256 * gi, CPUs: 64}},
+			opts: Options{Auto: true},
+			expected: Reservation{
+				SystemReserved: map[string]string{CPU: "230m", Memory: "12165Mi", EphemeralStorage: "1Gi"},
+			},
+		},
+		{
+			name: "clamped",
+			host: fakeHost{capacity: Capacity{MemoryBytes: 64 * gi, CPUs: 16}},
+			opts: Options{Auto: true, Min: map[string]string{CPU: "500m"}, Max: map[string]string{Memory: "4Gi"}},
+			expected: Reservation{
+				SystemReserved: map[string]string{CPU: "500m", Memory: "4Gi", EphemeralStorage: "1Gi"},
+			},
+		},
+		{
+			name: "overridden",
+			host: fakeHost{capacity: Capacity{MemoryBytes: 64 * gi, CPUs: 16}},
+			opts: Options{Auto: true, Max: map[string]string{Memory: "4Gi"},
+				Override: map[string]string{Memory: "6Gi", EphemeralStorage: "10Gi"}},
+			expected: Reservation{
+				SystemReserved: map[string]string{CPU: "110m", Memory: "6Gi", EphemeralStorage: "10Gi"},
+			},
+		},
+		{
+			name: "kube reserved and eviction",
+			host: fakeHost{capacity: Capacity{MemoryBytes: 16 * gi, CPUs: 4}},
+			opts: Options{Auto: true, KubeReservedPercent: 25, EvictionHard: true},
+			expected: Reservation{
+				SystemReserved: map[string]string{CPU: "60m", Memory: "1997Mi", EphemeralStorage: "1Gi"},
+				KubeReserved:   map[string]string{CPU: "20m", Memory: "665Mi"},
+				EvictionHard:   map[string]string{"memory.available": "163Mi", "nodefs.available": "10%"},
+			},
+		},
+		{
+			name: "minimum eviction threshold",
+			host: fakeHost{capacity: Capacity{MemoryBytes: 4 * gi, CPUs: 2}},
+			opts: Options{EvictionHard: true},
+			expected: Reservation{
+				SystemReserved: map[string]string{CPU: "500m", Memory: "1Gi", EphemeralStorage: "1Gi"},
+				EvictionHard:   map[string]string{"memory.available": "100Mi", "nodefs.available": "10%"},
+			},
+		},
+		{
+			name:   "capacity unavailable",
+			host:   fakeHost{err: fmt.Errorf("access denied")},
+			opts:   Options{Auto: true},
+			errMsg: "access denied",
+		},
+		{
+			name:   "invalid capacity",
+			host:   fakeHost{capacity: Capacity{MemoryBytes: 4 * gi}},
+			opts:   Options{Auto: true},
+			errMsg: "invalid node capacity",
+		},
+		{
+			name:   "unknown resource",
+			host:   fakeHost{},
+			opts:   Options{Override: map[string]string{"gpu": "1"}},
+			errMsg: "unknown resource \"gpu\"",
+		},
+		{
+			name:   "invalid quantity",
+			host:   fakeHost{},
+			opts:   Options{Min: map[string]string{Memory: "lots"}},
+			errMsg: "invalid minimum: memory",
+		},
+		{
+			name:   "minimum above maximum",
+			host:   fakeHost{},
+			opts:   Options{Min: map[string]string{CPU: "2"}, Max: map[string]string{CPU: "1"}},
+			errMsg: "larger than the maximum",
+		},
+		{
+			name:   "invalid kube reserved percent",
+			host:   fakeHost{},
+			opts:   Options{KubeReservedPercent: 101},
+			errMsg: "must be between 0 and 100",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			reservation, err := Compute(test.host, test.opts)
+			if test.errMsg != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), test.errMsg)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, reservation)
+		})
+	}
+}
@@ -0,0 +1,36 @@
+package osinfo
+
+import "fmt"
+
+// Info describes the Windows version of a host
+type Info struct {
+	// Build is the OS build number, for example 17763 for Windows Server 2019
+	Build int
+	// UBR is the update build revision, which is incremented by cumulative updates
+	UBR int
+	// ReleaseID is the Windows release, for example 1809
+	ReleaseID string
+	// ProductName is the marketing name of the OS, for example Windows Server 2019 Datacenter
+	ProductName string
+	// EditionID is the edition of the OS, for example ServerDatacenter
+	EditionID string
+}
+
+// Provider returns information about the OS of the host
+type Provider interface {
+	// OSInfo returns the Windows version of the host
+	OSInfo() (Info, error)
+}
+
+// Version returns the full build version of the OS, for example 10.0.17763.1432
+func (i Info) Version() string {
+	return fmt.Sprintf("10.0.%d.%d", i.Build, i.UBR)
+}
+
+// Static is a Provider that returns fixed information. It is used when the information is known upfront and in tests.
+type Static Info
+
+// OSInfo returns the fixed information
+func (s Static) OSInfo() (Info, error) {
+	return Info(s), nil
+}
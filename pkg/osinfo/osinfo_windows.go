@@ -0,0 +1,42 @@
+package osinfo
+
+import (
+	"fmt"
+	"strconv"
+
+	"golang.org/x/sys/windows/registry"
+)
+
+// currentVersionKey is the registry key holding the Windows version information
+const currentVersionKey = `SOFTWARE\Microsoft\Windows NT\CurrentVersion`
+
+// Host is the Provider that reads the Windows version of the host it runs on from the registry
+type Host struct{}
+
+// OSInfo returns the Windows version of the host
+func (Host) OSInfo() (Info, error) {
+	key, err := registry.OpenKey(registry.LOCAL_MACHINE, currentVersionKey, registry.QUERY_VALUE)
+	if err != nil {
+		return Info{}, fmt.Errorf("unable to open registry key %s: %v", currentVersionKey, err)
+	}
+	defer key.Close()
+
+	buildNumber, _, err := key.GetStringValue("CurrentBuildNumber")
+	if err != nil {
+		return Info{}, fmt.Errorf("unable to read CurrentBuildNumber: %v", err)
+	}
+	build, err := strconv.Atoi(buildNumber)
+	if err != nil {
+		return Info{}, fmt.Errorf("invalid CurrentBuildNumber %q: %v", buildNumber, err)
+	}
+	info := Info{Build: build}
+
+	// The remaining values are informational, and not all of them are present on every Windows version
+	if ubr, _, err := key.GetIntegerValue("UBR"); err == nil {
+		info.UBR = int(ubr)
+	}
+	info.ReleaseID, _, _ = key.GetStringValue("ReleaseId")
+	info.ProductName, _, _ = key.GetStringValue("ProductName")
+	info.EditionID, _, _ = key.GetStringValue("EditionID")
+	return info, nil
+}
@@ -0,0 +1,96 @@
+package pauseimage
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"github.com/go-logr/logr"
+	"gopkg.in/yaml.v2"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/osinfo"
+)
+
+// DefaultImage is the pause image used on Windows builds the manifest has no entry for
+const DefaultImage = "mcr.microsoft.com/oss/kubernetes/pause:1.3.0"
+
+// Manifest maps Windows builds to the pause image matching them. Process isolated Windows containers can only run
+// images built for the same Windows build as the host, so the pause image has to be picked based on the host build.
+type Manifest struct {
+	// Images lists the pause image to use for each supported Windows build
+	Images []Entry `yaml:"images"`
+}
+
+// Entry associates a Windows build with a pause image
+type Entry struct {
+	// Build is the Windows build number, for example 17763
+	Build int `yaml:"build"`
+	// Image is the pause image for the build
+	Image string `yaml:"image"`
+}
+
+// DefaultManifest returns the manifest used when none is given. The 1.4.1 image is a manifest list covering the
+// semi-annual channel releases.
+func DefaultManifest() Manifest {
+	return Manifest{
+		Images: []Entry{
+			// Windows Server 2019 / 1809
+			{Build: 17763, Image: "mcr.microsoft.com/oss/kubernetes/pause:1.3.0"},
+			// 1903
+			{Build: 18362, Image: "mcr.microsoft.com/oss/kubernetes/pause:1.4.1"},
+			// 1909
+			{Build: 18363, Image: "mcr.microsoft.com/oss/kubernetes/pause:1.4.1"},
+			// 2004
+			{Build: 19041, Image: "mcr.microsoft.com/oss/kubernetes/pause:1.4.1"},
+			// 20H2
+			{Build: 19042, Image: "mcr.microsoft.com/oss/kubernetes/pause:1.4.1"},
+		},
+	}
+}
+
+// LoadManifest reads a manifest from the given YAML file
+func LoadManifest(path string) (Manifest, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return Manifest{}, fmt.Errorf("error reading pause image manifest %s: %v", path, err)
+	}
+	var manifest Manifest
+	if err = yaml.UnmarshalStrict(contents, &manifest); err != nil {
+		return Manifest{}, fmt.Errorf("error parsing pause image manifest %s: %v", path, err)
+	}
+	for _, entry := range manifest.Images {
+		if entry.Build <= 0 || entry.Image == "" {
+			return Manifest{}, fmt.Errorf("invalid pause image manifest %s: every entry needs a build and an image",
+				path)
+		}
+	}
+	return manifest, nil
+}
+
+// Image returns the pause image for the given Windows build, and false if the manifest has no entry for the build
+func (m Manifest) Image(build int) (string, bool) {
+	for _, entry := range m.Images {
+		if entry.Build == build {
+			return entry.Image, true
+		}
+	}
+	return "", false
+}
+
+// Resolve returns the pause image to use on the host described by the given provider. The override is returned as is
+// if it is set, otherwise the image matching the host build is picked from the manifest. DefaultImage is returned, and
+// a warning logged, if the manifest has no entry for the host build.
+func Resolve(provider osinfo.Provider, manifest Manifest, override string, log logr.Logger) (string, error) {
+	if override != "" {
+		return override, nil
+	}
+	info, err := provider.OSInfo()
+	if err != nil {
+		return "", fmt.Errorf("unable to determine the Windows build: %v", err)
+	}
+	if image, ok := manifest.Image(info.Build); ok {
+		return image, nil
+	}
+	log.Info("warning: no pause image known for the Windows build, using the default pause image", "build",
+		info.Build, "image", DefaultImage)
+	return DefaultImage, nil
+}
@@ -0,0 +1,101 @@
+package pauseimage
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	crlog "sigs.k8s.io/controller-runtime/pkg/log"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/osinfo"
+)
+
+// failingProvider is an osinfo.Provider that cannot determine the OS information
+type failingProvider struct{}
+
+func (failingProvider) OSInfo() (osinfo.Info, error) {
+	return osinfo.Info{}, fmt.Errorf("registry unavailable")
+}
+
+// TestResolve tests picking the pause image for the host build
+func TestResolve(t *testing.T) {
+	tests := []struct {
+		name     string
+		provider osinfo.Provider
+		override string
+		expected string
+		errMsg   string
+	}{
+		{
+			name:     "Windows Server 2019",
+			provider: osinfo.Static{Build: 17763},
+			expected: "mcr.microsoft.com/oss/kubernetes/pause:1.3.0",
+		},
+		{
+			name:     "2004",
+			provider: osinfo.Static{Build: 19041},
+			expected: "mcr.microsoft.com/oss/kubernetes/pause:1.4.1",
+		},
+		{
+			name:     "unknown build",
+			provider: osinfo.Static{Build: 20348},
+			expected: DefaultImage,
+		},
+		{
+			name:     "override",
+			provider: failingProvider{},
+			override: "registry.example.com/pause:custom",
+			expected: "registry.example.com/pause:custom",
+		},
+		{
+			name:     "OS info unavailable",
+			provider: failingProvider{},
+			errMsg:   "registry unavailable",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			image, err := Resolve(test.provider, DefaultManifest(), test.override, crlog.NullLogger{})
+			if test.errMsg != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), test.errMsg)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, image)
+		})
+	}
+}
+
+// TestLoadManifest tests reading a pause image manifest from a file
+func TestLoadManifest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pauseimage")
+	require.NoError(t, err, "error creating temp directory")
+	// Ignore the return error as there is not much we can do if the temporary directory is not deleted
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "manifest.yaml")
+
+	require.NoError(t, ioutil.WriteFile(path, []byte(`
+images:
+- build: 17763
+  image: registry.example.com/pause:1809
+`), 0644))
+	manifest, err := LoadManifest(path)
+	require.NoError(t, err)
+	image, err := Resolve(osinfo.Static{Build: 17763}, manifest, "", crlog.NullLogger{})
+	require.NoError(t, err)
+	assert.Equal(t, "registry.example.com/pause:1809", image)
+
+	require.NoError(t, ioutil.WriteFile(path, []byte("images:\n- build: 17763\n"), 0644))
+	_, err = LoadManifest(path)
+	require.Error(t, err, "no error returned for an entry without an image")
+
+	require.NoError(t, ioutil.WriteFile(path, []byte("imagez: []\n"), 0644))
+	_, err = LoadManifest(path)
+	require.Error(t, err, "no error returned for an unknown field")
+}
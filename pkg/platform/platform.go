@@ -0,0 +1,154 @@
+package platform
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const (
+	// CloudProviderOption is the kubelet flag selecting the cloud provider
+	CloudProviderOption = "cloud-provider"
+	// CloudConfigOption is the kubelet flag pointing to the cloud provider configuration
+	CloudConfigOption = "cloud-config"
+)
+
+// unitFlagRegex matches the --name=value flags of a systemd unit. Quoted values may contain spaces.
+var unitFlagRegex = regexp.MustCompile(`--([A-Za-z0-9-]+)=("[^"]*"|\S*)`)
+
+// TransformFunc changes the contents of an ignition file for use on Windows
+type TransformFunc func([]byte) ([]byte, error)
+
+// File is an ignition file a platform needs on the node
+type File struct {
+	// Source is the path of the file in the ignition
+	Source string
+	// Dest is where the file is written on the node
+	Dest string
+	// Transform changes the contents of the file for use on Windows. The contents are written as is if it is nil.
+	Transform TransformFunc
+}
+
+// Input is what a Handler derives the node configuration from
+type Input struct {
+	// UnitFlags are the flags of the kubelet systemd unit in the ignition, keyed by name without the leading dashes
+	UnitFlags map[string]string
+	// InstallDir is the directory the kubelet is installed in
+	InstallDir string
+	// ReadFile returns the decoded contents of the ignition file with the given path, and false if the ignition does
+	// not contain it
+	ReadFile func(path string) ([]byte, bool, error)
+}
+
+// Handler adapts the cloud provider configuration of the Linux worker ignition to a Windows node
+type Handler interface {
+	// Files returns the ignition files the platform needs on the node
+	Files(in Input) ([]File, error)
+	// KubeletArgs returns the kubelet flags the platform needs, keyed by name without the leading dashes. They are
+	// added to the kubelet command line, replacing any value already set.
+	KubeletArgs(in Input) (map[string]string, error)
+}
+
+// handlers maps the --cloud-provider values to the handler of the platform
+var handlers = map[string]Handler{
+	"":         noneHandler{},
+	"none":     noneHandler{},
+	"external": externalHandler{},
+	"aws":      cloudConfigHandler{provider: "aws"},
+	"azure":    cloudConfigHandler{provider: "azure"},
+	"gce":      cloudConfigHandler{provider: "gce"},
+	"vsphere":  vsphereHandler{},
+}
+
+// Lookup returns the handler for the given --cloud-provider value. The cloud provider and cloud config of a platform
+// without a handler of its own, such as openstack, are passed through to the kubelet as is.
+func Lookup(cloudProvider string) Handler {
+	if handler, ok := handlers[cloudProvider]; ok {
+		return handler
+	}
+	return cloudConfigHandler{provider: cloudProvider}
+}
+
+// ParseUnitFlags returns the --name=value flags found in the given systemd unit contents, keyed by name. If a flag is
+// given more than once, the last value wins, as it does for the kubelet.
+func ParseUnitFlags(contents string) map[string]string {
+	flags := make(map[string]string)
+	for _, match := range unitFlagRegex.FindAllStringSubmatch(contents, -1) {
+		flags[match[1]] = strings.Trim(match[2], `"`)
+	}
+	return flags
+}
+
+// cloudConfigFile returns the file given to the kubelet with --cloud-config in the ignition, along with where it is
+// written on the node. ok is false if the flag is not set.
+func cloudConfigFile(in Input) (source string, dest string, ok bool, err error) {
+	source, ok = in.UnitFlags[CloudConfigOption]
+	if !ok {
+		return "", "", false, nil
+	}
+	// The ignition is meant for Linux workers, so the path uses forward slashes whatever OS WMCB runs on
+	base := source[strings.LastIndex(source, "/")+1:]
+	// Check if we were able to get a valid filename
+	if base == "" || base == "." || base == ".." || os.IsPathSeparator(base[0]) {
+		return "", "", false, fmt.Errorf("could not get cloud config filename from --%s=%s", CloudConfigOption,
+			source)
+	}
+	return source, filepath.Join(in.InstallDir, base), true, nil
+}
+
+// noneHandler is the handler of nodes without a cloud provider, like bare metal nodes
+type noneHandler struct{}
+
+// Files returns no files, as there is no cloud provider to configure
+func (noneHandler) Files(Input) ([]File, error) {
+	return nil, nil
+}
+
+// KubeletArgs returns no kubelet flags, so that the kubelet runs without a cloud provider
+func (noneHandler) KubeletArgs(Input) (map[string]string, error) {
+	return nil, nil
+}
+
+// externalHandler is the handler of nodes whose cloud provider integration runs out of tree
+type externalHandler struct{}
+
+// Files returns no files, as the kubelet does not read the cloud config of an external cloud provider
+func (externalHandler) Files(Input) ([]File, error) {
+	return nil, nil
+}
+
+// KubeletArgs tells the kubelet to wait for the external cloud provider to initialize the node
+func (externalHandler) KubeletArgs(Input) (map[string]string, error) {
+	return map[string]string{CloudProviderOption: "external"}, nil
+}
+
+// cloudConfigHandler is the handler of in-tree cloud providers whose cloud config can be used on Windows as is, and of
+// the cloud providers without a handler of their own
+type cloudConfigHandler struct {
+	// provider is the --cloud-provider value
+	provider string
+}
+
+// Files returns the cloud config, if the kubelet is given one
+func (h cloudConfigHandler) Files(in Input) ([]File, error) {
+	source, dest, ok, err := cloudConfigFile(in)
+	if err != nil || !ok {
+		return nil, err
+	}
+	return []File{{Source: source, Dest: dest}}, nil
+}
+
+// KubeletArgs sets the cloud provider and, if the kubelet is given one, the cloud config on the node
+func (h cloudConfigHandler) KubeletArgs(in Input) (map[string]string, error) {
+	args := map[string]string{CloudProviderOption: h.provider}
+	_, dest, ok, err := cloudConfigFile(in)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		args[CloudConfigOption] = dest
+	}
+	return args, nil
+}
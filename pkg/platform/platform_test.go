@@ -0,0 +1,181 @@
+package platform
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// kubeletUnit is the ExecStart of a Linux worker kubelet unit with the given cloud flags
+func kubeletUnit(cloudFlags string) string {
+	return "ExecStart=/usr/bin/hyperkube \\\n    kubelet \\\n      --config=/etc/kubernetes/kubelet.conf \\\n" +
+		"      --node-labels=node-role.kubernetes.io/worker,node.openshift.io/os_id=${ID} \\\n" + cloudFlags +
+		"      --v=3\n"
+}
+
+// ignitionFiles returns a ReadFile function serving the given files
+func ignitionFiles(files map[string]string) func(string) ([]byte, bool, error) {
+	return func(path string) ([]byte, bool, error) {
+		contents, ok := files[path]
+		return []byte(contents), ok, nil
+	}
+}
+
+// TestParseUnitFlags tests extracting the flags of a kubelet systemd unit
+func TestParseUnitFlags(t *testing.T) {
+	flags := ParseUnitFlags(kubeletUnit(
+		"      --cloud-provider=azure \\\n      --cloud-config=/etc/kubernetes/cloud.conf \\\n"))
+	assert.Equal(t, map[string]string{
+		"config":         "/etc/kubernetes/kubelet.conf",
+		"node-labels":    "node-role.kubernetes.io/worker,node.openshift.io/os_id=${ID}",
+		"cloud-provider": "azure",
+		"cloud-config":   "/etc/kubernetes/cloud.conf",
+		"v":              "3",
+	}, flags)
+
+	flags = ParseUnitFlags(`--cloud-provider= --v="4" --v=5`)
+	assert.Equal(t, map[string]string{"cloud-provider": "", "v": "5"}, flags)
+}
+
+// TestHandlers tests the files and kubelet flags of each platform
+func TestHandlers(t *testing.T) {
+	installDir := filepath.Join("C:", "k")
+	tests := []struct {
+		name          string
+		unit          string
+		files         map[string]string
+		expectedFiles []File
+		expectedArgs  map[string]string
+		errMsg        string
+	}{
+		{
+			name: "no cloud provider",
+			unit: kubeletUnit(""),
+		},
+		{
+			name: "none",
+			unit: kubeletUnit("      --cloud-provider=none \\\n"),
+		},
+		{
+			name: "empty cloud provider",
+			unit: kubeletUnit("      --cloud-provider= \\\n"),
+		},
+		{
+			name:         "aws",
+			unit:         kubeletUnit("      --cloud-provider=aws \\\n"),
+			expectedArgs: map[string]string{CloudProviderOption: "aws"},
+		},
+		{
+			name: "azure",
+			unit: kubeletUnit(
+				"      --cloud-provider=azure \\\n      --cloud-config=/etc/kubernetes/cloud.conf \\\n"),
+			expectedFiles: []File{{Source: "/etc/kubernetes/cloud.conf",
+				Dest: filepath.Join(installDir, "cloud.conf")}},
+			expectedArgs: map[string]string{CloudProviderOption: "azure",
+				CloudConfigOption: filepath.Join(installDir, "cloud.conf")},
+		},
+		{
+			name: "gce with a cloud config without extension",
+			unit: kubeletUnit(
+				"      --cloud-provider=gce \\\n      --cloud-config=/etc/kubernetes/cloud-config \\\n"),
+			expectedFiles: []File{{Source: "/etc/kubernetes/cloud-config",
+				Dest: filepath.Join(installDir, "cloud-config")}},
+			expectedArgs: map[string]string{CloudProviderOption: "gce",
+				CloudConfigOption: filepath.Join(installDir, "cloud-config")},
+		},
+		{
+			name:         "external",
+			unit:         kubeletUnit("      --cloud-provider=external \\\n"),
+			expectedArgs: map[string]string{CloudProviderOption: "external"},
+		},
+		{
+			name:   "invalid cloud config",
+			unit:   kubeletUnit("      --cloud-provider=azure \\\n      --cloud-config=/ \\\n"),
+			errMsg: "could not get cloud config filename",
+		},
+		{
+			name: "cloud provider without a handler",
+			unit: kubeletUnit(
+				"      --cloud-provider=openstack \\\n      --cloud-config=/etc/kubernetes/cloud.conf \\\n"),
+			expectedFiles: []File{{Source: "/etc/kubernetes/cloud.conf",
+				Dest: filepath.Join(installDir, "cloud.conf")}},
+			expectedArgs: map[string]string{CloudProviderOption: "openstack",
+				CloudConfigOption: filepath.Join(installDir, "cloud.conf")},
+		},
+		{
+			name:   "vsphere without cloud config",
+			unit:   kubeletUnit("      --cloud-provider=vsphere \\\n"),
+			errMsg: "requires --cloud-config",
+		},
+		{
+			name: "vsphere cloud config missing from ignition",
+			unit: kubeletUnit(
+				"      --cloud-provider=vsphere \\\n      --cloud-config=/etc/kubernetes/cloud.conf \\\n"),
+			errMsg: "not found in the ignition",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			in := Input{UnitFlags: ParseUnitFlags(test.unit), InstallDir: installDir,
+				ReadFile: ignitionFiles(test.files)}
+			var args map[string]string
+			handler := Lookup(in.UnitFlags[CloudProviderOption])
+			files, err := handler.Files(in)
+			if err == nil {
+				args, err = handler.KubeletArgs(in)
+			}
+			if test.errMsg != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), test.errMsg)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedFiles, files)
+			assert.Equal(t, test.expectedArgs, args)
+		})
+	}
+}
+
+// TestVSphere tests that the vSphere cloud config and the CA bundles it references are carried over to the node
+func TestVSphere(t *testing.T) {
+	installDir := `C:\k`
+	cloudConf := "[Global]\nsecret-name = \"vsphere-creds\"\nsecret-namespace = \"kube-system\"\n" +
+		"ca-file = /etc/kubernetes/static-pod-resources/vsphere-ca.pem\n\n" +
+		"[VirtualCenter \"vcenter.example.com\"]\ndatacenters = \"dc1\"\n" +
+		"ca-file = \"/etc/kubernetes/static-pod-resources/vsphere-ca.pem\"\r\n"
+	in := Input{
+		UnitFlags: ParseUnitFlags(kubeletUnit(
+			"      --cloud-provider=vsphere \\\n      --cloud-config=/etc/kubernetes/cloud.conf \\\n")),
+		InstallDir: installDir,
+		ReadFile: ignitionFiles(map[string]string{
+			"/etc/kubernetes/cloud.conf":                          cloudConf,
+			"/etc/kubernetes/static-pod-resources/vsphere-ca.pem": "ca",
+		}),
+	}
+	handler := Lookup("vsphere")
+
+	args, err := handler.KubeletArgs(in)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{CloudProviderOption: "vsphere",
+		CloudConfigOption: filepath.Join(installDir, "cloud.conf")}, args)
+
+	files, err := handler.Files(in)
+	require.NoError(t, err)
+	require.Len(t, files, 2)
+	assert.Equal(t, "/etc/kubernetes/cloud.conf", files[0].Source)
+	assert.Equal(t, File{Source: "/etc/kubernetes/static-pod-resources/vsphere-ca.pem",
+		Dest: filepath.Join(installDir, "vsphere-vsphere-ca.pem")}, files[1])
+
+	require.NotNil(t, files[0].Transform, "vsphere cloud config is not transformed")
+	transformed, err := files[0].Transform([]byte(cloudConf))
+	require.NoError(t, err)
+	caFile := `"` + strings.ReplaceAll(filepath.Join(installDir, "vsphere-vsphere-ca.pem"), `\`, `\\`) + `"`
+	assert.Equal(t, "[Global]\nsecret-name = \"vsphere-creds\"\nsecret-namespace = \"kube-system\"\n"+
+		"ca-file = "+caFile+"\n\n"+
+		"[VirtualCenter \"vcenter.example.com\"]\ndatacenters = \"dc1\"\n"+
+		"ca-file = "+caFile+"\r\n", string(transformed))
+}
@@ -0,0 +1,89 @@
+package platform
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// vsphereCAFileRegex matches the ca-file keys of the vSphere cloud config, which point to files on the Linux worker
+var vsphereCAFileRegex = regexp.MustCompile(`(?m)^([ \t]*ca-file[ \t]*=[ \t]*)("[^"\n]*"|\S+)[ \t]*(\r?)$`)
+
+// vsphereHandler is the handler of the in-tree vSphere cloud provider. The vSphere cloud config holds the vCenter
+// connection details, including the credentials when they are not read from a secret, and may point to CA bundles on
+// the Linux worker with ca-file keys. Those bundles are carried over to the node and the keys rewritten to point to
+// them.
+type vsphereHandler struct{}
+
+// Files returns the cloud config along with the CA bundles it references
+func (vsphereHandler) Files(in Input) ([]File, error) {
+	source, dest, ok, err := cloudConfigFile(in)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("the vsphere cloud provider requires --%s", CloudConfigOption)
+	}
+	files := []File{{Source: source, Dest: dest, Transform: vsphereConfTransform(in.InstallDir)}}
+
+	contents, found, err := in.ReadFile(source)
+	if err != nil {
+		return nil, fmt.Errorf("could not read %s: %v", source, err)
+	}
+	if !found {
+		return nil, fmt.Errorf("cloud config %s not found in the ignition", source)
+	}
+	for _, caFile := range vsphereCAFiles(contents) {
+		files = append(files, File{Source: caFile, Dest: vsphereCAFileDest(in.InstallDir, caFile)})
+	}
+	return files, nil
+}
+
+// KubeletArgs sets the vSphere cloud provider and the cloud config on the node
+func (vsphereHandler) KubeletArgs(in Input) (map[string]string, error) {
+	_, dest, ok, err := cloudConfigFile(in)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("the vsphere cloud provider requires --%s", CloudConfigOption)
+	}
+	return map[string]string{CloudProviderOption: "vsphere", CloudConfigOption: dest}, nil
+}
+
+// vsphereCAFiles returns the CA bundles referenced by the given vSphere cloud config
+func vsphereCAFiles(contents []byte) []string {
+	var caFiles []string
+	seen := make(map[string]bool)
+	for _, match := range vsphereCAFileRegex.FindAllSubmatch(contents, -1) {
+		caFile := strings.Trim(string(match[2]), `"`)
+		if caFile != "" && !seen[caFile] {
+			seen[caFile] = true
+			caFiles = append(caFiles, caFile)
+		}
+	}
+	return caFiles
+}
+
+// vsphereCAFileDest returns where the given CA bundle of the Linux worker is written on the node
+func vsphereCAFileDest(installDir, caFile string) string {
+	return filepath.Join(installDir, "vsphere-"+caFile[strings.LastIndex(caFile, "/")+1:])
+}
+
+// vsphereConfTransform returns the transform rewriting the ca-file keys of a vSphere cloud config to the location of
+// the CA bundles on the node
+func vsphereConfTransform(installDir string) TransformFunc {
+	return func(contents []byte) ([]byte, error) {
+		return vsphereCAFileRegex.ReplaceAllFunc(contents, func(line []byte) []byte {
+			match := vsphereCAFileRegex.FindSubmatch(line)
+			caFile := strings.Trim(string(match[2]), `"`)
+			if caFile == "" {
+				return line
+			}
+			// gcfg treats backslashes as escapes, so the backslashes of the Windows path have to be doubled
+			return []byte(string(match[1]) + `"` + strings.ReplaceAll(vsphereCAFileDest(installDir, caFile), `\`,
+				`\\`) + `"` + string(match[3]))
+		}), nil
+	}
+}
@@ -0,0 +1,309 @@
+package preflight
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"k8s.io/client-go/tools/clientcmd"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/fileutil"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/ignition"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/kubeversion"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/nodecerts"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/osinfo"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/pauseimage"
+)
+
+const (
+	// DefaultMinFreeMB is the free disk space in MB below which the disk check fails
+	DefaultMinFreeMB = 2048
+	// DefaultCAExpiryWarning is how long before the expiry of the bootstrap kubeconfig CA the ignition check warns
+	DefaultCAExpiryWarning = 30 * 24 * time.Hour
+	// kubeletServiceName is the name of the kubelet Windows service
+	kubeletServiceName = "kubelet"
+)
+
+// DefaultPorts are the kubelet ports that have to be free: the kubelet API and the healthz endpoint
+var DefaultPorts = []int{10250, 10248}
+
+// Host gives access to the state of the node the checks look at
+type Host interface {
+	// FreeDiskSpace returns the number of bytes available on the volume containing the given path
+	FreeDiskSpace(path string) (uint64, error)
+	// ServiceState returns whether the Windows service with the given name is present and whether it is running
+	ServiceState(name string) (installed, running bool, err error)
+	// PortInUse returns true if the given TCP port cannot be listened on
+	PortInUse(port int) (bool, error)
+	// HNSAvailable returns an error if the Host Networking Service cannot be reached
+	HNSAvailable() error
+	// KubeletVersion runs the kubelet binary at the given path with --version and returns its output
+	KubeletVersion(ctx context.Context, path string) (string, error)
+}
+
+// Options configures the default checks
+type Options struct {
+	// InstallDir is the directory the kubelet is installed in
+	InstallDir string
+	// MinFreeMB is the free disk space in MB required on the volume of the install directory
+	MinFreeMB uint64
+	// RuntimeService is the Windows service of the container runtime
+	RuntimeService string
+	// Ports are the TCP ports the kubelet listens on
+	Ports []int
+	// KubeletPath is the kubelet binary to check. The kubelet check is not registered if it is empty.
+	KubeletPath string
+	// KubeletVersion is the expected kubelet version. Only the kubelet is required to run if it is empty.
+	KubeletVersion string
+	// IgnitionFile is the worker ignition file to check. The ignition check is not registered if it is empty.
+	IgnitionFile string
+	// CAExpiryWarning is how long before the expiry of the bootstrap kubeconfig CA a warning is given
+	CAExpiryWarning time.Duration
+	// PauseImages lists the Windows builds with a known pause image, which are the supported builds
+	PauseImages pauseimage.Manifest
+	// Now returns the current time. time.Now is used if it is nil.
+	Now func() time.Time
+}
+
+// NewRegistry returns a registry with the default checks for the given options
+func NewRegistry(host Host, osInfo osinfo.Provider, opts Options) *Registry {
+	if opts.MinFreeMB == 0 {
+		opts.MinFreeMB = DefaultMinFreeMB
+	}
+	if opts.Ports == nil {
+		opts.Ports = DefaultPorts
+	}
+	if opts.CAExpiryWarning == 0 {
+		opts.CAExpiryWarning = DefaultCAExpiryWarning
+	}
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+
+	r := &Registry{}
+	r.Register("install-dir-writable", func(context.Context) Result {
+		return checkInstallDir(opts.InstallDir)
+	})
+	r.Register("disk-space", func(context.Context) Result {
+		return checkDiskSpace(host, opts.InstallDir, opts.MinFreeMB)
+	})
+	r.Register("container-runtime", func(context.Context) Result {
+		return checkRuntimeService(host, opts.RuntimeService)
+	})
+	for _, port := range opts.Ports {
+		port := port
+		r.Register(fmt.Sprintf("port-%d", port), func(context.Context) Result {
+			return checkPort(host, port)
+		})
+	}
+	r.Register("windows-build", func(context.Context) Result {
+		return checkWindowsBuild(osInfo, opts.PauseImages)
+	})
+	r.Register("hns", func(context.Context) Result {
+		return checkHNS(host)
+	})
+	if opts.KubeletPath != "" {
+		r.Register("kubelet-binary", func(ctx context.Context) Result {
+			return checkKubelet(ctx, host, opts.KubeletPath, opts.KubeletVersion)
+		})
+	}
+	if opts.IgnitionFile != "" {
+		r.Register("ignition", func(context.Context) Result {
+			return checkIgnition(opts.IgnitionFile, opts.Now(), opts.CAExpiryWarning)
+		})
+	}
+	return r
+}
+
+// existingDir returns the given directory, or its closest parent that exists if it has not been created yet
+func existingDir(dir string) (string, error) {
+	for {
+		info, err := os.Stat(dir)
+		if err == nil {
+			if !info.IsDir() {
+				return "", fmt.Errorf("%s is not a directory", dir)
+			}
+			return dir, nil
+		}
+		if !os.IsNotExist(err) {
+			return "", err
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", fmt.Errorf("no parent of %s exists", dir)
+		}
+		dir = parent
+	}
+}
+
+// checkInstallDir checks that files can be created in the install directory, or in the directory it will be created
+// in
+func checkInstallDir(installDir string) Result {
+	remediation := fmt.Sprintf("run as a user allowed to write to %s, or pick another install directory", installDir)
+	dir, err := existingDir(installDir)
+	if err != nil {
+		return fail(fmt.Sprintf("unable to access %s: %v", installDir, err), remediation)
+	}
+	// Files are written the way the bootstrapper writes them, which also checks that they can be renamed
+	probe := filepath.Join(dir, ".wmcb-preflight")
+	if err = fileutil.WriteFile(probe, nil); err != nil {
+		return fail(fmt.Sprintf("unable to write to %s: %v", dir, err), remediation)
+	}
+	// Ignore the return error as the file is empty and hidden
+	os.Remove(probe)
+	return pass("%s is writable", dir)
+}
+
+// checkDiskSpace checks the free disk space on the volume of the install directory
+func checkDiskSpace(host Host, installDir string, minFreeMB uint64) Result {
+	dir, err := existingDir(installDir)
+	if err != nil {
+		return fail(fmt.Sprintf("unable to access %s: %v", installDir, err), "")
+	}
+	free, err := host.FreeDiskSpace(dir)
+	if err != nil {
+		return fail(fmt.Sprintf("error getting free disk space of %s: %v", dir, err), "")
+	}
+	if freeMB := free / (1024 * 1024); freeMB < minFreeMB {
+		return fail(fmt.Sprintf("%d MB free on the volume of %s, less than %d MB", freeMB, dir, minFreeMB),
+			"free up disk space or extend the volume")
+	}
+	return pass("%d MB free on the volume of %s", free/(1024*1024), dir)
+}
+
+// checkRuntimeService checks that the container runtime service is present and running
+func checkRuntimeService(host Host, name string) Result {
+	installed, running, err := host.ServiceState(name)
+	if err != nil {
+		return fail(fmt.Sprintf("error querying %s service: %v", name, err), "")
+	}
+	if !installed {
+		return fail(fmt.Sprintf("%s service is not present", name),
+			fmt.Sprintf("install %s before bootstrapping the node", name))
+	}
+	if !running {
+		return fail(fmt.Sprintf("%s service is not running", name),
+			fmt.Sprintf("start the %s service with Start-Service %s", name, name))
+	}
+	return pass("%s service is running", name)
+}
+
+// checkPort checks that the given kubelet port is free. A port in use while the kubelet service is running is only a
+// warning, as it is expected on a node that has already been bootstrapped.
+func checkPort(host Host, port int) Result {
+	inUse, err := host.PortInUse(port)
+	if err != nil {
+		return fail(fmt.Sprintf("error checking port %d: %v", port, err), "")
+	}
+	if !inUse {
+		return pass("port %d is free", port)
+	}
+	if _, running, err := host.ServiceState(kubeletServiceName); err == nil && running {
+		return warn(fmt.Sprintf("port %d is in use, presumably by the running kubelet", port),
+			"run uninstall first to bootstrap the node from scratch")
+	}
+	return fail(fmt.Sprintf("port %d is in use", port),
+		fmt.Sprintf("stop the process listening on port %d, which can be found with netstat -ano", port))
+}
+
+// checkWindowsBuild checks that the Windows build of the node is one the bootstrapper knows a pause image for. Other
+// builds are only a warning, as the default pause image is used on them.
+func checkWindowsBuild(osInfo osinfo.Provider, pauseImages pauseimage.Manifest) Result {
+	info, err := osInfo.OSInfo()
+	if err != nil {
+		return fail(fmt.Sprintf("error getting Windows version: %v", err), "")
+	}
+	if _, ok := pauseImages.Image(info.Build); !ok {
+		var builds []string
+		for _, entry := range pauseImages.Images {
+			builds = append(builds, fmt.Sprint(entry.Build))
+		}
+		return warn(fmt.Sprintf("Windows build %d is not supported, the default pause image %s is used", info.Build,
+			pauseimage.DefaultImage), fmt.Sprintf("use one of the supported builds %s, or a pause image manifest "+
+			"with an entry for the build", strings.Join(builds, ", ")))
+	}
+	return pass("Windows build %s is supported", info.Version())
+}
+
+// checkHNS checks that the Host Networking Service the CNI plugins rely on is available
+func checkHNS(host Host) Result {
+	if err := host.HNSAvailable(); err != nil {
+		return fail(fmt.Sprintf("Host Networking Service is not available: %v", err),
+			"enable the Containers feature with Install-WindowsFeature Containers and reboot")
+	}
+	return pass("Host Networking Service is available")
+}
+
+// checkKubelet checks that the kubelet binary runs and, if given, that it has the expected version. A different patch
+// version is only a warning.
+func checkKubelet(ctx context.Context, host Host, path, expected string) Result {
+	out, err := host.KubeletVersion(ctx, path)
+	if err != nil {
+		return fail(fmt.Sprintf("unable to run %s: %v", path, err),
+			"make sure the kubelet binary is present and built for Windows")
+	}
+	version, err := kubeversion.Parse(out)
+	if err != nil {
+		return fail(fmt.Sprintf("unable to get the version of %s: %v", path, err),
+			"make sure the kubelet binary is present and built for Windows")
+	}
+	if expected == "" {
+		return pass("%s is kubelet %s", path, version)
+	}
+	want, err := kubeversion.Parse(expected)
+	if err != nil {
+		return fail(fmt.Sprintf("invalid expected kubelet version: %v", err), "")
+	}
+	remediation := fmt.Sprintf("use the kubelet %s binary", want)
+	if version.Major != want.Major || version.Minor != want.Minor {
+		return fail(fmt.Sprintf("%s is kubelet %s, expected %s", path, version, want), remediation)
+	}
+	if version.Patch != want.Patch {
+		return warn(fmt.Sprintf("%s is kubelet %s, expected %s", path, version, want), remediation)
+	}
+	return pass("%s is kubelet %s", path, version)
+}
+
+// checkIgnition checks that the ignition file can be parsed and that its bootstrap kubeconfig is valid at the given
+// time. A warning is given for the CA certificates that have expired or expire within the given window.
+func checkIgnition(path string, now time.Time, expiryWarning time.Duration) Result {
+	remediation := "download the worker ignition file from the Machine Config Server again"
+	config, err := ignition.Load(path)
+	if err != nil {
+		return fail(fmt.Sprintf("unable to parse %s: %v", path, err), remediation)
+	}
+	contents, found, err := ignition.ReadFile(config, ignition.BootstrapKubeconfigPath)
+	if err != nil {
+		return fail(err.Error(), remediation)
+	}
+	if !found {
+		return fail(fmt.Sprintf("%s has no bootstrap kubeconfig", path), remediation)
+	}
+	kc, err := clientcmd.Load(contents)
+	if err != nil {
+		return fail(fmt.Sprintf("invalid bootstrap kubeconfig: %v", err), remediation)
+	}
+	certs, err := nodecerts.ValidateBootstrapKubeconfig(kc, now)
+	if err != nil {
+		return fail(fmt.Sprintf("invalid bootstrap kubeconfig: %v", err),
+			remediation+", and check that the clock of the node is correct")
+	}
+
+	var expiring []string
+	for _, cert := range certs {
+		if now.After(cert.NotAfter) {
+			expiring = append(expiring, fmt.Sprintf("bootstrap kubeconfig CA %s expired on %s",
+				cert.Subject.CommonName, cert.NotAfter.UTC().Format(time.RFC3339)))
+		} else if now.Add(expiryWarning).After(cert.NotAfter) {
+			expiring = append(expiring, fmt.Sprintf("bootstrap kubeconfig CA %s expires on %s",
+				cert.Subject.CommonName, cert.NotAfter.UTC().Format(time.RFC3339)))
+		}
+	}
+	if len(expiring) != 0 {
+		return warn(strings.Join(expiring, ", "), "rotate the bootstrap credentials before the CA expires")
+	}
+	return pass("%s is valid and its bootstrap kubeconfig CA is not expired", path)
+}
@@ -0,0 +1,110 @@
+// Package preflight checks that a Windows node meets the requirements of the bootstrapper before it is run
+package preflight
+
+import (
+	"context"
+	"fmt"
+)
+
+// Status is the outcome of a check
+type Status string
+
+const (
+	// StatusPass means the node meets the requirement
+	StatusPass Status = "pass"
+	// StatusWarn means the bootstrap is expected to succeed, but the node should be looked at
+	StatusWarn Status = "warn"
+	// StatusFail means the bootstrap is expected to fail
+	StatusFail Status = "fail"
+)
+
+// Result is the outcome of a check along with how to address it
+type Result struct {
+	// Name is the name of the check
+	Name string `json:"name"`
+	// Status is the outcome of the check
+	Status Status `json:"status"`
+	// Message describes what was found
+	Message string `json:"message"`
+	// Remediation describes how to address a warning or failure
+	Remediation string `json:"remediation,omitempty"`
+}
+
+// CheckFunc runs a check. The name of the returned result is set by the registry.
+type CheckFunc func(ctx context.Context) Result
+
+// check is a CheckFunc registered under a name
+type check struct {
+	name string
+	run  CheckFunc
+}
+
+// Registry holds the checks to run, in the order they were registered
+type Registry struct {
+	checks []check
+}
+
+// Register adds a check under the given name. Registering a name twice replaces the earlier check in place.
+func (r *Registry) Register(name string, run CheckFunc) {
+	for i := range r.checks {
+		if r.checks[i].name == name {
+			r.checks[i].run = run
+			return
+		}
+	}
+	r.checks = append(r.checks, check{name: name, run: run})
+}
+
+// Names returns the names of the registered checks in the order they are run
+func (r *Registry) Names() []string {
+	names := make([]string, 0, len(r.checks))
+	for _, c := range r.checks {
+		names = append(names, c.name)
+	}
+	return names
+}
+
+// Run runs every registered check. The checks that have not been run when the context is cancelled fail with the
+// context error.
+func (r *Registry) Run(ctx context.Context) Results {
+	results := make(Results, 0, len(r.checks))
+	for _, c := range r.checks {
+		var result Result
+		if err := ctx.Err(); err != nil {
+			result = fail(fmt.Sprintf("not run: %v", err), "")
+		} else {
+			result = c.run(ctx)
+		}
+		result.Name = c.name
+		results = append(results, result)
+	}
+	return results
+}
+
+// Results are the outcomes of a run of the registry
+type Results []Result
+
+// Failed returns true if any check failed
+func (r Results) Failed() bool {
+	for _, result := range r {
+		if result.Status == StatusFail {
+			return true
+		}
+	}
+	return false
+}
+
+// pass returns a passing result with the given message
+func pass(format string, args ...interface{}) Result {
+	return Result{Status: StatusPass, Message: fmt.Sprintf(format, args...)}
+}
+
+// warn returns a warning with the given message and remediation
+func warn(message, remediation string) Result {
+	return Result{Status: StatusWarn, Message: message, Remediation: remediation}
+}
+
+// fail returns a failure with the given message and remediation
+func fail(message, remediation string) Result {
+	return Result{Status: StatusFail, Message: message, Remediation: remediation}
+}
@@ -0,0 +1,339 @@
+package preflight
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/osinfo"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/pauseimage"
+)
+
+// fakeHost is a Host whose state is set by the test
+type fakeHost struct {
+	freeBytes uint64
+	// services maps the installed services to whether they are running
+	services       map[string]bool
+	portsInUse     map[int]bool
+	hnsErr         error
+	kubeletVersion string
+	kubeletErr     error
+}
+
+func (h *fakeHost) FreeDiskSpace(path string) (uint64, error) {
+	return h.freeBytes, nil
+}
+
+func (h *fakeHost) ServiceState(name string) (bool, bool, error) {
+	running, installed := h.services[name]
+	return installed, running, nil
+}
+
+func (h *fakeHost) PortInUse(port int) (bool, error) {
+	return h.portsInUse[port], nil
+}
+
+func (h *fakeHost) HNSAvailable() error {
+	return h.hnsErr
+}
+
+func (h *fakeHost) KubeletVersion(ctx context.Context, path string) (string, error) {
+	return h.kubeletVersion, h.kubeletErr
+}
+
+// healthyHost returns a host on which all checks pass
+func healthyHost() *fakeHost {
+	return &fakeHost{
+		freeBytes:      10 * 1024 * 1024 * 1024,
+		services:       map[string]bool{"docker": true},
+		kubeletVersion: "Kubernetes v1.19.0+0f5d5ab",
+	}
+}
+
+// TestRegistry tests the order of the checks, replacing a check and running with a cancelled context
+func TestRegistry(t *testing.T) {
+	r := &Registry{}
+	r.Register("first", func(context.Context) Result { return pass("ok") })
+	r.Register("second", func(context.Context) Result { return fail("broken", "fix it") })
+	r.Register("first", func(context.Context) Result { return warn("meh", "look at it") })
+	assert.Equal(t, []string{"first", "second"}, r.Names())
+
+	results := r.Run(context.Background())
+	assert.Equal(t, Results{
+		{Name: "first", Status: StatusWarn, Message: "meh", Remediation: "look at it"},
+		{Name: "second", Status: StatusFail, Message: "broken", Remediation: "fix it"},
+	}, results)
+	assert.True(t, results.Failed())
+	assert.False(t, results[:1].Failed())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for _, result := range r.Run(ctx) {
+		assert.Equal(t, StatusFail, result.Status, "check %s", result.Name)
+	}
+}
+
+// TestNewRegistry tests the outcome of the default checks against different hosts
+func TestNewRegistry(t *testing.T) {
+	installDir, err := ioutil.TempDir("", "preflight")
+	require.NoError(t, err, "error creating temp directory")
+	// Ignore the return error as there is not much we can do if the temporary directory is not deleted
+	defer os.RemoveAll(installDir)
+
+	tests := []struct {
+		name    string
+		modify  func(h *fakeHost, o *Options, info *osinfo.Static)
+		check   string
+		status  Status
+		message string
+	}{
+		{
+			name:   "healthy node",
+			modify: func(*fakeHost, *Options, *osinfo.Static) {},
+			check:  "kubelet-binary",
+			status: StatusPass,
+		},
+		{
+			name:   "install dir created by the bootstrapper",
+			modify: func(h *fakeHost, o *Options, _ *osinfo.Static) { o.InstallDir = filepath.Join(o.InstallDir, "k") },
+			check:  "install-dir-writable",
+			status: StatusPass,
+		},
+		{
+			name:    "not enough disk space",
+			modify:  func(h *fakeHost, _ *Options, _ *osinfo.Static) { h.freeBytes = 1024 * 1024 * 1024 },
+			check:   "disk-space",
+			status:  StatusFail,
+			message: "1024 MB free",
+		},
+		{
+			name:    "container runtime not installed",
+			modify:  func(h *fakeHost, _ *Options, _ *osinfo.Static) { h.services = nil },
+			check:   "container-runtime",
+			status:  StatusFail,
+			message: "docker service is not present",
+		},
+		{
+			name:    "container runtime stopped",
+			modify:  func(h *fakeHost, _ *Options, _ *osinfo.Static) { h.services["docker"] = false },
+			check:   "container-runtime",
+			status:  StatusFail,
+			message: "docker service is not running",
+		},
+		{
+			name:    "port in use",
+			modify:  func(h *fakeHost, _ *Options, _ *osinfo.Static) { h.portsInUse = map[int]bool{10250: true} },
+			check:   "port-10250",
+			status:  StatusFail,
+			message: "port 10250 is in use",
+		},
+		{
+			name: "port in use by the running kubelet",
+			modify: func(h *fakeHost, _ *Options, _ *osinfo.Static) {
+				h.portsInUse = map[int]bool{10248: true}
+				h.services["kubelet"] = true
+			},
+			check:   "port-10248",
+			status:  StatusWarn,
+			message: "presumably by the running kubelet",
+		},
+		{
+			name:    "unsupported Windows build",
+			modify:  func(_ *fakeHost, _ *Options, info *osinfo.Static) { info.Build = 14393 },
+			check:   "windows-build",
+			status:  StatusWarn,
+			message: "Windows build 14393 is not supported",
+		},
+		{
+			name:    "HNS not available",
+			modify:  func(h *fakeHost, _ *Options, _ *osinfo.Static) { h.hnsErr = fmt.Errorf("not found") },
+			check:   "hns",
+			status:  StatusFail,
+			message: "not found",
+		},
+		{
+			name:    "kubelet does not run",
+			modify:  func(h *fakeHost, _ *Options, _ *osinfo.Static) { h.kubeletErr = fmt.Errorf("bad exe") },
+			check:   "kubelet-binary",
+			status:  StatusFail,
+			message: "bad exe",
+		},
+		{
+			name:    "kubelet minor version mismatch",
+			modify:  func(_ *fakeHost, o *Options, _ *osinfo.Static) { o.KubeletVersion = "v1.20.0" },
+			check:   "kubelet-binary",
+			status:  StatusFail,
+			message: "expected v1.20.0",
+		},
+		{
+			name:    "kubelet patch version mismatch",
+			modify:  func(_ *fakeHost, o *Options, _ *osinfo.Static) { o.KubeletVersion = "v1.19.2" },
+			check:   "kubelet-binary",
+			status:  StatusWarn,
+			message: "expected v1.19.2",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			host := healthyHost()
+			opts := Options{
+				InstallDir:     installDir,
+				RuntimeService: "docker",
+				KubeletPath:    "kubelet.exe",
+				KubeletVersion: "v1.19.0",
+				PauseImages:    pauseimage.DefaultManifest(),
+			}
+			info := osinfo.Static{Build: 17763}
+			tt.modify(host, &opts, &info)
+
+			results := NewRegistry(host, info, opts).Run(context.Background())
+			for _, result := range results {
+				if result.Name != tt.check {
+					assert.Equal(t, StatusPass, result.Status, "check %s: %s", result.Name, result.Message)
+					continue
+				}
+				assert.Equal(t, tt.status, result.Status, result.Message)
+				assert.Contains(t, result.Message, tt.message)
+				if tt.status != StatusPass {
+					assert.NotEmpty(t, result.Remediation)
+				}
+			}
+		})
+	}
+}
+
+// TestCheckIgnition tests parsing the ignition file and checking the expiry of the bootstrap kubeconfig CA
+func TestCheckIgnition(t *testing.T) {
+	dir, err := ioutil.TempDir("", "preflight")
+	require.NoError(t, err, "error creating temp directory")
+	// Ignore the return error as there is not much we can do if the temporary directory is not deleted
+	defer os.RemoveAll(dir)
+
+	notBefore := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	notAfter := notBefore.Add(365 * 24 * time.Hour)
+	path := filepath.Join(dir, "worker.ign")
+	require.NoError(t, ioutil.WriteFile(path, workerIgnition(t, notBefore, notAfter), 0644))
+	invalidPath := filepath.Join(dir, "invalid.ign")
+	require.NoError(t, ioutil.WriteFile(invalidPath, []byte("{}"), 0644))
+
+	tests := []struct {
+		name    string
+		path    string
+		now     time.Time
+		status  Status
+		message string
+	}{
+		{
+			name:   "valid CA",
+			path:   path,
+			now:    notBefore.Add(24 * time.Hour),
+			status: StatusPass,
+		},
+		{
+			name:    "CA expiring soon",
+			path:    path,
+			now:     notAfter.Add(-24 * time.Hour),
+			status:  StatusWarn,
+			message: "expires on",
+		},
+		{
+			name:    "expired CA",
+			path:    path,
+			now:     notAfter.Add(time.Hour),
+			status:  StatusFail,
+			message: "expired on",
+		},
+		{
+			name:    "CA not valid yet",
+			path:    path,
+			now:     notBefore.Add(-time.Hour),
+			status:  StatusFail,
+			message: "is not valid before",
+		},
+		{
+			name:    "missing ignition file",
+			path:    filepath.Join(dir, "missing.ign"),
+			status:  StatusFail,
+			message: "could not read ignition file",
+		},
+		{
+			name:    "invalid ignition file",
+			path:    invalidPath,
+			status:  StatusFail,
+			message: "unable to parse",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := checkIgnition(tt.path, tt.now, DefaultCAExpiryWarning)
+			assert.Equal(t, tt.status, result.Status, result.Message)
+			assert.Contains(t, result.Message, tt.message)
+		})
+	}
+}
+
+// workerIgnition returns a worker ignition file holding a bootstrap kubeconfig with a CA valid between the given times
+func workerIgnition(t *testing.T, notBefore, notAfter time.Time) []byte {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "kube-apiserver-lb-signer"},
+		NotBefore:             notBefore,
+		NotAfter:              notAfter,
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+
+	kubeconfig := fmt.Sprintf(`apiVersion: v1
+clusters:
+- cluster:
+    certificate-authority-data: %s
+    server: https://api-int.cluster.example.com:6443
+  name: local
+contexts:
+- context:
+    cluster: local
+    user: kubelet
+  name: kubelet
+current-context: kubelet
+users:
+- name: kubelet
+  user:
+    token: secret
+`, base64.StdEncoding.EncodeToString(ca))
+	source := "data:," + url.PathEscape(kubeconfig)
+	contents, err := json.Marshal(map[string]interface{}{
+		"ignition": map[string]string{"version": "3.1.0"},
+		"storage": map[string]interface{}{
+			"files": []map[string]interface{}{
+				{"path": "/etc/kubernetes/kubeconfig", "contents": map[string]string{"source": source}},
+			},
+		},
+	})
+	require.NoError(t, err)
+	return contents
+}
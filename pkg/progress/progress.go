@@ -0,0 +1,239 @@
+// Package progress records the phases a bootstrap goes through, along with how long each took and which one failed, so
+// that a slow or failed bootstrap can be attributed to the service manager, to a wait or to file I/O. The phases are
+// logged as they start and end, and written to a progress file that WMCO can poll while the bootstrap runs.
+package progress
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/fileutil"
+)
+
+// Phase is a named step of a bootstrap
+type Phase string
+
+const (
+	// ParseIgnition reads the ignition file and translates the files it describes
+	ParseIgnition Phase = "parse-ignition"
+	// RenderConfig resolves the node identity and renders the kubelet and container runtime configuration
+	RenderConfig Phase = "render-config"
+	// ProbeAPIServer checks that the API server reports ready when reached with the bootstrap kubeconfig
+	ProbeAPIServer Phase = "probe-api-server"
+	// StopService stops the kubelet service, or removes it when it is recreated
+	StopService Phase = "stop-service"
+	// WriteFiles creates the directories and writes the files that are not up to date to the node, and applies the host
+	// configuration
+	WriteFiles Phase = "write-files"
+	// CreateService creates the kubelet service
+	CreateService Phase = "create-service"
+	// UpdateService updates the config of the existing kubelet service, restarting it when the CNI is configured
+	UpdateService Phase = "update-service"
+	// StartService starts the kubelet service
+	StartService Phase = "start-service"
+	// VerifyHealth waits for the kubelet to report healthy
+	VerifyHealth Phase = "verify-health"
+)
+
+// State is the state of a bootstrap
+type State string
+
+const (
+	// Running is the state of a bootstrap that has not finished yet
+	Running State = "Running"
+	// Succeeded is the state of a bootstrap that finished without error
+	Succeeded State = "Succeeded"
+	// Failed is the state of a bootstrap that finished with an error
+	Failed State = "Failed"
+)
+
+// PhaseResult is the timing and outcome of a run of a phase
+type PhaseResult struct {
+	// Name is the name of the phase
+	Name Phase `json:"name"`
+	// Start is when the phase started
+	Start time.Time `json:"start"`
+	// End is when the phase ended, unset while it runs
+	End *time.Time `json:"end,omitempty"`
+	// DurationSeconds is how long the phase took
+	DurationSeconds float64 `json:"durationSeconds"`
+	// Error is the error the phase failed with, if any
+	Error string `json:"error,omitempty"`
+}
+
+// Report is the timeline of a bootstrap. A phase appears once per run, so a phase that runs more than once, such as
+// write-files when the kubelet has to be stopped before some of the files can be replaced, appears more than once.
+type Report struct {
+	// Operation is the bootstrap operation, such as initialize-kubelet
+	Operation string `json:"operation"`
+	// State is the state of the bootstrap
+	State State `json:"state"`
+	// Start is when the bootstrap started
+	Start time.Time `json:"start"`
+	// End is when the bootstrap ended, unset while it runs
+	End *time.Time `json:"end,omitempty"`
+	// DurationSeconds is how long the bootstrap took
+	DurationSeconds float64 `json:"durationSeconds"`
+	// CurrentPhase is the phase that is running, if any
+	CurrentPhase Phase `json:"currentPhase,omitempty"`
+	// Phases are the phases that have run or are running, in the order they started
+	Phases []PhaseResult `json:"phases"`
+	// Error is the error the bootstrap failed with, if any
+	Error string `json:"error,omitempty"`
+}
+
+// Recorder records the phases of a bootstrap. A nil Recorder runs the phases without recording them. The report of a
+// Recorder can be read while the bootstrap runs.
+type Recorder struct {
+	// mu guards report
+	mu sync.Mutex
+	// report is the timeline recorded so far
+	report Report
+	// finished is true once the bootstrap has ended. Phases run afterwards are not recorded.
+	finished bool
+	// log receives an event when a phase starts or ends
+	log logr.Logger
+	// path is the progress file the report is written to whenever it changes, if any
+	path string
+	// now returns the current time
+	now func() time.Time
+}
+
+// NewRecorder returns a Recorder of the given operation, starting now. The report is written to the progress file at
+// the given path whenever it changes, unless the path is empty.
+func NewRecorder(operation string, log logr.Logger, path string) *Recorder {
+	return newRecorder(operation, log, path, time.Now)
+}
+
+// newRecorder returns a Recorder taking the time from the given clock
+func newRecorder(operation string, log logr.Logger, path string, now func() time.Time) *Recorder {
+	r := &Recorder{
+		report: Report{Operation: operation, State: Running, Start: now(), Phases: []PhaseResult{}},
+		log:    log,
+		path:   path,
+		now:    now,
+	}
+	r.write(r.report)
+	return r
+}
+
+// Run runs the given phase, recording when it started and ended and the error it returned, if any
+func (r *Recorder) Run(phase Phase, run func() error) error {
+	if r == nil {
+		return run()
+	}
+	r.mu.Lock()
+	if r.finished {
+		r.mu.Unlock()
+		return run()
+	}
+	r.report.CurrentPhase = phase
+	r.report.Phases = append(r.report.Phases, PhaseResult{Name: phase, Start: r.now()})
+	index := len(r.report.Phases) - 1
+	report := r.snapshot()
+	r.mu.Unlock()
+	r.log.Info("phase started", "operation", report.Operation, "phase", phase)
+	r.write(report)
+
+	err := run()
+
+	r.mu.Lock()
+	end := r.now()
+	result := &r.report.Phases[index]
+	result.End = &end
+	result.DurationSeconds = end.Sub(result.Start).Seconds()
+	if err != nil {
+		result.Error = err.Error()
+	}
+	r.report.CurrentPhase = ""
+	duration := result.DurationSeconds
+	report = r.snapshot()
+	r.mu.Unlock()
+	if err != nil {
+		r.log.Error(err, "phase failed", "operation", report.Operation, "phase", phase, "durationSeconds", duration)
+	} else {
+		r.log.Info("phase completed", "operation", report.Operation, "phase", phase, "durationSeconds", duration)
+	}
+	r.write(report)
+	return err
+}
+
+// Finish records the end of the bootstrap along with the error it failed with, if any, and returns that error
+func (r *Recorder) Finish(err error) error {
+	if r == nil {
+		return err
+	}
+	r.mu.Lock()
+	end := r.now()
+	r.finished = true
+	r.report.End = &end
+	r.report.DurationSeconds = end.Sub(r.report.Start).Seconds()
+	r.report.CurrentPhase = ""
+	r.report.State = Succeeded
+	if err != nil {
+		r.report.State = Failed
+		r.report.Error = err.Error()
+	}
+	report := r.snapshot()
+	r.mu.Unlock()
+	r.log.Info("bootstrap finished", "operation", report.Operation, "state", report.State,
+		"durationSeconds", report.DurationSeconds)
+	r.write(report)
+	return err
+}
+
+// Report returns the timeline recorded so far. The report of a nil Recorder is empty.
+func (r *Recorder) Report() Report {
+	if r == nil {
+		return Report{}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.snapshot()
+}
+
+// snapshot returns a copy of the report that is not changed by the phases that follow. The caller must hold mu.
+func (r *Recorder) snapshot() Report {
+	report := r.report
+	report.Phases = append([]PhaseResult{}, r.report.Phases...)
+	return report
+}
+
+// write replaces the progress file with the given report. A progress file that cannot be written is logged rather than
+// failing the bootstrap, as the bootstrap does not depend on it.
+func (r *Recorder) write(report Report) {
+	if r.path == "" {
+		return
+	}
+	if err := WriteFile(r.path, report); err != nil {
+		r.log.Error(err, "unable to write progress file", "path", r.path)
+	}
+}
+
+// WriteFile writes the given report to the file at the given path as JSON. The file is replaced rather than rewritten,
+// so that a reader polling it never sees a partial report.
+func WriteFile(path string, report Report) error {
+	contents, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding progress report: %v", err)
+	}
+	return fileutil.WriteFile(path, append(contents, '\n'))
+}
+
+// ReadFile reads the report from the progress file at the given path
+func ReadFile(path string) (Report, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return Report{}, err
+	}
+	var report Report
+	if err = json.Unmarshal(contents, &report); err != nil {
+		return Report{}, fmt.Errorf("invalid progress file %s: %v", path, err)
+	}
+	return report, nil
+}
@@ -0,0 +1,100 @@
+package progress
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	crlog "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// fakeClock returns a clock starting at the given time and advancing by a second every time it is read
+func fakeClock(start time.Time) func() time.Time {
+	now := start
+	return func() time.Time {
+		current := now
+		now = now.Add(time.Second)
+		return current
+	}
+}
+
+// TestRecorder tests that the phases are timed, that errors are attributed to the phase they occurred in, and that the
+// progress file follows the bootstrap while it runs
+func TestRecorder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "progress")
+	require.NoError(t, err, "error creating temp directory")
+	// Ignore the return error as there is not much we can do if the temporary directory is not deleted
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "progress.json")
+
+	start := time.Date(2020, 10, 1, 12, 0, 0, 0, time.UTC)
+	r := newRecorder("initialize-kubelet", crlog.NullLogger{}, path, fakeClock(start))
+	report, err := ReadFile(path)
+	require.NoError(t, err, "progress file was not written when the bootstrap started")
+	assert.Equal(t, Running, report.State)
+	assert.Empty(t, report.Phases)
+
+	require.NoError(t, r.Run(ParseIgnition, func() error {
+		report, err := ReadFile(path)
+		require.NoError(t, err)
+		assert.Equal(t, ParseIgnition, report.CurrentPhase, "running phase was not written to the progress file")
+		require.Len(t, report.Phases, 1)
+		assert.Nil(t, report.Phases[0].End, "running phase has an end")
+		return nil
+	}))
+	phaseErr := fmt.Errorf("access denied")
+	assert.Equal(t, phaseErr, r.Run(WriteFiles, func() error { return phaseErr }))
+	assert.Equal(t, phaseErr, r.Finish(phaseErr))
+
+	report, err = ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, r.Report(), report, "progress file does not hold the final report")
+	assert.Equal(t, "initialize-kubelet", report.Operation)
+	assert.Equal(t, Failed, report.State)
+	assert.Equal(t, "access denied", report.Error)
+	assert.Empty(t, report.CurrentPhase)
+	assert.Equal(t, float64(5), report.DurationSeconds)
+	require.Len(t, report.Phases, 2)
+	assert.Equal(t, ParseIgnition, report.Phases[0].Name)
+	assert.Equal(t, start.Add(time.Second), report.Phases[0].Start)
+	assert.Equal(t, float64(1), report.Phases[0].DurationSeconds)
+	assert.Empty(t, report.Phases[0].Error)
+	assert.Equal(t, WriteFiles, report.Phases[1].Name)
+	assert.Equal(t, "access denied", report.Phases[1].Error, "error was not attributed to the failed phase")
+
+	t.Run("phases run after the bootstrap finished", func(t *testing.T) {
+		ran := false
+		require.NoError(t, r.Run(StartService, func() error {
+			ran = true
+			return nil
+		}))
+		assert.True(t, ran, "phase was not run")
+		assert.Len(t, r.Report().Phases, 2, "phase run after the bootstrap finished was recorded")
+	})
+}
+
+// TestNilRecorder tests that phases are run without being recorded by a nil Recorder
+func TestNilRecorder(t *testing.T) {
+	var r *Recorder
+	ran := false
+	require.NoError(t, r.Run(VerifyHealth, func() error {
+		ran = true
+		return nil
+	}))
+	assert.True(t, ran, "phase was not run")
+	assert.Equal(t, fmt.Errorf("failed"), r.Finish(fmt.Errorf("failed")))
+	assert.Equal(t, Report{}, r.Report())
+}
+
+// TestUnwritableProgressFile tests that a progress file that cannot be written does not fail the bootstrap
+func TestUnwritableProgressFile(t *testing.T) {
+	r := NewRecorder("configure-cni", crlog.NullLogger{}, filepath.Join("does", "not", "exist", "progress.json"))
+	require.NoError(t, r.Run(WriteFiles, func() error { return nil }))
+	require.NoError(t, r.Finish(nil))
+	assert.Equal(t, Succeeded, r.Report().State)
+}
@@ -0,0 +1,147 @@
+package runtimeconf
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// imageConfigAPIVersion is the apiVersion of the image.config.openshift.io objects
+	imageConfigAPIVersion = "config.openshift.io/v1"
+	// imageConfigKind is the kind of the image.config.openshift.io objects
+	imageConfigKind = "Image"
+)
+
+// imageConfig holds the fields of an image.config.openshift.io object, as given by
+// oc get image.config.openshift.io cluster -o yaml, that the container runtime config is rendered from
+type imageConfig struct {
+	APIVersion string `yaml:"apiVersion"`
+	Kind       string `yaml:"kind"`
+	Spec       struct {
+		RegistrySources struct {
+			InsecureRegistries []string `yaml:"insecureRegistries"`
+			AllowedRegistries  []string `yaml:"allowedRegistries"`
+			BlockedRegistries  []string `yaml:"blockedRegistries"`
+		} `yaml:"registrySources"`
+	} `yaml:"spec"`
+}
+
+// Registries are the registry sources of the cluster image config. An entry is a registry host, optionally followed by
+// a repository path, or a wildcard such as *.example.com matching the subdomains of a domain.
+type Registries struct {
+	// Insecure are the registries pulled from without verifying their certificate
+	Insecure []string
+	// Allowed are the only registries images may be pulled from, if any
+	Allowed []string
+	// Blocked are the registries images may not be pulled from
+	Blocked []string
+}
+
+// LoadImageConfig reads the registries from the image.config.openshift.io object in the given YAML or JSON file
+func LoadImageConfig(path string) (Registries, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return Registries{}, fmt.Errorf("could not read image config %s: %v", path, err)
+	}
+	r, err := ParseImageConfig(data)
+	if err != nil {
+		return Registries{}, fmt.Errorf("invalid image config %s: %v", path, err)
+	}
+	return r, nil
+}
+
+// ParseImageConfig reads the registries from an image.config.openshift.io object given as YAML or JSON
+func ParseImageConfig(data []byte) (Registries, error) {
+	var config imageConfig
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return Registries{}, fmt.Errorf("could not parse image config: %v", err)
+	}
+	if config.APIVersion != imageConfigAPIVersion || config.Kind != imageConfigKind {
+		return Registries{}, fmt.Errorf("unsupported image config %s %s, must be %s %s", config.APIVersion,
+			config.Kind, imageConfigAPIVersion, imageConfigKind)
+	}
+	sources := config.Spec.RegistrySources
+	r := Registries{
+		Insecure: sources.InsecureRegistries,
+		Allowed:  sources.AllowedRegistries,
+		Blocked:  sources.BlockedRegistries,
+	}
+	if err := r.Validate(); err != nil {
+		return Registries{}, err
+	}
+	return r, nil
+}
+
+// Validate returns an error if both allowed and blocked registries are given, which the cluster rejects as well
+func (r Registries) Validate() error {
+	if len(r.Allowed) != 0 && len(r.Blocked) != 0 {
+		return fmt.Errorf("only one of allowedRegistries and blockedRegistries can be set")
+	}
+	return nil
+}
+
+// InsecureHosts returns the hosts of the insecure registries, sorted. Wildcards cannot be given to either container
+// runtime and are left out, so that pulling from them keeps verifying the registry certificate.
+func (r Registries) InsecureHosts() []string {
+	seen := make(map[string]bool)
+	var hosts []string
+	for _, entry := range r.Insecure {
+		host := strings.SplitN(entry, "/", 2)[0]
+		if strings.Contains(host, "*") || !registryHostRegex.MatchString(host) || seen[host] {
+			continue
+		}
+		seen[host] = true
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	return hosts
+}
+
+// CheckImage returns an error if the given image is from a blocked registry, or not from an allowed one. The container
+// runtimes of Windows nodes cannot enforce the allowed and blocked registries themselves, so the images WMCB has the
+// node pull, such as the pause image, are checked instead.
+func (r Registries) CheckImage(image string) error {
+	name := imageName(image)
+	for _, entry := range r.Blocked {
+		if registryMatches(entry, name) {
+			return fmt.Errorf("image %s is from blocked registry %s", image, entry)
+		}
+	}
+	if len(r.Allowed) == 0 {
+		return nil
+	}
+	for _, entry := range r.Allowed {
+		if registryMatches(entry, name) {
+			return nil
+		}
+	}
+	return fmt.Errorf("image %s is not from any of the allowed registries %s", image, strings.Join(r.Allowed, ", "))
+}
+
+// imageName returns the name of the given image without its tag or digest, with the docker.io registry of the images
+// given without one
+func imageName(image string) string {
+	name := strings.SplitN(image, "@", 2)[0]
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		name = name[:i]
+	}
+	parts := strings.SplitN(name, "/", 2)
+	if len(parts) == 1 || (!strings.ContainsAny(parts[0], ".:") && parts[0] != "localhost") {
+		return DockerHub + "/" + name
+	}
+	return name
+}
+
+// registryMatches returns true if the given image name is from the registry or repository of the entry
+func registryMatches(entry, name string) bool {
+	if strings.HasPrefix(entry, "*.") {
+		host := strings.SplitN(name, "/", 2)[0]
+		host = strings.SplitN(host, ":", 2)[0]
+		return strings.HasSuffix(host, entry[1:])
+	}
+	return name == entry || strings.HasPrefix(name, entry+"/")
+}
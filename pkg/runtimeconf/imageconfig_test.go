@@ -0,0 +1,103 @@
+package runtimeconf
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestParseImageConfig tests that the registry sources are read from the cluster image config
+func TestParseImageConfig(t *testing.T) {
+	r, err := ParseImageConfig([]byte(`apiVersion: config.openshift.io/v1
+kind: Image
+metadata:
+  name: cluster
+spec:
+  registrySources:
+    insecureRegistries:
+    - registry.local:5000
+    blockedRegistries:
+    - untrusted.com
+status:
+  internalRegistryHostname: image-registry.openshift-image-registry.svc:5000
+`))
+	require.NoError(t, err)
+	assert.Equal(t, Registries{Insecure: []string{"registry.local:5000"}, Blocked: []string{"untrusted.com"}}, r)
+
+	r, err = ParseImageConfig([]byte(`{"apiVersion":"config.openshift.io/v1","kind":"Image",` +
+		`"spec":{"registrySources":{"allowedRegistries":["quay.io"]}}}`))
+	require.NoError(t, err, "error parsing JSON image config")
+	assert.Equal(t, Registries{Allowed: []string{"quay.io"}}, r)
+
+	_, err = ParseImageConfig([]byte("apiVersion: v1\nkind: ConfigMap\n"))
+	assert.Error(t, err, "object other than an image config accepted")
+
+	_, err = ParseImageConfig([]byte(`apiVersion: config.openshift.io/v1
+kind: Image
+spec:
+  registrySources:
+    allowedRegistries: [quay.io]
+    blockedRegistries: [untrusted.com]
+`))
+	assert.Error(t, err, "both allowed and blocked registries accepted")
+}
+
+// TestCheckImage tests that images are matched against the allowed and blocked registries
+func TestCheckImage(t *testing.T) {
+	tests := []struct {
+		name       string
+		registries Registries
+		image      string
+		allowed    bool
+	}{
+		{
+			name:    "no restrictions",
+			image:   "mcr.microsoft.com/oss/kubernetes/pause:1.4.1",
+			allowed: true,
+		},
+		{
+			name:       "blocked registry",
+			registries: Registries{Blocked: []string{"mcr.microsoft.com"}},
+			image:      "mcr.microsoft.com/oss/kubernetes/pause:1.4.1",
+		},
+		{
+			name:       "registry with a blocked prefix",
+			registries: Registries{Blocked: []string{"mcr.microsoft"}},
+			image:      "mcr.microsoft.com/oss/kubernetes/pause:1.4.1",
+			allowed:    true,
+		},
+		{
+			name:       "allowed repository",
+			registries: Registries{Allowed: []string{"mcr.microsoft.com/oss"}},
+			image:      "mcr.microsoft.com/oss/kubernetes/pause@sha256:abc",
+			allowed:    true,
+		},
+		{
+			name:       "allowed wildcard",
+			registries: Registries{Allowed: []string{"*.microsoft.com"}},
+			image:      "mcr.microsoft.com:443/oss/kubernetes/pause:1.4.1",
+			allowed:    true,
+		},
+		{
+			name:       "Docker Hub image not allowed",
+			registries: Registries{Allowed: []string{"quay.io"}},
+			image:      "pause:3.2",
+		},
+		{
+			name:       "blocked Docker Hub",
+			registries: Registries{Blocked: []string{"docker.io"}},
+			image:      "library/pause:3.2",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.registries.CheckImage(test.image)
+			if test.allowed {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,235 @@
+// Package runtimeconf describes the daemon configuration of the container runtime of Windows nodes: the docker
+// daemon.json or the containerd config.toml. It is rendered from the cluster image and logging settings, so that every
+// node runs its container runtime with the same configuration instead of a hand-tuned one.
+package runtimeconf
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+const (
+	// DefaultLogMaxSize is the size a container log is rotated at, as the containerLogMaxSize of the kubelet config
+	DefaultLogMaxSize = "50Mi"
+	// DefaultLogMaxFiles is the number of log files kept per container, as the containerLogMaxFiles of the kubelet
+	// config
+	DefaultLogMaxFiles = 5
+	// DefaultContainerdRoot is where containerd keeps its images and containers unless a data root is given
+	DefaultContainerdRoot = `C:\ProgramData\containerd\root`
+	// DockerHub is the registry docker pulls images without a registry from, the only one docker can be given mirrors of
+	DockerHub = "docker.io"
+	// dockerLogDriver is the docker log driver the kubelet reads the container logs of
+	dockerLogDriver = "json-file"
+)
+
+var (
+	// registryHostRegex matches a registry host with an optional port, such as quay.io or registry.local:5000
+	registryHostRegex = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9.-]*[a-zA-Z0-9])?(:[0-9]+)?$`)
+	// windowsPathRegex matches an absolute Windows path
+	windowsPathRegex = regexp.MustCompile(`^[a-zA-Z]:\\`)
+)
+
+// Options are the container runtime settings that do not come from the cluster image config
+type Options struct {
+	// LogMaxSize is the size a container log is rotated at, as a Kubernetes quantity such as 50Mi. It is the
+	// containerLogMaxSize of the kubelet config, which the kubelet enforces with containerd and docker enforces itself.
+	LogMaxSize string
+	// LogMaxFiles is the number of log files kept per container
+	LogMaxFiles int32
+	// DataRoot is where the container runtime keeps its images and containers. The default of the runtime is used if
+	// it is empty.
+	DataRoot string
+	// ImageConfigPath is the image.config.openshift.io object of the cluster the registries are read from, if any
+	ImageConfigPath string
+	// Mirrors are the registries images are pulled from instead of the registry of the image
+	Mirrors []Mirror
+}
+
+// Mirror lists the endpoints the images of a registry are pulled from, in order of preference
+type Mirror struct {
+	// Source is the registry host, such as docker.io or quay.io
+	Source string
+	// Endpoints are the URLs of the mirrors, https://mirror.local for example
+	Endpoints []string
+}
+
+// ParseMirrors parses mirrors given as source=endpoint. Endpoints of the same source are kept in the given order.
+func ParseMirrors(values []string) ([]Mirror, error) {
+	var mirrors []Mirror
+	index := make(map[string]int)
+	for _, value := range values {
+		parts := strings.SplitN(value, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("invalid registry mirror %q, must be source=endpoint", value)
+		}
+		i, found := index[parts[0]]
+		if !found {
+			i = len(mirrors)
+			index[parts[0]] = i
+			mirrors = append(mirrors, Mirror{Source: parts[0]})
+		}
+		mirrors[i].Endpoints = append(mirrors[i].Endpoints, parts[1])
+	}
+	return mirrors, nil
+}
+
+// Validate returns an error if the options cannot be rendered for either container runtime
+func (o Options) Validate() error {
+	if _, err := LogSizeBytes(o.LogMaxSize); err != nil {
+		return fmt.Errorf("invalid containerLogMaxSize %q: %v", o.LogMaxSize, err)
+	}
+	// The kubelet refuses to rotate the logs into fewer than two files
+	if o.LogMaxFiles < 2 {
+		return fmt.Errorf("containerLogMaxFiles must be at least 2")
+	}
+	if o.DataRoot != "" && (!windowsPathRegex.MatchString(o.DataRoot) || strings.ContainsAny(o.DataRoot, `'"`)) {
+		return fmt.Errorf("invalid runtimeDataRoot %q, must be an absolute Windows path", o.DataRoot)
+	}
+	seen := make(map[string]bool)
+	for _, mirror := range o.Mirrors {
+		if !registryHostRegex.MatchString(mirror.Source) {
+			return fmt.Errorf("invalid registry mirror source %q, must be a registry host", mirror.Source)
+		}
+		if seen[mirror.Source] {
+			return fmt.Errorf("duplicate registry mirror source %s", mirror.Source)
+		}
+		seen[mirror.Source] = true
+		if len(mirror.Endpoints) == 0 {
+			return fmt.Errorf("registry mirror source %s has no endpoints", mirror.Source)
+		}
+		for _, endpoint := range mirror.Endpoints {
+			if err := validateEndpoint(endpoint); err != nil {
+				return fmt.Errorf("invalid endpoint %q of registry mirror source %s: %v", endpoint, mirror.Source, err)
+			}
+		}
+	}
+	return nil
+}
+
+// ValidateDocker returns an error if the options cannot be rendered for docker, which can only be given mirrors of
+// Docker Hub
+func (o Options) ValidateDocker() error {
+	if err := o.Validate(); err != nil {
+		return err
+	}
+	for _, mirror := range o.Mirrors {
+		if mirror.Source != DockerHub {
+			return fmt.Errorf("docker only supports mirrors of %s, mirroring %s requires containerd", DockerHub,
+				mirror.Source)
+		}
+	}
+	return nil
+}
+
+// validateEndpoint returns an error if the given mirror endpoint is not an http or https URL of a host
+func validateEndpoint(endpoint string) error {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return err
+	}
+	if (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return fmt.Errorf("must be an http or https URL")
+	}
+	if strings.ContainsAny(endpoint, `'"`) {
+		return fmt.Errorf("must not contain quotes")
+	}
+	return nil
+}
+
+// LogSizeBytes returns the number of bytes of the given log size, a Kubernetes quantity such as 50Mi
+func LogSizeBytes(size string) (int64, error) {
+	quantity, err := resource.ParseQuantity(size)
+	if err != nil {
+		return 0, err
+	}
+	bytes, ok := quantity.AsInt64()
+	if !ok || bytes <= 0 {
+		return 0, fmt.Errorf("must be a positive number of bytes")
+	}
+	return bytes, nil
+}
+
+// dockerLogSize returns the given number of bytes in the unit suffixed format of the docker max-size log option, in
+// which k, m and g are powers of 1024 as Ki, Mi and Gi are in Kubernetes quantities
+func dockerLogSize(bytes int64) string {
+	for _, unit := range []struct {
+		suffix string
+		size   int64
+	}{{"g", 1 << 30}, {"m", 1 << 20}, {"k", 1 << 10}} {
+		if bytes%unit.size == 0 {
+			return fmt.Sprintf("%d%s", bytes/unit.size, unit.suffix)
+		}
+	}
+	return fmt.Sprintf("%d", bytes)
+}
+
+// DockerDaemon is the docker daemon.json rendered by Docker
+type DockerDaemon struct {
+	// DataRoot is where docker keeps its images and containers
+	DataRoot string `json:"data-root,omitempty"`
+	// LogDriver is the log driver of the containers
+	LogDriver string `json:"log-driver"`
+	// LogOpts configures the rotation of the container logs
+	LogOpts map[string]string `json:"log-opts"`
+	// InsecureRegistries are the registries docker pulls from without verifying their certificate, or over http
+	InsecureRegistries []string `json:"insecure-registries,omitempty"`
+	// RegistryMirrors are the mirrors of Docker Hub
+	RegistryMirrors []string `json:"registry-mirrors,omitempty"`
+}
+
+// Docker renders the docker daemon.json. The containers log with the json-file driver, which the kubelet reads, rotated
+// like the kubelet rotates the container logs of containerd.
+func Docker(o Options, r Registries) ([]byte, error) {
+	if err := o.ValidateDocker(); err != nil {
+		return nil, err
+	}
+	if err := r.Validate(); err != nil {
+		return nil, err
+	}
+	// Validated above
+	logSize, _ := LogSizeBytes(o.LogMaxSize)
+	daemon := DockerDaemon{
+		DataRoot:  o.DataRoot,
+		LogDriver: dockerLogDriver,
+		LogOpts: map[string]string{
+			"max-size": dockerLogSize(logSize),
+			"max-file": fmt.Sprintf("%d", o.LogMaxFiles),
+		},
+		InsecureRegistries: r.InsecureHosts(),
+	}
+	for _, mirror := range o.Mirrors {
+		daemon.RegistryMirrors = append(daemon.RegistryMirrors, mirror.Endpoints...)
+	}
+	data, err := json.MarshalIndent(daemon, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("error encoding docker daemon config: %v", err)
+	}
+	return append(data, '\n'), nil
+}
+
+// ContainerdRegistries are the registry settings of the containerd CRI plugin
+type ContainerdRegistries struct {
+	// Mirrors are the mirrors of the registries, sorted by source
+	Mirrors []Mirror
+	// InsecureHosts are the registries whose certificate is not verified
+	InsecureHosts []string
+}
+
+// Containerd returns the registry settings of the containerd config.toml
+func Containerd(o Options, r Registries) (ContainerdRegistries, error) {
+	if err := o.Validate(); err != nil {
+		return ContainerdRegistries{}, err
+	}
+	if err := r.Validate(); err != nil {
+		return ContainerdRegistries{}, err
+	}
+	mirrors := append([]Mirror(nil), o.Mirrors...)
+	sort.Slice(mirrors, func(i, j int) bool { return mirrors[i].Source < mirrors[j].Source })
+	return ContainerdRegistries{Mirrors: mirrors, InsecureHosts: r.InsecureHosts()}, nil
+}
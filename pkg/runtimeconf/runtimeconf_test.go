@@ -0,0 +1,142 @@
+package runtimeconf
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testOptions returns valid options with the default log settings
+func testOptions() Options {
+	return Options{LogMaxSize: DefaultLogMaxSize, LogMaxFiles: DefaultLogMaxFiles}
+}
+
+// TestDocker tests the rendering of the docker daemon.json
+func TestDocker(t *testing.T) {
+	data, err := Docker(testOptions(), Registries{})
+	require.NoError(t, err)
+	assert.Equal(t, `{
+  "log-driver": "json-file",
+  "log-opts": {
+    "max-file": "5",
+    "max-size": "50m"
+  }
+}
+`, string(data))
+
+	o := testOptions()
+	o.LogMaxSize = "1500Ki"
+	o.DataRoot = `D:\docker`
+	o.Mirrors = []Mirror{{Source: DockerHub, Endpoints: []string{"https://mirror.local", "http://mirror2.local:5000"}}}
+	data, err = Docker(o, Registries{Insecure: []string{"registry.local:5000", "*.example.com", "quay.io/ns"}})
+	require.NoError(t, err)
+	assert.Equal(t, `{
+  "data-root": "D:\\docker",
+  "log-driver": "json-file",
+  "log-opts": {
+    "max-file": "5",
+    "max-size": "1500k"
+  },
+  "insecure-registries": [
+    "quay.io",
+    "registry.local:5000"
+  ],
+  "registry-mirrors": [
+    "https://mirror.local",
+    "http://mirror2.local:5000"
+  ]
+}
+`, string(data))
+
+	o = testOptions()
+	o.Mirrors = []Mirror{{Source: "quay.io", Endpoints: []string{"https://mirror.local"}}}
+	_, err = Docker(o, Registries{})
+	require.Error(t, err, "mirror of a registry other than Docker Hub accepted")
+	assert.Contains(t, err.Error(), "docker only supports mirrors of docker.io")
+}
+
+// TestContainerd tests the registry settings of the containerd config.toml
+func TestContainerd(t *testing.T) {
+	o := testOptions()
+	o.Mirrors = []Mirror{
+		{Source: "quay.io", Endpoints: []string{"https://quay-mirror.local"}},
+		{Source: DockerHub, Endpoints: []string{"https://mirror.local"}},
+	}
+	registries, err := Containerd(o, Registries{Insecure: []string{"registry.local:5000"}})
+	require.NoError(t, err)
+	assert.Equal(t, ContainerdRegistries{
+		Mirrors: []Mirror{
+			{Source: DockerHub, Endpoints: []string{"https://mirror.local"}},
+			{Source: "quay.io", Endpoints: []string{"https://quay-mirror.local"}},
+		},
+		InsecureHosts: []string{"registry.local:5000"},
+	}, registries)
+}
+
+// TestValidate tests that invalid options are rejected
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*Options)
+		errMsg string
+	}{
+		{
+			name:   "invalid log size",
+			modify: func(o *Options) { o.LogMaxSize = "50MB" },
+			errMsg: `invalid containerLogMaxSize "50MB"`,
+		},
+		{
+			name:   "zero log size",
+			modify: func(o *Options) { o.LogMaxSize = "0" },
+			errMsg: "must be a positive number of bytes",
+		},
+		{
+			name:   "single log file",
+			modify: func(o *Options) { o.LogMaxFiles = 1 },
+			errMsg: "containerLogMaxFiles must be at least 2",
+		},
+		{
+			name:   "relative data root",
+			modify: func(o *Options) { o.DataRoot = `docker` },
+			errMsg: `invalid runtimeDataRoot "docker"`,
+		},
+		{
+			name:   "mirror source with a path",
+			modify: func(o *Options) { o.Mirrors = []Mirror{{Source: "quay.io/ns", Endpoints: []string{"https://m"}}} },
+			errMsg: `invalid registry mirror source "quay.io/ns"`,
+		},
+		{
+			name:   "mirror without endpoints",
+			modify: func(o *Options) { o.Mirrors = []Mirror{{Source: "quay.io"}} },
+			errMsg: "registry mirror source quay.io has no endpoints",
+		},
+		{
+			name:   "mirror endpoint without scheme",
+			modify: func(o *Options) { o.Mirrors = []Mirror{{Source: "quay.io", Endpoints: []string{"mirror.local"}}} },
+			errMsg: `invalid endpoint "mirror.local" of registry mirror source quay.io`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			o := testOptions()
+			test.modify(&o)
+			err := o.Validate()
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), test.errMsg)
+		})
+	}
+}
+
+// TestParseMirrors tests that the endpoints of a source are grouped in the given order
+func TestParseMirrors(t *testing.T) {
+	mirrors, err := ParseMirrors([]string{"docker.io=https://a", "quay.io=https://b", "docker.io=https://c"})
+	require.NoError(t, err)
+	assert.Equal(t, []Mirror{
+		{Source: "docker.io", Endpoints: []string{"https://a", "https://c"}},
+		{Source: "quay.io", Endpoints: []string{"https://b"}},
+	}, mirrors)
+
+	_, err = ParseMirrors([]string{"docker.io"})
+	assert.Error(t, err, "mirror without endpoint accepted")
+}
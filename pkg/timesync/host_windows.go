@@ -0,0 +1,82 @@
+package timesync
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/windows/registry"
+)
+
+const (
+	// parametersKey is the registry key holding the sync type and the NtpServer list of W32Time
+	parametersKey = `SYSTEM\CurrentControlSet\Services\W32Time\Parameters`
+	// configKey is the registry key holding the poll intervals of W32Time
+	configKey = `SYSTEM\CurrentControlSet\Services\W32Time\Config`
+)
+
+// NodeHost is the Host backed by the registry of the host it runs on
+type NodeHost struct{}
+
+// Current reads the configuration of W32Time from the registry. Values that are not present are left empty.
+func (NodeHost) Current() (Plan, error) {
+	params, err := registry.OpenKey(registry.LOCAL_MACHINE, parametersKey, registry.QUERY_VALUE)
+	if err != nil {
+		return Plan{}, fmt.Errorf("unable to open registry key %s: %v", parametersKey, err)
+	}
+	defer params.Close()
+	config, err := registry.OpenKey(registry.LOCAL_MACHINE, configKey, registry.QUERY_VALUE)
+	if err != nil {
+		return Plan{}, fmt.Errorf("unable to open registry key %s: %v", configKey, err)
+	}
+	defer config.Close()
+
+	var plan Plan
+	if plan.Type, _, err = params.GetStringValue("Type"); err != nil && err != registry.ErrNotExist {
+		return Plan{}, fmt.Errorf("unable to read Type: %v", err)
+	}
+	ntpServer, _, err := params.GetStringValue("NtpServer")
+	if err != nil && err != registry.ErrNotExist {
+		return Plan{}, fmt.Errorf("unable to read NtpServer: %v", err)
+	}
+	if plan.Peers, err = ParseNtpServer(ntpServer); err != nil {
+		return Plan{}, err
+	}
+	minPoll, _, err := config.GetIntegerValue("MinPollInterval")
+	if err != nil && err != registry.ErrNotExist {
+		return Plan{}, fmt.Errorf("unable to read MinPollInterval: %v", err)
+	}
+	maxPoll, _, err := config.GetIntegerValue("MaxPollInterval")
+	if err != nil && err != registry.ErrNotExist {
+		return Plan{}, fmt.Errorf("unable to read MaxPollInterval: %v", err)
+	}
+	plan.MinPollInterval = uint32(minPoll)
+	plan.MaxPollInterval = uint32(maxPoll)
+	return plan, nil
+}
+
+// Apply writes the given configuration of W32Time to the registry
+func (NodeHost) Apply(plan Plan) error {
+	params, err := registry.OpenKey(registry.LOCAL_MACHINE, parametersKey, registry.SET_VALUE)
+	if err != nil {
+		return fmt.Errorf("unable to open registry key %s: %v", parametersKey, err)
+	}
+	defer params.Close()
+	config, err := registry.OpenKey(registry.LOCAL_MACHINE, configKey, registry.SET_VALUE)
+	if err != nil {
+		return fmt.Errorf("unable to open registry key %s: %v", configKey, err)
+	}
+	defer config.Close()
+
+	if err = params.SetStringValue("Type", plan.Type); err != nil {
+		return fmt.Errorf("unable to write Type: %v", err)
+	}
+	if err = params.SetStringValue("NtpServer", plan.NtpServer()); err != nil {
+		return fmt.Errorf("unable to write NtpServer: %v", err)
+	}
+	if err = config.SetDWordValue("MinPollInterval", plan.MinPollInterval); err != nil {
+		return fmt.Errorf("unable to write MinPollInterval: %v", err)
+	}
+	if err = config.SetDWordValue("MaxPollInterval", plan.MaxPollInterval); err != nil {
+		return fmt.Errorf("unable to write MaxPollInterval: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,209 @@
+// Package timesync translates the NTP servers of the cluster, as given to the chrony of the Linux workers through a
+// MachineConfig, into the configuration of the Windows time service (W32Time), so that Windows workers sync with the
+// same servers instead of drifting away from the cluster with time.windows.com.
+package timesync
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	// TypeNTP is the W32Time sync type syncing with the servers of the NtpServer list
+	TypeNTP = "NTP"
+	// FlagSpecialInterval polls the peer at the SpecialPollInterval of the peer instead of the poll intervals of W32Time
+	FlagSpecialInterval uint32 = 0x1
+	// FlagUseAsFallbackOnly only syncs with the peer when the other peers cannot be reached
+	FlagUseAsFallbackOnly uint32 = 0x2
+	// FlagSymmetricActive syncs with the peer in symmetric active mode
+	FlagSymmetricActive uint32 = 0x4
+	// FlagClient syncs with the peer in client mode, as chrony does with its servers and pools
+	FlagClient uint32 = 0x8
+	// defaultMinPoll is the minpoll chrony uses for servers without one, in log2 seconds
+	defaultMinPoll = 6
+	// defaultMaxPoll is the maxpoll chrony uses for servers without one, in log2 seconds
+	defaultMaxPoll = 10
+)
+
+// Server is a server or pool directive of a chrony config
+type Server struct {
+	// Address is the host name or IP address of the server or pool
+	Address string
+	// Pool is true for a pool directive, whose address resolves to several servers
+	Pool bool
+	// Prefer is true if chrony prefers the server over the servers without the prefer option
+	Prefer bool
+	// MinPoll is the minimum poll interval, in log2 seconds
+	MinPoll int
+	// MaxPoll is the maximum poll interval, in log2 seconds
+	MaxPoll int
+}
+
+// ParseChrony returns the servers and pools of the given chrony config, in the order they are given. Servers with the
+// noselect option are left out, as chrony never syncs with them.
+func ParseChrony(data []byte) ([]Server, error) {
+	var servers []Server
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.ContainsAny(fields[0][:1], "#%;!") {
+			continue
+		}
+		directive := strings.ToLower(fields[0])
+		if directive != "server" && directive != "pool" {
+			continue
+		}
+		server, selected, err := parseServer(directive, fields[1:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s directive on line %d: %v", directive, line, err)
+		}
+		if selected {
+			servers = append(servers, server)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading chrony config: %v", err)
+	}
+	return servers, nil
+}
+
+// parseServer parses the address and options of a server or pool directive. selected is false if the server has the
+// noselect option.
+func parseServer(directive string, args []string) (server Server, selected bool, err error) {
+	if len(args) == 0 {
+		return Server{}, false, fmt.Errorf("missing address")
+	}
+	// The peers of the W32Time NtpServer list are separated by spaces, and their flags follow a comma
+	if strings.Contains(args[0], ",") {
+		return Server{}, false, fmt.Errorf("invalid address %q", args[0])
+	}
+	server = Server{Address: args[0], Pool: directive == "pool", MinPoll: defaultMinPoll, MaxPoll: defaultMaxPoll}
+	selected = true
+	// Options taking a value other than minpoll and maxpoll, such as key 5, are skipped along with their value as the
+	// value is not an option
+	for i := 1; i < len(args); i++ {
+		switch args[i] {
+		case "prefer":
+			server.Prefer = true
+		case "noselect":
+			selected = false
+		case "minpoll", "maxpoll":
+			if i+1 == len(args) {
+				return Server{}, false, fmt.Errorf("missing value of %s", args[i])
+			}
+			value, err := strconv.Atoi(args[i+1])
+			if err != nil {
+				return Server{}, false, fmt.Errorf("invalid %s %q", args[i], args[i+1])
+			}
+			if args[i] == "minpoll" {
+				server.MinPoll = value
+			} else {
+				server.MaxPoll = value
+			}
+			i++
+		}
+	}
+	if server.MinPoll > server.MaxPoll {
+		return Server{}, false, fmt.Errorf("minpoll %d of %s is greater than its maxpoll %d", server.MinPoll,
+			server.Address, server.MaxPoll)
+	}
+	return server, selected, nil
+}
+
+// Peer is an entry of the W32Time NtpServer list
+type Peer struct {
+	// Address is the host name or IP address of the peer
+	Address string
+	// Flags are the Flag values of the peer, combined
+	Flags uint32
+}
+
+// Plan is the configuration of W32Time syncing with the servers of a chrony config
+type Plan struct {
+	// Type is the sync type of W32Time
+	Type string
+	// Peers are the entries of the NtpServer list
+	Peers []Peer
+	// MinPollInterval is the minimum poll interval of W32Time, in log2 seconds
+	MinPollInterval uint32
+	// MaxPollInterval is the maximum poll interval of W32Time, in log2 seconds
+	MaxPollInterval uint32
+}
+
+// NewPlan returns the W32Time configuration syncing with the given chrony servers in client mode. If some of the
+// servers are preferred, the others are only used as a fallback. W32Time has a single pair of poll intervals, so it
+// polls as often as the most frequently polled server and at least as often as the least frequently polled one, and
+// never more than once a second. ok is false if no servers are given.
+func NewPlan(servers []Server) (plan Plan, ok bool) {
+	if len(servers) == 0 {
+		return Plan{}, false
+	}
+	preferred := false
+	for _, server := range servers {
+		preferred = preferred || server.Prefer
+	}
+	minPoll, maxPoll := servers[0].MinPoll, servers[0].MaxPoll
+	plan = Plan{Type: TypeNTP}
+	for _, server := range servers {
+		flags := FlagClient
+		if preferred && !server.Prefer {
+			flags |= FlagUseAsFallbackOnly
+		}
+		plan.Peers = append(plan.Peers, Peer{Address: server.Address, Flags: flags})
+		if server.MinPoll < minPoll {
+			minPoll = server.MinPoll
+		}
+		if server.MaxPoll > maxPoll {
+			maxPoll = server.MaxPoll
+		}
+	}
+	plan.MinPollInterval = nonNegative(minPoll)
+	plan.MaxPollInterval = nonNegative(maxPoll)
+	return plan, true
+}
+
+// nonNegative returns the given poll interval, or 0 if it is negative
+func nonNegative(poll int) uint32 {
+	if poll < 0 {
+		return 0
+	}
+	return uint32(poll)
+}
+
+// NtpServer returns the W32Time NtpServer value of the plan, such as "time1.local,0x8 time2.local,0xa"
+func (p Plan) NtpServer() string {
+	entries := make([]string, 0, len(p.Peers))
+	for _, peer := range p.Peers {
+		entries = append(entries, fmt.Sprintf("%s,0x%x", peer.Address, peer.Flags))
+	}
+	return strings.Join(entries, " ")
+}
+
+// ParseNtpServer returns the peers of the given W32Time NtpServer value. Peers given without flags have no flags.
+func ParseNtpServer(value string) ([]Peer, error) {
+	var peers []Peer
+	for _, entry := range strings.Fields(value) {
+		parts := strings.SplitN(entry, ",", 2)
+		peer := Peer{Address: parts[0]}
+		if len(parts) == 2 {
+			flags, err := strconv.ParseUint(parts[1], 0, 32)
+			if err != nil {
+				return nil, fmt.Errorf("invalid flags of NtpServer entry %q: %v", entry, err)
+			}
+			peer.Flags = uint32(flags)
+		}
+		peers = append(peers, peer)
+	}
+	return peers, nil
+}
+
+// Host reads and writes the W32Time configuration of a Windows host
+type Host interface {
+	// Current returns the configuration W32Time has on the host
+	Current() (Plan, error)
+	// Apply writes the given configuration for W32Time, which picks it up once restarted
+	Apply(plan Plan) error
+}
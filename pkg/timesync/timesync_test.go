@@ -0,0 +1,108 @@
+package timesync
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestParseChrony tests that the servers and pools are read from a chrony config along with their options
+func TestParseChrony(t *testing.T) {
+	servers, err := ParseChrony([]byte(`# Use internal NTP servers
+server ntp1.example.com iburst prefer minpoll 4 maxpoll 8
+server 10.0.0.5 key 5 maxpoll 12
+pool 2.rhel.pool.ntp.org iburst
+! server commented.example.com
+server monitor.example.com noselect
+driftfile /var/lib/chrony/drift
+makestep 1.0 3
+`))
+	require.NoError(t, err)
+	assert.Equal(t, []Server{
+		{Address: "ntp1.example.com", Prefer: true, MinPoll: 4, MaxPoll: 8},
+		{Address: "10.0.0.5", MinPoll: 6, MaxPoll: 12},
+		{Address: "2.rhel.pool.ntp.org", Pool: true, MinPoll: 6, MaxPoll: 10},
+	}, servers)
+
+	servers, err = ParseChrony([]byte("driftfile /var/lib/chrony/drift\n"))
+	require.NoError(t, err)
+	assert.Empty(t, servers, "servers found in a chrony config without any")
+
+	for _, invalid := range []string{
+		"server\n",
+		"server ntp.example.com minpoll\n",
+		"server ntp.example.com maxpoll often\n",
+		"server ntp.example.com minpoll 8 maxpoll 6\n",
+		"pool a.example.com,b.example.com\n",
+	} {
+		_, err = ParseChrony([]byte(invalid))
+		assert.Error(t, err, "invalid chrony config %q accepted", invalid)
+	}
+}
+
+// TestNewPlan tests that chrony servers are translated into the W32Time NtpServer list and poll intervals
+func TestNewPlan(t *testing.T) {
+	tests := []struct {
+		name      string
+		servers   []Server
+		ntpServer string
+		minPoll   uint32
+		maxPoll   uint32
+	}{
+		{
+			name: "servers and pools",
+			servers: []Server{
+				{Address: "ntp1.example.com", MinPoll: 6, MaxPoll: 10},
+				{Address: "pool.example.com", Pool: true, MinPoll: 6, MaxPoll: 10},
+			},
+			ntpServer: "ntp1.example.com,0x8 pool.example.com,0x8",
+			minPoll:   6,
+			maxPoll:   10,
+		},
+		{
+			name: "preferred server",
+			servers: []Server{
+				{Address: "ntp1.example.com", MinPoll: 6, MaxPoll: 12},
+				{Address: "ntp2.example.com", Prefer: true, MinPoll: 4, MaxPoll: 8},
+			},
+			ntpServer: "ntp1.example.com,0xa ntp2.example.com,0x8",
+			minPoll:   4,
+			maxPoll:   12,
+		},
+		{
+			name:      "sub-second polling",
+			servers:   []Server{{Address: "ntp1.example.com", MinPoll: -2, MaxPoll: 2}},
+			ntpServer: "ntp1.example.com,0x8",
+			minPoll:   0,
+			maxPoll:   2,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			plan, ok := NewPlan(test.servers)
+			require.True(t, ok)
+			assert.Equal(t, TypeNTP, plan.Type)
+			assert.Equal(t, test.ntpServer, plan.NtpServer())
+			assert.Equal(t, test.minPoll, plan.MinPollInterval)
+			assert.Equal(t, test.maxPoll, plan.MaxPollInterval)
+
+			peers, err := ParseNtpServer(plan.NtpServer())
+			require.NoError(t, err)
+			assert.Equal(t, plan.Peers, peers, "NtpServer does not round trip")
+		})
+	}
+
+	_, ok := NewPlan(nil)
+	assert.False(t, ok, "plan returned without servers")
+}
+
+// TestParseNtpServer tests that NtpServer values set by other tools are read
+func TestParseNtpServer(t *testing.T) {
+	peers, err := ParseNtpServer("time.windows.com,0x9  time.nist.gov")
+	require.NoError(t, err)
+	assert.Equal(t, []Peer{{Address: "time.windows.com", Flags: 0x9}, {Address: "time.nist.gov"}}, peers)
+
+	_, err = ParseNtpServer("time.windows.com,fast")
+	assert.Error(t, err, "invalid flags accepted")
+}
@@ -1,6 +1,7 @@
 package e2e
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -9,6 +10,7 @@ import (
 	"time"
 
 	"github.com/openshift/windows-machine-config-bootstrapper/pkg/bootstrapper"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/config"
 	"github.com/spf13/pflag"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -53,9 +55,10 @@ func TestBootstrapper(t *testing.T) {
 	t.Run("Configure CNI without kubelet service present", testConfigureCNIWithoutKubeletSvc)
 
 	// Run the bootstrapper, which will start the kubelet service
-	wmcb, err := bootstrapper.NewWinNodeBootstrapper(installDir, ignitionFilePath, kubeletPath, "", "")
-	require.NoErrorf(t, err, "Could not create WinNodeBootstrapper: %s", err)
-	err = wmcb.InitializeKubelet()
+	wmcb, err := bootstrapper.New(bootstrapper.WithConfiguration(wmcbConfiguration(installDir)),
+		bootstrapper.WithIgnitionFile(ignitionFilePath), bootstrapper.WithKubeletPath(kubeletPath))
+	require.NoErrorf(t, err, "Could not create bootstrapper: %s", err)
+	err = wmcb.InitializeKubelet(context.Background())
 	assert.NoErrorf(t, err, "Could not run bootstrapper: %s", err)
 	err = wmcb.Disconnect()
 	assert.NoErrorf(t, err, "Could not disconnect from windows svc API: %s", err)
@@ -92,6 +95,13 @@ func TestBootstrapper(t *testing.T) {
 	})
 }
 
+// wmcbConfiguration returns the default WMCB configuration installing to the given directory
+func wmcbConfiguration(installDir string) config.Configuration {
+	c := config.Default()
+	c.InstallDir = installDir
+	return c
+}
+
 // ensureIgnitionFileExists will create a generic ignition file if one is not provided on the node
 func ensureIgnitionFileExists(t *testing.T, path string) {
 	if fp, err := os.Open(path); err == nil {
@@ -1,13 +1,16 @@
 package e2e
 
 import (
+	"context"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/openshift/windows-machine-config-bootstrapper/pkg/bootstrapper"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/cniconf"
 	"github.com/spf13/pflag"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -15,10 +18,15 @@ import (
 
 var cniDir string
 var cniConfig string
+var hostSubnets []string
+var serviceCIDRs []string
 
 func init() {
 	pflag.StringVar(&cniDir, "cni-dir", "C:\\Windows\\Temp\\cni", "CNI binary location")
 	pflag.StringVar(&cniConfig, "cni-config", "C:\\Windows\\Temp\\cni\\config\\cni.conf", "CNI config location")
+	pflag.StringSliceVar(&hostSubnets, "host-subnet", nil,
+		"Hybrid overlay subnet of the node. If set, the CNI config is rendered instead of read from --cni-config")
+	pflag.StringSliceVar(&serviceCIDRs, "service-cidr", nil, "Service network CIDRs of the cluster")
 }
 
 func TestConfigureCNI(t *testing.T) {
@@ -36,16 +44,20 @@ func testConfigureCNIWithoutKubeletSvc(t *testing.T) {
 	// this test is called from TestBootstrapper
 	tempDir, err := ioutil.TempDir("", "wmcb")
 	require.NoError(t, err, "could not create temp directory")
-	cniConfig, err := ioutil.TempFile(tempDir, "cni.conf")
-	require.NoError(t, err, "could not create temp CNI config")
 	// Ignore the return error as there is not much we can do if the temporary directory is not deleted
 	defer os.RemoveAll(tempDir)
+	cniConfig := filepath.Join(tempDir, "cni.conf")
+	require.NoError(t, ioutil.WriteFile(cniConfig, []byte(`{"name":"net","type":"win-overlay"}`), 0644),
+		"could not create temp CNI config")
+	require.NoError(t, ioutil.WriteFile(filepath.Join(tempDir, "win-overlay.exe"), nil, 0644),
+		"could not create temp CNI plugin")
 
 	// Instantiate the bootstrapper
-	wmcb, err := bootstrapper.NewWinNodeBootstrapper(tempDir, "", "", tempDir, cniConfig.Name())
+	wmcb, err := bootstrapper.New(bootstrapper.WithConfiguration(wmcbConfiguration(tempDir)),
+		bootstrapper.WithCNI(tempDir, cniConfig))
 	require.NoError(t, err, "could not instantiate wmcb")
 
-	err = wmcb.Configure()
+	err = wmcb.ConfigureCNI(context.Background())
 	assert.Error(t, err, "no error when attempting to configure CNI without kubelet svc")
 	assert.Contains(t, err.Error(), "kubelet service is not present", "incorrect error thrown")
 }
@@ -53,10 +65,15 @@ func testConfigureCNIWithoutKubeletSvc(t *testing.T) {
 // testConfigureCNI tests if ConfigureCNI() runs successfully by checking if the kubelet service comes up after
 // configuring CNI
 func testConfigureCNI(t *testing.T) {
-	wmcb, err := bootstrapper.NewWinNodeBootstrapper(installDir, "", "", cniDir, cniConfig)
+	cniOption := bootstrapper.WithCNI(cniDir, cniConfig)
+	if len(hostSubnets) != 0 {
+		cniOption = bootstrapper.WithCNIOverlay(cniDir, cniconf.Overlay{HostSubnets: hostSubnets,
+			ServiceCIDRs: serviceCIDRs, DNS: true})
+	}
+	wmcb, err := bootstrapper.New(bootstrapper.WithConfiguration(wmcbConfiguration(installDir)), cniOption)
 	require.NoError(t, err, "could not create wmcb")
 
-	err = wmcb.Configure()
+	err = wmcb.ConfigureCNI(context.Background())
 	assert.NoError(t, err, "error running wmcb.ConfigureCNI")
 
 	err = wmcb.Disconnect()